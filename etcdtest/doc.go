@@ -0,0 +1,14 @@
+// Package etcdtest 在进程内启动嵌入式etcd，用于注册中心及其使用方的集成测试，无需docker或外部etcd
+//
+// 典型用法：
+//
+//	srv := etcdtest.Start(t, etcdtest.WithAuth("root", "secret"), etcdtest.WithTLS())
+//	reg, err := registry.NewEtcdRegistryWithClient(srv.Client(), 5)
+//	defer reg.Close()
+//
+//	srv.Stop()    // 模拟etcd宕机
+//	srv.Restart() // 使用原有数据和端口恢复，客户端自动重连
+//
+// 服务端监听本机的临时端口，数据目录在Close时删除；
+// Config返回的etcd配置段可以填入config.Conf.Etcd，通过registry.NewEtcdRegistryFromConfig测试配置加载的完整路径
+package etcdtest
@@ -0,0 +1,92 @@
+// etcdtest/options.go
+package etcdtest
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 默认值
+const (
+	// DefaultStartTimeout 等待嵌入式etcd就绪的默认时间
+	DefaultStartTimeout = 10 * time.Second
+	// DefaultLogLevel 嵌入式etcd的默认日志级别，etcd正常关闭时也会输出error日志，默认只保留fatal，
+	// 启动失败的原因由New返回
+	DefaultLogLevel = "fatal"
+)
+
+// Option 嵌入式etcd配置选项
+type Option func(*options)
+
+type options struct {
+	username     string
+	password     string
+	tls          bool
+	clientCert   bool
+	startTimeout time.Duration
+	logLevel     string
+}
+
+func defaultOptions() options {
+	return options{
+		startTimeout: DefaultStartTimeout,
+		logLevel:     DefaultLogLevel,
+	}
+}
+
+// WithAuth 开启etcd认证，创建root用户以及拥有root角色的username用户，Client使用username连接
+func WithAuth(username, password string) Option {
+	return func(o *options) {
+		o.username = username
+		o.password = password
+	}
+}
+
+// WithTLS 客户端端口使用TLS，证书由进程内生成的测试CA签发，Client和Config使用该CA校验服务端
+func WithTLS() Option {
+	return func(o *options) {
+		o.tls = true
+	}
+}
+
+// WithClientCertAuth 开启TLS并要求客户端证书，Client和Config使用同一CA签发的客户端证书
+func WithClientCertAuth() Option {
+	return func(o *options) {
+		o.tls = true
+		o.clientCert = true
+	}
+}
+
+// WithStartTimeout 设置启动和重启时等待etcd就绪的时间，默认DefaultStartTimeout
+func WithStartTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.startTimeout = timeout
+	}
+}
+
+// WithLogLevel 设置嵌入式etcd的日志级别，支持debug、info、warn、error、panic、fatal，默认DefaultLogLevel
+func WithLogLevel(level string) Option {
+	return func(o *options) {
+		o.logLevel = level
+	}
+}
+
+// validate 校验选项
+func (o *options) validate() error {
+	if o.startTimeout <= 0 {
+		return fmt.Errorf("start timeout %v must be positive", o.startTimeout)
+	}
+	if o.password != "" && o.username == "" {
+		return errors.New("auth password set without username")
+	}
+	return nil
+}
+
+// clientCN 客户端证书的CN，开启认证时与Client使用的用户一致
+func (o *options) clientCN() string {
+	if o.username != "" {
+		return o.username
+	}
+	return "root"
+}
@@ -0,0 +1,318 @@
+// etcdtest/server.go
+package etcdtest
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"go.etcd.io/etcd/client/pkg/v3/transport"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+
+	"github.com/YuanJey/grpc-etcd/pkg/config"
+)
+
+// clientDialTimeout Client连接嵌入式etcd的超时时间
+const clientDialTimeout = 5 * time.Second
+
+// Server 进程内运行的单节点etcd
+// 端口和数据目录在生命周期内保持不变，Stop和Restart之间写入的数据不会丢失，已创建的客户端会自动重连
+type Server struct {
+	opts options
+	// dir 临时目录，包含数据目录和证书，Close时删除
+	dir       string
+	dataDir   string
+	certs     certFiles
+	clientURL url.URL
+	peerURL   url.URL
+
+	mu     sync.Mutex
+	etcd   *embed.Etcd
+	client *clientv3.Client
+	closed bool
+}
+
+// Start 启动嵌入式etcd，失败时终止测试，测试结束时自动Close
+func Start(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+	srv, err := New(opts...)
+	if err != nil {
+		t.Fatalf("etcdtest: %v", err)
+	}
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// NewClient 启动嵌入式etcd并返回已连接的客户端，cleanup关闭客户端和etcd并删除数据，
+// 适合在TestMain等没有testing.T的地方使用
+func NewClient(opts ...Option) (*clientv3.Client, func(), error) {
+	srv, err := New(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return srv.Client(), srv.Close, nil
+}
+
+// New 在本机临时端口上启动嵌入式etcd，等待就绪并按选项开启认证，使用完后需调用Close
+func New(opts ...Option) (_ *Server, err error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "etcdtest-")
+	if err != nil {
+		return nil, fmt.Errorf("create temp dir: %w", err)
+	}
+	srv := &Server{opts: o, dir: dir, dataDir: filepath.Join(dir, "data")}
+	defer func() {
+		if err != nil {
+			srv.Close()
+		}
+	}()
+
+	scheme := "http"
+	if o.tls {
+		scheme = "https"
+		if srv.certs, err = generateCerts(dir, o.clientCN()); err != nil {
+			return nil, err
+		}
+	}
+	clientPort, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	peerPort, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	srv.clientURL = url.URL{Scheme: scheme, Host: net.JoinHostPort("127.0.0.1", clientPort)}
+	srv.peerURL = url.URL{Scheme: "http", Host: net.JoinHostPort("127.0.0.1", peerPort)}
+
+	if err := srv.start(); err != nil {
+		return nil, err
+	}
+	if o.username != "" {
+		if err := srv.enableAuth(); err != nil {
+			return nil, err
+		}
+	}
+	if srv.client, err = srv.NewClient(); err != nil {
+		return nil, err
+	}
+	return srv, nil
+}
+
+// start 使用固定的端口和数据目录启动etcd并等待就绪
+func (s *Server) start() error {
+	cfg := embed.NewConfig()
+	cfg.Name = "etcdtest"
+	cfg.Dir = s.dataDir
+	cfg.ListenClientUrls = []url.URL{s.clientURL}
+	cfg.AdvertiseClientUrls = []url.URL{s.clientURL}
+	cfg.ListenPeerUrls = []url.URL{s.peerURL}
+	cfg.AdvertisePeerUrls = []url.URL{s.peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	cfg.LogLevel = s.opts.logLevel
+	if s.opts.tls {
+		cfg.ClientTLSInfo = transport.TLSInfo{
+			CertFile: s.certs.serverCertFile,
+			KeyFile:  s.certs.serverKeyFile,
+		}
+		// 设置了TrustedCAFile时etcd总是要求客户端证书，只在开启客户端证书认证时设置
+		if s.opts.clientCert {
+			cfg.ClientTLSInfo.TrustedCAFile = s.certs.caFile
+			cfg.ClientTLSInfo.ClientCertAuth = true
+		}
+	}
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		return fmt.Errorf("start embedded etcd: %w", err)
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+	case err := <-e.Err():
+		e.Close()
+		return fmt.Errorf("start embedded etcd: %w", err)
+	case <-time.After(s.opts.startTimeout):
+		e.Close()
+		return fmt.Errorf("embedded etcd not ready after %v", s.opts.startTimeout)
+	}
+	s.etcd = e
+	return nil
+}
+
+// enableAuth 创建root用户和WithAuth指定的用户并开启认证，认证状态保存在数据目录中，重启后仍然生效
+func (s *Server) enableAuth() error {
+	config := s.ClientConfig()
+	config.Username, config.Password = "", ""
+	cli, err := clientv3.New(config)
+	if err != nil {
+		return fmt.Errorf("connect to enable auth: %w", err)
+	}
+	defer cli.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.startTimeout)
+	defer cancel()
+
+	if _, err := cli.RoleAdd(ctx, "root"); err != nil && !errors.Is(err, rpctypes.ErrRoleAlreadyExist) {
+		return fmt.Errorf("add root role: %w", err)
+	}
+	users := []string{"root"}
+	if s.opts.username != "root" {
+		users = append(users, s.opts.username)
+	}
+	for _, user := range users {
+		if _, err := cli.UserAdd(ctx, user, s.opts.password); err != nil {
+			return fmt.Errorf("add user %q: %w", user, err)
+		}
+		if _, err := cli.UserGrantRole(ctx, user, "root"); err != nil {
+			return fmt.Errorf("grant root role to %q: %w", user, err)
+		}
+	}
+	if _, err := cli.AuthEnable(ctx); err != nil {
+		return fmt.Errorf("enable auth: %w", err)
+	}
+	return nil
+}
+
+// Client 返回Server创建的客户端，Close时关闭，调用方不应自行关闭
+func (s *Server) Client() *clientv3.Client {
+	return s.client
+}
+
+// NewClient 创建一个新的客户端，调用方负责关闭，用于模拟多个进程各自连接etcd
+func (s *Server) NewClient() (*clientv3.Client, error) {
+	cli, err := clientv3.New(s.ClientConfig())
+	if err != nil {
+		return nil, fmt.Errorf("connect to embedded etcd: %w", err)
+	}
+	return cli, nil
+}
+
+// Endpoints 返回etcd的客户端地址，例如 http://127.0.0.1:40123，重启后不变
+func (s *Server) Endpoints() []string {
+	return []string{s.clientURL.String()}
+}
+
+// ClientConfig 返回连接etcd的客户端配置，包含认证和TLS设置，可交给registry.NewEtcdRegistryWithConfig
+func (s *Server) ClientConfig() clientv3.Config {
+	config := clientv3.Config{
+		Endpoints:   s.Endpoints(),
+		DialTimeout: clientDialTimeout,
+		Username:    s.opts.username,
+		Password:    s.opts.password,
+	}
+	if s.opts.tls {
+		config.TLS = s.tlsConfig()
+	}
+	return config
+}
+
+// tlsConfig 信任测试CA，开启客户端证书认证时带上客户端证书；证书在New中生成，这里不会失败
+func (s *Server) tlsConfig() *tls.Config {
+	pool := x509.NewCertPool()
+	if ca, err := os.ReadFile(s.certs.caFile); err == nil {
+		pool.AppendCertsFromPEM(ca)
+	}
+	config := &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	if s.opts.clientCert {
+		if cert, err := tls.LoadX509KeyPair(s.certs.clientCertFile, s.certs.clientKeyFile); err == nil {
+			config.Certificates = []tls.Certificate{cert}
+		}
+	}
+	return config
+}
+
+// Config 返回连接etcd的配置段，证书为临时目录中的文件，可填入config.Conf.Etcd
+func (s *Server) Config() config.Etcd {
+	etcd := config.Etcd{
+		EtcdAddr:    s.Endpoints(),
+		DialTimeout: config.Duration(clientDialTimeout),
+		UserName:    s.opts.username,
+		Password:    s.opts.password,
+	}
+	if s.opts.tls {
+		etcd.CAFile = s.certs.caFile
+	}
+	if s.opts.clientCert {
+		etcd.CertFile = s.certs.clientCertFile
+		etcd.KeyFile = s.certs.clientKeyFile
+	}
+	return etcd
+}
+
+// Stop 停止etcd以模拟宕机，数据和端口保留，已停止时直接返回
+// 停止期间客户端的请求会失败或阻塞到超时，Restart后自动恢复
+func (s *Server) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.etcd != nil {
+		s.etcd.Close()
+		s.etcd = nil
+	}
+}
+
+// Restart 使用原有的数据目录和端口重新启动etcd，运行中时先停止，Close之后返回错误
+func (s *Server) Restart() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("etcdtest: server closed")
+	}
+	if s.etcd != nil {
+		s.etcd.Close()
+		s.etcd = nil
+	}
+	return s.start()
+}
+
+// Running etcd是否正在运行
+func (s *Server) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.etcd != nil
+}
+
+// Close 关闭客户端和etcd并删除临时目录，重复调用是安全的
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if s.client != nil {
+		s.client.Close()
+	}
+	if s.etcd != nil {
+		s.etcd.Close()
+		s.etcd = nil
+	}
+	os.RemoveAll(s.dir)
+}
+
+// freePort 返回一个当前空闲的本机端口
+func freePort() (string, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("allocate port: %w", err)
+	}
+	defer lis.Close()
+	_, port, err := net.SplitHostPort(lis.Addr().String())
+	return port, err
+}
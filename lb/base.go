@@ -0,0 +1,375 @@
+// lb/base.go
+package lb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// readySubConn 处于READY状态的子连接及其最新地址
+type readySubConn struct {
+	subConn balancer.SubConn
+	address resolver.Address
+}
+
+// buildInfo 构造picker所需的信息
+type buildInfo struct {
+	// ready 按地址排序的READY子连接
+	ready []readySubConn
+	// addresses 当前所有子连接（包括未READY的）的地址key，见addressKey，
+	// 在多次构造之间按地址保存状态的pickerBuilder只应清理不在其中的地址
+	addresses map[string]bool
+	// config 负载均衡配置，服务配置未给出时为ParseConfig返回的默认值
+	config serviceconfig.LoadBalancingConfig
+	// attributes resolver.State上的属性
+	attributes *attributes.Attributes
+	// target balancer所属ClientConn的拨号target，例如 etcd:///svc，用作指标标签
+	target string
+}
+
+// pickerBuilder 根据当前子连接状态构造picker
+// 每个balancer实例拥有独立的pickerBuilder，可以在多次构造之间保存状态
+type pickerBuilder interface {
+	build(info buildInfo) balancer.Picker
+}
+
+// subConnObserver 需要感知子连接数量的pickerBuilder可选实现，每次重建picker前调用
+type subConnObserver interface {
+	observe(total, ready int)
+}
+
+// pickerCloser 需要在balancer关闭时释放资源的pickerBuilder可选实现
+type pickerCloser interface {
+	close()
+}
+
+// configParser 解析负载均衡配置JSON
+type configParser func(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error)
+
+// emptyConfig 无配置项的负载均衡配置
+type emptyConfig struct {
+	serviceconfig.LoadBalancingConfig
+}
+
+// pickerFactory 可作为子策略使用的picker构造方式
+type pickerFactory struct {
+	newPicker   func() pickerBuilder
+	parseConfig configParser
+}
+
+// pickerFactories 按名称登记的picker构造方式，供包装型balancer选择子策略
+var pickerFactories = map[string]pickerFactory{
+	roundRobinName: {newPicker: func() pickerBuilder { return rrPickerBuilder{} }},
+}
+
+// register 注册balancer并登记其picker构造方式，只应在init中调用
+func register(name string, newPicker func() pickerBuilder, parseConfig configParser) {
+	pickerFactories[name] = pickerFactory{newPicker: newPicker, parseConfig: parseConfig}
+	balancer.Register(newBuilder(name, newPicker, parseConfig))
+}
+
+// childPolicy 包装型balancer的子策略
+type childPolicy struct {
+	name   string
+	picker pickerBuilder
+	config serviceconfig.LoadBalancingConfig
+}
+
+// parseChildPolicy 解析子策略名称和配置，名称为空时使用round_robin
+func parseChildPolicy(name string, js json.RawMessage) (*childPolicyConfig, error) {
+	if name == "" {
+		name = roundRobinName
+	}
+	factory, ok := pickerFactories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown child policy %q", name)
+	}
+	cfg := &childPolicyConfig{name: name, factory: factory}
+	if factory.parseConfig != nil {
+		var err error
+		if cfg.config, err = factory.parseConfig(js); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// childPolicyConfig 解析后的子策略配置
+type childPolicyConfig struct {
+	name    string
+	factory pickerFactory
+	config  serviceconfig.LoadBalancingConfig
+}
+
+// ensure 返回与配置一致的子策略实例，子策略名称变化时重新创建
+func (c *childPolicyConfig) ensure(current *childPolicy) *childPolicy {
+	if current == nil || current.name != c.name {
+		current = &childPolicy{name: c.name, picker: c.factory.newPicker()}
+	}
+	current.config = c.config
+	return current
+}
+
+// build 使用子策略为给定的READY子连接构造picker
+func (c *childPolicy) build(info buildInfo, ready []readySubConn) balancer.Picker {
+	info.ready = ready
+	info.config = c.config
+	return c.picker.build(info)
+}
+
+// builder 基于pickerBuilder的balancer.Builder
+type builder struct {
+	name        string
+	newPicker   func() pickerBuilder
+	parseConfig configParser
+}
+
+// newBuilder 创建balancer.Builder，parseConfig为nil时不接受任何配置项
+func newBuilder(name string, newPicker func() pickerBuilder, parseConfig configParser) balancer.Builder {
+	return &builder{
+		name:        name,
+		newPicker:   newPicker,
+		parseConfig: parseConfig,
+	}
+}
+
+// Build 实现balancer.Builder接口
+func (b *builder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	return &baseBalancer{
+		cc:       cc,
+		target:   opts.Target.String(),
+		picker:   b.newPicker(),
+		csEvltr:  &balancer.ConnectivityStateEvaluator{},
+		state:    connectivity.Connecting,
+		subConns: make(map[string]*subConn),
+		scStates: make(map[balancer.SubConn]*subConn),
+	}
+}
+
+// Name 实现balancer.Builder接口
+func (b *builder) Name() string {
+	return b.name
+}
+
+// ParseConfig 实现balancer.ConfigParser接口
+func (b *builder) ParseConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	if b.parseConfig == nil {
+		return emptyConfig{}, nil
+	}
+	return b.parseConfig(js)
+}
+
+// subConn 子连接及其状态
+type subConn struct {
+	sc      balancer.SubConn
+	address resolver.Address
+	state   connectivity.State
+}
+
+// baseBalancer 为每个地址维护一个子连接，并在状态变化时通过pickerBuilder重建picker
+// 与grpc的base balancer不同，子连接只按地址和ServerName复用，
+// 属性变化（例如权重调整）不会重建连接，picker总能拿到最新的地址属性
+type baseBalancer struct {
+	cc     balancer.ClientConn
+	target string
+	picker pickerBuilder
+
+	csEvltr  *balancer.ConnectivityStateEvaluator
+	state    connectivity.State
+	subConns map[string]*subConn
+	scStates map[balancer.SubConn]*subConn
+	current  balancer.Picker
+
+	config     serviceconfig.LoadBalancingConfig
+	attributes *attributes.Attributes
+
+	resolverErr error
+	connErr     error
+}
+
+func addressKey(addr resolver.Address) string {
+	return addr.Addr + "|" + addr.ServerName
+}
+
+// UpdateClientConnState 实现balancer.Balancer接口
+func (b *baseBalancer) UpdateClientConnState(s balancer.ClientConnState) error {
+	b.resolverErr = nil
+	b.config = s.BalancerConfig
+	b.attributes = s.ResolverState.Attributes
+
+	seen := make(map[string]bool, len(s.ResolverState.Addresses))
+	for _, addr := range s.ResolverState.Addresses {
+		key := addressKey(addr)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		if entry, ok := b.subConns[key]; ok {
+			entry.address = addr
+			continue
+		}
+
+		entry := &subConn{address: addr, state: connectivity.Idle}
+		sc, err := b.cc.NewSubConn([]resolver.Address{addr}, balancer.NewSubConnOptions{
+			StateListener: func(scs balancer.SubConnState) { b.updateSubConnState(entry, scs) },
+		})
+		if err != nil {
+			continue
+		}
+		entry.sc = sc
+		b.subConns[key] = entry
+		b.scStates[sc] = entry
+		b.csEvltr.RecordTransition(connectivity.Shutdown, connectivity.Idle)
+		sc.Connect()
+	}
+
+	for key, entry := range b.subConns {
+		if !seen[key] {
+			// 状态保留在scStates中直到子连接进入Shutdown
+			entry.sc.Shutdown()
+			delete(b.subConns, key)
+		}
+	}
+
+	if len(s.ResolverState.Addresses) == 0 {
+		b.ResolverError(errors.New("produced zero addresses"))
+		return balancer.ErrBadResolverState
+	}
+
+	b.regeneratePicker()
+	return nil
+}
+
+// ResolverError 实现balancer.Balancer接口
+func (b *baseBalancer) ResolverError(err error) {
+	b.resolverErr = err
+	if len(b.subConns) == 0 {
+		b.state = connectivity.TransientFailure
+	}
+	if b.state != connectivity.TransientFailure {
+		// 仍有可用连接时保持当前picker
+		return
+	}
+	b.regeneratePicker()
+}
+
+// UpdateSubConnState 实现balancer.Balancer接口，状态变化通过StateListener接收
+func (b *baseBalancer) UpdateSubConnState(sc balancer.SubConn, state balancer.SubConnState) {}
+
+func (b *baseBalancer) updateSubConnState(entry *subConn, state balancer.SubConnState) {
+	s := state.ConnectivityState
+	if _, ok := b.scStates[entry.sc]; !ok {
+		return
+	}
+	old := entry.state
+	if old == connectivity.TransientFailure && (s == connectivity.Connecting || s == connectivity.Idle) {
+		// 保持TRANSIENT_FAILURE直到重新READY，避免状态抖动
+		if s == connectivity.Idle {
+			entry.sc.Connect()
+		}
+		return
+	}
+	entry.state = s
+	switch s {
+	case connectivity.Idle:
+		entry.sc.Connect()
+	case connectivity.Shutdown:
+		delete(b.scStates, entry.sc)
+	case connectivity.TransientFailure:
+		b.connErr = state.ConnectionError
+	}
+
+	b.state = b.csEvltr.RecordTransition(old, s)
+	if (s == connectivity.Ready) != (old == connectivity.Ready) || b.state == connectivity.TransientFailure {
+		b.regeneratePicker()
+		return
+	}
+	b.cc.UpdateState(balancer.State{ConnectivityState: b.state, Picker: b.current})
+}
+
+// regeneratePicker 根据当前READY子连接重建picker并推送给ClientConn
+func (b *baseBalancer) regeneratePicker() {
+	if observer, ok := b.picker.(subConnObserver); ok {
+		ready := 0
+		for _, entry := range b.subConns {
+			if entry.state == connectivity.Ready {
+				ready++
+			}
+		}
+		observer.observe(len(b.subConns), ready)
+	}
+
+	var picker balancer.Picker
+	if b.state == connectivity.TransientFailure {
+		picker = errPicker{err: b.mergeErrors()}
+	} else if !b.hasReady() {
+		picker = errPicker{err: balancer.ErrNoSubConnAvailable}
+	} else {
+		info := buildInfo{config: b.config, attributes: b.attributes, target: b.target, addresses: make(map[string]bool, len(b.subConns))}
+		for key, entry := range b.subConns {
+			info.addresses[key] = true
+			if entry.state == connectivity.Ready {
+				info.ready = append(info.ready, readySubConn{subConn: entry.sc, address: entry.address})
+			}
+		}
+		sort.Slice(info.ready, func(i, j int) bool {
+			return addressKey(info.ready[i].address) < addressKey(info.ready[j].address)
+		})
+		picker = b.picker.build(info)
+	}
+	b.current = picker
+	b.cc.UpdateState(balancer.State{ConnectivityState: b.state, Picker: picker})
+}
+
+func (b *baseBalancer) hasReady() bool {
+	for _, entry := range b.subConns {
+		if entry.state == connectivity.Ready {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *baseBalancer) mergeErrors() error {
+	if b.connErr == nil {
+		return fmt.Errorf("last resolver error: %v", b.resolverErr)
+	}
+	if b.resolverErr == nil {
+		return fmt.Errorf("last connection error: %v", b.connErr)
+	}
+	return fmt.Errorf("last connection error: %v; last resolver error: %v", b.connErr, b.resolverErr)
+}
+
+// ExitIdle 实现balancer.Balancer接口
+func (b *baseBalancer) ExitIdle() {
+	for _, entry := range b.subConns {
+		if entry.state == connectivity.Idle {
+			entry.sc.Connect()
+		}
+	}
+}
+
+// Close 实现balancer.Balancer接口，子连接由ClientConn负责关闭
+func (b *baseBalancer) Close() {
+	if closer, ok := b.picker.(pickerCloser); ok {
+		closer.close()
+	}
+}
+
+// errPicker 始终返回错误的picker
+type errPicker struct {
+	err error
+}
+
+func (p errPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	return balancer.PickResult{}, p.err
+}
@@ -0,0 +1,130 @@
+// lb/base_test.go
+package lb
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+
+	"github.com/YuanJey/grpc-etcd/registry"
+)
+
+// fakeSubConn 只用于标识地址的子连接，picker单元测试不会调用其方法
+type fakeSubConn struct {
+	balancer.SubConn
+	addr string
+}
+
+// testAddress 返回带有服务信息属性的地址，与resolver推送的地址一致
+func testAddress(service *registry.ServiceInfo) resolver.Address {
+	return registry.ResolverState([]*registry.ServiceInfo{service}).Addresses[0]
+}
+
+// newBuildInfo 用services构造全部READY的buildInfo，子连接按地址复用subConns中已有的
+func newBuildInfo(subConns map[string]*fakeSubConn, services ...*registry.ServiceInfo) buildInfo {
+	info := buildInfo{config: emptyConfig{}, addresses: make(map[string]bool)}
+	for _, service := range services {
+		sc, ok := subConns[service.Address]
+		if !ok {
+			sc = &fakeSubConn{addr: service.Address}
+			subConns[service.Address] = sc
+		}
+		addr := testAddress(service)
+		info.addresses[addressKey(addr)] = true
+		info.ready = append(info.ready, readySubConn{subConn: sc, address: addr})
+	}
+	return info
+}
+
+// pickCounts 执行n次Pick并按地址计数，done为false时不结束请求
+func pickCounts(t *testing.T, p balancer.Picker, n int, done bool) map[string]int {
+	t.Helper()
+	counts := make(map[string]int)
+	for range n {
+		result, err := p.Pick(balancer.PickInfo{Ctx: context.Background()})
+		if err != nil {
+			t.Fatalf("pick: %v", err)
+		}
+		counts[result.SubConn.(*fakeSubConn).addr]++
+		if done && result.Done != nil {
+			result.Done(balancer.DoneInfo{})
+		}
+	}
+	return counts
+}
+
+// backend 记录收到请求数的健康检查服务，delay模拟处理缓慢的实例
+type backend struct {
+	healthpb.UnimplementedHealthServer
+	addr  string
+	delay time.Duration
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (b *backend) Check(ctx context.Context, _ *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	b.mu.Lock()
+	b.calls++
+	b.mu.Unlock()
+	if b.delay > 0 {
+		select {
+		case <-time.After(b.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+func (b *backend) count() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.calls
+}
+
+// startBackend 在本机临时端口启动后端，测试结束时停止
+func startBackend(t *testing.T, delay time.Duration) *backend {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	b := &backend{addr: lis.Addr().String(), delay: delay}
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, b)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return b
+}
+
+// dialPolicy 使用policy通过手动resolver连接services，返回health客户端和resolver
+func dialPolicy(t *testing.T, policy string, services ...*registry.ServiceInfo) (healthpb.HealthClient, *manual.Resolver) {
+	t.Helper()
+	r := manual.NewBuilderWithScheme("lbtest")
+	r.InitialState(stateOf(services...))
+	conn, err := grpc.NewClient(r.Scheme()+":///svc",
+		grpc.WithResolvers(r),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingConfig":[{%q:{}}]}`, policy)))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn), r
+}
+
+// stateOf 返回与etcd resolver推送形式相同的状态
+func stateOf(services ...*registry.ServiceInfo) resolver.State {
+	return registry.ResolverState(services)
+}
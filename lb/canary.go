@@ -0,0 +1,124 @@
+// lb/canary.go
+package lb
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/YuanJey/grpc-etcd/registry"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// CanaryName 按版本百分比划分流量的balancer名称
+const CanaryName = "etcd_canary"
+
+func init() {
+	register(CanaryName, func() pickerBuilder {
+		return canaryPickerBuilder{}
+	}, parseCanaryConfig)
+}
+
+// CanaryConfig 版本流量划分配置，例如
+// {"loadBalancingConfig":[{"etcd_canary":{"splits":{"v2":10}}}]}
+// etcd中/routing/{service}/split存在时以etcd中的划分为准，并随key变化实时生效
+type CanaryConfig struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+
+	Splits registry.TrafficSplit `json:"splits,omitempty"`
+}
+
+func parseCanaryConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	cfg := &CanaryConfig{}
+	if len(js) > 0 {
+		if err := json.Unmarshal(js, cfg); err != nil {
+			return nil, fmt.Errorf("%s: invalid config: %v", CanaryName, err)
+		}
+	}
+	if err := cfg.Splits.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", CanaryName, err)
+	}
+	return cfg, nil
+}
+
+type canaryPickerBuilder struct{}
+
+func (canaryPickerBuilder) build(info buildInfo) balancer.Picker {
+	split, ok := registry.TrafficSplitFromState(info.attributes)
+	if !ok {
+		if cfg, _ := info.config.(*CanaryConfig); cfg != nil {
+			split = cfg.Splits
+		}
+	}
+
+	// 实例按版本分组，未在划分中列出的版本归入剩余流量组
+	const rest = ""
+	groups := make(map[string][]readySubConn)
+	for _, ready := range info.ready {
+		group := rest
+		if service, ok := registry.ServiceInfoFromAddress(ready.address); ok {
+			if _, listed := split[service.Version]; listed && service.Version != rest {
+				group = service.Version
+			}
+		}
+		groups[group] = append(groups[group], ready)
+	}
+
+	// 只有有READY实例的组参与划分，没有实例的版本其流量按比例溢出到其他组
+	var remaining float64 = 100
+	for _, percent := range split {
+		remaining -= percent
+	}
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	p := &canaryPicker{byVersion: groupByVersion(info.ready)}
+	for _, name := range names {
+		share := remaining
+		if name != rest {
+			share = split[name]
+		}
+		p.groups = append(p.groups, canaryGroup{share: share, picker: newRRPicker(groups[name])})
+		p.total += share
+	}
+	return p
+}
+
+type canaryGroup struct {
+	share  float64
+	picker *rrPicker
+}
+
+// canaryPicker 每次RPC按比例随机选择版本组，组内轮询
+// 请求通过registry.WithTargetVersion显式指定版本且该版本有READY实例时，显式版本优先
+type canaryPicker struct {
+	groups    []canaryGroup
+	total     float64
+	byVersion map[string]*rrPicker
+}
+
+// Pick 实现balancer.Picker接口
+func (p *canaryPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	if version, ok := registry.TargetVersionFromContext(info.Ctx); ok {
+		if picker, ok := p.byVersion[version]; ok {
+			return picker.Pick(info)
+		}
+	}
+	if p.total <= 0 {
+		// 所有有实例的组比例都为0，只能均分
+		return p.groups[rand.Intn(len(p.groups))].picker.Pick(info)
+	}
+	n := rand.Float64() * p.total
+	for _, group := range p.groups {
+		if n < group.share {
+			return group.picker.Pick(info)
+		}
+		n -= group.share
+	}
+	return p.groups[len(p.groups)-1].picker.Pick(info)
+}
@@ -0,0 +1,125 @@
+// lb/chash.go
+package lb
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+
+	"github.com/YuanJey/grpc-etcd/registry"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// ConsistentHashName 一致性哈希balancer名称
+const ConsistentHashName = "etcd_consistent_hash"
+
+// defaultVirtualNodes 每个地址默认的虚拟节点数
+const defaultVirtualNodes = 100
+
+func init() {
+	register(ConsistentHashName, func() pickerBuilder {
+		return chashPickerBuilder{}
+	}, parseConsistentHashConfig)
+}
+
+// ConsistentHashConfig 一致性哈希balancer配置，例如
+// {"loadBalancingConfig":[{"etcd_consistent_hash":{"hashHeader":"x-user-id"}}]}
+type ConsistentHashConfig struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+
+	// HashHeader 读取哈希key的outgoing metadata名称，
+	// registry.WithHashKey设置的key优先
+	HashHeader string `json:"hashHeader,omitempty"`
+	// VirtualNodes 每个地址在哈希环上的虚拟节点数，默认100
+	VirtualNodes int `json:"virtualNodes,omitempty"`
+}
+
+func parseConsistentHashConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	cfg := &ConsistentHashConfig{}
+	if len(js) > 0 {
+		if err := json.Unmarshal(js, cfg); err != nil {
+			return nil, fmt.Errorf("%s: invalid config: %v", ConsistentHashName, err)
+		}
+	}
+	if cfg.VirtualNodes < 0 {
+		return nil, fmt.Errorf("%s: virtualNodes must not be negative", ConsistentHashName)
+	}
+	if cfg.VirtualNodes == 0 {
+		cfg.VirtualNodes = defaultVirtualNodes
+	}
+	return cfg, nil
+}
+
+type chashPickerBuilder struct{}
+
+// build 每个地址的虚拟节点只和自身地址有关，成员变化时只有增删地址对应的区间会迁移
+func (chashPickerBuilder) build(info buildInfo) balancer.Picker {
+	cfg, _ := info.config.(*ConsistentHashConfig)
+	if cfg == nil {
+		cfg = &ConsistentHashConfig{VirtualNodes: defaultVirtualNodes}
+	}
+
+	p := &chashPicker{
+		header:   cfg.HashHeader,
+		fallback: newRRPicker(info.ready),
+		ring:     make([]ringNode, 0, len(info.ready)*cfg.VirtualNodes),
+	}
+	for _, ready := range info.ready {
+		key := addressKey(ready.address)
+		for i := 0; i < cfg.VirtualNodes; i++ {
+			p.ring = append(p.ring, ringNode{hash: hashString(key + "#" + strconv.Itoa(i)), subConn: ready.subConn})
+		}
+	}
+	sort.Slice(p.ring, func(i, j int) bool { return p.ring[i].hash < p.ring[j].hash })
+	return p
+}
+
+type ringNode struct {
+	hash    uint64
+	subConn balancer.SubConn
+}
+
+// chashPicker 按哈希key在环上顺时针查找第一个虚拟节点，无key的请求退化为轮询
+type chashPicker struct {
+	header   string
+	ring     []ringNode
+	fallback *rrPicker
+}
+
+// Pick 实现balancer.Picker接口
+func (p *chashPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	key, ok := p.hashKey(info)
+	if !ok {
+		return p.fallback.Pick(info)
+	}
+	h := hashString(key)
+	i := sort.Search(len(p.ring), func(i int) bool { return p.ring[i].hash >= h })
+	if i == len(p.ring) {
+		i = 0
+	}
+	return balancer.PickResult{SubConn: p.ring[i].subConn}, nil
+}
+
+func (p *chashPicker) hashKey(info balancer.PickInfo) (string, bool) {
+	if key, ok := registry.HashKeyFromContext(info.Ctx); ok {
+		return key, true
+	}
+	if p.header == "" {
+		return "", false
+	}
+	md, _ := metadata.FromOutgoingContext(info.Ctx)
+	if values := md.Get(p.header); len(values) > 0 && values[0] != "" {
+		return values[0], true
+	}
+	return "", false
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
@@ -0,0 +1,91 @@
+// lb/leastrequest.go
+package lb
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc/balancer"
+)
+
+// LeastRequestName 最少在途请求balancer名称
+const LeastRequestName = "least_request"
+
+func init() {
+	register(LeastRequestName, func() pickerBuilder {
+		return &leastRequestPickerBuilder{inFlight: make(map[string]*atomic.Int64)}
+	}, nil)
+}
+
+// leastRequestPickerBuilder 按地址保存在途请求计数，重建picker时计数不会丢失
+// 子连接暂时离开READY时计数保留，重新READY后仍然反映其上尚未结束的请求，只有子连接被移除后才删除
+type leastRequestPickerBuilder struct {
+	mu       sync.Mutex
+	inFlight map[string]*atomic.Int64
+}
+
+func (b *leastRequestPickerBuilder) build(info buildInfo) balancer.Picker {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for key := range b.inFlight {
+		if !info.addresses[key] {
+			delete(b.inFlight, key)
+		}
+	}
+	p := &leastRequestPicker{}
+	for _, ready := range info.ready {
+		key := addressKey(ready.address)
+		counter, ok := b.inFlight[key]
+		if !ok {
+			counter = &atomic.Int64{}
+			b.inFlight[key] = counter
+		}
+		p.entries = append(p.entries, leastRequestEntry{
+			subConn:  ready.subConn,
+			weight:   addressWeight(ready.address),
+			inFlight: counter,
+		})
+	}
+	return p
+}
+
+type leastRequestEntry struct {
+	subConn  balancer.SubConn
+	weight   int64
+	inFlight *atomic.Int64
+}
+
+// load 有效负载：在途请求数/权重
+func (e leastRequestEntry) load() float64 {
+	return float64(e.inFlight.Load()) / float64(e.weight)
+}
+
+// leastRequestPicker 随机选两个实例，取有效负载较低的一个（power of two choices）
+// 卡在GC或处理缓慢的实例在途请求堆积后会自然少分到流量
+type leastRequestPicker struct {
+	entries []leastRequestEntry
+}
+
+// Pick 实现balancer.Picker接口
+func (p *leastRequestPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	chosen := p.entries[0]
+	if n := len(p.entries); n > 1 {
+		i := rand.Intn(n)
+		j := rand.Intn(n - 1)
+		if j >= i {
+			j++
+		}
+		chosen = p.entries[i]
+		if other := p.entries[j]; other.load() < chosen.load() {
+			chosen = other
+		}
+	}
+
+	chosen.inFlight.Add(1)
+	return balancer.PickResult{
+		SubConn: chosen.subConn,
+		Done:    func(balancer.DoneInfo) { chosen.inFlight.Add(-1) },
+	}, nil
+}
@@ -0,0 +1,83 @@
+// lb/leastrequest_test.go
+package lb
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/YuanJey/grpc-etcd/registry"
+)
+
+func TestLeastRequestKeepsCountersAcrossRebuilds(t *testing.T) {
+	a := &registry.ServiceInfo{Name: "svc", Address: "10.0.0.1:80"}
+	b := &registry.ServiceInfo{Name: "svc", Address: "10.0.0.2:80"}
+	subConns := make(map[string]*fakeSubConn)
+	builder := &leastRequestPickerBuilder{inFlight: make(map[string]*atomic.Int64)}
+
+	// a只有一个实例时积压100个未结束的请求
+	pickCounts(t, builder.build(newBuildInfo(subConns, a)), 100, false)
+
+	// a暂时离开READY但子连接仍然存在，计数必须保留
+	info := newBuildInfo(subConns, b)
+	info.addresses[addressKey(testAddress(a))] = true
+	builder.build(info)
+
+	counts := pickCounts(t, builder.build(newBuildInfo(subConns, a, b)), 50, true)
+	if counts[a.Address] != 0 {
+		t.Errorf("picks to the backlogged instance after rebuild: got %d of 50, want 0", counts[a.Address])
+	}
+
+	// a被移除后计数删除，重新加入时从零开始
+	builder.build(newBuildInfo(subConns, b))
+	if _, ok := builder.inFlight[addressKey(testAddress(a))]; ok {
+		t.Errorf("counter of a removed subconn was kept")
+	}
+	counts = pickCounts(t, builder.build(newBuildInfo(subConns, a, b)), 100, true)
+	if counts[a.Address] == 0 {
+		t.Errorf("re-added instance got no picks")
+	}
+}
+
+func TestLeastRequestAvoidsSlowBackend(t *testing.T) {
+	slow := startBackend(t, 200*time.Millisecond)
+	fast := startBackend(t, 0)
+	client, r := dialPolicy(t, LeastRequestName,
+		&registry.ServiceInfo{Name: "svc", Address: slow.addr},
+		&registry.ServiceInfo{Name: "svc", Address: fast.addr})
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("warm up: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+					t.Errorf("check: %v", err)
+					return
+				}
+			}
+		}()
+		if i == 10 {
+			// 请求进行中更新地址属性，picker重建后慢实例上的在途请求仍然计入
+			r.UpdateState(stateOf(
+				&registry.ServiceInfo{Name: "svc", Address: slow.addr, Version: "v2"},
+				&registry.ServiceInfo{Name: "svc", Address: fast.addr, Version: "v2"}))
+		}
+	}
+	wg.Wait()
+
+	slowCalls, fastCalls := slow.count(), fast.count()
+	if slowCalls*5 > fastCalls {
+		t.Errorf("slow backend got %d calls, fast backend %d: want the slow one below 1/5 of the fast one", slowCalls, fastCalls)
+	}
+}
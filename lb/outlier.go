@@ -0,0 +1,374 @@
+// lb/outlier.go
+package lb
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/serviceconfig"
+	"google.golang.org/grpc/status"
+
+	"github.com/YuanJey/grpc-etcd/registry"
+)
+
+// OutlierDetectionName 异常实例摘除balancer名称
+const OutlierDetectionName = "etcd_outlier_detection"
+
+func init() {
+	register(OutlierDetectionName, func() pickerBuilder {
+		return &outlierPickerBuilder{stats: make(map[string]*outlierStats)}
+	}, parseOutlierConfig)
+}
+
+// OutlierDetectionConfig 异常实例摘除配置，例如
+// {"loadBalancingConfig":[{"etcd_outlier_detection":{"failureRateThreshold":0.5,"childPolicy":"etcd_weighted_round_robin"}}]}
+type OutlierDetectionConfig struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+
+	// Interval 统计失败率的周期，默认10s
+	Interval string `json:"interval,omitempty"`
+	// FailureRateThreshold 周期内失败率超过该值的实例会被摘除，默认0.5
+	FailureRateThreshold float64 `json:"failureRateThreshold,omitempty"`
+	// MinimumRequests 周期内请求数少于该值的实例不参与判断，默认10
+	MinimumRequests int64 `json:"minimumRequests,omitempty"`
+	// BaseEjectionTime 首次摘除时长，之后每次连续摘除翻倍，默认30s
+	BaseEjectionTime string `json:"baseEjectionTime,omitempty"`
+	// MaxEjectionTime 单次摘除的最长时长，默认300s
+	MaxEjectionTime string `json:"maxEjectionTime,omitempty"`
+	// MaxEjectionPercent 同时被摘除的实例最多占比，默认50
+	MaxEjectionPercent int `json:"maxEjectionPercent,omitempty"`
+	// ChildPolicy 实际选择实例的子策略，默认round_robin
+	ChildPolicy string `json:"childPolicy,omitempty"`
+	// ChildConfig 子策略配置
+	ChildConfig json.RawMessage `json:"childConfig,omitempty"`
+
+	interval         time.Duration
+	baseEjectionTime time.Duration
+	maxEjectionTime  time.Duration
+	child            *childPolicyConfig
+}
+
+func parseOutlierConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	cfg := &OutlierDetectionConfig{}
+	if len(js) > 0 {
+		if err := json.Unmarshal(js, cfg); err != nil {
+			return nil, fmt.Errorf("%s: invalid config: %v", OutlierDetectionName, err)
+		}
+	}
+	if err := cfg.init(); err != nil {
+		return nil, fmt.Errorf("%s: %v", OutlierDetectionName, err)
+	}
+	return cfg, nil
+}
+
+// init 填充默认值并校验
+func (c *OutlierDetectionConfig) init() error {
+	var err error
+	if c.interval, err = parsePositiveDuration("interval", c.Interval, 10*time.Second); err != nil {
+		return err
+	}
+	if c.baseEjectionTime, err = parsePositiveDuration("baseEjectionTime", c.BaseEjectionTime, 30*time.Second); err != nil {
+		return err
+	}
+	if c.maxEjectionTime, err = parsePositiveDuration("maxEjectionTime", c.MaxEjectionTime, 300*time.Second); err != nil {
+		return err
+	}
+	if c.maxEjectionTime < c.baseEjectionTime {
+		return fmt.Errorf("maxEjectionTime %v must not be less than baseEjectionTime %v", c.maxEjectionTime, c.baseEjectionTime)
+	}
+	if c.FailureRateThreshold == 0 {
+		c.FailureRateThreshold = 0.5
+	}
+	if c.FailureRateThreshold < 0 || c.FailureRateThreshold > 1 {
+		return fmt.Errorf("failureRateThreshold must be within (0, 1], got %v", c.FailureRateThreshold)
+	}
+	if c.MinimumRequests == 0 {
+		c.MinimumRequests = 10
+	}
+	if c.MinimumRequests < 0 {
+		return fmt.Errorf("minimumRequests must not be negative")
+	}
+	if c.MaxEjectionPercent == 0 {
+		c.MaxEjectionPercent = 50
+	}
+	if c.MaxEjectionPercent < 0 || c.MaxEjectionPercent > 100 {
+		return fmt.Errorf("maxEjectionPercent must be within [0, 100], got %d", c.MaxEjectionPercent)
+	}
+	c.child, err = parseChildPolicy(c.ChildPolicy, c.ChildConfig)
+	return err
+}
+
+func parsePositiveDuration(name, value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %v", name, value, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s must be positive, got %v", name, d)
+	}
+	return d, nil
+}
+
+// OutlierEvent 实例被摘除或恢复的事件
+type OutlierEvent struct {
+	Address string
+	// Ejected 为true表示被摘除，false表示恢复
+	Ejected bool
+	// FailureRate 触发摘除时的失败率
+	FailureRate float64
+	// Duration 本次摘除时长
+	Duration time.Duration
+}
+
+// 异常实例摘除balancer的摘除和恢复计数，与MetricZoneAffinityPicks一样通过registry.WithMetrics设置的接收器按target上报
+const (
+	// MetricOutlierEjections 摘除次数，标签为LabelTarget和registry.LabelAddress
+	MetricOutlierEjections = "lb_outlier_ejections_total"
+	// MetricOutlierReadmissions 摘除到期后恢复的次数，标签与MetricOutlierEjections相同
+	MetricOutlierReadmissions = "lb_outlier_readmissions_total"
+)
+
+var (
+	outlierHook      atomic.Value // func(OutlierEvent)
+	outlierEjections atomic.Uint64
+)
+
+// SetOutlierEjectionHook 设置实例摘除和恢复时的回调，回调在选择路径上同步执行，应尽快返回
+//
+// Deprecated: 回调是进程级的，无法区分target；改用registry.WithMetrics设置的接收器，
+// 见MetricOutlierEjections和MetricOutlierReadmissions。为兼容旧代码回调仍会被调用
+func SetOutlierEjectionHook(hook func(OutlierEvent)) {
+	outlierHook.Store(hook)
+}
+
+// OutlierEjections 返回进程内所有target的累计摘除次数
+//
+// Deprecated: 改用按target上报的MetricOutlierEjections
+func OutlierEjections() uint64 {
+	return outlierEjections.Load()
+}
+
+// fireEventLocked 按target上报摘除或恢复事件，再交给已废弃的全局回调，调用方需持有b.mu
+func (b *outlierPickerBuilder) fireEventLocked(event OutlierEvent) {
+	if b.metrics != nil {
+		name := MetricOutlierReadmissions
+		if event.Ejected {
+			name = MetricOutlierEjections
+		}
+		b.metrics.IncCounter(name, map[string]string{LabelTarget: b.info.target, registry.LabelAddress: event.Address}, 1)
+	}
+	fireOutlierEvent(event)
+}
+
+func fireOutlierEvent(event OutlierEvent) {
+	if event.Ejected {
+		outlierEjections.Add(1)
+	}
+	if hook, _ := outlierHook.Load().(func(OutlierEvent)); hook != nil {
+		hook(event)
+	}
+}
+
+// outlierStats 单个地址的统计和摘除状态
+type outlierStats struct {
+	successes atomic.Int64
+	failures  atomic.Int64
+
+	// 以下字段由outlierPickerBuilder.mu保护
+	ejectedUntil  time.Time
+	ejectionCount int
+	address       string
+}
+
+// outlierPickerBuilder 根据请求结果统计各地址失败率，超过阈值的地址暂时摘除，
+// 剩余地址交给子策略选择；统计在选择时按周期惰性结算，不需要额外的goroutine
+type outlierPickerBuilder struct {
+	mu          sync.Mutex
+	cfg         *OutlierDetectionConfig
+	child       *childPolicy
+	info        buildInfo
+	stats       map[string]*outlierStats
+	bySubConn   map[balancer.SubConn]*outlierStats
+	ejected     map[string]bool
+	periodStart time.Time
+	childPicker balancer.Picker
+	metrics     registry.Metrics
+}
+
+func (b *outlierPickerBuilder) build(info buildInfo) balancer.Picker {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cfg, _ := info.config.(*OutlierDetectionConfig)
+	if cfg == nil {
+		cfg = &OutlierDetectionConfig{}
+		cfg.init()
+	}
+	b.cfg = cfg
+	b.child = cfg.child.ensure(b.child)
+	b.info = info
+	b.metrics, _ = registry.MetricsFromState(info.attributes)
+
+	// 暂时离开READY的地址保留统计和摘除状态，重连后不会绕过摘除
+	for key := range b.stats {
+		if !info.addresses[key] {
+			delete(b.stats, key)
+		}
+	}
+	b.bySubConn = make(map[balancer.SubConn]*outlierStats, len(info.ready))
+	for _, ready := range info.ready {
+		key := addressKey(ready.address)
+		stats, ok := b.stats[key]
+		if !ok {
+			stats = &outlierStats{address: ready.address.Addr}
+			b.stats[key] = stats
+		}
+		b.bySubConn[ready.subConn] = stats
+	}
+	if b.periodStart.IsZero() {
+		b.periodStart = time.Now()
+	}
+	b.rebuildLocked(time.Now())
+	return &outlierPicker{builder: b}
+}
+
+// rebuildLocked 使用未被摘除的地址重建子picker，调用方需持有b.mu
+func (b *outlierPickerBuilder) rebuildLocked(now time.Time) {
+	ejected := make(map[string]bool)
+	for key, stats := range b.stats {
+		if now.Before(stats.ejectedUntil) {
+			ejected[key] = true
+		}
+	}
+	var candidates []readySubConn
+	for _, ready := range b.info.ready {
+		if !ejected[addressKey(ready.address)] {
+			candidates = append(candidates, ready)
+		}
+	}
+	if len(candidates) == 0 {
+		// 全部被摘除时不如照常使用全部实例
+		candidates = b.info.ready
+	}
+	b.ejected = ejected
+	b.childPicker = b.child.build(b.info, candidates)
+}
+
+// evaluateLocked 周期结束时结算失败率并更新摘除状态，调用方需持有b.mu
+func (b *outlierPickerBuilder) evaluateLocked(now time.Time) {
+	changed := false
+	for key, stats := range b.stats {
+		if b.ejected[key] && !now.Before(stats.ejectedUntil) {
+			changed = true
+			b.fireEventLocked(OutlierEvent{Address: stats.address})
+		}
+	}
+
+	if now.Sub(b.periodStart) >= b.cfg.interval {
+		b.periodStart = now
+		maxEjected := len(b.stats) * b.cfg.MaxEjectionPercent / 100
+		ejectedCount := 0
+		for _, stats := range b.stats {
+			if now.Before(stats.ejectedUntil) {
+				ejectedCount++
+			}
+		}
+
+		for _, stats := range b.stats {
+			successes := stats.successes.Swap(0)
+			failures := stats.failures.Swap(0)
+			if now.Before(stats.ejectedUntil) {
+				continue
+			}
+			total := successes + failures
+			if total < b.cfg.MinimumRequests {
+				continue
+			}
+			rate := float64(failures) / float64(total)
+			if rate <= b.cfg.FailureRateThreshold {
+				// 健康周期逐步降低连续摘除次数
+				if stats.ejectionCount > 0 {
+					stats.ejectionCount--
+				}
+				continue
+			}
+			if ejectedCount >= maxEjected {
+				continue
+			}
+
+			stats.ejectionCount++
+			duration := b.cfg.baseEjectionTime << (stats.ejectionCount - 1)
+			if duration > b.cfg.maxEjectionTime || duration <= 0 {
+				duration = b.cfg.maxEjectionTime
+			}
+			stats.ejectedUntil = now.Add(duration)
+			ejectedCount++
+			changed = true
+			b.fireEventLocked(OutlierEvent{Address: stats.address, Ejected: true, FailureRate: rate, Duration: duration})
+		}
+	}
+
+	if changed {
+		b.rebuildLocked(now)
+	}
+}
+
+// outlierPicker 选择前先结算统计，并记录每次请求的结果
+type outlierPicker struct {
+	builder *outlierPickerBuilder
+}
+
+// Pick 实现balancer.Picker接口
+func (p *outlierPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	b := p.builder
+	b.mu.Lock()
+	b.evaluateLocked(time.Now())
+	picker := b.childPicker
+	b.mu.Unlock()
+
+	result, err := picker.Pick(info)
+	if err != nil {
+		return result, err
+	}
+
+	b.mu.Lock()
+	stats := b.bySubConn[result.SubConn]
+	b.mu.Unlock()
+	if stats == nil {
+		return result, nil
+	}
+
+	childDone := result.Done
+	result.Done = func(done balancer.DoneInfo) {
+		if isServerFailure(done.Err) {
+			stats.failures.Add(1)
+		} else {
+			stats.successes.Add(1)
+		}
+		if childDone != nil {
+			childDone(done)
+		}
+	}
+	return result, nil
+}
+
+// isServerFailure 判断请求错误是否说明实例本身异常，客户端自身原因的错误不计入失败率
+func isServerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unknown, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted,
+		codes.Internal, codes.Unavailable, codes.DataLoss:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+// lb/outlier_test.go
+package lb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/YuanJey/grpc-etcd/etcdtest"
+	"github.com/YuanJey/grpc-etcd/registry"
+)
+
+// outlierRecorder 按指标名、target和地址记录摘除和恢复计数的registry.Metrics实现
+type outlierRecorder struct {
+	mu       sync.Mutex
+	counters map[string]float64
+}
+
+func (m *outlierRecorder) IncCounter(name string, labels map[string]string, delta float64) {
+	if name != MetricOutlierEjections && name != MetricOutlierReadmissions {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.counters == nil {
+		m.counters = make(map[string]float64)
+	}
+	m.counters[name+" "+labels[LabelTarget]+" "+labels[registry.LabelAddress]] += delta
+}
+
+func (m *outlierRecorder) SetGauge(string, map[string]string, float64)         {}
+func (m *outlierRecorder) ObserveHistogram(string, map[string]string, float64) {}
+
+func (m *outlierRecorder) get(name, target, addr string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counters[name+" "+target+" "+addr]
+}
+
+// failingHealth 所有健康检查都返回Unavailable的后端
+type failingHealth struct {
+	healthpb.UnimplementedHealthServer
+}
+
+func (failingHealth) Check(context.Context, *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	return nil, status.Error(codes.Unavailable, "backend failing")
+}
+
+// startFailingBackend 在本机临时端口启动failingHealth，返回其地址
+func startFailingBackend(t *testing.T) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, failingHealth{})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String()
+}
+
+func TestOutlierEjectionSurvivesReconnect(t *testing.T) {
+	a := &registry.ServiceInfo{Name: "svc", Address: "10.0.0.1:80"}
+	b := &registry.ServiceInfo{Name: "svc", Address: "10.0.0.2:80"}
+	cfg, err := parseOutlierConfig(json.RawMessage(`{"interval":"1ms","minimumRequests":5,"baseEjectionTime":"1m"}`))
+	if err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+	subConns := make(map[string]*fakeSubConn)
+	builder := &outlierPickerBuilder{stats: make(map[string]*outlierStats)}
+	build := func(services ...*registry.ServiceInfo) balancer.Picker {
+		info := newBuildInfo(subConns, services...)
+		info.config = cfg
+		return builder.build(info)
+	}
+
+	// a上的请求全部失败，周期结束后被摘除
+	p := build(a, b)
+	for range 40 {
+		result, err := p.Pick(balancer.PickInfo{Ctx: context.Background()})
+		if err != nil {
+			t.Fatalf("pick: %v", err)
+		}
+		var done balancer.DoneInfo
+		if result.SubConn.(*fakeSubConn).addr == a.Address {
+			done.Err = status.Error(codes.Unavailable, "backend failing")
+		}
+		result.Done(done)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if counts := pickCounts(t, p, 20, true); counts[a.Address] != 0 {
+		t.Fatalf("picks to the failing instance: got %d of 20, want 0", counts[a.Address])
+	}
+	stats := builder.stats[addressKey(testAddress(a))]
+	if stats == nil || stats.ejectionCount != 1 {
+		t.Fatalf("stats of the ejected instance: %+v", stats)
+	}
+
+	// a经历Connecting后重新READY，摘除状态和次数都保留
+	info := newBuildInfo(subConns, b)
+	info.config = cfg
+	info.addresses[addressKey(testAddress(a))] = true
+	builder.build(info)
+	p = build(a, b)
+	if counts := pickCounts(t, p, 20, true); counts[a.Address] != 0 {
+		t.Errorf("picks to the ejected instance after reconnect: got %d of 20, want 0", counts[a.Address])
+	}
+	if got := builder.stats[addressKey(testAddress(a))]; got != stats || got.ejectionCount != 1 {
+		t.Errorf("stats after reconnect: got %+v, want ejectionCount 1 kept", got)
+	}
+
+	// a被移除后统计删除
+	build(b)
+	if _, ok := builder.stats[addressKey(testAddress(a))]; ok {
+		t.Error("stats of a removed subconn were kept")
+	}
+}
+
+func TestOutlierEventsReportedPerTarget(t *testing.T) {
+	healthy := startBackend(t, 0)
+	failing := startFailingBackend(t)
+	srv := etcdtest.Start(t)
+	metrics := &outlierRecorder{}
+	outlierConfig := fmt.Sprintf(`{"loadBalancingConfig":[{%q:{"interval":"50ms","minimumRequests":5,"baseEjectionTime":"200ms"}}]}`,
+		OutlierDetectionName)
+	r, err := registry.NewEtcdRegistryWithConfig(srv.ClientConfig(), 5,
+		registry.WithMetrics(metrics), registry.WithServiceConfig(outlierConfig))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	defer r.Close()
+	for _, addr := range []string{healthy.addr, failing} {
+		if err := r.RegisterService(&registry.ServiceInfo{Name: "orders", Address: addr}); err != nil {
+			t.Fatalf("register: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	conn, err := r.Dial(ctx, "orders", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	// 摘除200ms后到期，之后的请求触发恢复
+	const target = "etcd:///orders"
+	for metrics.get(MetricOutlierEjections, target, failing) == 0 ||
+		metrics.get(MetricOutlierReadmissions, target, failing) == 0 {
+		if ctx.Err() != nil {
+			t.Fatalf("ejections %v, readmissions %v before the deadline",
+				metrics.get(MetricOutlierEjections, target, failing), metrics.get(MetricOutlierReadmissions, target, failing))
+		}
+		client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true))
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := metrics.get(MetricOutlierEjections, target, healthy.addr); got != 0 {
+		t.Errorf("ejections of the healthy instance: got %v, want 0", got)
+	}
+}
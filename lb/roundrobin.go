@@ -0,0 +1,40 @@
+// lb/roundrobin.go
+package lb
+
+import (
+	"math/rand"
+	"sync/atomic"
+
+	"google.golang.org/grpc/balancer"
+)
+
+// roundRobinName 作为子策略使用的轮询名称，与grpc内置round_robin行为一致
+const roundRobinName = "round_robin"
+
+// rrPickerBuilder 构造轮询picker
+type rrPickerBuilder struct{}
+
+func (rrPickerBuilder) build(info buildInfo) balancer.Picker {
+	return newRRPicker(info.ready)
+}
+
+// rrPicker 轮询picker，起始位置随机以免所有客户端同时压在第一个实例上
+type rrPicker struct {
+	subConns []balancer.SubConn
+	next     atomic.Uint32
+}
+
+func newRRPicker(ready []readySubConn) *rrPicker {
+	p := &rrPicker{subConns: make([]balancer.SubConn, 0, len(ready))}
+	for _, r := range ready {
+		p.subConns = append(p.subConns, r.subConn)
+	}
+	p.next.Store(uint32(rand.Intn(len(ready))))
+	return p
+}
+
+// Pick 实现balancer.Picker接口
+func (p *rrPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	n := p.next.Add(1)
+	return balancer.PickResult{SubConn: p.subConns[n%uint32(len(p.subConns))]}, nil
+}
@@ -0,0 +1,203 @@
+// lb/sticky.go
+package lb
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// StickySessionName 会话粘滞balancer名称
+const StickySessionName = "etcd_sticky_session"
+
+// defaultMaxSessions 默认最多保存的会话分配数
+const defaultMaxSessions = 10000
+
+func init() {
+	register(StickySessionName, func() pickerBuilder {
+		return &stickyPickerBuilder{sessions: list.New(), index: make(map[string]*list.Element)}
+	}, parseStickyConfig)
+}
+
+// StickySessionConfig 会话粘滞配置，例如
+// {"loadBalancingConfig":[{"etcd_sticky_session":{"sessionHeader":"session-id"}}]}
+type StickySessionConfig struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+
+	// SessionHeader 读取会话标识的outgoing metadata名称，默认session-id
+	SessionHeader string `json:"sessionHeader,omitempty"`
+	// MaxSessions 最多保存的会话分配数，超出时淘汰最久未使用的会话，默认10000
+	MaxSessions int `json:"maxSessions,omitempty"`
+	// ChildPolicy 为新会话和无会话请求选择实例的子策略，默认round_robin
+	ChildPolicy string `json:"childPolicy,omitempty"`
+	// ChildConfig 子策略配置
+	ChildConfig json.RawMessage `json:"childConfig,omitempty"`
+
+	child *childPolicyConfig
+}
+
+func parseStickyConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	cfg := &StickySessionConfig{}
+	if len(js) > 0 {
+		if err := json.Unmarshal(js, cfg); err != nil {
+			return nil, fmt.Errorf("%s: invalid config: %v", StickySessionName, err)
+		}
+	}
+	if err := cfg.init(); err != nil {
+		return nil, fmt.Errorf("%s: %v", StickySessionName, err)
+	}
+	return cfg, nil
+}
+
+func (c *StickySessionConfig) init() error {
+	if c.SessionHeader == "" {
+		c.SessionHeader = "session-id"
+	}
+	if c.MaxSessions == 0 {
+		c.MaxSessions = defaultMaxSessions
+	}
+	if c.MaxSessions < 0 {
+		return fmt.Errorf("maxSessions must not be negative")
+	}
+	var err error
+	c.child, err = parseChildPolicy(c.ChildPolicy, c.ChildConfig)
+	return err
+}
+
+var (
+	stickySessions      atomic.Int64
+	stickyReassignments atomic.Uint64
+)
+
+// StickySessionStats 返回所有会话粘滞balancer当前保存的会话数和累计重新分配次数
+func StickySessionStats() (sessions int64, reassignments uint64) {
+	return stickySessions.Load(), stickyReassignments.Load()
+}
+
+type stickySession struct {
+	id      string
+	address string
+}
+
+// stickyPickerBuilder 在多次构造之间保存会话到地址的LRU分配表
+type stickyPickerBuilder struct {
+	mu       sync.Mutex
+	cfg      *StickySessionConfig
+	child    *childPolicy
+	sessions *list.List
+	index    map[string]*list.Element
+	ready    map[string]balancer.SubConn
+	keys     map[balancer.SubConn]string
+	picker   balancer.Picker
+}
+
+func (b *stickyPickerBuilder) build(info buildInfo) balancer.Picker {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cfg, _ := info.config.(*StickySessionConfig)
+	if cfg == nil {
+		cfg = &StickySessionConfig{}
+		cfg.init()
+	}
+	b.cfg = cfg
+	b.child = cfg.child.ensure(b.child)
+
+	b.ready = make(map[string]balancer.SubConn, len(info.ready))
+	b.keys = make(map[balancer.SubConn]string, len(info.ready))
+	for _, ready := range info.ready {
+		key := addressKey(ready.address)
+		b.ready[key] = ready.subConn
+		b.keys[ready.subConn] = key
+	}
+	b.picker = b.child.build(info, info.ready)
+	b.evictLocked()
+	return &stickyPicker{builder: b, header: cfg.SessionHeader}
+}
+
+// evictLocked 淘汰超出上限的会话，调用方需持有b.mu
+func (b *stickyPickerBuilder) evictLocked() {
+	for b.sessions.Len() > b.cfg.MaxSessions {
+		oldest := b.sessions.Back()
+		b.sessions.Remove(oldest)
+		delete(b.index, oldest.Value.(*stickySession).id)
+		stickySessions.Add(-1)
+	}
+}
+
+// close 实现pickerCloser接口，balancer关闭时清空分配表并从全局统计中移除
+func (b *stickyPickerBuilder) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stickySessions.Add(-int64(b.sessions.Len()))
+	b.sessions.Init()
+	b.index = make(map[string]*list.Element)
+}
+
+// stickyPicker 同一会话的请求固定发往同一实例，该实例离开READY集合时通过子策略重新分配
+type stickyPicker struct {
+	builder *stickyPickerBuilder
+	header  string
+}
+
+// Pick 实现balancer.Picker接口
+func (p *stickyPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	b := p.builder
+	md, _ := metadata.FromOutgoingContext(info.Ctx)
+	values := md.Get(p.header)
+	if len(values) == 0 || values[0] == "" {
+		b.mu.Lock()
+		picker := b.picker
+		b.mu.Unlock()
+		return picker.Pick(info)
+	}
+	id := values[0]
+
+	b.mu.Lock()
+	if elem, ok := b.index[id]; ok {
+		if sc, ok := b.ready[elem.Value.(*stickySession).address]; ok {
+			b.sessions.MoveToFront(elem)
+			b.mu.Unlock()
+			return balancer.PickResult{SubConn: sc}, nil
+		}
+	}
+	picker := b.picker
+	b.mu.Unlock()
+
+	// 子策略在锁外选择，新会话和需要重新分配的会话不阻塞其他请求
+	result, err := picker.Pick(info)
+	if err != nil {
+		return result, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.assignLocked(id, b.keys[result.SubConn])
+	return result, nil
+}
+
+// assignLocked 将会话id分配到地址key，调用方需持有b.mu
+func (b *stickyPickerBuilder) assignLocked(id, key string) {
+	if key == "" {
+		// 选择期间子连接已离开READY集合，下次请求重新分配
+		return
+	}
+	if elem, ok := b.index[id]; ok {
+		session := elem.Value.(*stickySession)
+		if session.address != key {
+			session.address = key
+			stickyReassignments.Add(1)
+		}
+		b.sessions.MoveToFront(elem)
+		return
+	}
+	b.index[id] = b.sessions.PushFront(&stickySession{id: id, address: key})
+	stickySessions.Add(1)
+	b.evictLocked()
+}
@@ -0,0 +1,52 @@
+// lb/sticky_test.go
+package lb
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/YuanJey/grpc-etcd/registry"
+)
+
+// pickSession 使用会话id执行一次Pick，返回选中的地址
+func pickSession(t *testing.T, p balancer.Picker, id string) string {
+	t.Helper()
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "session-id", id)
+	result, err := p.Pick(balancer.PickInfo{Ctx: ctx})
+	if err != nil {
+		t.Fatalf("pick %s: %v", id, err)
+	}
+	return result.SubConn.(*fakeSubConn).addr
+}
+
+func TestStickySessionsReleasedOnClose(t *testing.T) {
+	a := &registry.ServiceInfo{Name: "svc", Address: "10.0.0.1:80"}
+	b := &registry.ServiceInfo{Name: "svc", Address: "10.0.0.2:80"}
+	builder := &stickyPickerBuilder{sessions: list.New(), index: make(map[string]*list.Element)}
+	p := builder.build(newBuildInfo(make(map[string]*fakeSubConn), a, b))
+
+	for i := range 10 {
+		id := fmt.Sprint("session-", i)
+		if first, again := pickSession(t, p, id), pickSession(t, p, id); first != again {
+			t.Errorf("%s: picked %s then %s", id, first, again)
+		}
+	}
+	// 无会话标识的请求交给子策略，不记录会话
+	pickCounts(t, p, 4, true)
+	if sessions, _ := StickySessionStats(); sessions != 10 {
+		t.Errorf("sessions: got %d, want 10", sessions)
+	}
+
+	builder.close()
+	if sessions, _ := StickySessionStats(); sessions != 0 {
+		t.Errorf("sessions after close: got %d, want 0", sessions)
+	}
+	if builder.sessions.Len() != 0 || len(builder.index) != 0 {
+		t.Errorf("session table not cleared: %d entries, %d indexed", builder.sessions.Len(), len(builder.index))
+	}
+}
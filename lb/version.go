@@ -0,0 +1,98 @@
+// lb/version.go
+package lb
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/YuanJey/grpc-etcd/registry"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// VersionRoutingName 按单次RPC指定版本路由的balancer名称
+const VersionRoutingName = "etcd_version_routing"
+
+func init() {
+	register(VersionRoutingName, func() pickerBuilder {
+		return &versionPickerBuilder{}
+	}, parseVersionConfig)
+}
+
+// VersionRoutingConfig 版本路由配置，例如
+// {"loadBalancingConfig":[{"etcd_version_routing":{"childPolicy":"etcd_canary","childConfig":{"splits":{"v2":5}}}}]}
+// 请求通过registry.WithTargetVersion指定版本时只发往该版本的实例，
+// 未指定或该版本没有READY实例时交给子策略；与etcd_canary组合时显式指定的版本优先于比例划分
+type VersionRoutingConfig struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+
+	// ChildPolicy 未指定版本时使用的子策略，默认round_robin
+	ChildPolicy string `json:"childPolicy,omitempty"`
+	// ChildConfig 子策略配置
+	ChildConfig json.RawMessage `json:"childConfig,omitempty"`
+
+	child *childPolicyConfig
+}
+
+func parseVersionConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	cfg := &VersionRoutingConfig{}
+	if len(js) > 0 {
+		if err := json.Unmarshal(js, cfg); err != nil {
+			return nil, fmt.Errorf("%s: invalid config: %v", VersionRoutingName, err)
+		}
+	}
+	var err error
+	if cfg.child, err = parseChildPolicy(cfg.ChildPolicy, cfg.ChildConfig); err != nil {
+		return nil, fmt.Errorf("%s: %v", VersionRoutingName, err)
+	}
+	return cfg, nil
+}
+
+type versionPickerBuilder struct {
+	child *childPolicy
+}
+
+func (b *versionPickerBuilder) build(info buildInfo) balancer.Picker {
+	cfg, _ := info.config.(*VersionRoutingConfig)
+	if cfg == nil {
+		cfg = &VersionRoutingConfig{}
+		cfg.child, _ = parseChildPolicy("", nil)
+	}
+	b.child = cfg.child.ensure(b.child)
+
+	return &versionPicker{
+		byVersion: groupByVersion(info.ready),
+		fallback:  b.child.build(info, info.ready),
+	}
+}
+
+// groupByVersion 按实例版本分组并为每组构造轮询picker
+func groupByVersion(ready []readySubConn) map[string]*rrPicker {
+	groups := make(map[string][]readySubConn)
+	for _, r := range ready {
+		if service, ok := registry.ServiceInfoFromAddress(r.address); ok {
+			groups[service.Version] = append(groups[service.Version], r)
+		}
+	}
+	pickers := make(map[string]*rrPicker, len(groups))
+	for version, group := range groups {
+		pickers[version] = newRRPicker(group)
+	}
+	return pickers
+}
+
+// versionPicker 优先按请求指定的版本选择实例
+type versionPicker struct {
+	byVersion map[string]*rrPicker
+	fallback  balancer.Picker
+}
+
+// Pick 实现balancer.Picker接口
+func (p *versionPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	if version, ok := registry.TargetVersionFromContext(info.Ctx); ok {
+		if picker, ok := p.byVersion[version]; ok {
+			return picker.Pick(info)
+		}
+	}
+	return p.fallback.Pick(info)
+}
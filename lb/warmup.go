@@ -0,0 +1,100 @@
+// lb/warmup.go
+package lb
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// WarmUpName 预连接balancer名称
+const WarmUpName = "etcd_warm_up"
+
+func init() {
+	register(WarmUpName, func() pickerBuilder { return &warmUpPickerBuilder{} }, parseWarmUpConfig)
+}
+
+// WarmUpConfig 预连接配置，例如
+// {"loadBalancingConfig":[{"etcd_warm_up":{"childPolicy":"etcd_weighted_round_robin"}}]}
+// resolver推送新地址后立即与每个地址建立连接，连接断开后自动重连，
+// 请求只交给已建立连接的实例，新实例不会承担首次建连的延迟
+type WarmUpConfig struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+
+	// ChildPolicy 在已建立连接的实例中选择的子策略，默认round_robin
+	ChildPolicy string `json:"childPolicy,omitempty"`
+	// ChildConfig 子策略配置
+	ChildConfig json.RawMessage `json:"childConfig,omitempty"`
+
+	child *childPolicyConfig
+}
+
+func parseWarmUpConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	cfg := &WarmUpConfig{}
+	if len(js) > 0 {
+		if err := json.Unmarshal(js, cfg); err != nil {
+			return nil, fmt.Errorf("%s: invalid config: %v", WarmUpName, err)
+		}
+	}
+	if err := cfg.init(); err != nil {
+		return nil, fmt.Errorf("%s: %v", WarmUpName, err)
+	}
+	return cfg, nil
+}
+
+func (c *WarmUpConfig) init() error {
+	var err error
+	c.child, err = parseChildPolicy(c.ChildPolicy, c.ChildConfig)
+	return err
+}
+
+var (
+	warmConns atomic.Int64
+	coldConns atomic.Int64
+)
+
+// WarmUpStats 返回所有预连接balancer当前已建立（warm）和尚未建立（cold）的连接数
+func WarmUpStats() (warm, cold int64) {
+	return warmConns.Load(), coldConns.Load()
+}
+
+// warmUpPickerBuilder 将本balancer的连接数计入全局统计，选择交给子策略
+type warmUpPickerBuilder struct {
+	mu    sync.Mutex
+	child *childPolicy
+	warm  int64
+	cold  int64
+}
+
+func (b *warmUpPickerBuilder) build(info buildInfo) balancer.Picker {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cfg, _ := info.config.(*WarmUpConfig)
+	if cfg == nil {
+		cfg = &WarmUpConfig{}
+		cfg.init()
+	}
+	b.child = cfg.child.ensure(b.child)
+	return b.child.build(info, info.ready)
+}
+
+// observe 实现subConnObserver接口
+func (b *warmUpPickerBuilder) observe(total, ready int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	warm, cold := int64(ready), int64(total-ready)
+	warmConns.Add(warm - b.warm)
+	coldConns.Add(cold - b.cold)
+	b.warm, b.cold = warm, cold
+}
+
+// close 实现pickerCloser接口，balancer关闭时从全局统计中移除
+func (b *warmUpPickerBuilder) close() {
+	b.observe(0, 0)
+}
@@ -0,0 +1,97 @@
+// lb/wrr.go
+package lb
+
+import (
+	"sync"
+
+	"github.com/YuanJey/grpc-etcd/registry"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/resolver"
+)
+
+// WeightedRoundRobinName 平滑加权轮询balancer名称
+const WeightedRoundRobinName = "etcd_weighted_round_robin"
+
+func init() {
+	register(WeightedRoundRobinName, func() pickerBuilder {
+		return &wrrPickerBuilder{}
+	}, nil)
+}
+
+// addressWeight 读取地址上的权重属性，未设置或非正数时为1
+func addressWeight(addr resolver.Address) int64 {
+	if service, ok := registry.ServiceInfoFromAddress(addr); ok && service.Weight > 0 {
+		return int64(service.Weight)
+	}
+	return 1
+}
+
+// wrrPickerBuilder 构造平滑加权轮询picker
+// 重建picker时沿用上一个picker各地址的当前权重，地址增减不会打乱其余地址的相对顺序
+type wrrPickerBuilder struct {
+	last *wrrPicker
+}
+
+func (b *wrrPickerBuilder) build(info buildInfo) balancer.Picker {
+	var previous map[string]int64
+	if b.last != nil {
+		previous = b.last.currentWeights()
+	}
+
+	p := &wrrPicker{}
+	for _, ready := range info.ready {
+		key := addressKey(ready.address)
+		weight := addressWeight(ready.address)
+		p.entries = append(p.entries, &wrrEntry{
+			key:     key,
+			subConn: ready.subConn,
+			weight:  weight,
+			current: previous[key],
+		})
+		p.total += weight
+	}
+	b.last = p
+	return p
+}
+
+type wrrEntry struct {
+	key     string
+	subConn balancer.SubConn
+	weight  int64
+	current int64
+}
+
+// wrrPicker 平滑加权轮询（nginx算法）：每次为所有地址累加权重，
+// 选出当前权重最大的地址并减去总权重，使选择在时间上均匀分散
+type wrrPicker struct {
+	mu      sync.Mutex
+	entries []*wrrEntry
+	total   int64
+}
+
+// Pick 实现balancer.Picker接口
+func (p *wrrPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var best *wrrEntry
+	for _, entry := range p.entries {
+		entry.current += entry.weight
+		if best == nil || entry.current > best.current {
+			best = entry
+		}
+	}
+	best.current -= p.total
+	return balancer.PickResult{SubConn: best.subConn}, nil
+}
+
+func (p *wrrPicker) currentWeights() map[string]int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	weights := make(map[string]int64, len(p.entries))
+	for _, entry := range p.entries {
+		weights[entry.key] = entry.current
+	}
+	return weights
+}
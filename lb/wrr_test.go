@@ -0,0 +1,110 @@
+// lb/wrr_test.go
+package lb
+
+import (
+	"context"
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/YuanJey/grpc-etcd/registry"
+)
+
+// expectShares 检查counts中各地址的占比与weights一致，误差不超过tolerance
+func expectShares(t *testing.T, counts map[string]int, weights map[string]int, tolerance float64) {
+	t.Helper()
+	var picks, total int
+	for _, n := range counts {
+		picks += n
+	}
+	for _, w := range weights {
+		total += w
+	}
+	for addr, w := range weights {
+		got := float64(counts[addr]) / float64(picks)
+		want := float64(w) / float64(total)
+		if math.Abs(got-want) > tolerance {
+			t.Errorf("%s: share %.3f, want %.3f (counts %v)", addr, got, want, counts)
+		}
+	}
+}
+
+func TestWRRDistribution(t *testing.T) {
+	subConns := make(map[string]*fakeSubConn)
+	// 权重为0或未设置时按1处理
+	info := newBuildInfo(subConns,
+		&registry.ServiceInfo{Name: "svc", Address: "10.0.0.1:80", Weight: 5},
+		&registry.ServiceInfo{Name: "svc", Address: "10.0.0.2:80", Weight: 3},
+		&registry.ServiceInfo{Name: "svc", Address: "10.0.0.3:80", Weight: 1},
+		&registry.ServiceInfo{Name: "svc", Address: "10.0.0.4:80"})
+	p := (&wrrPickerBuilder{}).build(info)
+	counts := pickCounts(t, p, 1000, true)
+	expectShares(t, counts, map[string]int{"10.0.0.1:80": 5, "10.0.0.2:80": 3, "10.0.0.3:80": 1, "10.0.0.4:80": 1}, 0.01)
+}
+
+func TestWRRSmooth(t *testing.T) {
+	subConns := make(map[string]*fakeSubConn)
+	info := newBuildInfo(subConns,
+		&registry.ServiceInfo{Name: "svc", Address: "a:80", Weight: 5},
+		&registry.ServiceInfo{Name: "svc", Address: "b:80", Weight: 1},
+		&registry.ServiceInfo{Name: "svc", Address: "c:80", Weight: 1})
+	p := (&wrrPickerBuilder{}).build(info)
+
+	// 平滑加权轮询的一个周期，低权重地址穿插在高权重地址之间而不是集中在末尾
+	var got []string
+	for range 7 {
+		result, err := p.Pick(balancer.PickInfo{Ctx: context.Background()})
+		if err != nil {
+			t.Fatalf("pick: %v", err)
+		}
+		got = append(got, result.SubConn.(*fakeSubConn).addr)
+	}
+	want := []string{"a:80", "a:80", "b:80", "a:80", "c:80", "a:80", "a:80"}
+	if !slices.Equal(got, want) {
+		t.Errorf("pick sequence: got %v, want %v", got, want)
+	}
+}
+
+func TestWRRRebuildKeepsRemainingShares(t *testing.T) {
+	subConns := make(map[string]*fakeSubConn)
+	b := &wrrPickerBuilder{}
+	a := &registry.ServiceInfo{Name: "svc", Address: "10.0.0.1:80", Weight: 3}
+	c := &registry.ServiceInfo{Name: "svc", Address: "10.0.0.2:80", Weight: 1}
+	removed := &registry.ServiceInfo{Name: "svc", Address: "10.0.0.3:80", Weight: 2}
+	pickCounts(t, b.build(newBuildInfo(subConns, a, c, removed)), 7, true)
+
+	// 删除一个地址后其余地址的当前权重得以保留，长期分布仍与权重一致
+	counts := pickCounts(t, b.build(newBuildInfo(subConns, a, c)), 400, true)
+	expectShares(t, counts, map[string]int{a.Address: 3, c.Address: 1}, 0.01)
+	if counts[removed.Address] != 0 {
+		t.Errorf("removed address picked %d times", counts[removed.Address])
+	}
+}
+
+func TestWRRBalancerFollowsWeights(t *testing.T) {
+	heavy, light := startBackend(t, 0), startBackend(t, 0)
+	client, _ := dialPolicy(t, WeightedRoundRobinName,
+		&registry.ServiceInfo{Name: "svc", Address: heavy.addr, Weight: 3},
+		&registry.ServiceInfo{Name: "svc", Address: light.addr, Weight: 1})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// 等待两个子连接都就绪后再计数
+	for heavy.count() == 0 || light.count() == 0 {
+		if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true)); err != nil {
+			t.Fatalf("check: %v", err)
+		}
+	}
+	heavyBefore, lightBefore := heavy.count(), light.count()
+	for range 400 {
+		if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+			t.Fatalf("check: %v", err)
+		}
+	}
+	counts := map[string]int{heavy.addr: heavy.count() - heavyBefore, light.addr: light.count() - lightBefore}
+	expectShares(t, counts, map[string]int{heavy.addr: 3, light.addr: 1}, 0.02)
+}
@@ -0,0 +1,139 @@
+// lb/zone.go
+package lb
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/YuanJey/grpc-etcd/registry"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// ZoneAffinityName 同可用区优先balancer名称
+const ZoneAffinityName = "etcd_zone_affinity"
+
+// LocalZoneEnv 未在配置中指定localZone时读取客户端所在可用区的环境变量
+const LocalZoneEnv = "GRPC_ETCD_LOCAL_ZONE"
+
+func init() {
+	register(ZoneAffinityName, func() pickerBuilder {
+		return &zonePickerBuilder{}
+	}, parseZoneConfig)
+}
+
+// ZoneAffinityConfig 同可用区优先配置，例如
+// {"loadBalancingConfig":[{"etcd_zone_affinity":{"localZone":"az1","maxLocalInFlight":64}}]}
+type ZoneAffinityConfig struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+
+	// LocalZone 客户端所在可用区，为空时读取环境变量GRPC_ETCD_LOCAL_ZONE
+	LocalZone string `json:"localZone,omitempty"`
+	// MaxLocalInFlight 本区每个READY实例的平均在途请求数超过该值时溢出到其他可用区，0表示不溢出
+	MaxLocalInFlight int64 `json:"maxLocalInFlight,omitempty"`
+}
+
+func parseZoneConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	cfg := &ZoneAffinityConfig{}
+	if len(js) > 0 {
+		if err := json.Unmarshal(js, cfg); err != nil {
+			return nil, fmt.Errorf("%s: invalid config: %v", ZoneAffinityName, err)
+		}
+	}
+	if cfg.MaxLocalInFlight < 0 {
+		return nil, fmt.Errorf("%s: maxLocalInFlight must not be negative", ZoneAffinityName)
+	}
+	if cfg.LocalZone == "" {
+		cfg.LocalZone = os.Getenv(LocalZoneEnv)
+	}
+	return cfg, nil
+}
+
+// 同可用区优先balancer的选择计数，通过resolver.State携带的注册中心指标接收器（见registry.MetricsFromState）上报，
+// 即registry.WithMetrics设置的接收器，未设置时不上报
+const (
+	// MetricZoneAffinityPicks 选择次数，标签为LabelTarget和LabelZone
+	MetricZoneAffinityPicks = "lb_zone_affinity_picks_total"
+	// LabelTarget 拨号target，例如 etcd:///svc
+	LabelTarget = "target"
+	// LabelZone 选择的实例是否与客户端同区，取值为ZoneLocal或ZoneRemote
+	LabelZone  = "zone"
+	ZoneLocal  = "local"
+	ZoneRemote = "remote"
+)
+
+// zonePickerBuilder 在多次构造之间共享本区在途请求计数
+type zonePickerBuilder struct {
+	localInFlight atomic.Int64
+}
+
+func (b *zonePickerBuilder) build(info buildInfo) balancer.Picker {
+	cfg, _ := info.config.(*ZoneAffinityConfig)
+	if cfg == nil {
+		cfg = &ZoneAffinityConfig{LocalZone: os.Getenv(LocalZoneEnv)}
+	}
+
+	var local, remote []readySubConn
+	for _, ready := range info.ready {
+		if service, ok := registry.ServiceInfoFromAddress(ready.address); ok && cfg.LocalZone != "" && service.Zone == cfg.LocalZone {
+			local = append(local, ready)
+		} else {
+			remote = append(remote, ready)
+		}
+	}
+
+	p := &zonePicker{
+		inFlight:    &b.localInFlight,
+		maxInFlight: cfg.MaxLocalInFlight * int64(len(local)),
+	}
+	if metrics, ok := registry.MetricsFromState(info.attributes); ok {
+		p.metrics = metrics
+		p.localLabels = map[string]string{LabelTarget: info.target, LabelZone: ZoneLocal}
+		p.remoteLabels = map[string]string{LabelTarget: info.target, LabelZone: ZoneRemote}
+	}
+	if len(local) > 0 {
+		p.local = newRRPicker(local)
+	}
+	if len(remote) > 0 {
+		p.remote = newRRPicker(remote)
+	}
+	return p
+}
+
+// zonePicker 优先选择本区READY实例，本区没有可用实例或超过溢出阈值时才跨区
+type zonePicker struct {
+	local       *rrPicker
+	remote      *rrPicker
+	inFlight    *atomic.Int64
+	maxInFlight int64
+	// metrics 为nil时不上报选择计数
+	metrics      registry.Metrics
+	localLabels  map[string]string
+	remoteLabels map[string]string
+}
+
+// Pick 实现balancer.Picker接口
+func (p *zonePicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	overflow := p.maxInFlight > 0 && p.inFlight.Load() >= p.maxInFlight
+	if p.local != nil && (!overflow || p.remote == nil) {
+		result, err := p.local.Pick(info)
+		if err != nil {
+			return result, err
+		}
+		p.count(p.localLabels)
+		p.inFlight.Add(1)
+		result.Done = func(balancer.DoneInfo) { p.inFlight.Add(-1) }
+		return result, nil
+	}
+	p.count(p.remoteLabels)
+	return p.remote.Pick(info)
+}
+
+// count 上报一次选择
+func (p *zonePicker) count(labels map[string]string) {
+	if p.metrics != nil {
+		p.metrics.IncCounter(MetricZoneAffinityPicks, labels, 1)
+	}
+}
@@ -0,0 +1,111 @@
+// lb/zone_test.go
+package lb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/YuanJey/grpc-etcd/etcdtest"
+	"github.com/YuanJey/grpc-etcd/registry"
+)
+
+// counterRecorder 记录计数器的registry.Metrics实现
+type counterRecorder struct {
+	mu       sync.Mutex
+	counters map[string]float64
+}
+
+func (m *counterRecorder) IncCounter(name string, labels map[string]string, delta float64) {
+	if name != MetricZoneAffinityPicks {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.counters == nil {
+		m.counters = make(map[string]float64)
+	}
+	m.counters[labels[LabelTarget]+" "+labels[LabelZone]] += delta
+}
+
+func (m *counterRecorder) SetGauge(string, map[string]string, float64)         {}
+func (m *counterRecorder) ObserveHistogram(string, map[string]string, float64) {}
+
+func (m *counterRecorder) get(target, zone string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counters[target+" "+zone]
+}
+
+func TestZoneAffinityPicksReportedPerTarget(t *testing.T) {
+	local := startBackend(t, 0)
+	remote := startBackend(t, 0)
+	srv := etcdtest.Start(t)
+	metrics := &counterRecorder{}
+	// 注册中心默认下发round_robin服务配置，会覆盖拨号时的默认配置，因此通过WithServiceConfig指定策略
+	zoneConfig := fmt.Sprintf(`{"loadBalancingConfig":[{%q:{"localZone":"az1"}}]}`, ZoneAffinityName)
+	r, err := registry.NewEtcdRegistryWithConfig(srv.ClientConfig(), 5,
+		registry.WithMetrics(metrics), registry.WithServiceConfig(zoneConfig))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	defer r.Close()
+	for _, service := range []string{"orders", "users"} {
+		for _, info := range []*registry.ServiceInfo{
+			{Name: service, Address: local.addr, Zone: "az1"},
+			{Name: service, Address: remote.addr, Zone: "az2"},
+		} {
+			if err := r.RegisterService(info); err != nil {
+				t.Fatalf("register: %v", err)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	call := func(service string, n int) {
+		t.Helper()
+		conn, err := r.Dial(ctx, service, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatalf("dial %s: %v", service, err)
+		}
+		defer conn.Close()
+		client := healthpb.NewHealthClient(conn)
+		for range n {
+			if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true)); err != nil {
+				t.Fatalf("check %s: %v", service, err)
+			}
+		}
+	}
+	call("orders", 20)
+	call("users", 5)
+
+	// 本区子连接先就绪前的少数请求可能跨区，两个target的计数互不累加
+	picks := func(target string) float64 {
+		return metrics.get(target, ZoneLocal) + metrics.get(target, ZoneRemote)
+	}
+	if got := picks("etcd:///orders"); got != 20 {
+		t.Errorf("orders picks: got %v, want 20", got)
+	}
+	if got := picks("etcd:///users"); got != 5 {
+		t.Errorf("users picks: got %v, want 5", got)
+	}
+	if got := metrics.get("etcd:///orders", ZoneLocal); got < 10 {
+		t.Errorf("orders local picks: got %v, want most of 20", got)
+	}
+
+	// 本区没有实例时跨区
+	if err := r.Unregister("users", local.addr); err != nil {
+		t.Fatalf("unregister: %v", err)
+	}
+	call("users", 5)
+	if got := metrics.get("etcd:///users", ZoneRemote); got < 5 {
+		t.Errorf("users remote picks after the local zone left: got %v, want at least 5", got)
+	}
+}
@@ -0,0 +1,10 @@
+// Package logadapter 将常用日志库适配为registry.Logger
+//
+// 典型用法：
+//
+//	reg, err := registry.NewEtcdRegistry(addrs, ttl, registry.WithLogger(logadapter.Slog(slog.Default())))
+//	reg, err := registry.NewEtcdRegistry(addrs, ttl, registry.WithLogger(logadapter.Zap(zapLogger)))
+//	reg, err := registry.NewEtcdRegistry(addrs, ttl, registry.WithLogger(logadapter.Logrus(logrus.StandardLogger())))
+//
+// 高频日志可以配合registry.WithLogSampling按日志位置采样
+package logadapter
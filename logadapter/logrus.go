@@ -0,0 +1,51 @@
+// logadapter/logrus.go
+package logadapter
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/YuanJey/grpc-etcd/registry"
+)
+
+// badKey 键值对数量为奇数或键不是字符串时使用的键，与slog一致
+const badKey = "!BADKEY"
+
+// logrusLogger 将键值对转换为logrus.Fields输出
+type logrusLogger struct {
+	logger logrus.FieldLogger
+}
+
+// Logrus 将logrus.FieldLogger（*logrus.Logger或*logrus.Entry）适配为registry.Logger，logger为nil时使用logrus.StandardLogger
+func Logrus(logger logrus.FieldLogger) registry.Logger {
+	if logger == nil {
+		logger = logrus.StandardLogger()
+	}
+	return logrusLogger{logger: logger}
+}
+
+func (l logrusLogger) Debug(msg string, keyvals ...any) { l.with(keyvals).Debug(msg) }
+func (l logrusLogger) Info(msg string, keyvals ...any)  { l.with(keyvals).Info(msg) }
+func (l logrusLogger) Warn(msg string, keyvals ...any)  { l.with(keyvals).Warn(msg) }
+func (l logrusLogger) Error(msg string, keyvals ...any) { l.with(keyvals).Error(msg) }
+
+// with 将交替出现的键和值转换为logrus.Fields
+func (l logrusLogger) with(keyvals []any) logrus.FieldLogger {
+	if len(keyvals) == 0 {
+		return l.logger
+	}
+	fields := make(logrus.Fields, (len(keyvals)+1)/2)
+	for i := 0; i < len(keyvals); i += 2 {
+		if i+1 == len(keyvals) {
+			fields[badKey] = keyvals[i]
+			break
+		}
+		key, ok := keyvals[i].(string)
+		if !ok {
+			key = fmt.Sprint(keyvals[i])
+		}
+		fields[key] = keyvals[i+1]
+	}
+	return l.logger.WithFields(fields)
+}
@@ -0,0 +1,16 @@
+// logadapter/slog.go
+package logadapter
+
+import (
+	"log/slog"
+
+	"github.com/YuanJey/grpc-etcd/registry"
+)
+
+// Slog 将slog.Logger适配为registry.Logger，logger为nil时使用slog.Default()
+func Slog(logger *slog.Logger) registry.Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return logger
+}
@@ -0,0 +1,27 @@
+// logadapter/zap.go
+package logadapter
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/YuanJey/grpc-etcd/registry"
+)
+
+// zapLogger 通过SugaredLogger的*w方法输出键值对
+type zapLogger struct {
+	sugar *zap.SugaredLogger
+}
+
+// Zap 将zap.Logger适配为registry.Logger，logger为nil时丢弃所有日志
+func Zap(logger *zap.Logger) registry.Logger {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	// 跳过适配层，调用位置指向注册中心内部
+	return zapLogger{sugar: logger.WithOptions(zap.AddCallerSkip(1)).Sugar()}
+}
+
+func (l zapLogger) Debug(msg string, keyvals ...any) { l.sugar.Debugw(msg, keyvals...) }
+func (l zapLogger) Info(msg string, keyvals ...any)  { l.sugar.Infow(msg, keyvals...) }
+func (l zapLogger) Warn(msg string, keyvals ...any)  { l.sugar.Warnw(msg, keyvals...) }
+func (l zapLogger) Error(msg string, keyvals ...any) { l.sugar.Errorw(msg, keyvals...) }
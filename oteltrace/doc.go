@@ -0,0 +1,7 @@
+// Package oteltrace 通过OpenTelemetry追踪注册中心操作
+//
+// 典型用法：
+//
+//	reg, err := registry.NewEtcdRegistry(addrs, ttl, registry.WithTracer(oteltrace.New(otel.GetTracerProvider())))
+//	err = reg.RegisterServiceContext(ctx, info)
+package oteltrace
@@ -0,0 +1,92 @@
+// oteltrace/tracer.go
+package oteltrace
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/YuanJey/grpc-etcd/registry"
+)
+
+// InstrumentationName 创建otel Tracer使用的名称
+const InstrumentationName = "github.com/YuanJey/grpc-etcd/registry"
+
+// tracer 将registry.Tracer适配到otel
+type tracer struct {
+	tracer trace.Tracer
+}
+
+// New 使用provider创建registry.Tracer，provider为nil时使用otel全局的TracerProvider
+func New(provider trace.TracerProvider) registry.Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return tracer{tracer: provider.Tracer(InstrumentationName)}
+}
+
+// Start 实现registry.Tracer接口
+// ctx中没有父span时创建根span，links中有效的span上下文作为链接加入
+func (t tracer) Start(ctx context.Context, name string, links ...context.Context) (context.Context, registry.Span) {
+	opts := []trace.SpanStartOption{trace.WithSpanKind(trace.SpanKindClient)}
+	for _, link := range links {
+		if link == nil {
+			continue
+		}
+		if sc := trace.SpanContextFromContext(link); sc.IsValid() {
+			opts = append(opts, trace.WithLinks(trace.Link{SpanContext: sc}))
+		}
+	}
+	ctx, span := t.tracer.Start(ctx, name, opts...)
+	return ctx, otelSpan{span: span}
+}
+
+// otelSpan 将registry.Span适配到otel
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s otelSpan) SetAttributes(keyvals ...any) {
+	s.span.SetAttributes(attributes(keyvals)...)
+}
+
+func (s otelSpan) AddEvent(name string, keyvals ...any) {
+	s.span.AddEvent(name, trace.WithAttributes(attributes(keyvals)...))
+}
+
+func (s otelSpan) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+// attributes 将交替出现的键和值转换为otel属性，键统一加上 registry. 前缀
+func attributes(keyvals []any) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(keyvals)/2)
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		key := attribute.Key("registry." + fmt.Sprint(keyvals[i]))
+		switch v := keyvals[i+1].(type) {
+		case string:
+			attrs = append(attrs, key.String(v))
+		case bool:
+			attrs = append(attrs, key.Bool(v))
+		case int:
+			attrs = append(attrs, key.Int(v))
+		case int64:
+			attrs = append(attrs, key.Int64(v))
+		case float64:
+			attrs = append(attrs, key.Float64(v))
+		case error:
+			attrs = append(attrs, key.String(v.Error()))
+		default:
+			attrs = append(attrs, key.String(fmt.Sprint(v)))
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,149 @@
+// pkg/config/config.go
+package config
+
+// Config 当前生效的配置，由Load填充
+var Config Conf
+
+// Conf youKaConf配置结构，YAML、JSON和TOML使用相同的字段名
+type Conf struct {
+	// ConfigVersion 配置布局版本，见CurrentVersion
+	ConfigVersion int `yaml:"configVersion" json:"configVersion" toml:"configVersion"`
+
+	Etcd Etcd `yaml:"etcd" json:"etcd" toml:"etcd"`
+
+	// RpcRegisterIP 服务注册到etcd使用的IP，可以是IP字面量、网卡名或CIDR，通过RegisterIP解析
+	RpcRegisterIP string `yaml:"rpcRegisterIP" json:"rpcRegisterIP" toml:"rpcRegisterIP"`
+
+	// Services 按逻辑服务标识配置的服务，例如 services.sCUser.name
+	Services map[string]ServiceConf `yaml:"services" json:"services" toml:"services"`
+
+	// Deprecated: 使用Services，旧的配置布局仍会被读取并合并到Services中
+	RpcRegisterName struct {
+		SCUserName string `yaml:"sCUserName" json:"sCUserName" toml:"sCUserName"`
+		RelayName  string `yaml:"relayName" json:"relayName" toml:"relayName"`
+	} `yaml:"rpcRegisterName" json:"rpcRegisterName" toml:"rpcRegisterName"`
+
+	// Deprecated: 使用Services，旧的配置布局仍会被读取并合并到Services中
+	RpcPort struct {
+		GatewayPort []int `yaml:"gatewayPort" json:"gatewayPort" toml:"gatewayPort"`
+		SCUserPort  []int `yaml:"sCUserPort" json:"sCUserPort" toml:"sCUserPort"`
+	} `yaml:"rpcPort" json:"rpcPort" toml:"rpcPort"`
+
+	// Registry 注册中心行为配置
+	Registry Registry `yaml:"registry" json:"registry" toml:"registry"`
+
+	// Log 注册中心日志配置
+	Log Log `yaml:"log" json:"log" toml:"log"`
+}
+
+// Log 日志配置
+type Log struct {
+	// Level 日志级别：debug、info、warn、error
+	Level string `yaml:"level" json:"level" toml:"level"`
+	// Format 日志格式：json或console
+	Format string `yaml:"format" json:"format" toml:"format"`
+	// Output 日志输出：stdout、stderr或文件路径，文件以追加方式写入
+	Output string `yaml:"output" json:"output" toml:"output"`
+}
+
+// 日志格式
+const (
+	LogFormatJSON    = "json"
+	LogFormatConsole = "console"
+)
+
+// Registry 注册中心行为配置，时长使用 "30s"、"500ms" 形式的字符串，未配置的字段取Default中的值
+type Registry struct {
+	// TTL 注册租约时长
+	TTL Duration `yaml:"ttl" json:"ttl" toml:"ttl"`
+	// Namespace 注册中心所有key的命名空间前缀，为空表示不加前缀
+	Namespace string `yaml:"namespace" json:"namespace" toml:"namespace"`
+	// RequestTimeout 单次etcd请求超时时间
+	RequestTimeout Duration `yaml:"requestTimeout" json:"requestTimeout" toml:"requestTimeout"`
+	// RetryAttempts、RetryBaseDelay和RetryMaxDelay 同步etcd请求的重试策略
+	RetryAttempts  int      `yaml:"retryAttempts" json:"retryAttempts" toml:"retryAttempts"`
+	RetryBaseDelay Duration `yaml:"retryBaseDelay" json:"retryBaseDelay" toml:"retryBaseDelay"`
+	RetryMaxDelay  Duration `yaml:"retryMaxDelay" json:"retryMaxDelay" toml:"retryMaxDelay"`
+	// WatchDebounce 合并watch事件的时间窗口，0表示每个事件立即推送
+	WatchDebounce Duration `yaml:"watchDebounce" json:"watchDebounce" toml:"watchDebounce"`
+	// CacheTTL Discover结果的缓存时间，0表示不缓存
+	CacheTTL Duration `yaml:"cacheTTL" json:"cacheTTL" toml:"cacheTTL"`
+	// InstanceName 注册中心标识中的名称，标识为 instanceName@hostname:pid，用于区分日志和指标的来源
+	InstanceName string `yaml:"instanceName" json:"instanceName" toml:"instanceName"`
+	// RegisteredBy 是否在注册的服务元数据中写入registeredBy，值为注册中心标识
+	RegisteredBy bool `yaml:"registeredBy" json:"registeredBy" toml:"registeredBy"`
+	// Audit 是否在etcd中记录注册变更审计，AuditActor为空时使用注册中心标识
+	Audit      bool   `yaml:"audit" json:"audit" toml:"audit"`
+	AuditActor string `yaml:"auditActor" json:"auditActor" toml:"auditActor"`
+	// AuditMaxRecords和AuditTTL 每个服务保留的审计记录数和单条记录的保留时长，0表示不按时长删除
+	AuditMaxRecords int      `yaml:"auditMaxRecords" json:"auditMaxRecords" toml:"auditMaxRecords"`
+	AuditTTL        Duration `yaml:"auditTTL" json:"auditTTL" toml:"auditTTL"`
+}
+
+// Etcd etcd连接配置
+type Etcd struct {
+	// EtcdSchema 注册中心使用的resolver scheme
+	EtcdSchema string `yaml:"etcdSchema" json:"etcdSchema" toml:"etcdSchema"`
+	// EtcdAddr etcd地址列表，Load时按Etcd.Endpoints规范化为 scheme://host:port
+	EtcdAddr []string `yaml:"etcdAddr" json:"etcdAddr" toml:"etcdAddr"`
+	// DialTimeout 连接etcd的超时时间
+	DialTimeout Duration `yaml:"dialTimeout" json:"dialTimeout" toml:"dialTimeout"`
+	// UserName和Password etcd用户名密码认证
+	UserName string `yaml:"userName" json:"userName" toml:"userName"`
+	Password string `yaml:"password" json:"password" toml:"password"`
+	// PasswordFile 从文件读取Password，内容去掉首尾空白，与Password不能同时设置
+	PasswordFile string `yaml:"passwordFile" json:"passwordFile" toml:"passwordFile"`
+	// Secret 注册信息的加密密钥
+	Secret string `yaml:"secret" json:"secret" toml:"secret"`
+	// SecretFile 从文件读取Secret，内容去掉首尾空白，与Secret不能同时设置
+	SecretFile string `yaml:"secretFile" json:"secretFile" toml:"secretFile"`
+	// SecretMode 注册中心如何使用Secret：encrypt表示加密注册信息，none表示Secret用于其他用途，
+	// 设置了Secret时必须显式选择
+	SecretMode string `yaml:"secretMode" json:"secretMode" toml:"secretMode"`
+	// CAFile、CertFile和KeyFile 连接etcd的TLS证书文件，均为空表示不使用TLS
+	CAFile   string `yaml:"caFile" json:"caFile" toml:"caFile"`
+	CertFile string `yaml:"certFile" json:"certFile" toml:"certFile"`
+	KeyFile  string `yaml:"keyFile" json:"keyFile" toml:"keyFile"`
+	// InsecureSkipVerify 不校验etcd服务端证书，仅用于测试环境
+	InsecureSkipVerify bool `yaml:"insecureSkipVerify" json:"insecureSkipVerify" toml:"insecureSkipVerify"`
+	// ServerNameOverride 校验etcd服务端证书时使用的主机名，为空时使用连接地址
+	ServerNameOverride string `yaml:"serverNameOverride" json:"serverNameOverride" toml:"serverNameOverride"`
+}
+
+// TLSEnabled 是否配置了连接etcd的TLS
+func (e *Etcd) TLSEnabled() bool {
+	return e.CAFile != "" || e.CertFile != "" || e.InsecureSkipVerify || e.ServerNameOverride != ""
+}
+
+// referencedFiles 配置引用的需要在加载时读取的文件
+func (c *Conf) referencedFiles() []string {
+	var files []string
+	for _, file := range []string{c.Etcd.CAFile, c.Etcd.CertFile, c.Etcd.KeyFile, c.Etcd.PasswordFile, c.Etcd.SecretFile} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// Secret的使用方式
+const (
+	SecretModeNone    = "none"
+	SecretModeEncrypt = "encrypt"
+)
+
+// ServiceConf 单个服务的注册配置
+type ServiceConf struct {
+	// Name 注册到etcd的服务名
+	Name string `yaml:"name" json:"name" toml:"name"`
+	// Ports 服务监听的端口
+	Ports []int `yaml:"ports" json:"ports" toml:"ports"`
+	// Version 服务版本
+	Version string `yaml:"version" json:"version" toml:"version"`
+	// Weight 负载均衡权重，0表示使用默认权重
+	Weight int `yaml:"weight" json:"weight" toml:"weight"`
+	// Tags 服务标签
+	Tags []string `yaml:"tags" json:"tags" toml:"tags"`
+	// Metadata 服务元数据
+	Metadata map[string]string `yaml:"metadata" json:"metadata" toml:"metadata"`
+}
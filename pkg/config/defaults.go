@@ -0,0 +1,57 @@
+// pkg/config/defaults.go
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// 默认值
+const (
+	// DefaultEtcdAddr 默认的etcd地址
+	DefaultEtcdAddr = "127.0.0.1:2379"
+	// DefaultEtcdSchema 默认的resolver scheme
+	DefaultEtcdSchema = "etcd"
+	// DefaultDialTimeout 默认的etcd连接超时时间
+	DefaultDialTimeout = 5 * time.Second
+	// DefaultTTL 默认的注册租约时长
+	DefaultTTL = 30 * time.Second
+	// DefaultRequestTimeout 默认的etcd请求超时时间
+	DefaultRequestTimeout = 5 * time.Second
+	// DefaultRetryAttempts、DefaultRetryBaseDelay和DefaultRetryMaxDelay 默认的重试策略
+	DefaultRetryAttempts  = 3
+	DefaultRetryBaseDelay = 100 * time.Millisecond
+	DefaultRetryMaxDelay  = time.Second
+	// DefaultAuditMaxRecords 每个服务默认保留的审计记录数
+	DefaultAuditMaxRecords = 100
+)
+
+// Default 返回默认配置，可直接连接本地etcd用于开发，无需配置文件
+// Load在默认配置之上解析文件和环境变量，显式给出的值总是优先
+func Default() Conf {
+	var conf Conf
+	conf.ConfigVersion = CurrentVersion
+	conf.Etcd.EtcdSchema = DefaultEtcdSchema
+	conf.Etcd.EtcdAddr = []string{DefaultEtcdAddr}
+	conf.Etcd.DialTimeout = Duration(DefaultDialTimeout)
+	conf.Registry = Registry{
+		TTL:            Duration(DefaultTTL),
+		RequestTimeout: Duration(DefaultRequestTimeout),
+		RetryAttempts:  DefaultRetryAttempts,
+		RetryBaseDelay: Duration(DefaultRetryBaseDelay),
+		RetryMaxDelay:  Duration(DefaultRetryMaxDelay),
+
+		AuditMaxRecords: DefaultAuditMaxRecords,
+	}
+	conf.Log = Log{Level: "info", Format: LogFormatConsole, Output: "stderr"}
+	return conf
+}
+
+// TTL 返回Registry.TTL，短于MinTTL时返回错误
+func (c *Conf) TTL() (time.Duration, error) {
+	ttl := c.Registry.TTL.Std()
+	if ttl < MinTTL {
+		return ttl, fmt.Errorf("registry.ttl: %v is shorter than %v", ttl, MinTTL)
+	}
+	return ttl, nil
+}
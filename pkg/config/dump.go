@@ -0,0 +1,147 @@
+// pkg/config/dump.go
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// provenance 各顶层配置段的来源，按生效顺序排列，例如 ["defaults", "/etc/youKaConf.yaml", "env"]
+type provenance map[string][]string
+
+// 配置来源名称
+const (
+	sourceDefaults = "defaults"
+	sourceEtcd     = "etcd"
+	sourceEnv      = "env"
+	sourceFlags    = "flags"
+)
+
+// sources 当前生效配置的来源，由mu保护
+var sources provenance
+
+// add 记录changed中的配置段来自source
+func (p provenance) add(changed []string, source string) {
+	for _, section := range changed {
+		if !slices.Contains(p[section], source) {
+			p[section] = append(p[section], source)
+		}
+	}
+}
+
+func (p provenance) clone() provenance {
+	cloned := make(provenance, len(p))
+	for section, list := range p {
+		cloned[section] = slices.Clone(list)
+	}
+	return cloned
+}
+
+// sectionNames 按Conf字段顺序排列的顶层配置段名称
+func sectionNames() []string {
+	t := reflect.TypeOf(Conf{})
+	names := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		names = append(names, sectionName(t.Field(i)))
+	}
+	return names
+}
+
+func sectionName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "" {
+		name = field.Name
+	}
+	return name
+}
+
+// changedSections 返回before和after中不同的顶层配置段
+func changedSections(before, after Conf) []string {
+	b, a := reflect.ValueOf(before), reflect.ValueOf(after)
+	var changed []string
+	for i := 0; i < b.NumField(); i++ {
+		if !reflect.DeepEqual(b.Field(i).Interface(), a.Field(i).Interface()) {
+			changed = append(changed, sectionName(b.Type().Field(i)))
+		}
+	}
+	return changed
+}
+
+// defaultProvenance 默认值非空的配置段
+func defaultProvenance() provenance {
+	p := make(provenance)
+	p.add(changedSections(Conf{}, Default()), sourceDefaults)
+	return p
+}
+
+// fileProvenance 单个配置文件修改了的配置段
+func fileProvenance(base Conf, file string) provenance {
+	p := defaultProvenance()
+	p.add(changedSections(Default(), base), file)
+	return p
+}
+
+// layeredProvenance 按文件顺序记录LoadLayered中各文件提供的配置段
+func layeredProvenance(files []string, origins map[string]string) provenance {
+	p := defaultProvenance()
+	for _, file := range files {
+		for path, origin := range origins {
+			if origin == file {
+				section, _, _ := strings.Cut(path, ".")
+				p.add([]string{section}, file)
+			}
+		}
+	}
+	return p
+}
+
+// Dump 以YAML输出当前生效的配置（默认值、文件、etcd、环境变量和命令行参数合并后），
+// 密码和密钥替换为<redacted>，每个顶层配置段前以注释注明其来源
+func Dump() (string, error) {
+	mu.Lock()
+	conf, prov := Config.Redacted(), sources.clone()
+	mu.Unlock()
+
+	var node yaml.Node
+	if err := node.Encode(conf); err != nil {
+		return "", err
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		if list := prov[key.Value]; len(list) > 0 {
+			key.HeadComment = "source: " + strings.Join(list, ", ")
+		}
+	}
+	data, err := yaml.Marshal(&node)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// DumpJSON 以JSON输出当前生效的配置和各顶层配置段的来源，密码和密钥替换为<redacted>
+func DumpJSON() ([]byte, error) {
+	mu.Lock()
+	conf, prov := Config.Redacted(), sources.clone()
+	mu.Unlock()
+
+	sorted := make(map[string][]string, len(prov))
+	for _, section := range sectionNames() {
+		if list, ok := prov[section]; ok {
+			sorted[section] = list
+		}
+	}
+	data, err := json.MarshalIndent(struct {
+		Config  Conf                `json:"config"`
+		Sources map[string][]string `json:"sources"`
+	}{conf, sorted}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("dump config: %w", err)
+	}
+	return data, nil
+}
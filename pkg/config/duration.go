@@ -0,0 +1,91 @@
+// pkg/config/duration.go
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration 配置中的时长，使用Go时长字符串，例如 "30s"、"500ms"、"2m"
+// 为兼容旧配置也接受不带单位的整数，按秒解析；输出时总是使用时长字符串
+type Duration time.Duration
+
+// Std 返回对应的time.Duration
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+// String 返回时长字符串
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalText 实现encoding.TextMarshaler接口，YAML、JSON和TOML输出均为时长字符串
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText 实现encoding.TextUnmarshaler接口，环境变量和命令行参数也通过它解析
+func (d *Duration) UnmarshalText(text []byte) error {
+	return d.parse(string(text))
+}
+
+// UnmarshalYAML 实现yaml.Unmarshaler接口，接受时长字符串和整数秒
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %d: duration must be a string like \"30s\" or integer seconds", node.Line)
+	}
+	if err := d.parse(node.Value); err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	return nil
+}
+
+// UnmarshalJSON 实现json.Unmarshaler接口，接受时长字符串和整数秒
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return d.parse(s)
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\" or integer seconds, got %s", data)
+	}
+	return d.parse(n.String())
+}
+
+// UnmarshalTOML 实现toml.Unmarshaler接口，接受时长字符串和整数秒
+func (d *Duration) UnmarshalTOML(value any) error {
+	switch v := value.(type) {
+	case string:
+		return d.parse(v)
+	case int64:
+		return d.parse(strconv.FormatInt(v, 10))
+	default:
+		return fmt.Errorf("duration must be a string like \"30s\" or integer seconds, got %v", value)
+	}
+}
+
+// parse 解析时长字符串或整数秒，空字符串表示0
+func (d *Duration) parse(s string) error {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		*d = 0
+		return nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		*d = Duration(time.Duration(n) * time.Second)
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, use a value like \"30s\", \"500ms\" or \"2m\"", s)
+	}
+	*d = Duration(v)
+	return nil
+}
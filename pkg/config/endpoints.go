@@ -0,0 +1,125 @@
+// pkg/config/endpoints.go
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// 不做规范化、原样交给注册中心处理的etcd地址前缀
+var passthroughSchemes = []string{"dns+srv://", "dns://", "unix://", "unixs://"}
+
+// Endpoints 返回规范化后的etcd地址，形式为 http://host:port 或 https://host:port
+//
+// 不带scheme的地址在配置了TLS时使用https，否则使用http，且必须带端口；
+// 带scheme但不带端口的URL使用scheme的默认端口；
+// 所有地址必须使用同一种scheme，配置了TLS时不能使用http；
+// dns+srv://、dns://、unix://和unixs://形式的地址原样保留
+func (e *Etcd) Endpoints() ([]string, error) {
+	if len(e.EtcdAddr) == 0 {
+		return nil, fmt.Errorf("etcd.etcdAddr: at least one endpoint is required")
+	}
+	defaultScheme := "http"
+	if e.TLSEnabled() {
+		defaultScheme = "https"
+	}
+
+	var errs []error
+	endpoints := make([]string, 0, len(e.EtcdAddr))
+	schemes := make(map[string]int)
+	for i, addr := range e.EtcdAddr {
+		endpoint, scheme, err := normalizeEndpoint(addr, defaultScheme)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("etcd.etcdAddr[%d]: %w", i, err))
+			continue
+		}
+		if scheme != "" {
+			if _, ok := schemes[scheme]; !ok {
+				schemes[scheme] = i
+			}
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	if first, ok := schemes["http"]; ok {
+		if other, mixed := schemes["https"]; mixed {
+			errs = append(errs, fmt.Errorf("etcd.etcdAddr: mixed schemes, etcdAddr[%d] uses http but etcdAddr[%d] uses https", first, other))
+		} else if e.TLSEnabled() {
+			errs = append(errs, fmt.Errorf("etcd.etcdAddr[%d]: uses http but TLS is configured", first))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return endpoints, nil
+}
+
+// normalizeEndpoint 将单个地址规范化为 scheme://host:port，返回规范化的地址和scheme
+// 原样保留的地址返回空scheme
+func normalizeEndpoint(addr, defaultScheme string) (string, string, error) {
+	addr = strings.TrimSpace(addr)
+	if addr == "" {
+		return "", "", fmt.Errorf("empty endpoint")
+	}
+	for _, prefix := range passthroughSchemes {
+		if strings.HasPrefix(addr, prefix) {
+			if len(addr) == len(prefix) {
+				return "", "", fmt.Errorf("invalid endpoint %q: missing host", addr)
+			}
+			return addr, "", nil
+		}
+	}
+
+	if !strings.Contains(addr, "://") {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid endpoint %q: expected host:port or URL", addr)
+		}
+		if host == "" {
+			return "", "", fmt.Errorf("invalid endpoint %q: missing host", addr)
+		}
+		if err := checkPort(port); err != nil {
+			return "", "", fmt.Errorf("invalid endpoint %q: %w", addr, err)
+		}
+		return defaultScheme + "://" + net.JoinHostPort(host, port), defaultScheme, nil
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid URL %q: %v", addr, err)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	var defaultPort string
+	switch scheme {
+	case "http":
+		defaultPort = "80"
+	case "https":
+		defaultPort = "443"
+	default:
+		return "", "", fmt.Errorf("invalid URL %q: unsupported scheme %q, use http or https", addr, u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return "", "", fmt.Errorf("invalid URL %q: missing host", addr)
+	}
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return "", "", fmt.Errorf("invalid URL %q: only scheme, host and port are allowed", addr)
+	}
+	port := u.Port()
+	if port == "" {
+		port = defaultPort
+	} else if err := checkPort(port); err != nil {
+		return "", "", fmt.Errorf("invalid URL %q: %w", addr, err)
+	}
+	return scheme + "://" + net.JoinHostPort(u.Hostname(), port), scheme, nil
+}
+
+// checkPort 校验端口为1-65535
+func checkPort(port string) error {
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("port must be 1-65535")
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// pkg/config/env.go
+package config
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix 覆盖配置项的环境变量前缀
+//
+// 环境变量名为 YOUKA_ 加上字段路径，嵌套字段以下划线连接并转为大写，例如：
+//
+//	YOUKA_ETCD_ETCDADDR=10.0.0.1:2379,10.0.0.2:2379
+//	YOUKA_ETCD_USERNAME=root
+//	YOUKA_RPCREGISTERIP=10.0.0.10
+//	YOUKA_RPCPORT_GATEWAYPORT=10001,10002
+//
+// 切片使用逗号分隔，整数和布尔值按Go语法解析，时长使用 "30s" 形式或整数秒；环境变量在配置文件之后生效
+const EnvPrefix = "YOUKA"
+
+// applyEnv 用环境变量覆盖conf中的字段，每个无法转换的变量返回一个错误
+func applyEnv(conf *Conf) error {
+	return applyEnvValue(reflect.ValueOf(conf).Elem(), EnvPrefix)
+}
+
+func applyEnvValue(v reflect.Value, name string) error {
+	if v.Kind() == reflect.Struct {
+		var errs []error
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			errs = append(errs, applyEnvValue(v.Field(i), name+"_"+strings.ToUpper(field.Name)))
+		}
+		return errors.Join(errs...)
+	}
+
+	raw, ok := os.LookupEnv(name)
+	if !ok {
+		return nil
+	}
+	if err := setValue(v, raw); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// setValue 将环境变量的值转换为字段类型并赋值
+func setValue(v reflect.Value, raw string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(raw))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		var parts []string
+		if strings.TrimSpace(raw) != "" {
+			parts = strings.Split(raw, ",")
+		}
+		slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setValue(slice.Index(i), strings.TrimSpace(part)); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		v.Set(slice)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+// pkg/config/env_test.go
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const envBaseConfig = `
+etcd:
+  etcdAddr: ["127.0.0.1:2379"]
+  userName: file-user
+  password: file-password
+rpcRegisterIP: 10.0.0.1
+rpcPort:
+  sCUserPort: [10110]
+registry:
+  ttl: 10s
+  retryAttempts: 3
+`
+
+func TestLoadEnvOverrides(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		env   map[string]string
+		check func(Conf) error
+	}{
+		{
+			name: "string slice",
+			env:  map[string]string{"YOUKA_ETCD_ETCDADDR": "10.0.0.1:2379, 10.0.0.2:2379"},
+			check: func(c Conf) error {
+				if len(c.Etcd.EtcdAddr) != 2 || !strings.Contains(c.Etcd.EtcdAddr[1], "10.0.0.2:2379") {
+					return fmt.Errorf("etcdAddr: %v", c.Etcd.EtcdAddr)
+				}
+				return nil
+			},
+		},
+		{
+			name: "int slice",
+			env:  map[string]string{"YOUKA_RPCPORT_SCUSERPORT": "10111,10112"},
+			check: func(c Conf) error {
+				if !slices.Equal(c.RpcPort.SCUserPort, []int{10111, 10112}) {
+					return fmt.Errorf("sCUserPort: %v", c.RpcPort.SCUserPort)
+				}
+				return nil
+			},
+		},
+		{
+			name: "nested int and bool",
+			env:  map[string]string{"YOUKA_REGISTRY_RETRYATTEMPTS": "7", "YOUKA_REGISTRY_AUDIT": "true"},
+			check: func(c Conf) error {
+				if c.Registry.RetryAttempts != 7 || !c.Registry.Audit {
+					return fmt.Errorf("registry: retryAttempts %d, audit %v", c.Registry.RetryAttempts, c.Registry.Audit)
+				}
+				return nil
+			},
+		},
+		{
+			name: "nested durations",
+			env:  map[string]string{"YOUKA_REGISTRY_TTL": "45s", "YOUKA_REGISTRY_REQUESTTIMEOUT": "2"},
+			check: func(c Conf) error {
+				if c.Registry.TTL.Std() != 45*time.Second || c.Registry.RequestTimeout.Std() != 2*time.Second {
+					return fmt.Errorf("registry: ttl %v, requestTimeout %v", c.Registry.TTL, c.Registry.RequestTimeout)
+				}
+				return nil
+			},
+		},
+		{
+			name: "nested and top-level strings",
+			env:  map[string]string{"YOUKA_ETCD_USERNAME": "root", "YOUKA_RPCREGISTERIP": "10.0.0.10"},
+			check: func(c Conf) error {
+				if c.Etcd.UserName != "root" || c.RpcRegisterIP != "10.0.0.10" {
+					return fmt.Errorf("userName %q, rpcRegisterIP %q", c.Etcd.UserName, c.RpcRegisterIP)
+				}
+				return nil
+			},
+		},
+		{
+			name: "unset variables keep file values",
+			check: func(c Conf) error {
+				if c.Etcd.UserName != "file-user" || c.Registry.RetryAttempts != 3 || c.Registry.TTL.Std() != 10*time.Second {
+					return fmt.Errorf("file values lost: %+v", c)
+				}
+				return nil
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for name, value := range tc.env {
+				t.Setenv(name, value)
+			}
+			if err := Load(writeConfig(t, "youKaConf.yaml", envBaseConfig)); err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			if err := tc.check(Current()); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestLoadEnvErrorsPerVariable(t *testing.T) {
+	path := writeConfig(t, "youKaConf.yaml", envBaseConfig)
+	if err := Load(path); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	t.Setenv("YOUKA_REGISTRY_RETRYATTEMPTS", "many")
+	t.Setenv("YOUKA_REGISTRY_AUDIT", "maybe")
+	t.Setenv("YOUKA_RPCPORT_SCUSERPORT", "10111,x")
+	t.Setenv("YOUKA_REGISTRY_TTL", "soon")
+
+	err := Load(path)
+	if err == nil {
+		t.Fatal("invalid environment: got nil error")
+	}
+	for _, want := range []string{
+		`YOUKA_REGISTRY_RETRYATTEMPTS: invalid integer "many"`,
+		`YOUKA_REGISTRY_AUDIT: invalid boolean "maybe"`,
+		`YOUKA_RPCPORT_SCUSERPORT: element 1: invalid integer "x"`,
+		"YOUKA_REGISTRY_TTL",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not report %s: %v", want, err)
+		}
+	}
+	// 失败时保留原配置
+	if got := Current().Registry.RetryAttempts; got != 3 {
+		t.Errorf("config replaced after failed load: retryAttempts %d", got)
+	}
+}
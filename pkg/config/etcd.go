@@ -0,0 +1,125 @@
+// pkg/config/etcd.go
+package config
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// DefaultEtcdKey 集中配置在etcd中的默认key
+const DefaultEtcdKey = "/config/youKaConf"
+
+// etcdRequestTimeout 读取etcd配置的超时时间
+const etcdRequestTimeout = 5 * time.Second
+
+// LoadFromEtcd 从etcd的key读取配置（YAML或JSON），叠加在配置文件（未加载时为默认值）之上并替换Config
+// 配置文件通常只包含etcd连接信息，其余配置集中存放在etcd中；
+// key不存在时回退到配置文件和默认值，内容无法解析或校验失败时保留原配置并返回错误
+func LoadFromEtcd(client *clientv3.Client, key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+
+	_, err := loadFromEtcd(ctx, client, key)
+	return err
+}
+
+// loadFromEtcd 读取并应用key的当前值，返回读取时的revision
+func loadFromEtcd(ctx context.Context, client *clientv3.Client, key string) (int64, error) {
+	resp, err := client.Get(ctx, key)
+	if err != nil {
+		return 0, fmt.Errorf("get config %s from etcd: %w", key, err)
+	}
+	var value []byte
+	if len(resp.Kvs) > 0 {
+		value = resp.Kvs[0].Value
+	}
+	return resp.Header.Revision, applyEtcd(key, value)
+}
+
+// applyEtcd 使用etcd中的配置重新合成并替换Config，value为nil表示key不存在
+func applyEtcd(key string, value []byte) error {
+	mu.Lock()
+	base, files := fileBase, fileSources
+	if len(loadedPaths) == 0 {
+		base, files = Default(), defaultProvenance()
+	}
+	conf, prov, err := compose(base, value, fileOrigins, files)
+	if err != nil {
+		mu.Unlock()
+		return fmt.Errorf("etcd config %s: %w", key, err)
+	}
+	etcdOverlay = value
+	sources = prov
+	old := Config
+	Config = conf
+	mu.Unlock()
+
+	notifyChange(old, conf)
+	return nil
+}
+
+// WatchEtcd 读取key的当前配置并持续监听变化，配置内容变化时调用onChange（可以为nil），
+// 同时通知OnChange的订阅者；key被删除时回退到配置文件和默认值，
+// 内容无效时保留原配置并通过OnError通知；watch中断时按间隔重新读取，直到ctx结束
+// 首次读取失败时直接返回错误
+func WatchEtcd(ctx context.Context, client *clientv3.Client, key string, onChange func(old, new Conf)) error {
+	if onChange != nil {
+		cancel := OnChange(onChange)
+		go func() {
+			<-ctx.Done()
+			cancel()
+		}()
+	}
+
+	getCtx, cancel := context.WithTimeout(ctx, etcdRequestTimeout)
+	rev, err := loadFromEtcd(getCtx, client, key)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			watchEtcd(ctx, client, key, rev)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Second):
+				}
+				getCtx, cancel := context.WithTimeout(ctx, etcdRequestTimeout)
+				rev, err = loadFromEtcd(getCtx, client, key)
+				cancel()
+				if err == nil {
+					break
+				}
+				notifyError(err)
+			}
+		}
+	}()
+	return nil
+}
+
+// watchEtcd 从revision之后监听key，直到watch中断或ctx结束
+func watchEtcd(ctx context.Context, client *clientv3.Client, key string, rev int64) {
+	for resp := range client.Watch(ctx, key, clientv3.WithRev(rev+1)) {
+		if err := resp.Err(); err != nil {
+			notifyError(fmt.Errorf("watch config %s in etcd: %w", key, err))
+			return
+		}
+		if len(resp.Events) == 0 {
+			continue
+		}
+		event := resp.Events[len(resp.Events)-1]
+		var value []byte
+		if event.Type == clientv3.EventTypePut {
+			value = event.Kv.Value
+		}
+		if err := applyEtcd(key, value); err != nil {
+			notifyError(err)
+		}
+	}
+}
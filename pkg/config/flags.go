@@ -0,0 +1,65 @@
+// pkg/config/flags.go
+package config
+
+import (
+	"flag"
+	"strings"
+)
+
+// FlagSet 绑定命令行参数需要的方法，*flag.FlagSet和pflag的*FlagSet都满足
+type FlagSet interface {
+	StringVar(p *string, name, value, usage string)
+}
+
+// flagValues 命令行参数的值，空字符串表示未指定
+var flagValues struct {
+	config        string
+	etcdAddr      string
+	etcdSchema    string
+	rpcRegisterIP string
+	logLevel      string
+}
+
+// BindFlags 在fs上注册常用配置项的命令行参数，需要在fs.Parse之前调用，Load时生效
+//
+//	--config           配置文件路径或所在目录，优先级低于Load的path参数，高于$CONFIG_PATH
+//	--etcd-addr        etcd地址，逗号分隔
+//	--etcd-schema      resolver scheme
+//	--rpc-register-ip  服务注册使用的IP
+//	--log-level        日志级别
+//
+// 配置来源的优先级为：命令行参数 > 环境变量 > 配置文件 > 默认值
+func BindFlags(fs *flag.FlagSet) {
+	BindFlagSet(fs)
+}
+
+// BindFlagSet 与BindFlags相同，接受pflag等兼容的FlagSet
+func BindFlagSet(fs FlagSet) {
+	fs.StringVar(&flagValues.config, "config", "", "path to the config file or its directory")
+	fs.StringVar(&flagValues.etcdAddr, "etcd-addr", "", "comma-separated etcd endpoints, overrides etcd.etcdAddr")
+	fs.StringVar(&flagValues.etcdSchema, "etcd-schema", "", "resolver scheme, overrides etcd.etcdSchema")
+	fs.StringVar(&flagValues.rpcRegisterIP, "rpc-register-ip", "", "IP, interface name or CIDR registered for RPC services, overrides rpcRegisterIP")
+	fs.StringVar(&flagValues.logLevel, "log-level", "", "log level, overrides log.level")
+}
+
+// applyFlags 用已指定的命令行参数覆盖conf
+func applyFlags(conf *Conf) {
+	if flagValues.etcdAddr != "" {
+		var addrs []string
+		for _, addr := range strings.Split(flagValues.etcdAddr, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				addrs = append(addrs, addr)
+			}
+		}
+		conf.Etcd.EtcdAddr = addrs
+	}
+	if flagValues.etcdSchema != "" {
+		conf.Etcd.EtcdSchema = flagValues.etcdSchema
+	}
+	if flagValues.rpcRegisterIP != "" {
+		conf.RpcRegisterIP = flagValues.rpcRegisterIP
+	}
+	if flagValues.logLevel != "" {
+		conf.Log.Level = flagValues.logLevel
+	}
+}
@@ -0,0 +1,158 @@
+// pkg/config/flags_test.go
+package config
+
+import (
+	"flag"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// parseFlags 在新的FlagSet上绑定并解析args，测试结束时恢复原来的参数值
+func parseFlags(t *testing.T, args ...string) {
+	t.Helper()
+	saved := flagValues
+	t.Cleanup(func() { flagValues = saved })
+	fs := flag.NewFlagSet(t.Name(), flag.ContinueOnError)
+	BindFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+}
+
+const flagsFileConfig = `
+etcd:
+  etcdAddr: ["file:2379"]
+rpcRegisterIP: 10.0.0.1
+log:
+  level: warn
+`
+
+func TestLoadSourcePrecedence(t *testing.T) {
+	path := writeConfig(t, "youKaConf.yaml", flagsFileConfig)
+	defaults := Default()
+	for _, tc := range []struct {
+		name     string
+		file     string
+		env      map[string]string
+		flags    []string
+		wantAddr string
+		wantIP   string
+		wantLog  string
+	}{
+		{
+			name:     "flags over env over file",
+			file:     path,
+			env:      map[string]string{"YOUKA_ETCD_ETCDADDR": "env:2379", "YOUKA_RPCREGISTERIP": "10.0.0.2", "YOUKA_LOG_LEVEL": "info"},
+			flags:    []string{"--etcd-addr", "flag-a:2379, flag-b:2379", "--rpc-register-ip", "10.0.0.3", "--log-level", "debug"},
+			wantAddr: "flag-a:2379", wantIP: "10.0.0.3", wantLog: "debug",
+		},
+		{
+			name:     "env over file",
+			file:     path,
+			env:      map[string]string{"YOUKA_ETCD_ETCDADDR": "env:2379", "YOUKA_RPCREGISTERIP": "10.0.0.2"},
+			flags:    []string{"--log-level", "error"},
+			wantAddr: "env:2379", wantIP: "10.0.0.2", wantLog: "error",
+		},
+		{
+			name:     "file over defaults",
+			file:     path,
+			wantAddr: "file:2379", wantIP: "10.0.0.1", wantLog: "warn",
+		},
+		{
+			name:     "defaults",
+			file:     writeConfig(t, "youKaConf.yaml", "etcd:\n  etcdAddr: [\"file:2379\"]\n"),
+			wantAddr: "file:2379", wantIP: defaults.RpcRegisterIP, wantLog: defaults.Log.Level,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for name, value := range tc.env {
+				t.Setenv(name, value)
+			}
+			parseFlags(t, tc.flags...)
+			if err := Load(tc.file); err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			conf := Current()
+			if len(conf.Etcd.EtcdAddr) == 0 || strings.TrimPrefix(conf.Etcd.EtcdAddr[0], "http://") != tc.wantAddr {
+				t.Errorf("etcdAddr: got %v, want %s first", conf.Etcd.EtcdAddr, tc.wantAddr)
+			}
+			if conf.RpcRegisterIP != tc.wantIP {
+				t.Errorf("rpcRegisterIP: got %q, want %q", conf.RpcRegisterIP, tc.wantIP)
+			}
+			if conf.Log.Level != tc.wantLog {
+				t.Errorf("log.level: got %q, want %q", conf.Log.Level, tc.wantLog)
+			}
+		})
+	}
+}
+
+func TestFlagEtcdAddrList(t *testing.T) {
+	parseFlags(t, "--etcd-addr", "a:2379, ,b:2379", "--etcd-schema", "flag-schema")
+	if err := Load(writeConfig(t, "youKaConf.yaml", flagsFileConfig)); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	conf := Current()
+	// 空项被忽略
+	var hosts []string
+	for _, addr := range conf.Etcd.EtcdAddr {
+		hosts = append(hosts, strings.TrimPrefix(addr, "http://"))
+	}
+	if !slices.Equal(hosts, []string{"a:2379", "b:2379"}) {
+		t.Errorf("etcdAddr: got %v", conf.Etcd.EtcdAddr)
+	}
+	if conf.Etcd.EtcdSchema != "flag-schema" {
+		t.Errorf("etcdSchema: got %q", conf.Etcd.EtcdSchema)
+	}
+}
+
+func TestConfigFlagPrecedence(t *testing.T) {
+	fromFlag := writeConfig(t, "youKaConf.yaml", flagsFileConfig)
+	fromEnv := writeConfig(t, "youKaConf.yaml", flagsFileConfig)
+	fromArg := writeConfig(t, "youKaConf.yaml", flagsFileConfig)
+	t.Setenv(EnvConfigPath, fromEnv)
+	parseFlags(t, "--config", filepath.Dir(fromFlag))
+
+	// --config优先于$CONFIG_PATH
+	if err := Load(""); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := Path(); got != fromFlag {
+		t.Errorf("path with --config: got %s, want %s", got, fromFlag)
+	}
+	// Load的path参数优先于--config
+	if err := Load(fromArg); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := Path(); got != fromArg {
+		t.Errorf("path with explicit argument: got %s, want %s", got, fromArg)
+	}
+}
+
+// stringFlagSet 只实现StringVar的FlagSet，模拟pflag
+type stringFlagSet map[string]*string
+
+func (s stringFlagSet) StringVar(p *string, name, value, _ string) {
+	*p = value
+	s[name] = p
+}
+
+func TestBindFlagSet(t *testing.T) {
+	saved := flagValues
+	t.Cleanup(func() { flagValues = saved })
+	fs := stringFlagSet{}
+	BindFlagSet(fs)
+	for _, name := range []string{"config", "etcd-addr", "etcd-schema", "rpc-register-ip", "log-level"} {
+		if fs[name] == nil {
+			t.Fatalf("flag %s not registered", name)
+		}
+	}
+	*fs["rpc-register-ip"] = "10.0.0.9"
+	if err := Load(writeConfig(t, "youKaConf.yaml", flagsFileConfig)); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := Current().RpcRegisterIP; got != "10.0.0.9" {
+		t.Errorf("rpcRegisterIP from FlagSet: got %q", got)
+	}
+}
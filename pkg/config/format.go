@@ -0,0 +1,107 @@
+// pkg/config/format.go
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Format 配置文件格式
+type Format string
+
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+	FormatTOML Format = "toml"
+)
+
+// formatOf 按扩展名识别文件格式，未知扩展名按YAML处理
+func formatOf(file string) Format {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		return FormatJSON
+	case ".toml":
+		return FormatTOML
+	default:
+		return FormatYAML
+	}
+}
+
+// parse 在默认值之上解析配置，文件中出现的字段覆盖默认值，语法错误信息中包含行号
+// 旧版本的配置先迁移到当前版本，返回迁移产生的弃用提示
+func parse(data []byte, format Format) (Conf, []string, error) {
+	tree, err := parseTree(data, format)
+	if err != nil {
+		return Conf{}, nil, err
+	}
+	warnings, err := migrate(tree)
+	if err != nil {
+		return Conf{}, nil, err
+	}
+	if len(warnings) == 0 {
+		// 无需迁移时直接解码原文，类型错误能对应到原文件的行号
+		conf, err := decode(data, format)
+		conf.ConfigVersion = CurrentVersion
+		return conf, nil, err
+	}
+	migrated, err := yaml.Marshal(tree)
+	if err != nil {
+		return Conf{}, nil, err
+	}
+	conf, err := decode(migrated, FormatYAML)
+	if err != nil {
+		return Conf{}, nil, fmt.Errorf("after migrating to configVersion %d: %w", CurrentVersion, err)
+	}
+	return conf, warnings, nil
+}
+
+// decode 在默认值之上解码配置
+func decode(data []byte, format Format) (Conf, error) {
+	conf := Default()
+	switch format {
+	case FormatYAML:
+		err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&conf)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return Conf{}, err
+		}
+	case FormatJSON:
+		if len(bytes.TrimSpace(data)) == 0 {
+			return conf, nil
+		}
+		if err := json.Unmarshal(data, &conf); err != nil {
+			return Conf{}, jsonError(data, err)
+		}
+	case FormatTOML:
+		if _, err := toml.Decode(string(data), &conf); err != nil {
+			return Conf{}, err
+		}
+	default:
+		return Conf{}, fmt.Errorf("unsupported config format %q", format)
+	}
+	return conf, nil
+}
+
+// jsonError 为JSON错误补充行号，encoding/json只给出字节偏移
+func jsonError(data []byte, err error) error {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return err
+	}
+	line := 1 + bytes.Count(data[:min(int(offset), len(data))], []byte("\n"))
+	return fmt.Errorf("line %d: %w", line, err)
+}
@@ -0,0 +1,153 @@
+// pkg/config/format_test.go
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 同一份配置的三种格式
+const (
+	formatYAML = `
+etcd:
+  etcdAddr: ["10.0.0.1:2379", "10.0.0.2:2379"]
+  dialTimeout: 3s
+  userName: root
+  password: secret
+rpcRegisterIP: 10.0.0.10
+services:
+  sCUser:
+    name: user-rpc
+    ports: [10110, 10111]
+registry:
+  ttl: 15s
+  retryAttempts: 4
+  audit: true
+log:
+  level: debug
+  format: json
+`
+	formatJSON = `{
+  "etcd": {
+    "etcdAddr": ["10.0.0.1:2379", "10.0.0.2:2379"],
+    "dialTimeout": "3s",
+    "userName": "root",
+    "password": "secret"
+  },
+  "rpcRegisterIP": "10.0.0.10",
+  "services": {
+    "sCUser": {"name": "user-rpc", "ports": [10110, 10111]}
+  },
+  "registry": {"ttl": "15s", "retryAttempts": 4, "audit": true},
+  "log": {"level": "debug", "format": "json"}
+}`
+	formatTOML = `
+rpcRegisterIP = "10.0.0.10"
+
+[etcd]
+etcdAddr = ["10.0.0.1:2379", "10.0.0.2:2379"]
+dialTimeout = "3s"
+userName = "root"
+password = "secret"
+
+[services.sCUser]
+name = "user-rpc"
+ports = [10110, 10111]
+
+[registry]
+ttl = "15s"
+retryAttempts = 4
+audit = true
+
+[log]
+level = "debug"
+format = "json"
+`
+)
+
+// loadCurrent 加载path并返回生效的配置
+func loadCurrent(t *testing.T, path string, format Format) Conf {
+	t.Helper()
+	if err := LoadFormat(path, format); err != nil {
+		t.Fatalf("load %s: %v", filepath.Base(path), err)
+	}
+	return Current()
+}
+
+func TestLoadFormatsAgree(t *testing.T) {
+	want := loadCurrent(t, writeConfig(t, "youKaConf.yaml", formatYAML), "")
+	if want.Registry.TTL.Std() != 15*time.Second || want.Etcd.DialTimeout.Std() != 3*time.Second ||
+		want.Services[ServiceSCUser].Name != "user-rpc" || !want.Registry.Audit || want.Log.Level != "debug" {
+		t.Fatalf("yaml config not decoded: %+v", want)
+	}
+	for name, content := range map[string]string{
+		"youKaConf.yml":  formatYAML,
+		"youKaConf.json": formatJSON,
+		"youKaConf.toml": formatTOML,
+	} {
+		got := loadCurrent(t, writeConfig(t, name, content), "")
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s differs from yaml:\ngot  %+v\nwant %+v", name, got, want)
+		}
+	}
+}
+
+func TestLoadExplicitFormat(t *testing.T) {
+	want := loadCurrent(t, writeConfig(t, "youKaConf.yaml", formatYAML), "")
+	// 显式格式优先于扩展名
+	for format, content := range map[Format]string{FormatJSON: formatJSON, FormatTOML: formatTOML} {
+		got := loadCurrent(t, writeConfig(t, "youKaConf.conf", content), format)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s with explicit format differs from yaml", format)
+		}
+	}
+	// 未知扩展名按YAML解析
+	if got := loadCurrent(t, writeConfig(t, "youKaConf.conf", formatYAML), ""); !reflect.DeepEqual(got, want) {
+		t.Error("unknown extension not parsed as yaml")
+	}
+	if err := LoadFormat(writeConfig(t, "youKaConf.conf", formatYAML), "ini"); err == nil ||
+		!strings.Contains(err.Error(), `unsupported config format "ini"`) {
+		t.Errorf("unsupported format: got %v", err)
+	}
+}
+
+func TestLoadFindsJSONInDirectory(t *testing.T) {
+	dir := filepath.Dir(writeConfig(t, "youKaConf.json", formatJSON))
+	if err := Load(dir); err != nil {
+		t.Fatalf("load dir: %v", err)
+	}
+	if got := Path(); got != filepath.Join(dir, "youKaConf.json") {
+		t.Errorf("path: got %s", got)
+	}
+	// 同一目录中YAML优先
+	if err := os.WriteFile(filepath.Join(dir, "youKaConf.yaml"), []byte(formatYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(dir); err != nil {
+		t.Fatalf("load dir: %v", err)
+	}
+	if got := Path(); got != filepath.Join(dir, "youKaConf.yaml") {
+		t.Errorf("path with yaml present: got %s", got)
+	}
+}
+
+func TestLoadFormatErrorsHaveLines(t *testing.T) {
+	for name, content := range map[string]string{
+		"youKaConf.json": "{\n  \"registry\": {\n    \"retryAttempts\": \"four\"\n  }\n}",
+		"youKaConf.toml": "[registry]\nretryAttempts = \"four\"\n",
+		"youKaConf.yaml": "registry:\n  retryAttempts: four\n",
+	} {
+		err := Load(writeConfig(t, name, content))
+		if err == nil {
+			t.Errorf("%s: got nil error", name)
+			continue
+		}
+		if !strings.Contains(err.Error(), "line") {
+			t.Errorf("%s: error without line: %v", name, err)
+		}
+	}
+}
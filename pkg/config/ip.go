@@ -0,0 +1,110 @@
+// pkg/config/ip.go
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// RegisterIP 返回RpcRegisterIP解析后的注册IP，规则见ResolveIP
+func (c *Conf) RegisterIP() (string, error) {
+	ip, err := ResolveIP(c.RpcRegisterIP)
+	if err != nil {
+		return "", fmt.Errorf("rpcRegisterIP: %w", err)
+	}
+	return ip, nil
+}
+
+// ResolveIP 将IP选择器解析为具体的IP
+// 选择器可以是IP字面量、网卡名（例如eth0）或CIDR（例如10.8.0.0/16），
+// 网卡名和CIDR选取第一个匹配的非回环地址，IPv4优先；没有匹配地址时错误中列出所有可用网卡
+func ResolveIP(selector string) (string, error) {
+	if selector == "" {
+		return "", fmt.Errorf("empty IP selector")
+	}
+	if ip := net.ParseIP(selector); ip != nil {
+		return ip.String(), nil
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", fmt.Errorf("list interfaces: %w", err)
+	}
+
+	var match func(iface net.Interface, ip net.IP) bool
+	if strings.Contains(selector, "/") {
+		_, network, err := net.ParseCIDR(selector)
+		if err != nil {
+			return "", fmt.Errorf("invalid CIDR %q: %v", selector, err)
+		}
+		match = func(_ net.Interface, ip net.IP) bool { return network.Contains(ip) }
+	} else {
+		found := false
+		for _, iface := range ifaces {
+			found = found || iface.Name == selector
+		}
+		if !found {
+			return "", fmt.Errorf("no interface named %q, available interfaces: %s", selector, describeInterfaces(ifaces))
+		}
+		match = func(iface net.Interface, _ net.IP) bool { return iface.Name == selector }
+	}
+
+	var fallback net.IP
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		for _, ip := range interfaceIPs(iface) {
+			if ip.IsLoopback() || ip.IsLinkLocalUnicast() || !match(iface, ip) {
+				continue
+			}
+			if ip.To4() != nil {
+				return ip.String(), nil
+			}
+			if fallback == nil {
+				fallback = ip
+			}
+		}
+	}
+	if fallback != nil {
+		return fallback.String(), nil
+	}
+	return "", fmt.Errorf("no non-loopback address matches %q, available interfaces: %s", selector, describeInterfaces(ifaces))
+}
+
+// interfaceIPs 返回网卡上配置的IP，读取失败时返回nil
+func interfaceIPs(iface net.Interface) []net.IP {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			ips = append(ips, ipNet.IP)
+		}
+	}
+	return ips
+}
+
+// describeInterfaces 将网卡及其地址格式化为 eth0 [10.0.0.2, fe80::1]，用于错误信息
+func describeInterfaces(ifaces []net.Interface) string {
+	if len(ifaces) == 0 {
+		return "none"
+	}
+	parts := make([]string, 0, len(ifaces))
+	for _, iface := range ifaces {
+		ips := interfaceIPs(iface)
+		addrs := make([]string, len(ips))
+		for i, ip := range ips {
+			addrs[i] = ip.String()
+		}
+		state := ""
+		if iface.Flags&net.FlagUp == 0 {
+			state = " (down)"
+		}
+		parts = append(parts, fmt.Sprintf("%s%s [%s]", iface.Name, state, strings.Join(addrs, ", ")))
+	}
+	return strings.Join(parts, ", ")
+}
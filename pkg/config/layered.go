@@ -0,0 +1,179 @@
+// pkg/config/layered.go
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadLayered 依次加载多个配置文件并深度合并后替换Config，例如 base.yaml 和 prod.yaml
+// 后面的文件优先：对象按字段递归合并（services按服务标识逐个合并），切片和标量整体替换；
+// 各文件可以使用不同格式，合并后再应用etcd配置、环境变量和校验，校验错误中注明出错的值来自哪个文件
+func LoadLayered(paths ...string) error {
+	if len(paths) == 0 {
+		return errors.New("config: LoadLayered needs at least one file")
+	}
+
+	mu.Lock()
+	files := make([]string, 0, len(paths))
+	for _, path := range paths {
+		file, err := find(path)
+		if err != nil {
+			mu.Unlock()
+			return err
+		}
+		files = append(files, file)
+	}
+	old, conf, err := loadFiles(files, "")
+	mu.Unlock()
+	if err != nil {
+		return err
+	}
+	notifyChange(old, conf)
+	return nil
+}
+
+// loadFiles 加载一个或多个配置文件并替换Config，调用方需持有mu
+func loadFiles(files []string, format Format) (old, conf Conf, err error) {
+	if len(files) == 1 {
+		return loadFile(files[0], format)
+	}
+
+	tree := make(map[string]any)
+	origins := make(map[string]string)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return old, conf, fmt.Errorf("read config %s: %w", file, err)
+		}
+		fileFormat := format
+		if fileFormat == "" {
+			fileFormat = formatOf(file)
+		}
+		// 先单独解析一次，类型错误能对应到原文件的行号
+		_, warnings, err := parse(data, fileFormat)
+		if err != nil {
+			return old, conf, fmt.Errorf("parse config %s: %w", file, err)
+		}
+		warnDeprecated(file, warnings)
+		layer, err := parseTree(data, fileFormat)
+		if err == nil {
+			_, err = migrate(layer)
+		}
+		if err != nil {
+			return old, conf, fmt.Errorf("parse config %s: %w", file, err)
+		}
+		mergeTree(tree, layer, "", file, origins)
+	}
+
+	merged, err := yaml.Marshal(tree)
+	if err != nil {
+		return old, conf, fmt.Errorf("merge config: %w", err)
+	}
+	base, err := decode(merged, FormatYAML)
+	if err != nil {
+		return old, conf, fmt.Errorf("merge config: %w", err)
+	}
+	layers := layeredProvenance(files, origins)
+	conf, prov, err := compose(base, etcdOverlay, origins, layers)
+	if err != nil {
+		return old, conf, fmt.Errorf("config %s: %w", strings.Join(files, " + "), err)
+	}
+	fileBase = base
+	fileOrigins = origins
+	fileSources = layers
+	sources = prov
+	old = Config
+	Config = conf
+	loadedPaths = files
+	loadedFormat = format
+	return old, conf, nil
+}
+
+// parseTree 将配置文件解析为通用的键值树
+func parseTree(data []byte, format Format) (map[string]any, error) {
+	tree := make(map[string]any)
+	var err error
+	switch format {
+	case FormatYAML:
+		err = yaml.Unmarshal(data, &tree)
+	case FormatJSON:
+		if len(strings.TrimSpace(string(data))) > 0 {
+			if err = json.Unmarshal(data, &tree); err != nil {
+				err = jsonError(data, err)
+			}
+		}
+	case FormatTOML:
+		_, err = toml.Decode(string(data), &tree)
+	default:
+		err = fmt.Errorf("unsupported config format %q", format)
+	}
+	return tree, err
+}
+
+// mergeTree 将src合并到dst，对象递归合并，其余值整体替换，并记录每个值来自的文件
+func mergeTree(dst, src map[string]any, prefix, file string, origins map[string]string) {
+	for key, value := range src {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		if child, ok := value.(map[string]any); ok {
+			existing, ok := dst[key].(map[string]any)
+			if !ok {
+				existing = make(map[string]any)
+				dst[key] = existing
+			}
+			mergeTree(existing, child, path, file, origins)
+			continue
+		}
+		dst[key] = value
+		for p := range origins {
+			if strings.HasPrefix(p, path+".") {
+				delete(origins, p)
+			}
+		}
+		origins[path] = file
+	}
+}
+
+// fieldPattern 匹配校验错误开头的字段路径，例如 etcd.etcdAddr[0]
+var fieldPattern = regexp.MustCompile(`^([A-Za-z0-9_.]+)(\[\d+\])?`)
+
+// annotateOrigins 在校验错误后注明字段来自的文件
+func annotateOrigins(err error, origins map[string]string) error {
+	if err == nil || origins == nil {
+		return err
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs := joined.Unwrap()
+		annotated := make([]error, len(errs))
+		for i, e := range errs {
+			annotated[i] = annotateOrigins(e, origins)
+		}
+		return errors.Join(annotated...)
+	}
+
+	match := fieldPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return err
+	}
+	for path := match[1]; path != ""; {
+		if file, ok := origins[path]; ok {
+			return fmt.Errorf("%w (from %s)", err, file)
+		}
+		i := strings.LastIndex(path, ".")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return err
+}
@@ -0,0 +1,253 @@
+// pkg/config/load.go
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName 默认的配置文件名
+const FileName = "youKaConf.yaml"
+
+// fileNames 在目录中查找配置文件时依次尝试的文件名
+var fileNames = []string{FileName, "youKaConf.yml", "youKaConf.json", "youKaConf.toml"}
+
+// EnvConfigPath 指定配置文件路径（或所在目录）的环境变量
+const EnvConfigPath = "CONFIG_PATH"
+
+// ErrNotFound 所有候选路径下都没有找到配置文件
+var ErrNotFound = errors.New("config file not found")
+
+var (
+	mu sync.Mutex
+	// loadedPaths和loadedFormat 最近一次成功加载的文件路径及其格式，LoadLayered加载时包含多个文件
+	loadedPaths  []string
+	loadedFormat Format
+	// fileBase 默认值和配置文件合并后的配置，不含etcd配置和环境变量
+	fileBase Conf
+	// fileOrigins LoadLayered加载时各字段来自的文件
+	fileOrigins map[string]string
+	// fileSources 默认值和配置文件对各配置段的来源
+	fileSources provenance
+	// etcdOverlay 最近一次从etcd读取的配置，为nil表示未使用或key不存在
+	etcdOverlay []byte
+)
+
+// Load 读取并解析配置文件，成功后替换Config
+// 查找顺序：path参数、--config参数（见BindFlags）、$CONFIG_PATH、工作目录、/etc，path或$CONFIG_PATH为目录时在其中依次查找
+// youKaConf.yaml、youKaConf.yml、youKaConf.json、youKaConf.toml；文件格式按扩展名识别，未知扩展名按YAML解析；
+// 文件在Default的默认值之上解析，之后依次应用LoadFromEtcd读取的配置、YOUKA_前缀的环境变量（见EnvPrefix）和命令行参数，
+// 最后调用Validate校验；
+// 解析或校验失败时Config保持不变，可以重复调用
+func Load(path string) error {
+	return LoadFormat(path, "")
+}
+
+// LoadFormat 与Load相同，但按format解析文件，format为空时按扩展名识别
+func LoadFormat(path string, format Format) error {
+	mu.Lock()
+	file, err := find(path)
+	if err != nil {
+		mu.Unlock()
+		return err
+	}
+	old, conf, err := loadFiles([]string{file}, format)
+	mu.Unlock()
+	if err != nil {
+		return err
+	}
+	notifyChange(old, conf)
+	return nil
+}
+
+// MustLoad 按默认顺序查找并加载配置文件，失败时panic
+func MustLoad() {
+	if err := Load(""); err != nil {
+		panic(err)
+	}
+}
+
+// Reload 按上次的格式重新读取最近一次加载的配置文件（LoadLayered加载时为所有文件），尚未加载过时等价于Load("")
+func Reload() error {
+	mu.Lock()
+	files := loadedPaths
+	if len(files) == 0 {
+		file, err := find("")
+		if err != nil {
+			mu.Unlock()
+			return err
+		}
+		files = []string{file}
+	}
+	old, conf, err := loadFiles(files, loadedFormat)
+	mu.Unlock()
+	if err != nil {
+		return err
+	}
+	notifyChange(old, conf)
+	return nil
+}
+
+// Current 返回当前生效配置的副本，配置可能被Watch或Reload并发替换时应使用Current而不是直接读取Config
+func Current() Conf {
+	mu.Lock()
+	defer mu.Unlock()
+	return Config
+}
+
+// Path 返回最近一次成功加载的配置文件路径，LoadLayered加载时为第一个文件，尚未加载时为空
+func Path() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if len(loadedPaths) == 0 {
+		return ""
+	}
+	return loadedPaths[0]
+}
+
+// Paths 返回最近一次成功加载的所有配置文件路径
+func Paths() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]string(nil), loadedPaths...)
+}
+
+// loadFile 解析配置文件并替换Config，返回替换前后的配置，调用方需持有mu
+func loadFile(file string, format Format) (old, conf Conf, err error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return old, conf, fmt.Errorf("read config %s: %w", file, err)
+	}
+	if format == "" {
+		format = formatOf(file)
+	}
+	base, warnings, err := parse(data, format)
+	if err != nil {
+		return old, conf, fmt.Errorf("parse config %s: %w", file, err)
+	}
+	warnDeprecated(file, warnings)
+	files := fileProvenance(base, file)
+	conf, prov, err := compose(base, etcdOverlay, nil, files)
+	if err != nil {
+		return old, conf, fmt.Errorf("config %s: %w", file, err)
+	}
+	fileBase = base
+	fileOrigins = nil
+	fileSources = files
+	sources = prov
+	old = Config
+	Config = conf
+	loadedPaths = []string{file}
+	loadedFormat = format
+	return old, conf, nil
+}
+
+// compose 在base之上依次应用etcd配置、环境变量和命令行参数，读取密码和密钥文件并合并旧的服务配置布局后校验
+// origins记录各字段来自哪个文件，不为nil时在校验错误中注明；files为默认值和文件对各配置段的来源，
+// 返回值中加上etcd、环境变量和命令行参数的来源
+func compose(base Conf, overlay []byte, origins map[string]string, files provenance) (Conf, provenance, error) {
+	prov := files.clone()
+	conf := base
+	// 解码会向已有map中写入，复制后再叠加etcd配置，避免修改base
+	conf.Services = maps.Clone(base.Services)
+	if overlay != nil {
+		if err := decodeOverlay(overlay, &conf); err != nil {
+			return Conf{}, nil, fmt.Errorf("parse etcd config: %w", err)
+		}
+		prov.add(changedSections(base, conf), sourceEtcd)
+	}
+	before := conf
+	if err := applyEnv(&conf); err != nil {
+		return Conf{}, nil, fmt.Errorf("apply environment overrides: %w", err)
+	}
+	prov.add(changedSections(before, conf), sourceEnv)
+	before = conf
+	applyFlags(&conf)
+	prov.add(changedSections(before, conf), sourceFlags)
+	if err := resolveSecretFiles(&conf); err != nil {
+		return Conf{}, nil, fmt.Errorf("read secret files: %w", err)
+	}
+	conf.Services = conf.services()
+	// 规范化失败时保留原值，由Validate报告
+	if endpoints, err := conf.Etcd.Endpoints(); err == nil {
+		conf.Etcd.EtcdAddr = endpoints
+	}
+	if err := conf.Validate(); err != nil {
+		return Conf{}, nil, fmt.Errorf("invalid config: %w", annotateOrigins(err, origins))
+	}
+	return conf, prov, nil
+}
+
+// decodeOverlay 将etcd中的配置迁移到当前版本后叠加到conf上
+func decodeOverlay(overlay []byte, conf *Conf) error {
+	tree, err := parseTree(overlay, FormatYAML)
+	if err != nil {
+		return err
+	}
+	if _, err := migrate(tree); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	err = yaml.NewDecoder(bytes.NewReader(data)).Decode(conf)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// find 按查找顺序返回第一个存在的配置文件
+func find(path string) (string, error) {
+	var candidates []string
+	if path != "" {
+		candidates = append(candidates, path)
+	} else if flagValues.config != "" {
+		path = flagValues.config
+		candidates = append(candidates, path)
+	} else {
+		if env := os.Getenv(EnvConfigPath); env != "" {
+			candidates = append(candidates, env)
+		}
+		candidates = append(candidates, ".", "/etc")
+	}
+
+	var searched []string
+	for _, candidate := range candidates {
+		info, err := os.Stat(candidate)
+		if err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("stat config %s: %w", candidate, err)
+		}
+		if err == nil {
+			// 目录中按文件名顺序查找
+			for _, name := range fileNames {
+				file := filepath.Join(candidate, name)
+				if _, err := os.Stat(file); err == nil {
+					return file, nil
+				}
+				searched = append(searched, file)
+			}
+		} else {
+			searched = append(searched, candidate)
+		}
+		if path != "" {
+			// 显式指定的路径不存在时不再回退
+			break
+		}
+	}
+	return "", fmt.Errorf("%w: searched %s", ErrNotFound, strings.Join(searched, ", "))
+}
@@ -0,0 +1,187 @@
+// pkg/config/migrate.go
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// CurrentVersion 当前的配置版本
+//
+//	1 最初的布局：服务名和端口在rpcRegisterName、rpcPort中，registry.ttl为整数秒
+//	2 服务配置在services中，时长使用 "30s" 形式的字符串
+//
+// 未设置configVersion的文件按版本1处理
+const CurrentVersion = 2
+
+// Logger 输出配置迁移等提示的日志接口，registry.Logger满足该接口
+type Logger interface {
+	Warn(msg string, keyvals ...any)
+}
+
+type noopLogger struct{}
+
+func (noopLogger) Warn(string, ...any) {}
+
+// logger 由mu保护
+var logger Logger = noopLogger{}
+
+// SetLogger 设置输出配置弃用提示的日志，默认丢弃
+func SetLogger(l Logger) {
+	mu.Lock()
+	defer mu.Unlock()
+	if l == nil {
+		l = noopLogger{}
+	}
+	logger = l
+}
+
+// warnDeprecated 输出迁移提示，调用方需持有mu
+func warnDeprecated(file string, warnings []string) {
+	for _, warning := range warnings {
+		logger.Warn("deprecated config layout", "file", file, "detail", warning)
+	}
+}
+
+// migrations migrations[i]将版本i+1的配置树迁移到版本i+2
+var migrations = []func(tree map[string]any) []string{
+	migrateV1,
+}
+
+// migrate 将配置树迁移到CurrentVersion，返回弃用提示；版本高于CurrentVersion时返回错误
+func migrate(tree map[string]any) ([]string, error) {
+	version := 1
+	if raw, ok := tree["configVersion"]; ok {
+		v, err := versionOf(raw)
+		if err != nil {
+			return nil, err
+		}
+		version = v
+	}
+	if version < 1 {
+		return nil, fmt.Errorf("configVersion: invalid version %d", version)
+	}
+	if version > CurrentVersion {
+		return nil, fmt.Errorf("configVersion %d is newer than the supported version %d: upgrade this program", version, CurrentVersion)
+	}
+
+	var warnings []string
+	if _, ok := tree["configVersion"]; !ok {
+		warnings = append(warnings, fmt.Sprintf("configVersion is not set, assuming 1; set configVersion: %d", CurrentVersion))
+	}
+	for ; version < CurrentVersion; version++ {
+		warnings = append(warnings, migrations[version-1](tree)...)
+	}
+	tree["configVersion"] = CurrentVersion
+	return warnings, nil
+}
+
+func versionOf(raw any) (int, error) {
+	switch v := raw.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	case string:
+		if n, err := strconv.Atoi(v); err == nil {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("configVersion: invalid value %v", raw)
+}
+
+// migrateV1 将rpcRegisterName和rpcPort合并到services，registry.ttl整数秒转为时长字符串
+// 旧字段保留，仍然读取它们的代码不受影响；缺少服务名或端口、被services覆盖以及未知的旧字段不迁移，每个字段给出一条提示
+func migrateV1(tree map[string]any) []string {
+	var warnings []string
+
+	names, _ := tree["rpcRegisterName"].(map[string]any)
+	ports, _ := tree["rpcPort"].(map[string]any)
+	if names != nil || ports != nil {
+		warnings = append(warnings, "rpcRegisterName and rpcPort are deprecated, use services")
+		services, _ := tree["services"].(map[string]any)
+		if services == nil {
+			services = make(map[string]any)
+		}
+		// defaultName 旧布局没有服务名字段时使用的服务名，与Conf.services一致
+		legacy := []struct {
+			id, nameKey, portsKey, defaultName string
+		}{
+			{ServiceSCUser, "sCUserName", "sCUserPort", ""},
+			{ServiceRelay, "relayName", "", ""},
+			{ServiceGateway, "", "gatewayPort", ServiceGateway},
+		}
+		known := map[string]map[string]bool{"rpcRegisterName": {}, "rpcPort": {}}
+		for _, l := range legacy {
+			known["rpcRegisterName"][l.nameKey] = true
+			known["rpcPort"][l.portsKey] = true
+
+			// 文件中出现的旧字段，未迁移时逐个提示
+			var fields []string
+			service := make(map[string]any)
+			if l.defaultName != "" {
+				service["name"] = l.defaultName
+			}
+			if name, ok := names[l.nameKey]; ok && l.nameKey != "" {
+				fields = append(fields, "rpcRegisterName."+l.nameKey)
+				if name != "" {
+					service["name"] = name
+				}
+			}
+			if p, ok := ports[l.portsKey]; ok && l.portsKey != "" {
+				fields = append(fields, "rpcPort."+l.portsKey)
+				service["ports"] = p
+			}
+			if len(fields) == 0 {
+				continue
+			}
+
+			var reason string
+			switch {
+			case services[l.id] != nil:
+				reason = fmt.Sprintf("services.%s is set and takes precedence", l.id)
+			case l.portsKey == "":
+				reason = fmt.Sprintf("the old layout has no port for %s, set services.%s.name and services.%s.ports", l.id, l.id, l.id)
+			case service["name"] == nil:
+				reason = fmt.Sprintf("rpcRegisterName.%s is empty or not set, set services.%s.name", l.nameKey, l.id)
+			case service["ports"] == nil:
+				reason = fmt.Sprintf("rpcPort.%s is not set, set services.%s.ports", l.portsKey, l.id)
+			default:
+				// 缺少服务名或端口的旧配置无法注册，其余的迁移到services
+				services[l.id] = service
+				continue
+			}
+			for _, field := range fields {
+				warnings = append(warnings, fmt.Sprintf("%s is not migrated: %s", field, reason))
+			}
+		}
+		for _, section := range []struct {
+			name   string
+			fields map[string]any
+		}{{"rpcRegisterName", names}, {"rpcPort", ports}} {
+			for _, key := range slices.Sorted(maps.Keys(section.fields)) {
+				if !known[section.name][key] {
+					warnings = append(warnings, fmt.Sprintf("%s.%s is not migrated: unknown field of the old layout", section.name, key))
+				}
+			}
+		}
+		if len(services) > 0 {
+			tree["services"] = services
+		}
+	}
+
+	if registry, ok := tree["registry"].(map[string]any); ok {
+		switch ttl := registry["ttl"].(type) {
+		case int, int64, float64:
+			registry["ttl"] = fmt.Sprintf("%vs", ttl)
+			warnings = append(warnings, fmt.Sprintf("registry.ttl as integer seconds is deprecated, use \"%vs\"", ttl))
+		}
+	}
+	return warnings
+}
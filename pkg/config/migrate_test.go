@@ -0,0 +1,154 @@
+// pkg/config/migrate_test.go
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMigrateV1(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		file     string
+		services map[string]ServiceConf
+		// warnings 除configVersion和整体弃用提示之外的提示
+		warnings []string
+	}{
+		{
+			name: "complete",
+			file: `
+rpcRegisterName: {sCUserName: user-rpc}
+rpcPort: {sCUserPort: [10110], gatewayPort: [10200]}
+`,
+			services: map[string]ServiceConf{
+				ServiceSCUser:  {Name: "user-rpc", Ports: []int{10110}},
+				ServiceGateway: {Name: ServiceGateway, Ports: []int{10200}},
+			},
+		},
+		{
+			name:     "name without ports",
+			file:     `rpcRegisterName: {sCUserName: user-rpc}`,
+			services: map[string]ServiceConf{},
+			warnings: []string{"rpcRegisterName.sCUserName is not migrated: rpcPort.sCUserPort is not set"},
+		},
+		{
+			name:     "ports without name",
+			file:     `rpcPort: {sCUserPort: [10110]}`,
+			services: map[string]ServiceConf{},
+			warnings: []string{"rpcPort.sCUserPort is not migrated: rpcRegisterName.sCUserName is empty or not set"},
+		},
+		{
+			name: "empty name",
+			file: `
+rpcRegisterName: {sCUserName: ""}
+rpcPort: {sCUserPort: [10110]}
+`,
+			services: map[string]ServiceConf{},
+			warnings: []string{
+				"rpcRegisterName.sCUserName is not migrated: rpcRegisterName.sCUserName is empty or not set",
+				"rpcPort.sCUserPort is not migrated: rpcRegisterName.sCUserName is empty or not set",
+			},
+		},
+		{
+			name:     "relay",
+			file:     `rpcRegisterName: {relayName: relay-rpc}`,
+			services: map[string]ServiceConf{},
+			warnings: []string{"rpcRegisterName.relayName is not migrated: the old layout has no port for relay"},
+		},
+		{
+			name: "services take precedence",
+			file: `
+rpcRegisterName: {sCUserName: old-user-rpc}
+rpcPort: {sCUserPort: [10110]}
+services:
+  sCUser: {name: user-rpc, ports: [10111]}
+`,
+			services: map[string]ServiceConf{ServiceSCUser: {Name: "user-rpc", Ports: []int{10111}}},
+			warnings: []string{
+				"rpcRegisterName.sCUserName is not migrated: services.sCUser is set and takes precedence",
+				"rpcPort.sCUserPort is not migrated: services.sCUser is set and takes precedence",
+			},
+		},
+		{
+			name:     "unknown fields",
+			file:     `rpcRegisterName: {adminName: admin-rpc}`,
+			services: map[string]ServiceConf{},
+			warnings: []string{"rpcRegisterName.adminName is not migrated: unknown field of the old layout"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conf, warnings, err := parse([]byte(tc.file), FormatYAML)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if conf.ConfigVersion != CurrentVersion {
+				t.Errorf("configVersion: got %d, want %d", conf.ConfigVersion, CurrentVersion)
+			}
+			if len(conf.Services) != len(tc.services) {
+				t.Errorf("services: got %+v, want %+v", conf.Services, tc.services)
+			}
+			for id, want := range tc.services {
+				got := conf.Services[id]
+				if got.Name != want.Name || !slices.Equal(got.Ports, want.Ports) {
+					t.Errorf("services.%s: got %+v, want %+v", id, got, want)
+				}
+			}
+
+			// 去掉每个旧文件都有的两条提示，其余必须逐条对应
+			var rest []string
+			for _, warning := range warnings {
+				if !strings.HasPrefix(warning, "configVersion is not set") && !strings.HasPrefix(warning, "rpcRegisterName and rpcPort are deprecated") {
+					rest = append(rest, warning)
+				}
+			}
+			if len(rest) != len(tc.warnings) {
+				t.Fatalf("warnings: got %q, want %q", rest, tc.warnings)
+			}
+			for i, want := range tc.warnings {
+				if !strings.HasPrefix(rest[i], want) {
+					t.Errorf("warning %d: got %q, want prefix %q", i, rest[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestMigrateV1TTL(t *testing.T) {
+	for _, format := range []struct {
+		format Format
+		file   string
+	}{
+		{FormatYAML, "registry: {ttl: 15}"},
+		{FormatJSON, `{"registry": {"ttl": 15}}`},
+		{FormatTOML, "[registry]\nttl = 15"},
+	} {
+		conf, warnings, err := parse([]byte(format.file), format.format)
+		if err != nil {
+			t.Fatalf("parse %s: %v", format.format, err)
+		}
+		if got := conf.Registry.TTL.Std(); got != 15*time.Second {
+			t.Errorf("%s: ttl got %v, want 15s", format.format, got)
+		}
+		if !slices.ContainsFunc(warnings, func(w string) bool {
+			return strings.Contains(w, `registry.ttl as integer seconds is deprecated, use "15s"`)
+		}) {
+			t.Errorf("%s: no ttl warning in %q", format.format, warnings)
+		}
+	}
+}
+
+func TestMigrateRejectsFutureVersion(t *testing.T) {
+	_, _, err := parse([]byte("configVersion: 99\nservices: {sCUser: {name: user-rpc, ports: [1]}}"), FormatYAML)
+	if err == nil || !strings.Contains(err.Error(), "configVersion 99 is newer") {
+		t.Fatalf("future configVersion: got %v", err)
+	}
+}
+
+func TestCurrentVersionHasNoWarnings(t *testing.T) {
+	_, warnings, err := parse([]byte("configVersion: 2\nservices: {sCUser: {name: user-rpc, ports: [1]}}"), FormatYAML)
+	if err != nil || len(warnings) > 0 {
+		t.Fatalf("current configVersion: warnings %q, err %v", warnings, err)
+	}
+}
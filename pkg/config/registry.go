@@ -0,0 +1,88 @@
+// pkg/config/registry.go
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MinTTL 允许的最短租约时长，更短的租约在心跳抖动时容易过期
+const MinTTL = 2 * time.Second
+
+// RegistrySettings 解析后的注册中心行为配置
+type RegistrySettings struct {
+	TTL            time.Duration
+	Namespace      string
+	RequestTimeout time.Duration
+	RetryAttempts  int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	WatchDebounce  time.Duration
+	CacheTTL       time.Duration
+
+	InstanceName string
+	RegisteredBy bool
+
+	Audit           bool
+	AuditActor      string
+	AuditMaxRecords int
+	AuditTTL        time.Duration
+}
+
+// Settings 返回注册中心行为配置并校验取值范围，一次返回所有问题
+// 租约时长、请求超时和重试间隔必须为正，RetryAttempts为0时使用DefaultRetryAttempts，
+// AuditMaxRecords为0时使用DefaultAuditMaxRecords
+func (r *Registry) Settings() (RegistrySettings, error) {
+	s := RegistrySettings{
+		TTL:            r.TTL.Std(),
+		Namespace:      r.Namespace,
+		RequestTimeout: r.RequestTimeout.Std(),
+		RetryAttempts:  r.RetryAttempts,
+		RetryBaseDelay: r.RetryBaseDelay.Std(),
+		RetryMaxDelay:  r.RetryMaxDelay.Std(),
+		WatchDebounce:  r.WatchDebounce.Std(),
+		CacheTTL:       r.CacheTTL.Std(),
+
+		InstanceName: r.InstanceName,
+		RegisteredBy: r.RegisteredBy,
+
+		Audit:           r.Audit,
+		AuditActor:      r.AuditActor,
+		AuditMaxRecords: r.AuditMaxRecords,
+		AuditTTL:        r.AuditTTL.Std(),
+	}
+	if s.RetryAttempts == 0 {
+		s.RetryAttempts = DefaultRetryAttempts
+	}
+	if s.AuditMaxRecords == 0 {
+		s.AuditMaxRecords = DefaultAuditMaxRecords
+	}
+
+	var errs []error
+	if s.TTL < MinTTL {
+		errs = append(errs, fmt.Errorf("registry.ttl: %v is shorter than %v", s.TTL, MinTTL))
+	}
+	if s.RequestTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("registry.requestTimeout: %v must be positive", s.RequestTimeout))
+	}
+	if s.RetryAttempts < 1 {
+		errs = append(errs, fmt.Errorf("registry.retryAttempts: %d must be at least 1", s.RetryAttempts))
+	}
+	if s.RetryBaseDelay <= 0 || s.RetryMaxDelay < s.RetryBaseDelay {
+		errs = append(errs, fmt.Errorf("registry.retryBaseDelay and registry.retryMaxDelay: need 0 < retryBaseDelay <= retryMaxDelay"))
+	}
+	if s.WatchDebounce < 0 {
+		errs = append(errs, fmt.Errorf("registry.watchDebounce: must not be negative"))
+	}
+	if s.CacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("registry.cacheTTL: must not be negative"))
+	}
+	if s.AuditMaxRecords < 0 {
+		errs = append(errs, fmt.Errorf("registry.auditMaxRecords: %d must not be negative", s.AuditMaxRecords))
+	}
+	if s.AuditTTL < 0 {
+		errs = append(errs, fmt.Errorf("registry.auditTTL: must not be negative"))
+	}
+	return s, errors.Join(errs...)
+}
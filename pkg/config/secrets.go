@@ -0,0 +1,63 @@
+// pkg/config/secrets.go
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// redacted 脱敏后显示的值
+const redacted = "<redacted>"
+
+// resolveSecretFiles 读取PasswordFile和SecretFile，同时设置了对应的明文字段时返回错误
+func resolveSecretFiles(conf *Conf) error {
+	var errs []error
+	secrets := []struct {
+		field, fileField string
+		value            *string
+		file             string
+	}{
+		{"etcd.password", "etcd.passwordFile", &conf.Etcd.Password, conf.Etcd.PasswordFile},
+		{"etcd.secret", "etcd.secretFile", &conf.Etcd.Secret, conf.Etcd.SecretFile},
+	}
+	for _, s := range secrets {
+		if s.file == "" {
+			continue
+		}
+		if *s.value != "" {
+			errs = append(errs, fmt.Errorf("%s and %s are mutually exclusive", s.field, s.fileField))
+			continue
+		}
+		data, err := os.ReadFile(s.file)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.fileField, err))
+			continue
+		}
+		*s.value = strings.TrimSpace(string(data))
+	}
+	return errors.Join(errs...)
+}
+
+// Redacted 返回将Password和Secret替换为<redacted>后的副本，用于打印和导出配置
+func (c Conf) Redacted() Conf {
+	c.Etcd = c.Etcd.redacted()
+	return c
+}
+
+// String 实现fmt.Stringer，输出中Password和Secret已脱敏
+func (e Etcd) String() string {
+	type plain Etcd
+	return fmt.Sprintf("%+v", plain(e.redacted()))
+}
+
+func (e Etcd) redacted() Etcd {
+	if e.Password != "" {
+		e.Password = redacted
+	}
+	if e.Secret != "" {
+		e.Secret = redacted
+	}
+	return e
+}
@@ -0,0 +1,124 @@
+// pkg/config/secrets_test.go
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const secretFilesConfig = `
+etcd:
+  etcdAddr: ["127.0.0.1:2379"]
+  userName: root
+  passwordFile: %s
+  secretFile: %s
+  secretMode: none
+`
+
+// writeSecret 在临时目录中写入密钥文件并返回路径
+func writeSecret(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestLoadSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	password := writeSecret(t, dir, "password", "  s3cret-password\n")
+	secret := writeSecret(t, dir, "secret", "s3cret-key\n")
+	path := writeConfig(t, "youKaConf.yaml", fmt.Sprintf(secretFilesConfig, password, secret))
+	if err := Load(path); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	// 文件内容去掉首尾空白
+	if got := Current().Etcd; got.Password != "s3cret-password" || got.Secret != "s3cret-key" {
+		t.Fatalf("secrets from files: password %q, secret %q", got.Password, got.Secret)
+	}
+
+	// 重新加载时重新读取文件
+	writeSecret(t, dir, "password", "rotated-password")
+	if err := Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := Current().Etcd.Password; got != "rotated-password" {
+		t.Errorf("password after reload: got %q", got)
+	}
+
+	// 文件丢失时重新加载失败并保留原配置
+	if err := os.Remove(password); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reload(); err == nil || !strings.Contains(err.Error(), "etcd.passwordFile") {
+		t.Errorf("reload with missing password file: got %v", err)
+	}
+	if got := Current().Etcd.Password; got != "rotated-password" {
+		t.Errorf("password after failed reload: got %q", got)
+	}
+}
+
+func TestLoadSecretFileConflicts(t *testing.T) {
+	dir := t.TempDir()
+	password := writeSecret(t, dir, "password", "from-file")
+	secret := writeSecret(t, dir, "secret", "key")
+
+	// 明文和文件同时设置时报错，而不是静默选择其中一个
+	err := Load(writeConfig(t, "youKaConf.yaml", fmt.Sprintf(secretFilesConfig, password, secret)+"  password: inline\n"))
+	if err == nil || !strings.Contains(err.Error(), "etcd.password and etcd.passwordFile are mutually exclusive") {
+		t.Errorf("inline password with password file: got %v", err)
+	}
+	err = Load(writeConfig(t, "youKaConf.yaml", fmt.Sprintf(secretFilesConfig, password, secret)+"  secret: inline\n"))
+	if err == nil || !strings.Contains(err.Error(), "etcd.secret and etcd.secretFile are mutually exclusive") {
+		t.Errorf("inline secret with secret file: got %v", err)
+	}
+
+	// 环境变量设置的明文同样冲突
+	t.Setenv("YOUKA_ETCD_PASSWORD", "from-env")
+	err = Load(writeConfig(t, "youKaConf.yaml", fmt.Sprintf(secretFilesConfig, password, secret)))
+	if err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+		t.Errorf("env password with password file: got %v", err)
+	}
+}
+
+func TestSecretsRedacted(t *testing.T) {
+	dir := t.TempDir()
+	password := writeSecret(t, dir, "password", "s3cret-password")
+	secret := writeSecret(t, dir, "secret", "s3cret-key")
+	if err := Load(writeConfig(t, "youKaConf.yaml", fmt.Sprintf(secretFilesConfig, password, secret))); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	dump, err := Dump()
+	if err != nil {
+		t.Fatalf("dump: %v", err)
+	}
+	dumpJSON, err := DumpJSON()
+	if err != nil {
+		t.Fatalf("dump json: %v", err)
+	}
+	conf := Current()
+	for name, output := range map[string]string{
+		"Dump":     dump,
+		"DumpJSON": string(dumpJSON),
+		"Etcd":     conf.Etcd.String(),
+		"Conf %+v": fmt.Sprintf("%+v", conf),
+		"Redacted": fmt.Sprintf("%+v", conf.Redacted().Etcd),
+	} {
+		if strings.Contains(output, "s3cret") {
+			t.Errorf("%s leaks a secret: %s", name, output)
+		}
+		// JSON中的尖括号被转义，只检查占位符的文字部分
+		if !strings.Contains(output, "redacted") {
+			t.Errorf("%s: no %s placeholder: %s", name, redacted, output)
+		}
+	}
+	// 脱敏不修改当前配置
+	if conf.Etcd.Password != "s3cret-password" {
+		t.Errorf("redaction modified the config: %q", conf.Etcd.Password)
+	}
+}
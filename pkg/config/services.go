@@ -0,0 +1,61 @@
+// pkg/config/services.go
+package config
+
+import "sort"
+
+// 旧配置布局对应的服务标识
+const (
+	ServiceSCUser  = "sCUser"
+	ServiceRelay   = "relay"
+	ServiceGateway = "gateway"
+)
+
+// Service 返回当前配置中指定标识的服务
+func Service(id string) (ServiceConf, bool) {
+	conf := Current()
+	return conf.Service(id)
+}
+
+// ServiceIDs 返回当前配置中所有服务标识，按字典序排列
+func ServiceIDs() []string {
+	conf := Current()
+	return conf.ServiceIDs()
+}
+
+// Service 返回指定标识的服务，包括从旧配置布局合并的服务
+func (c *Conf) Service(id string) (ServiceConf, bool) {
+	service, ok := c.services()[id]
+	return service, ok
+}
+
+// ServiceIDs 返回所有服务标识，按字典序排列
+func (c *Conf) ServiceIDs() []string {
+	services := c.services()
+	ids := make([]string, 0, len(services))
+	for id := range services {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// services 合并Services和旧的RpcRegisterName、RpcPort布局，Services中的配置优先
+// 旧布局中只有同时配置了服务名和端口的服务才会被合并；rpcPort.gatewayPort没有对应的服务名，使用ServiceGateway，
+// rpcRegisterName.relayName没有对应的端口，无法注册，加载配置文件时会输出提示
+func (c *Conf) services() map[string]ServiceConf {
+	services := make(map[string]ServiceConf, len(c.Services)+3)
+	legacy := map[string]ServiceConf{
+		ServiceSCUser:  {Name: c.RpcRegisterName.SCUserName, Ports: c.RpcPort.SCUserPort},
+		ServiceRelay:   {Name: c.RpcRegisterName.RelayName},
+		ServiceGateway: {Name: ServiceGateway, Ports: c.RpcPort.GatewayPort},
+	}
+	for id, service := range legacy {
+		if service.Name != "" && len(service.Ports) > 0 {
+			services[id] = service
+		}
+	}
+	for id, service := range c.Services {
+		services[id] = service
+	}
+	return services
+}
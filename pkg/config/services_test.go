@@ -0,0 +1,123 @@
+// pkg/config/services_test.go
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// writeConfig 在临时目录中写入配置文件并返回路径
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+// warnRecorder 记录SetLogger收到的提示
+type warnRecorder struct {
+	mu      sync.Mutex
+	details []string
+}
+
+func (w *warnRecorder) Warn(msg string, keyvals ...any) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if keyvals[i] == "detail" {
+			msg += ": " + fmt.Sprint(keyvals[i+1])
+		}
+	}
+	w.details = append(w.details, msg)
+}
+
+// contains 是否有提示包含全部parts
+func (w *warnRecorder) contains(parts ...string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return slices.ContainsFunc(w.details, func(detail string) bool {
+		for _, part := range parts {
+			if !strings.Contains(detail, part) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// recordWarnings 在测试期间记录配置提示
+func recordWarnings(t *testing.T) *warnRecorder {
+	w := &warnRecorder{}
+	SetLogger(w)
+	t.Cleanup(func() { SetLogger(nil) })
+	return w
+}
+
+const legacyConfig = `
+etcd:
+  etcdAddr: ["127.0.0.1:2379"]
+rpcRegisterName:
+  sCUserName: user-rpc
+  relayName: relay-rpc
+rpcPort:
+  sCUserPort: [10110]
+  gatewayPort: [%d]
+`
+
+func TestLoadLegacyRelayAndGateway(t *testing.T) {
+	warnings := recordWarnings(t)
+	if err := Load(writeConfig(t, "youKaConf.yaml", fmt.Sprintf(legacyConfig, 10200))); err != nil {
+		t.Fatalf("load v1 config: %v", err)
+	}
+
+	user, ok := Service(ServiceSCUser)
+	if !ok || user.Name != "user-rpc" || !slices.Equal(user.Ports, []int{10110}) {
+		t.Errorf("sCUser: got %+v, %v", user, ok)
+	}
+	// 旧布局没有网关服务名，使用服务标识
+	gateway, ok := Service(ServiceGateway)
+	if !ok || gateway.Name != ServiceGateway || !slices.Equal(gateway.Ports, []int{10200}) {
+		t.Errorf("gateway: got %+v, %v", gateway, ok)
+	}
+	// 旧布局没有relay端口，不能注册，必须明确提示被丢弃的字段
+	if _, ok := Service(ServiceRelay); ok {
+		t.Errorf("relay without ports should not be a registrable service")
+	}
+	if !warnings.contains("rpcRegisterName.relayName", "services.relay.ports") {
+		t.Errorf("no warning naming rpcRegisterName.relayName, got %q", warnings.details)
+	}
+}
+
+func TestLoadLegacyGatewayPortValidated(t *testing.T) {
+	err := Load(writeConfig(t, "youKaConf.yaml", fmt.Sprintf(legacyConfig, 10110)))
+	if err == nil || !strings.Contains(err.Error(), "port 10110 already used") {
+		t.Fatalf("gatewayPort duplicating sCUserPort: got %v", err)
+	}
+
+	err = Load(writeConfig(t, "youKaConf.yaml", fmt.Sprintf(legacyConfig, 70000)))
+	if err == nil || !strings.Contains(err.Error(), "services.gateway.ports[0]: port 70000 out of range") {
+		t.Fatalf("gatewayPort out of range: got %v", err)
+	}
+}
+
+func TestConfLegacyServicesInCode(t *testing.T) {
+	conf := Default()
+	conf.RpcRegisterName.RelayName = "relay-rpc"
+	conf.RpcPort.GatewayPort = []int{10200}
+	conf.Services = map[string]ServiceConf{ServiceSCUser: {Name: "user-rpc", Ports: []int{10110}}}
+
+	if got, want := conf.ServiceIDs(), []string{ServiceGateway, ServiceSCUser}; !slices.Equal(got, want) {
+		t.Errorf("service ids: got %v, want %v", got, want)
+	}
+	conf.RpcPort.GatewayPort = []int{10110}
+	if err := conf.Validate(); err == nil || !strings.Contains(err.Error(), "already used") {
+		t.Errorf("duplicate legacy gateway port: got %v", err)
+	}
+}
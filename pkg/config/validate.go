@@ -0,0 +1,162 @@
+// pkg/config/validate.go
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Validate 校验当前生效的Config
+func Validate() error {
+	mu.Lock()
+	conf := Config
+	mu.Unlock()
+	return conf.Validate()
+}
+
+// Validate 校验配置，一次返回所有问题
+func (c *Conf) Validate() error {
+	var errs []error
+
+	if _, err := c.Etcd.Endpoints(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Etcd.DialTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("etcd.dialTimeout: %v must be positive", c.Etcd.DialTimeout))
+	}
+	if (c.Etcd.UserName == "") != (c.Etcd.Password == "") {
+		errs = append(errs, fmt.Errorf("etcd.userName and etcd.password must be set together"))
+	}
+
+	switch c.Etcd.SecretMode {
+	case "":
+		if c.Etcd.Secret != "" {
+			errs = append(errs, fmt.Errorf("etcd.secret is set but etcd.secretMode is empty: choose %q or %q", SecretModeEncrypt, SecretModeNone))
+		}
+	case SecretModeNone:
+	case SecretModeEncrypt:
+		if c.Etcd.Secret == "" {
+			errs = append(errs, fmt.Errorf("etcd.secretMode %q requires etcd.secret", SecretModeEncrypt))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("etcd.secretMode: unknown mode %q", c.Etcd.SecretMode))
+	}
+	if (c.Etcd.CertFile == "") != (c.Etcd.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("etcd.certFile and etcd.keyFile must be set together"))
+	}
+	files := []struct{ field, path string }{
+		{"etcd.caFile", c.Etcd.CAFile},
+		{"etcd.certFile", c.Etcd.CertFile},
+		{"etcd.keyFile", c.Etcd.KeyFile},
+	}
+	for _, f := range files {
+		if f.path == "" {
+			continue
+		}
+		if err := checkReadable(f.path); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.field, err))
+		}
+	}
+
+	if c.RpcRegisterIP != "" {
+		if _, err := c.RegisterIP(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	seen := make(map[int]string)
+	services := c.services()
+	for _, id := range c.ServiceIDs() {
+		errs = append(errs, services[id].validate(id)...)
+		for i, port := range services[id].Ports {
+			field := fmt.Sprintf("services.%s.ports[%d]", id, i)
+			if port < 1 || port > 65535 {
+				errs = append(errs, fmt.Errorf("%s: port %d out of range 1-65535", field, port))
+				continue
+			}
+			if prev, ok := seen[port]; ok {
+				errs = append(errs, fmt.Errorf("%s: port %d already used by %s", field, port, prev))
+				continue
+			}
+			seen[port] = field
+		}
+	}
+
+	if _, err := c.Registry.Settings(); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, c.Log.validate()...)
+
+	return errors.Join(errs...)
+}
+
+// validate 校验单个服务的注册配置，规则与registry.ServiceInfo.Validate一致，端口范围和冲突由调用方检查
+func (s ServiceConf) validate(id string) []error {
+	var errs []error
+	if s.Name == "" || strings.Contains(s.Name, "/") {
+		errs = append(errs, fmt.Errorf("services.%s.name: %q must be non-empty and must not contain '/'", id, s.Name))
+	}
+	if len(s.Ports) == 0 {
+		errs = append(errs, fmt.Errorf("services.%s.ports: at least one port is required", id))
+	}
+	if s.Weight < 0 {
+		errs = append(errs, fmt.Errorf("services.%s.weight: %d must not be negative", id, s.Weight))
+	}
+	for i, tag := range s.Tags {
+		if tag == "" {
+			errs = append(errs, fmt.Errorf("services.%s.tags[%d]: empty tag", id, i))
+		}
+	}
+	for key := range s.Metadata {
+		if key == "" {
+			errs = append(errs, fmt.Errorf("services.%s.metadata: empty key", id))
+		}
+	}
+	return errs
+}
+
+// checkReadable 确认文件存在且可读
+func checkReadable(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	return nil
+}
+
+// validate 校验日志配置
+func (l *Log) validate() []error {
+	var errs []error
+	switch strings.ToLower(l.Level) {
+	case "", "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log.level: unknown level %q, expected debug, info, warn or error", l.Level))
+	}
+	switch l.Format {
+	case "", LogFormatJSON, LogFormatConsole:
+	default:
+		errs = append(errs, fmt.Errorf("log.format: unknown format %q, expected %s or %s", l.Format, LogFormatJSON, LogFormatConsole))
+	}
+	switch l.Output {
+	case "", "stdout", "stderr":
+	default:
+		if info, err := os.Stat(filepath.Dir(l.Output)); err != nil {
+			errs = append(errs, fmt.Errorf("log.output: %w", err))
+		} else if !info.IsDir() {
+			errs = append(errs, fmt.Errorf("log.output: %s is not a directory", filepath.Dir(l.Output)))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,261 @@
+// pkg/config/watch.go
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce 合并编辑器保存时产生的多次文件事件
+const watchDebounce = 100 * time.Millisecond
+
+var subscribers struct {
+	mu     sync.Mutex
+	nextID int
+	change map[int]func(old, new Conf)
+	errs   map[int]func(error)
+	files  map[int]func(string)
+}
+
+// OnChange 订阅配置变化，配置内容变化时以替换前后的配置串行回调，返回取消订阅函数
+// Load、Reload和Watch触发的替换都会通知
+func OnChange(callback func(old, new Conf)) func() {
+	subscribers.mu.Lock()
+	defer subscribers.mu.Unlock()
+
+	if subscribers.change == nil {
+		subscribers.change = make(map[int]func(old, new Conf))
+	}
+	subscribers.nextID++
+	id := subscribers.nextID
+	subscribers.change[id] = callback
+	return func() {
+		subscribers.mu.Lock()
+		defer subscribers.mu.Unlock()
+		delete(subscribers.change, id)
+	}
+}
+
+// OnEtcdChange 只订阅Etcd部分的变化，例如用于轮换注册中心的凭据
+func OnEtcdChange(callback func(old, new Etcd)) func() {
+	return OnChange(func(old, new Conf) {
+		if !reflect.DeepEqual(old.Etcd, new.Etcd) {
+			callback(old.Etcd, new.Etcd)
+		}
+	})
+}
+
+// OnError 订阅Watch重新加载失败的错误，失败时保留原配置，返回取消订阅函数
+func OnError(callback func(error)) func() {
+	subscribers.mu.Lock()
+	defer subscribers.mu.Unlock()
+
+	if subscribers.errs == nil {
+		subscribers.errs = make(map[int]func(error))
+	}
+	subscribers.nextID++
+	id := subscribers.nextID
+	subscribers.errs[id] = callback
+	return func() {
+		subscribers.mu.Lock()
+		defer subscribers.mu.Unlock()
+		delete(subscribers.errs, id)
+	}
+}
+
+// OnFileChange 订阅配置引用的文件（例如TLS证书）的内容变化，Watch重新加载成功后以文件的绝对路径回调，
+// 返回取消订阅函数；可以在回调中调用注册中心的ReloadTLS完成证书轮换
+func OnFileChange(callback func(path string)) func() {
+	subscribers.mu.Lock()
+	defer subscribers.mu.Unlock()
+
+	if subscribers.files == nil {
+		subscribers.files = make(map[int]func(string))
+	}
+	subscribers.nextID++
+	id := subscribers.nextID
+	subscribers.files[id] = callback
+	return func() {
+		subscribers.mu.Lock()
+		defer subscribers.mu.Unlock()
+		delete(subscribers.files, id)
+	}
+}
+
+// notifyMu 保证回调按配置替换的顺序串行执行
+var notifyMu sync.Mutex
+
+// notifyChange 配置内容变化时通知订阅者
+func notifyChange(old, new Conf) {
+	if reflect.DeepEqual(old, new) {
+		return
+	}
+	notifyMu.Lock()
+	defer notifyMu.Unlock()
+
+	subscribers.mu.Lock()
+	callbacks := make([]func(old, new Conf), 0, len(subscribers.change))
+	for _, callback := range subscribers.change {
+		callbacks = append(callbacks, callback)
+	}
+	subscribers.mu.Unlock()
+
+	for _, callback := range callbacks {
+		callback(old, new)
+	}
+}
+
+// notifyError 通知重新加载失败
+func notifyError(err error) {
+	notifyMu.Lock()
+	defer notifyMu.Unlock()
+
+	subscribers.mu.Lock()
+	callbacks := make([]func(error), 0, len(subscribers.errs))
+	for _, callback := range subscribers.errs {
+		callbacks = append(callbacks, callback)
+	}
+	subscribers.mu.Unlock()
+
+	for _, callback := range callbacks {
+		callback(err)
+	}
+}
+
+// notifyFileChange 通知引用文件变化
+func notifyFileChange(path string) {
+	notifyMu.Lock()
+	defer notifyMu.Unlock()
+
+	subscribers.mu.Lock()
+	callbacks := make([]func(string), 0, len(subscribers.files))
+	for _, callback := range subscribers.files {
+		callbacks = append(callbacks, callback)
+	}
+	subscribers.mu.Unlock()
+
+	for _, callback := range callbacks {
+		callback(path)
+	}
+}
+
+// Watch 监听最近一次加载的配置文件（LoadLayered加载时为所有文件），文件变化时重新解析和校验并原子替换配置，
+// 校验失败时保留原配置并通过OnError通知；ctx结束时停止监听
+// 配置引用的TLS证书等文件同样被监听，内容变化时重新加载并通过OnFileChange通知；
+// 监听的是文件所在目录，编辑器以重命名方式保存文件时同样生效；需要先成功调用Load
+func Watch(ctx context.Context) error {
+	paths := Paths()
+	if len(paths) == 0 {
+		return errors.New("config: Watch called before a config file was loaded")
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	fw := &fileWatch{
+		watcher: watcher,
+		files:   make(map[string]bool),
+		dirs:    make(map[string]bool),
+		configs: make(map[string]bool),
+	}
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err == nil {
+			err = fw.add(abs)
+		}
+		if err != nil {
+			watcher.Close()
+			return err
+		}
+		fw.configs[abs] = true
+	}
+	fw.sync()
+
+	go func() {
+		defer watcher.Close()
+
+		timer := time.NewTimer(watchDebounce)
+		timer.Stop()
+		defer timer.Stop()
+		changed := make(map[string]bool)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				name, err := filepath.Abs(event.Name)
+				if err != nil || !fw.files[name] || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				changed[name] = true
+				timer.Reset(watchDebounce)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				notifyError(err)
+			case <-timer.C:
+				if err := Reload(); err != nil {
+					notifyError(err)
+					continue
+				}
+				fw.sync()
+				for name := range changed {
+					if !fw.configs[name] {
+						notifyFileChange(name)
+					}
+				}
+				clear(changed)
+			}
+		}
+	}()
+	return nil
+}
+
+// fileWatch 记录Watch监听的文件及其所在目录
+type fileWatch struct {
+	watcher *fsnotify.Watcher
+	files   map[string]bool
+	dirs    map[string]bool
+	// configs 配置文件本身，其余为配置引用的文件
+	configs map[string]bool
+}
+
+// add 监听文件所在目录
+func (fw *fileWatch) add(file string) error {
+	fw.files[file] = true
+	dir := filepath.Dir(file)
+	if fw.dirs[dir] {
+		return nil
+	}
+	if err := fw.watcher.Add(dir); err != nil {
+		return err
+	}
+	fw.dirs[dir] = true
+	return nil
+}
+
+// sync 监听当前配置引用的文件，无法监听的文件通过OnError通知
+func (fw *fileWatch) sync() {
+	conf := Current()
+	for _, file := range conf.referencedFiles() {
+		abs, err := filepath.Abs(file)
+		if err == nil {
+			err = fw.add(abs)
+		}
+		if err != nil {
+			notifyError(fmt.Errorf("watch %s: %w", file, err))
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// prommetrics/collector.go
+package prommetrics
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/YuanJey/grpc-etcd/registry"
+)
+
+// DefaultNamespace 默认的指标名前缀
+const DefaultNamespace = "grpc_etcd"
+
+// OtherService 超出服务名上限或不在白名单中的服务使用的service标签值
+const OtherService = "other"
+
+// help 已知指标的说明，未知指标使用指标名
+var help = map[string]string{
+	registry.MetricResolverUpdates:           "Number of resolver state updates pushed to gRPC.",
+	registry.MetricResolverUpdatesSuppressed: "Number of resolver updates skipped because the state did not change.",
+	registry.MetricResolverErrors:            "Number of resolver errors reported to gRPC, by error class.",
+	registry.MetricResolverAddresses:         "Number of addresses in the latest resolver state.",
+	registry.MetricResolverLastRefresh:       "Unix time of the latest successful resolver refresh from etcd.",
+	registry.MetricEtcdOpsInflight:           "Number of etcd requests in flight.",
+	registry.MetricEtcdOpsQueued:             "Number of etcd requests waiting for a concurrency slot.",
+	registry.MetricRegistrations:             "Number of service instances currently registered by this registry.",
+	registry.MetricLeaseRenewals:             "Number of successful lease keepalives.",
+	registry.MetricLeaseLost:                 "Number of lost leases.",
+	registry.MetricReRegisterAttempts:        "Number of re-registration attempts after a lease was lost.",
+	registry.MetricDiscoverCalls:             "Number of Discover calls.",
+	registry.MetricDiscoverErrors:            "Number of Discover calls that returned an error.",
+	registry.MetricDiscoverDuration:          "Duration of Discover calls in seconds.",
+	registry.MetricWatchEvents:               "Number of etcd watch events received for services.",
+	registry.MetricWatchRestarts:             "Number of service watches re-established after interruption.",
+	registry.MetricWatchInstances:            "Number of instances currently discovered for a watched service.",
+	registry.MetricWatchZeroInstances:        "Number of times a watched service dropped to zero instances.",
+	registry.MetricLeaseTTLRemaining:         "Remaining TTL of the instance lease in seconds, -1 while the lease is lost.",
+	registry.MetricKeepAliveInterruptions:    "Number of keepalive stream interruptions, by reason.",
+	registry.MetricKeepAliveRecovery:         "Seconds from a keepalive interruption until the first keepalive on the re-registered lease.",
+	registry.MetricEtcdOpDuration:            "Duration of etcd KV and lease requests in seconds, excluding time spent queued.",
+	registry.MetricEtcdSlowOps:               "Number of etcd requests slower than the slow op threshold.",
+	registry.MetricRegistrationVisibility:    "Seconds from an instance registration write until a watch delivery containing it completed.",
+	registry.MetricDeregistrationVisibility:  "Seconds from an instance deregistration until a watch delivery removing it completed.",
+	registry.MetricKeepAliveAge:              "Seconds since the latest successful keepalive of the instance, -1 while the lease is lost.",
+}
+
+// Option 收集器选项
+type Option func(*Collector)
+
+// WithNamespace 设置指标名前缀，默认DefaultNamespace，为空表示不加前缀
+func WithNamespace(namespace string) Option {
+	return func(c *Collector) {
+		c.namespace = namespace
+	}
+}
+
+// WithMaxServices 限制service标签的不同取值数，超出后新出现的服务记为OtherService，0表示不限制
+func WithMaxServices(n int) Option {
+	return func(c *Collector) {
+		c.maxServices = n
+	}
+}
+
+// WithServices 只为指定服务保留service标签，其他服务记为OtherService
+func WithServices(names ...string) Option {
+	return func(c *Collector) {
+		c.allowed = make(map[string]bool, len(names))
+		for _, name := range names {
+			c.allowed[name] = true
+		}
+	}
+}
+
+// WithBuckets 设置直方图的桶，默认prometheus.DefBuckets
+func WithBuckets(buckets []float64) Option {
+	return func(c *Collector) {
+		c.buckets = buckets
+	}
+}
+
+// Collector 实现registry.Metrics和prometheus.Collector，
+// 通过registry.WithMetrics接收注册中心指标，再注册到Prometheus导出
+//
+// 指标在第一次上报时创建，标签名取第一次上报时的标签；
+// 多个服务合并为OtherService后，仪表盘类指标只保留最后一次设置的值
+type Collector struct {
+	namespace   string
+	maxServices int
+	allowed     map[string]bool
+	buckets     []float64
+
+	mu       sync.Mutex
+	services map[string]bool
+	metrics  map[string]*metric
+}
+
+// metric 一个指标名对应的向量，只有一个字段非nil
+type metric struct {
+	labels    []string
+	counter   *prometheus.CounterVec
+	gauge     *prometheus.GaugeVec
+	histogram *prometheus.HistogramVec
+}
+
+// New 创建收集器
+func New(opts ...Option) *Collector {
+	c := &Collector{
+		namespace: DefaultNamespace,
+		buckets:   prometheus.DefBuckets,
+		services:  make(map[string]bool),
+		metrics:   make(map[string]*metric),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// IncCounter 实现registry.Metrics接口
+func (c *Collector) IncCounter(name string, labels map[string]string, delta float64) {
+	m, values := c.lookup(name, labels, func(opts prometheus.Opts, names []string) *metric {
+		return &metric{counter: prometheus.NewCounterVec(prometheus.CounterOpts(opts), names)}
+	})
+	if m.counter != nil {
+		m.counter.WithLabelValues(values...).Add(delta)
+	}
+}
+
+// SetGauge 实现registry.Metrics接口
+func (c *Collector) SetGauge(name string, labels map[string]string, value float64) {
+	m, values := c.lookup(name, labels, func(opts prometheus.Opts, names []string) *metric {
+		return &metric{gauge: prometheus.NewGaugeVec(prometheus.GaugeOpts(opts), names)}
+	})
+	if m.gauge != nil {
+		m.gauge.WithLabelValues(values...).Set(value)
+	}
+}
+
+// DeleteGauge 实现registry.MetricsDeleter接口
+// service标签被归并为OtherService时不删除，避免误删其他服务共用的时间序列
+func (c *Collector) DeleteGauge(name string, labels map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m, ok := c.metrics[name]
+	if !ok || m.gauge == nil {
+		return
+	}
+	values := make([]string, len(m.labels))
+	for i, label := range m.labels {
+		values[i] = labels[label]
+		if label == registry.LabelService && !c.services[values[i]] {
+			return
+		}
+	}
+	m.gauge.DeleteLabelValues(values...)
+}
+
+// ObserveHistogram 实现registry.Metrics接口
+func (c *Collector) ObserveHistogram(name string, labels map[string]string, value float64) {
+	m, values := c.lookup(name, labels, func(opts prometheus.Opts, names []string) *metric {
+		return &metric{histogram: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: opts.Namespace,
+			Name:      opts.Name,
+			Help:      opts.Help,
+			Buckets:   c.buckets,
+		}, names)}
+	})
+	if m.histogram != nil {
+		m.histogram.WithLabelValues(values...).Observe(value)
+	}
+}
+
+// lookup 返回指标及按其标签名排列的标签值，指标不存在时用create创建
+// 同名指标的类型以第一次上报为准，类型不符的上报通过nil字段被忽略
+func (c *Collector) lookup(name string, labels map[string]string, create func(prometheus.Opts, []string) *metric) (*metric, []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m, ok := c.metrics[name]
+	if !ok {
+		names := make([]string, 0, len(labels))
+		for label := range labels {
+			names = append(names, label)
+		}
+		sort.Strings(names)
+		text := help[name]
+		if text == "" {
+			text = name
+		}
+		m = create(prometheus.Opts{Namespace: c.namespace, Name: name, Help: text}, names)
+		m.labels = names
+		c.metrics[name] = m
+	}
+
+	values := make([]string, len(m.labels))
+	for i, label := range m.labels {
+		values[i] = labels[label]
+		if label == registry.LabelService {
+			values[i] = c.serviceLocked(values[i])
+		}
+	}
+	return m, values
+}
+
+// serviceLocked 按白名单和上限返回service标签值，调用方需持有c.mu
+func (c *Collector) serviceLocked(name string) string {
+	if c.allowed != nil && !c.allowed[name] {
+		return OtherService
+	}
+	if c.services[name] {
+		return name
+	}
+	if c.maxServices > 0 && len(c.services) >= c.maxServices {
+		return OtherService
+	}
+	c.services[name] = true
+	return name
+}
+
+// Describe 实现prometheus.Collector接口
+// 指标在运行时按需创建，不预先声明描述符，收集器作为unchecked collector注册
+func (c *Collector) Describe(chan<- *prometheus.Desc) {}
+
+// Collect 实现prometheus.Collector接口
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	metrics := make([]*metric, 0, len(c.metrics))
+	for _, m := range c.metrics {
+		metrics = append(metrics, m)
+	}
+	c.mu.Unlock()
+
+	for _, m := range metrics {
+		switch {
+		case m.counter != nil:
+			m.counter.Collect(ch)
+		case m.gauge != nil:
+			m.gauge.Collect(ch)
+		case m.histogram != nil:
+			m.histogram.Collect(ch)
+		}
+	}
+}
+
+var (
+	_ registry.Metrics     = (*Collector)(nil)
+	_ prometheus.Collector = (*Collector)(nil)
+)
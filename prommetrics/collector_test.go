@@ -0,0 +1,173 @@
+// prommetrics/collector_test.go
+package prommetrics
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/grpc/resolver"
+
+	"github.com/YuanJey/grpc-etcd/etcdtest"
+	"github.com/YuanJey/grpc-etcd/registry"
+	"github.com/YuanJey/grpc-etcd/resolvertest"
+)
+
+// gather 从reg收集指标，按指标名索引
+func gather(t *testing.T, reg *prometheus.Registry) map[string]*dto.MetricFamily {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+	return byName
+}
+
+// value 返回指标族中service标签为service的样本值，直方图返回样本数
+func value(family *dto.MetricFamily, service string) (float64, bool) {
+	if family == nil {
+		return 0, false
+	}
+	for _, m := range family.GetMetric() {
+		matched := false
+		for _, label := range m.GetLabel() {
+			if label.GetName() == registry.LabelService && label.GetValue() == service {
+				matched = true
+			}
+		}
+		if !matched {
+			continue
+		}
+		switch {
+		case m.Counter != nil:
+			return m.Counter.GetValue(), true
+		case m.Gauge != nil:
+			return m.Gauge.GetValue(), true
+		case m.Histogram != nil:
+			return float64(m.Histogram.GetSampleCount()), true
+		}
+	}
+	return 0, false
+}
+
+func TestCollectorRoundTrip(t *testing.T) {
+	srv := etcdtest.Start(t)
+	c := New()
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+
+	r, err := registry.NewEtcdRegistryWithConfig(srv.ClientConfig(), 5, registry.WithMetrics(c))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	defer r.Close()
+
+	const service = "orders"
+	cc, rsv, err := resolvertest.Build(r, r.Target(service))
+	if err != nil {
+		t.Fatalf("build resolver: %v", err)
+	}
+	defer rsv.Close()
+	if err := r.Watch(service, func([]*registry.ServiceInfo) {}); err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	if err := r.RegisterService(&registry.ServiceInfo{Name: service, Address: "10.0.0.1:80"}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if _, err := r.Discover(service); err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if _, err := r.Discover("missing"); err == nil {
+		t.Fatal("discover missing service: got nil error")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if _, err := cc.WaitForState(ctx, func(s resolver.State) bool { return len(s.Addresses) == 1 }); err != nil {
+		t.Fatalf("resolver state: %v", err)
+	}
+
+	// 心跳每TTL/3续约一次，等待第一次续约
+	wants := map[string]string{
+		registry.MetricRegistrations:     service,
+		registry.MetricLeaseRenewals:     service,
+		registry.MetricDiscoverCalls:     service,
+		registry.MetricDiscoverDuration:  service,
+		registry.MetricDiscoverErrors:    "missing",
+		registry.MetricWatchEvents:       service,
+		registry.MetricWatchInstances:    service,
+		registry.MetricResolverUpdates:   service,
+		registry.MetricResolverAddresses: service,
+	}
+	deadline := time.Now().Add(15 * time.Second)
+	for {
+		families := gather(t, reg)
+		var missing []string
+		for name, svc := range wants {
+			if v, ok := value(families[DefaultNamespace+"_"+name], svc); !ok || v <= 0 {
+				missing = append(missing, fmt.Sprintf("%s{service=%q}=%v", name, svc, v))
+			}
+		}
+		if len(missing) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("metrics still zero after a round trip: %v", missing)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestCollectorServiceCardinality(t *testing.T) {
+	c := New(WithMaxServices(2), WithNamespace("test"))
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	for _, service := range []string{"a", "b", "c", "d", "a"} {
+		c.IncCounter(registry.MetricDiscoverCalls, map[string]string{registry.LabelService: service}, 1)
+	}
+	family := gather(t, reg)["test_"+registry.MetricDiscoverCalls]
+	for service, want := range map[string]float64{"a": 2, "b": 1, OtherService: 2} {
+		if got, _ := value(family, service); got != want {
+			t.Errorf("service %s: got %v, want %v", service, got, want)
+		}
+	}
+	if len(family.GetMetric()) != 3 {
+		t.Errorf("series: got %d, want 3", len(family.GetMetric()))
+	}
+}
+
+func TestCollectorServiceAllowlist(t *testing.T) {
+	c := New(WithServices("orders"))
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	for _, service := range []string{"orders", "users", "billing"} {
+		c.SetGauge(registry.MetricRegistrations, map[string]string{registry.LabelService: service}, 1)
+	}
+	family := gather(t, reg)[DefaultNamespace+"_"+registry.MetricRegistrations]
+	if got, _ := value(family, "orders"); got != 1 {
+		t.Errorf("orders: got %v, want 1", got)
+	}
+	if _, ok := value(family, "users"); ok {
+		t.Error("users not in the allowlist but has its own series")
+	}
+	if _, ok := value(family, OtherService); !ok {
+		t.Error("no series for other services")
+	}
+
+	// 删除归并后的服务不影响共用的时间序列
+	c.DeleteGauge(registry.MetricRegistrations, map[string]string{registry.LabelService: "users"})
+	c.DeleteGauge(registry.MetricRegistrations, map[string]string{registry.LabelService: "orders"})
+	family = gather(t, reg)[DefaultNamespace+"_"+registry.MetricRegistrations]
+	if _, ok := value(family, OtherService); !ok {
+		t.Error("deleting a folded service removed the shared series")
+	}
+	if _, ok := value(family, "orders"); ok {
+		t.Error("orders series not deleted")
+	}
+}
@@ -0,0 +1,8 @@
+// Package prommetrics 将注册中心指标导出为Prometheus指标，核心包不依赖client_golang
+//
+// 典型用法：
+//
+//	collector := prommetrics.New(prommetrics.WithMaxServices(100))
+//	prometheus.MustRegister(collector)
+//	reg, err := registry.NewEtcdRegistry(addrs, ttl, registry.WithMetrics(collector))
+package prommetrics
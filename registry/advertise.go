@@ -0,0 +1,271 @@
+// registry/advertise.go
+package registry
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/YuanJey/grpc-etcd/pkg/config"
+)
+
+// IPFamily 地址族偏好
+type IPFamily int
+
+const (
+	// PreferIPv4 优先IPv4，没有IPv4地址时使用IPv6，默认值
+	PreferIPv4 IPFamily = iota
+	// PreferIPv6 优先IPv6，没有IPv6地址时使用IPv4
+	PreferIPv6
+)
+
+// DetectOption DetectAdvertiseIP的配置项
+type DetectOption func(*detectOptions)
+
+type detectOptions struct {
+	explicit   string
+	conf       *config.Conf
+	iface      string
+	family     IPFamily
+	exclude    []string
+	interfaces func() ([]netInterface, error)
+}
+
+// WithAdvertiseIP 直接使用ip，优先级最高，为空时忽略
+func WithAdvertiseIP(ip string) DetectOption {
+	return func(o *detectOptions) {
+		o.explicit = ip
+	}
+}
+
+// WithDetectConfig 使用conf中的RpcRegisterIP，默认使用config.Current()（已加载配置时）
+func WithDetectConfig(conf config.Conf) DetectOption {
+	return func(o *detectOptions) {
+		o.conf = &conf
+	}
+}
+
+// WithInterface 使用指定网卡上的地址，例如eth0
+func WithInterface(name string) DetectOption {
+	return func(o *detectOptions) {
+		o.iface = name
+	}
+}
+
+// WithIPFamily 设置地址族偏好，默认PreferIPv4
+func WithIPFamily(family IPFamily) DetectOption {
+	return func(o *detectOptions) {
+		o.family = family
+	}
+}
+
+// WithExcludeCIDRs 自动选择地址时排除这些网段，例如docker网桥172.17.0.0/16
+func WithExcludeCIDRs(cidrs ...string) DetectOption {
+	return func(o *detectOptions) {
+		o.exclude = append(o.exclude, cidrs...)
+	}
+}
+
+// netInterface 参与选择的网卡及其地址
+type netInterface struct {
+	name     string
+	up       bool
+	loopback bool
+	ips      []net.IP
+}
+
+// systemInterfaces 读取本机网卡，读取地址失败的网卡视为没有地址
+func systemInterfaces() ([]netInterface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("list interfaces: %w", err)
+	}
+	list := make([]netInterface, 0, len(ifaces))
+	for _, iface := range ifaces {
+		item := netInterface{name: iface.Name, up: iface.Flags&net.FlagUp != 0, loopback: iface.Flags&net.FlagLoopback != 0}
+		if addrs, err := iface.Addrs(); err == nil {
+			for _, addr := range addrs {
+				if ipNet, ok := addr.(*net.IPNet); ok {
+					item.ips = append(item.ips, ipNet.IP)
+				}
+			}
+		}
+		list = append(list, item)
+	}
+	return list, nil
+}
+
+// DetectAdvertiseIP 确定注册到etcd使用的IP
+//
+// 优先级依次为：WithAdvertiseIP；配置中的RpcRegisterIP（规则见config.ResolveIP）；WithInterface指定网卡上的地址；
+// 所有已启用网卡上的全局单播非回环地址，排除WithExcludeCIDRs的网段。
+// 同一步骤中按地址族偏好选择；自动选择时候选地址分布在多个网卡上视为有歧义，返回列出全部候选地址的错误
+func DetectAdvertiseIP(opts ...DetectOption) (net.IP, error) {
+	o := &detectOptions{interfaces: systemInterfaces}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.conf == nil {
+		if current := config.Current(); current.ConfigVersion != 0 {
+			o.conf = &current
+		}
+	}
+	return o.detect()
+}
+
+func (o *detectOptions) detect() (net.IP, error) {
+	if o.explicit != "" {
+		ip := net.ParseIP(o.explicit)
+		if ip == nil {
+			return nil, fmt.Errorf("detect advertise IP: invalid IP %q", o.explicit)
+		}
+		return ip, nil
+	}
+	if o.conf != nil && o.conf.RpcRegisterIP != "" {
+		ip, err := o.conf.RegisterIP()
+		if err != nil {
+			return nil, fmt.Errorf("detect advertise IP: %w", err)
+		}
+		return net.ParseIP(ip), nil
+	}
+
+	excluded := make([]*net.IPNet, 0, len(o.exclude))
+	for _, cidr := range o.exclude {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("detect advertise IP: invalid excluded CIDR %q: %v", cidr, err)
+		}
+		excluded = append(excluded, network)
+	}
+	ifaces, err := o.interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("detect advertise IP: %w", err)
+	}
+
+	if o.iface != "" {
+		for _, iface := range ifaces {
+			if iface.name != o.iface {
+				continue
+			}
+			if ip := o.pick(iface.ips); ip != nil {
+				return ip, nil
+			}
+			return nil, fmt.Errorf("detect advertise IP: interface %q has no usable address, available interfaces: %s", o.iface, describeCandidates(ifaces))
+		}
+		return nil, fmt.Errorf("detect advertise IP: no interface named %q, available interfaces: %s", o.iface, describeCandidates(ifaces))
+	}
+
+	// 按网卡收集候选地址，只保留偏好的地址族；偏好的地址族没有候选时使用另一个
+	var candidates []candidateIP
+	for _, iface := range ifaces {
+		if !iface.up || iface.loopback {
+			continue
+		}
+		for _, ip := range iface.ips {
+			if usableIP(ip) && !inNetworks(ip, excluded) {
+				candidates = append(candidates, candidateIP{iface: iface.name, ip: ip})
+			}
+		}
+	}
+	preferred := filterFamily(candidates, o.family)
+	if len(preferred) == 0 {
+		preferred = candidates
+	}
+	switch {
+	case len(preferred) == 0:
+		return nil, fmt.Errorf("detect advertise IP: no global unicast address found, interfaces: %s", describeCandidates(ifaces))
+	case spansInterfaces(preferred):
+		return nil, fmt.Errorf("detect advertise IP: ambiguous, candidates %s; choose one with WithAdvertiseIP, WithInterface or WithExcludeCIDRs",
+			describeIPs(preferred))
+	}
+	return preferred[0].ip, nil
+}
+
+// pick 按地址族偏好返回ips中第一个可用地址
+func (o *detectOptions) pick(ips []net.IP) net.IP {
+	var fallback net.IP
+	for _, ip := range ips {
+		if !usableIP(ip) {
+			continue
+		}
+		if isIPv4(ip) == (o.family == PreferIPv4) {
+			return ip
+		}
+		if fallback == nil {
+			fallback = ip
+		}
+	}
+	return fallback
+}
+
+type candidateIP struct {
+	iface string
+	ip    net.IP
+}
+
+// usableIP 可作为注册地址的全局单播地址
+func usableIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast()
+}
+
+func isIPv4(ip net.IP) bool {
+	return ip.To4() != nil
+}
+
+func inNetworks(ip net.IP, networks []*net.IPNet) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func filterFamily(candidates []candidateIP, family IPFamily) []candidateIP {
+	filtered := make([]candidateIP, 0, len(candidates))
+	for _, c := range candidates {
+		if isIPv4(c.ip) == (family == PreferIPv4) {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
+
+// spansInterfaces 候选地址是否来自多个网卡
+func spansInterfaces(candidates []candidateIP) bool {
+	for _, c := range candidates[1:] {
+		if c.iface != candidates[0].iface {
+			return true
+		}
+	}
+	return false
+}
+
+// describeIPs 将候选地址格式化为 10.0.0.2 (eth0), 172.17.0.1 (docker0)
+func describeIPs(candidates []candidateIP) string {
+	parts := make([]string, len(candidates))
+	for i, c := range candidates {
+		parts[i] = fmt.Sprintf("%s (%s)", c.ip, c.iface)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// describeCandidates 将网卡及其地址格式化为 eth0 [10.0.0.2, fe80::1]，用于错误信息
+func describeCandidates(ifaces []netInterface) string {
+	if len(ifaces) == 0 {
+		return "none"
+	}
+	parts := make([]string, len(ifaces))
+	for i, iface := range ifaces {
+		addrs := make([]string, len(iface.ips))
+		for j, ip := range iface.ips {
+			addrs[j] = ip.String()
+		}
+		state := ""
+		if !iface.up {
+			state = " (down)"
+		}
+		parts[i] = fmt.Sprintf("%s%s [%s]", iface.name, state, strings.Join(addrs, ", "))
+	}
+	return strings.Join(parts, ", ")
+}
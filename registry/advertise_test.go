@@ -0,0 +1,136 @@
+// registry/advertise_test.go
+package registry
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/YuanJey/grpc-etcd/pkg/config"
+)
+
+// syntheticInterfaces 使用给定网卡列表代替本机网卡
+func syntheticInterfaces(ifaces ...netInterface) DetectOption {
+	return func(o *detectOptions) {
+		o.interfaces = func() ([]netInterface, error) { return ifaces, nil }
+	}
+}
+
+// iface 创建已启用的网卡
+func iface(name string, ips ...string) netInterface {
+	item := netInterface{name: name, up: true}
+	for _, ip := range ips {
+		item.ips = append(item.ips, net.ParseIP(ip))
+	}
+	return item
+}
+
+var (
+	loopback = netInterface{name: "lo", up: true, loopback: true, ips: []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}}
+	eth0     = iface("eth0", "fe80::1", "10.0.0.2", "2001:db8::2")
+	docker0  = iface("docker0", "172.17.0.1")
+)
+
+// detect 在不读取已加载配置的情况下检测地址
+func detect(t *testing.T, opts ...DetectOption) (string, error) {
+	t.Helper()
+	ip, err := DetectAdvertiseIP(append([]DetectOption{WithDetectConfig(config.Conf{})}, opts...)...)
+	if err != nil {
+		return "", err
+	}
+	return ip.String(), nil
+}
+
+func TestDetectAdvertiseIPPrecedence(t *testing.T) {
+	ifaces := syntheticInterfaces(loopback, eth0, iface("eth1", "10.1.0.2"))
+	conf := config.Conf{RpcRegisterIP: "10.9.0.9"}
+	for _, tc := range []struct {
+		name string
+		opts []DetectOption
+		want string
+	}{
+		{"explicit over config and interface",
+			[]DetectOption{WithAdvertiseIP("10.8.0.8"), WithDetectConfig(conf), WithInterface("eth1")}, "10.8.0.8"},
+		{"config over interface", []DetectOption{WithDetectConfig(conf), WithInterface("eth1")}, "10.9.0.9"},
+		{"interface over automatic selection", []DetectOption{WithInterface("eth1")}, "10.1.0.2"},
+		{"empty explicit is ignored", []DetectOption{WithAdvertiseIP(""), WithDetectConfig(conf)}, "10.9.0.9"},
+	} {
+		got, err := detect(t, append([]DetectOption{ifaces}, tc.opts...)...)
+		if err != nil || got != tc.want {
+			t.Errorf("%s: got %s, %v, want %s", tc.name, got, err, tc.want)
+		}
+	}
+	if _, err := detect(t, ifaces, WithAdvertiseIP("not-an-ip")); err == nil || !strings.Contains(err.Error(), `invalid IP "not-an-ip"`) {
+		t.Errorf("invalid explicit IP: got %v", err)
+	}
+}
+
+func TestDetectAdvertiseIPInterface(t *testing.T) {
+	ifaces := syntheticInterfaces(loopback, eth0, iface("tun0", "fe80::9"))
+	// 链路本地地址不可用，按地址族偏好选择
+	if got, err := detect(t, ifaces, WithInterface("eth0")); err != nil || got != "10.0.0.2" {
+		t.Errorf("eth0: got %s, %v", got, err)
+	}
+	if got, err := detect(t, ifaces, WithInterface("eth0"), WithIPFamily(PreferIPv6)); err != nil || got != "2001:db8::2" {
+		t.Errorf("eth0 preferring IPv6: got %s, %v", got, err)
+	}
+	_, err := detect(t, ifaces, WithInterface("tun0"))
+	if err == nil || !strings.Contains(err.Error(), `interface "tun0" has no usable address`) {
+		t.Errorf("interface without usable address: got %v", err)
+	}
+	_, err = detect(t, ifaces, WithInterface("eth9"))
+	if err == nil || !strings.Contains(err.Error(), `no interface named "eth9"`) ||
+		!strings.Contains(err.Error(), "eth0 [fe80::1, 10.0.0.2, 2001:db8::2]") {
+		t.Errorf("missing interface: got %v", err)
+	}
+}
+
+func TestDetectAdvertiseIPAutomatic(t *testing.T) {
+	down := iface("eth2", "10.2.0.2")
+	down.up = false
+	for _, tc := range []struct {
+		name   string
+		ifaces []netInterface
+		opts   []DetectOption
+		want   string
+	}{
+		{"skips loopback and down interfaces", []netInterface{loopback, eth0, down}, nil, "10.0.0.2"},
+		{"prefers IPv6", []netInterface{loopback, eth0}, []DetectOption{WithIPFamily(PreferIPv6)}, "2001:db8::2"},
+		{"falls back to the other family", []netInterface{iface("eth0", "2001:db8::3")}, nil, "2001:db8::3"},
+		{"excluded CIDR resolves ambiguity", []netInterface{eth0, docker0}, []DetectOption{WithExcludeCIDRs("172.17.0.0/16")}, "10.0.0.2"},
+		{"several addresses on one interface", []netInterface{iface("eth0", "10.0.0.2", "10.0.0.3")}, nil, "10.0.0.2"},
+	} {
+		got, err := detect(t, append([]DetectOption{syntheticInterfaces(tc.ifaces...)}, tc.opts...)...)
+		if err != nil || got != tc.want {
+			t.Errorf("%s: got %s, %v, want %s", tc.name, got, err, tc.want)
+		}
+	}
+}
+
+func TestDetectAdvertiseIPErrors(t *testing.T) {
+	// 候选地址分布在多个网卡上时列出全部候选
+	_, err := detect(t, syntheticInterfaces(loopback, eth0, docker0))
+	if err == nil || !strings.Contains(err.Error(), "ambiguous, candidates 10.0.0.2 (eth0), 172.17.0.1 (docker0)") {
+		t.Errorf("ambiguous: got %v", err)
+	}
+	_, err = detect(t, syntheticInterfaces(loopback, iface("tun0", "fe80::9")))
+	if err == nil || !strings.Contains(err.Error(), "no global unicast address found") || !strings.Contains(err.Error(), "lo [127.0.0.1, ::1]") {
+		t.Errorf("no candidates: got %v", err)
+	}
+	_, err = detect(t, syntheticInterfaces(eth0), WithExcludeCIDRs("172.17.0.0"))
+	if err == nil || !strings.Contains(err.Error(), `invalid excluded CIDR "172.17.0.0"`) {
+		t.Errorf("invalid CIDR: got %v", err)
+	}
+	_, err = detect(t, syntheticInterfaces(eth0), WithDetectConfig(config.Conf{RpcRegisterIP: "no-such-interface0"}))
+	if err == nil {
+		t.Error("unresolvable rpcRegisterIP: got nil error")
+	}
+	listErr := errors.New("netlink unavailable")
+	_, err = detect(t, func(o *detectOptions) {
+		o.interfaces = func() ([]netInterface, error) { return nil, listErr }
+	})
+	if !errors.Is(err, listErr) {
+		t.Errorf("interface listing error: got %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+// registry/attributes.go
+package registry
+
+import (
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+)
+
+// serviceInfoKey resolver.Address属性中保存*ServiceInfo的key
+type serviceInfoKey struct{}
+
+// staleKey resolver.Address负载均衡属性中标记地址来自过期缓存的key
+type staleKey struct{}
+
+// fallbackKey 标记地址来自静态兜底配置的key
+type fallbackKey struct{}
+
+// metricsKey resolver.State属性中携带注册中心指标接收器的key
+type metricsKey struct{}
+
+// newAddress 根据服务信息构造指定地址的resolver.Address
+func newAddress(service *ServiceInfo, addr string) resolver.Address {
+	return resolver.Address{
+		Addr:       addr,
+		ServerName: service.ServerName,
+		Attributes: attributes.New(serviceInfoKey{}, service),
+	}
+}
+
+// newEndpoint 根据服务信息构造resolver.Endpoint，包含实例的全部地址
+func newEndpoint(service *ServiceInfo, stale bool) resolver.Endpoint {
+	endpoint := resolver.Endpoint{
+		Addresses:  []resolver.Address{newAddress(service, service.Address)},
+		Attributes: attributes.New(serviceInfoKey{}, service),
+	}
+	for _, addr := range service.Addresses {
+		if addr != service.Address {
+			endpoint.Addresses = append(endpoint.Addresses, newAddress(service, addr))
+		}
+	}
+	if stale {
+		endpoint.Attributes = endpoint.Attributes.WithValue(staleKey{}, true)
+	}
+	return endpoint
+}
+
+// ResolverState 构造与etcd resolver相同形式的resolver.State：过滤掉非up状态的实例后按地址去重排序，
+// 每个实例对应一个Endpoint并展开到Addresses，地址附带ServiceInfoFromAddress可读取的服务信息；
+// 不包含过期标记、兜底地址、流量划分和服务配置，供Registry的其他实现（例如registrytest）复用
+func ResolverState(services []*ServiceInfo) resolver.State {
+	var state resolver.State
+	for _, service := range dedupServices(upServices(services)) {
+		endpoint := newEndpoint(service, false)
+		state.Addresses = append(state.Addresses, endpoint.Addresses...)
+		state.Endpoints = append(state.Endpoints, endpoint)
+	}
+	return state
+}
+
+// ServiceInfoFromEndpoint 从resolver.Endpoint中取出resolver附带的服务信息
+func ServiceInfoFromEndpoint(endpoint resolver.Endpoint) (*ServiceInfo, bool) {
+	service, ok := endpoint.Attributes.Value(serviceInfoKey{}).(*ServiceInfo)
+	return service, ok && service != nil
+}
+
+// IsStaleEndpoint 判断实例是否为etcd不可用时沿用的最近一次成功结果
+func IsStaleEndpoint(endpoint resolver.Endpoint) bool {
+	stale, _ := endpoint.Attributes.Value(staleKey{}).(bool)
+	return stale
+}
+
+// ServiceInfoFromAddress 从resolver.Address中取出resolver附带的服务信息，
+// 供自定义balancer/picker读取版本、权重、可用区和元数据
+func ServiceInfoFromAddress(addr resolver.Address) (*ServiceInfo, bool) {
+	service, ok := addr.Attributes.Value(serviceInfoKey{}).(*ServiceInfo)
+	return service, ok && service != nil
+}
+
+// markStale 标记地址来自etcd不可用期间保留的缓存
+// 使用BalancerAttributes以免影响子连接的复用
+func markStale(addr resolver.Address) resolver.Address {
+	addr.BalancerAttributes = addr.BalancerAttributes.WithValue(staleKey{}, true)
+	return addr
+}
+
+// IsStaleAddress 判断地址是否为etcd不可用时沿用的最近一次成功结果
+func IsStaleAddress(addr resolver.Address) bool {
+	stale, _ := addr.BalancerAttributes.Value(staleKey{}).(bool)
+	return stale
+}
+
+// markFallback 标记地址来自静态兜底配置
+func markFallback(addr resolver.Address) resolver.Address {
+	addr.BalancerAttributes = addr.BalancerAttributes.WithValue(fallbackKey{}, true)
+	return addr
+}
+
+// IsFallbackAddress 判断地址是否来自WithFallbackAddresses配置的静态兜底地址
+func IsFallbackAddress(addr resolver.Address) bool {
+	fallback, _ := addr.BalancerAttributes.Value(fallbackKey{}).(bool)
+	return fallback
+}
+
+// IsFallbackEndpoint 判断实例是否来自WithFallbackAddresses配置的静态兜底地址
+func IsFallbackEndpoint(endpoint resolver.Endpoint) bool {
+	fallback, _ := endpoint.Attributes.Value(fallbackKey{}).(bool)
+	return fallback
+}
+
+// MetricsFromState 从resolver.State的属性中取出注册中心通过WithMetrics设置的指标接收器，
+// lb包中的balancer通过它上报选择计数，与注册中心的指标使用同一个接收器；未设置WithMetrics时返回false
+func MetricsFromState(attrs *attributes.Attributes) (Metrics, bool) {
+	metrics, ok := attrs.Value(metricsKey{}).(Metrics)
+	return metrics, ok && metrics != nil
+}
@@ -0,0 +1,151 @@
+// registry/audit.go
+package registry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// 审计记录的操作类型
+const (
+	AuditRegister   = "register"
+	AuditDeregister = "deregister"
+	AuditUpdate     = "update"
+)
+
+// DefaultAuditMaxRecords 每个服务默认保留的审计记录数
+const DefaultAuditMaxRecords = 100
+
+// AuditRecord 一次注册变更的审计记录
+type AuditRecord struct {
+	Time    time.Time `json:"ts"`
+	Actor   string    `json:"actor"`
+	Action  string    `json:"action"`
+	Service string    `json:"service"`
+	Address string    `json:"address"`
+	Key     string    `json:"key"`
+}
+
+// auditOptions WithAudit配置的审计参数
+type auditOptions struct {
+	actor      string
+	maxRecords int
+	ttl        time.Duration
+}
+
+// auditPrefix 服务审计记录在etcd中的前缀
+func auditPrefix(serviceName string) string {
+	return fmt.Sprintf("/services-audit/%s/", serviceName)
+}
+
+// auditKey 审计记录的key，以纳秒时间戳开头保证按key排序即按时间排序，随机后缀避免多个进程同时写入时冲突
+func auditKey(serviceName string, t time.Time) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s%020d-%s", auditPrefix(serviceName), t.UnixNano(), hex.EncodeToString(suffix))
+}
+
+// writeAudit 写入一条审计记录并按保留条数删除最旧的记录
+// 审计是尽力而为的，失败只记录日志，不影响注册、注销和更新的结果
+func (r *EtcdRegistry) writeAudit(ctx context.Context, action string, info *ServiceInfo) {
+	if !r.opts.auditEnabled {
+		return
+	}
+	audit := &r.opts.audit
+	record := AuditRecord{
+		Time:    time.Now(),
+		Actor:   audit.actor,
+		Action:  action,
+		Service: info.Name,
+		Address: info.Address,
+		Key:     serviceKey(info.Name, info.Address),
+	}
+	if err := r.putAudit(ctx, audit, record); err != nil {
+		r.opts.logger.Warn("write audit record failed",
+			"service", info.Name, "address", info.Address, "action", action, "error", err)
+	}
+}
+
+func (r *EtcdRegistry) putAudit(ctx context.Context, audit *auditOptions, record AuditRecord) error {
+	ctx, cancel := context.WithTimeout(ctx, r.opts.requestTimeout)
+	defer cancel()
+
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	var putOpts []clientv3.OpOption
+	if audit.ttl > 0 {
+		grant, err := r.lease.Grant(ctx, int64(max(audit.ttl.Seconds(), 1)))
+		if err != nil {
+			return fmt.Errorf("grant audit lease: %w", err)
+		}
+		putOpts = append(putOpts, clientv3.WithLease(grant.ID))
+	}
+	if _, err := r.kv.Put(ctx, auditKey(record.Service, record.Time), string(value), putOpts...); err != nil {
+		return err
+	}
+	if audit.maxRecords <= 0 {
+		return nil
+	}
+
+	prefix := auditPrefix(record.Service)
+	count, err := r.kv.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		return fmt.Errorf("count audit records: %w", err)
+	}
+	excess := count.Count - int64(audit.maxRecords)
+	if excess <= 0 {
+		return nil
+	}
+	oldest, err := r.kv.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly(),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend), clientv3.WithLimit(excess))
+	if err != nil {
+		return fmt.Errorf("list audit records: %w", err)
+	}
+	if len(oldest.Kvs) == 0 {
+		return nil
+	}
+	// 删除从前缀开始到最旧的第excess条记录为止的区间
+	last := string(oldest.Kvs[len(oldest.Kvs)-1].Key)
+	if _, err := r.kv.Delete(ctx, prefix, clientv3.WithRange(last+"\x00")); err != nil {
+		return fmt.Errorf("trim audit records: %w", err)
+	}
+	return nil
+}
+
+// ReadAudit 读取服务最近的审计记录，按时间从新到旧排列，limit不大于0时返回全部保留的记录
+// 是否开启审计不影响读取，可以在未开启审计的进程中查看其他进程写入的记录
+func (r *EtcdRegistry) ReadAudit(ctx context.Context, serviceName string, limit int) ([]AuditRecord, error) {
+	ctx, cancel := r.opContext(ctx)
+	defer cancel()
+
+	getOpts := []clientv3.OpOption{clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortDescend)}
+	if limit > 0 {
+		getOpts = append(getOpts, clientv3.WithLimit(int64(limit)))
+	}
+	var resp *clientv3.GetResponse
+	err := r.retry(ctx, "read-audit", serviceName, func(ctx context.Context) (err error) {
+		resp, err = r.kv.Get(ctx, auditPrefix(serviceName), getOpts...)
+		return err
+	})
+	if err != nil {
+		return nil, wrapError("read-audit", serviceName, "", err)
+	}
+	records := make([]AuditRecord, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var record AuditRecord
+		if err := json.Unmarshal(kv.Value, &record); err != nil {
+			r.opts.logger.Warn("skipping unreadable audit record", "key", string(kv.Key), "error", err)
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
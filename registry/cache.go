@@ -0,0 +1,69 @@
+// registry/cache.go
+package registry
+
+import (
+	"sync"
+	"time"
+)
+
+// discoverCache 按服务名缓存Discover结果，ttl为0时不缓存
+type discoverCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	services []*ServiceInfo
+	expires  time.Time
+}
+
+func newDiscoverCache(ttl time.Duration) *discoverCache {
+	return &discoverCache{ttl: ttl, entries: make(map[string]cacheEntry)}
+}
+
+// get 返回未过期的缓存结果的副本
+func (c *discoverCache) get(serviceName string) ([]*ServiceInfo, bool) {
+	if c.ttl <= 0 {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[serviceName]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, serviceName)
+		return nil, false
+	}
+	return copyServices(entry.services), true
+}
+
+// put 缓存结果的副本，调用方之后修改返回值不影响缓存
+func (c *discoverCache) put(serviceName string, services []*ServiceInfo) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[serviceName] = cacheEntry{services: copyServices(services), expires: time.Now().Add(c.ttl)}
+}
+
+func copyServices(services []*ServiceInfo) []*ServiceInfo {
+	copied := make([]*ServiceInfo, len(services))
+	for i, service := range services {
+		s := *service
+		copied[i] = &s
+	}
+	return copied
+}
+
+// len 返回缓存中的服务数，包括尚未清理的过期项
+func (c *discoverCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
@@ -0,0 +1,113 @@
+// registry/client.go
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
+)
+
+// tlsOptions etcd客户端TLS配置
+type tlsOptions struct {
+	config             *tls.Config
+	caFile             string
+	certFile           string
+	keyFile            string
+	insecureSkipVerify bool
+	// serverName 覆盖证书校验使用的服务端名称，例如etcd位于四层负载均衡之后时
+	serverName string
+	// reloader 从文件加载的客户端证书，可通过ReloadTLS重新加载
+	reloader *certReloader
+}
+
+// enabled 是否配置了任何TLS选项
+func (t *tlsOptions) enabled() bool {
+	return t.config != nil || t.caFile != "" || t.certFile != "" || t.keyFile != "" ||
+		t.insecureSkipVerify || t.serverName != ""
+}
+
+// build 加载证书并构造tls.Config，证书文件无法读取或格式错误时返回错误
+func (t *tlsOptions) build() (*tls.Config, error) {
+	var config *tls.Config
+	if t.config != nil {
+		config = t.config.Clone()
+	} else {
+		config = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	if t.caFile != "" {
+		pem, err := os.ReadFile(t.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read etcd CA file %s: %w", t.caFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("etcd CA file %s contains no valid PEM certificates", t.caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if t.certFile != "" || t.keyFile != "" {
+		if t.certFile == "" || t.keyFile == "" {
+			return nil, fmt.Errorf("etcd client certificate requires both cert file and key file, got cert=%q key=%q",
+				t.certFile, t.keyFile)
+		}
+		reloader := &certReloader{certFile: t.certFile, keyFile: t.keyFile}
+		if err := reloader.load(); err != nil {
+			return nil, err
+		}
+		t.reloader = reloader
+		config.GetClientCertificate = reloader.getClientCertificate
+	}
+
+	if t.insecureSkipVerify {
+		config.InsecureSkipVerify = true
+	}
+	if t.serverName != "" {
+		config.ServerName = t.serverName
+	}
+	return config, nil
+}
+
+// fillClientConfig 用配置项填充etcd客户端配置中的零值字段，调用方已设置的字段保持不变
+func (o *options) fillClientConfig(config *clientv3.Config) error {
+	if config.AutoSyncInterval == 0 {
+		config.AutoSyncInterval = o.autoSyncInterval
+	}
+	if config.DialTimeout == 0 {
+		config.DialTimeout = o.dialTimeout
+	}
+	if config.DialKeepAliveTime == 0 {
+		config.DialKeepAliveTime = o.keepAliveTime
+	}
+	if config.DialKeepAliveTimeout == 0 {
+		config.DialKeepAliveTimeout = o.keepAliveTimeout
+	}
+	if config.MaxCallSendMsgSize == 0 {
+		config.MaxCallSendMsgSize = o.maxCallSendMsgSize
+	}
+	if config.MaxCallRecvMsgSize == 0 {
+		config.MaxCallRecvMsgSize = o.maxCallRecvMsgSize
+	}
+	// WithAuth配置的凭据由authenticator管理以便运行时替换，不交给clientv3
+	if o.transportCreds != nil {
+		if config.TLS != nil {
+			return fmt.Errorf("conflicting etcd transport security: WithTransportCredentials cannot be combined with clientv3.Config.TLS")
+		}
+		// clientv3会把DialOptions放在最后，这里的凭据会生效
+		config.DialOptions = append(config.DialOptions, grpc.WithTransportCredentials(o.transportCreds))
+	}
+	config.DialOptions = append(config.DialOptions, o.dialOptions...)
+	if config.TLS == nil && o.tls.enabled() {
+		tlsConfig, err := o.tls.build()
+		if err != nil {
+			return err
+		}
+		config.TLS = tlsConfig
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+// registry/client_test.go
+package registry
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
+
+	"github.com/YuanJey/grpc-etcd/etcdtest"
+)
+
+// filledConfig 按opts填充config并返回结果
+func filledConfig(t *testing.T, config clientv3.Config, opts ...Option) clientv3.Config {
+	t.Helper()
+	o, err := newOptions(opts)
+	if err != nil {
+		t.Fatalf("options: %v", err)
+	}
+	if err := o.fillClientConfig(&config); err != nil {
+		t.Fatalf("fill client config: %v", err)
+	}
+	return config
+}
+
+func TestFillClientConfigDefaults(t *testing.T) {
+	config := filledConfig(t, clientv3.Config{Endpoints: []string{"127.0.0.1:2379"}})
+	if config.DialTimeout != 5*time.Second {
+		t.Errorf("DialTimeout: got %v, want 5s", config.DialTimeout)
+	}
+	if config.DialKeepAliveTime != 30*time.Second || config.DialKeepAliveTimeout != 10*time.Second {
+		t.Errorf("keepalive: got %v/%v, want 30s/10s", config.DialKeepAliveTime, config.DialKeepAliveTimeout)
+	}
+	if config.MaxCallSendMsgSize != 0 || config.MaxCallRecvMsgSize != 0 {
+		t.Errorf("message sizes: got %d/%d, want clientv3 defaults", config.MaxCallSendMsgSize, config.MaxCallRecvMsgSize)
+	}
+	if config.TLS != nil {
+		t.Errorf("TLS without TLS options: got %+v", config.TLS)
+	}
+}
+
+func TestFillClientConfigOptions(t *testing.T) {
+	dialOpt := grpc.WithUserAgent("test")
+	config := filledConfig(t, clientv3.Config{Endpoints: []string{"127.0.0.1:2379"}},
+		WithDialTimeout(2*time.Second),
+		WithDialKeepAlive(5*time.Second, time.Second),
+		WithMaxCallMsgSize(4<<20, 8<<20),
+		WithAutoSyncInterval(time.Minute),
+		WithDialOptions(dialOpt),
+		WithInsecureSkipVerify(),
+		WithTLSServerName("etcd.internal"))
+	if config.DialTimeout != 2*time.Second {
+		t.Errorf("DialTimeout: got %v, want 2s", config.DialTimeout)
+	}
+	if config.DialKeepAliveTime != 5*time.Second || config.DialKeepAliveTimeout != time.Second {
+		t.Errorf("keepalive: got %v/%v, want 5s/1s", config.DialKeepAliveTime, config.DialKeepAliveTimeout)
+	}
+	if config.MaxCallSendMsgSize != 4<<20 || config.MaxCallRecvMsgSize != 8<<20 {
+		t.Errorf("message sizes: got %d/%d", config.MaxCallSendMsgSize, config.MaxCallRecvMsgSize)
+	}
+	if config.AutoSyncInterval != time.Minute {
+		t.Errorf("AutoSyncInterval: got %v, want 1m", config.AutoSyncInterval)
+	}
+	if len(config.DialOptions) != 1 {
+		t.Errorf("DialOptions: got %d, want 1", len(config.DialOptions))
+	}
+	if config.TLS == nil || !config.TLS.InsecureSkipVerify || config.TLS.ServerName != "etcd.internal" ||
+		config.TLS.MinVersion != tls.VersionTLS12 {
+		t.Errorf("TLS: got %+v", config.TLS)
+	}
+}
+
+func TestFillClientConfigKeepsCallerFields(t *testing.T) {
+	callerTLS := &tls.Config{ServerName: "caller"}
+	config := filledConfig(t, clientv3.Config{
+		DialTimeout:          time.Second,
+		DialKeepAliveTime:    time.Minute,
+		DialKeepAliveTimeout: 3 * time.Second,
+		MaxCallSendMsgSize:   1 << 20,
+		TLS:                  callerTLS,
+	}, WithDialTimeout(9*time.Second), WithDialKeepAlive(9*time.Second, 9*time.Second),
+		WithMaxCallMsgSize(9<<20, 9<<20), WithTLSServerName("option"))
+	if config.DialTimeout != time.Second || config.DialKeepAliveTime != time.Minute || config.DialKeepAliveTimeout != 3*time.Second {
+		t.Errorf("caller timeouts overwritten: %v %v %v", config.DialTimeout, config.DialKeepAliveTime, config.DialKeepAliveTimeout)
+	}
+	// 只填充零值字段
+	if config.MaxCallSendMsgSize != 1<<20 || config.MaxCallRecvMsgSize != 9<<20 {
+		t.Errorf("message sizes: got %d/%d", config.MaxCallSendMsgSize, config.MaxCallRecvMsgSize)
+	}
+	if config.TLS != callerTLS {
+		t.Errorf("caller TLS replaced: %+v", config.TLS)
+	}
+}
+
+func TestFillClientConfigTLSFiles(t *testing.T) {
+	srv := etcdtest.Start(t, etcdtest.WithClientCertAuth())
+	etcd := srv.Config()
+	config := filledConfig(t, clientv3.Config{}, WithTLSFiles(etcd.CAFile, etcd.CertFile, etcd.KeyFile))
+	if config.TLS == nil || config.TLS.RootCAs == nil || config.TLS.GetClientCertificate == nil {
+		t.Fatalf("TLS from files: got %+v", config.TLS)
+	}
+	if cert, err := config.TLS.GetClientCertificate(nil); err != nil || cert == nil {
+		t.Errorf("client certificate: %v", err)
+	}
+
+	o, err := newOptions([]Option{WithTLSFiles(etcd.CAFile, etcd.CertFile, "")})
+	if err != nil {
+		t.Fatalf("options: %v", err)
+	}
+	if err := o.fillClientConfig(&clientv3.Config{}); err == nil {
+		t.Error("cert file without key file: got nil error")
+	}
+}
+
+func TestNewEtcdRegistryRejectsInvalidClientOptions(t *testing.T) {
+	for name, opt := range map[string]Option{
+		"negative dial timeout": WithDialTimeout(-time.Second),
+		"negative keepalive":    WithDialKeepAlive(-time.Second, time.Second),
+		"negative message size": WithMaxCallMsgSize(-1, 0),
+		"negative auto sync":    WithAutoSyncInterval(-time.Second),
+	} {
+		if r, err := NewEtcdRegistry(sharedEtcd.Endpoints(), testTTL, opt); err == nil {
+			r.Close()
+			t.Errorf("%s: got nil error", name)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// registry/close.go
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// defaultCloseTimeout Close等待进行中的请求和注销完成的时间
+const defaultCloseTimeout = 3 * time.Second
+
+// ErrRegistryClosed 注册中心已关闭
+var ErrRegistryClosed = errors.New("registry closed")
+
+// CloseWithTimeout 关闭注册中心，重复调用是安全的
+// 关闭后不再接受新的请求；在timeout内等待进行中的注册、注销等请求结束，并撤销本注册中心注册的所有实例，
+// 之后停止watch并关闭客户端；超时仍未完成的部分会在返回的错误中列出
+func (r *EtcdRegistry) CloseWithTimeout(timeout time.Duration) error {
+	var err error
+	r.closeOnce.Do(func() {
+		err = r.shutdown(timeout)
+	})
+	return err
+}
+
+func (r *EtcdRegistry) shutdown(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+
+	var errs []error
+	drained := make(chan struct{})
+	go func() {
+		r.inflight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("%d in-flight etcd operations did not finish within %v", r.inflightCount.Load(), timeout))
+	}
+
+	errs = append(errs, r.deregisterAll(ctx)...)
+
+	r.cancel()
+	// 租约和watcher是注册中心单独创建的，共享客户端时也需要关闭
+	r.lease.Close()
+	r.watcher.Close()
+	r.errs.close()
+	if r.release != nil {
+		errs = append(errs, r.release())
+	} else if r.ownsClient {
+		errs = append(errs, r.client.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// deregisterAll 撤销所有注册实例的租约，实例key随租约一起删除，同组实例共享的租约只撤销一次
+func (r *EtcdRegistry) deregisterAll(ctx context.Context) []error {
+	type pending struct {
+		info    ServiceInfo
+		leaseID clientv3.LeaseID
+	}
+	r.mu.Lock()
+	regs := make(map[string]pending, len(r.registrations))
+	for key, reg := range r.registrations {
+		r.removeLocked(reg)
+		regs[key] = pending{info: *reg.info, leaseID: reg.leaseID}
+	}
+	r.mu.Unlock()
+
+	var errs []error
+	revoked := make(map[clientv3.LeaseID]error)
+	for key, p := range regs {
+		var err error
+		if p.leaseID != 0 {
+			var done bool
+			if err, done = revoked[p.leaseID]; !done {
+				_, err = r.lease.Revoke(ctx, p.leaseID)
+				revoked[p.leaseID] = err
+			}
+			if err != nil {
+				err = fmt.Errorf("deregister %s: %w", key, err)
+				errs = append(errs, err)
+			}
+		}
+		if err == nil {
+			r.writeAudit(ctx, AuditDeregister, &p.info)
+		}
+		r.fireDeregister(&p.info, err)
+	}
+	return errs
+}
+
+// isClosed 注册中心是否已开始关闭
+func (r *EtcdRegistry) isClosed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
+
+// begin 开始一个同步请求，注册中心已关闭时返回ErrRegistryClosed；请求结束后需调用end
+func (r *EtcdRegistry) begin() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return ErrRegistryClosed
+	}
+	r.inflight.Add(1)
+	r.inflightCount.Add(1)
+	return nil
+}
+
+// end 结束begin开始的请求
+func (r *EtcdRegistry) end() {
+	r.inflightCount.Add(-1)
+	r.inflight.Done()
+}
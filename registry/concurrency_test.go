@@ -0,0 +1,143 @@
+// registry/concurrency_test.go
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/YuanJey/grpc-etcd/resolvertest"
+)
+
+// waitGroup 等待wg结束，超过testTimeout视为死锁
+func waitGroup(t *testing.T, what string, wg *sync.WaitGroup) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(testTimeout):
+		t.Fatalf("%s did not finish within %v, possible deadlock", what, testTimeout)
+	}
+}
+
+// 使用 go test -race 运行，检查并发调用下的数据竞争和死锁
+func TestConcurrentOperationsStorm(t *testing.T) {
+	r := newTestRegistry(t)
+	services := []string{testService(t), testService(t), testService(t)}
+
+	// 回调中再调用注册中心，回调执行时不能持有内部锁
+	var watches [3]watchRecorder
+	for i, service := range services {
+		if err := r.Watch(service, func(infos []*ServiceInfo) {
+			watches[i].callback(infos)
+			if _, err := r.Discover(service); err != nil && !errors.Is(err, ErrNoInstances) && !errors.Is(err, ErrRegistryClosed) {
+				t.Errorf("discover inside watch callback: %v", err)
+			}
+			r.Readiness(service)
+		}); err != nil {
+			t.Fatalf("watch: %v", err)
+		}
+	}
+
+	const workers, rounds = 8, 10
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range rounds {
+				service := services[(w+i)%len(services)]
+				info := &ServiceInfo{Name: service, Address: fmt.Sprintf("10.0.%d.%d:80", w, i)}
+				if err := r.RegisterService(info); err != nil {
+					t.Errorf("register %s: %v", info.Address, err)
+					continue
+				}
+				if err := r.SetStatus(service, info.Address, StatusDraining); err != nil {
+					t.Errorf("set status %s: %v", info.Address, err)
+				}
+				cc, rsv, err := resolvertest.Build(r, r.Target(service))
+				if err != nil {
+					t.Errorf("build resolver: %v", err)
+				} else {
+					cc.States()
+					rsv.Close()
+				}
+				r.Stats()
+				r.Readiness()
+				if err := r.Unregister(service, info.Address); err != nil {
+					t.Errorf("unregister %s: %v", info.Address, err)
+				}
+			}
+		}()
+	}
+	waitGroup(t, "register/unregister/watch storm", &wg)
+
+	// 全部注销后每个watch最终收到空列表
+	for i := range services {
+		eventually(t, "watch after storm", func() error { return watches[i].expect() })
+	}
+	if state := r.Readiness(); len(state.Registrations) != 0 {
+		t.Errorf("registrations left after storm: %+v", state.Registrations)
+	}
+
+	// 与Close并发的操作要么成功要么返回ErrRegistryClosed，Close可重复调用
+	for w := range workers {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			info := &ServiceInfo{Name: services[0], Address: fmt.Sprintf("10.1.0.%d:80", w)}
+			if err := r.RegisterService(info); err != nil && !errors.Is(err, ErrRegistryClosed) {
+				t.Errorf("register during close: %v", err)
+			}
+			if _, err := r.Discover(services[0]); err != nil &&
+				!errors.Is(err, ErrRegistryClosed) && !errors.Is(err, ErrNoInstances) {
+				t.Errorf("discover during close: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := r.Close(); err != nil {
+				t.Errorf("close: %v", err)
+			}
+		}()
+	}
+	waitGroup(t, "operations racing close", &wg)
+
+	if err := r.RegisterService(&ServiceInfo{Name: services[0], Address: "10.2.0.1:80"}); !errors.Is(err, ErrRegistryClosed) {
+		t.Errorf("register after close: got %v, want ErrRegistryClosed", err)
+	}
+	if err := r.Watch(services[0], func([]*ServiceInfo) {}); !errors.Is(err, ErrRegistryClosed) {
+		t.Errorf("watch after close: got %v, want ErrRegistryClosed", err)
+	}
+}
+
+func TestWatchCallbackMayRegister(t *testing.T) {
+	r := newTestRegistry(t)
+	service, mirror := testService(t), testService(t)
+
+	// 回调中注册另一个服务的实例，不会因锁重入而死锁
+	if err := r.Watch(service, func(infos []*ServiceInfo) {
+		for _, info := range infos {
+			err := r.RegisterService(&ServiceInfo{Name: mirror, Address: info.Address})
+			if err != nil && !errors.Is(err, ErrAlreadyRegistered) {
+				t.Errorf("register inside watch callback: %v", err)
+			}
+		}
+	}); err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+	eventually(t, "mirrored registration", func() error {
+		infos, err := r.Discover(mirror)
+		if err != nil {
+			return err
+		}
+		return expectAddrs(infos, "10.0.0.1:80")
+	})
+}
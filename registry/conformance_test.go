@@ -0,0 +1,21 @@
+// registry/conformance_test.go
+package registry_test
+
+import (
+	"testing"
+
+	"github.com/YuanJey/grpc-etcd/etcdtest"
+	"github.com/YuanJey/grpc-etcd/registry"
+	"github.com/YuanJey/grpc-etcd/registrytest"
+)
+
+func TestEtcdRegistryConformance(t *testing.T) {
+	srv := etcdtest.Start(t)
+	registrytest.TestRegistry(t, func(t *testing.T) registry.Registry {
+		r, err := registry.NewEtcdRegistryWithConfig(srv.ClientConfig(), 5)
+		if err != nil {
+			t.Fatalf("new registry: %v", err)
+		}
+		return r
+	})
+}
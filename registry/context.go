@@ -0,0 +1,82 @@
+// registry/context.go
+package registry
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// hashKeyCtxKey context中保存一致性哈希key的键
+type hashKeyCtxKey struct{}
+
+// WithHashKey 为单次RPC指定一致性哈希使用的key，相同key的请求会落到同一实例
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKeyCtxKey{}, key)
+}
+
+// HashKeyFromContext 读取WithHashKey设置的key
+func HashKeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(hashKeyCtxKey{}).(string)
+	return key, ok && key != ""
+}
+
+// TargetVersionHeader 携带单次RPC目标版本的metadata名称
+const TargetVersionHeader = "x-target-version"
+
+// targetVersionCtxKey context中保存目标版本的键
+type targetVersionCtxKey struct{}
+
+// WithTargetVersion 指定单次RPC只发往该版本的实例
+// 需配合TargetVersionUnaryClientInterceptor/TargetVersionStreamClientInterceptor写入metadata，
+// 以便在服务间调用时继续向下游传递；显式指定的版本优先于按比例的灰度划分
+func WithTargetVersion(ctx context.Context, version string) context.Context {
+	return context.WithValue(ctx, targetVersionCtxKey{}, version)
+}
+
+// TargetVersionFromContext 读取单次RPC的目标版本
+// 依次检查WithTargetVersion、outgoing metadata和incoming metadata，
+// 后者使服务端处理请求时发起的下游调用沿用上游指定的版本
+func TargetVersionFromContext(ctx context.Context) (string, bool) {
+	if version, ok := ctx.Value(targetVersionCtxKey{}).(string); ok && version != "" {
+		return version, true
+	}
+	if md, ok := metadata.FromOutgoingContext(ctx); ok {
+		if values := md.Get(TargetVersionHeader); len(values) > 0 && values[0] != "" {
+			return values[0], true
+		}
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(TargetVersionHeader); len(values) > 0 && values[0] != "" {
+			return values[0], true
+		}
+	}
+	return "", false
+}
+
+// withTargetVersionMetadata 把目标版本写入outgoing metadata
+func withTargetVersionMetadata(ctx context.Context) context.Context {
+	version, ok := TargetVersionFromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(TargetVersionHeader)) > 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, TargetVersionHeader, version)
+}
+
+// TargetVersionUnaryClientInterceptor 把WithTargetVersion指定的版本写入请求metadata
+func TargetVersionUnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(withTargetVersionMetadata(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// TargetVersionStreamClientInterceptor 把WithTargetVersion指定的版本写入流式请求metadata
+func TargetVersionStreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(withTargetVersionMetadata(ctx), desc, cc, method, opts...)
+	}
+}
@@ -0,0 +1,148 @@
+// registry/credentials.go
+package registry
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
+)
+
+// authenticator 管理WithAuth配置的etcd用户名密码和认证token，
+// 作为PerRPCCredentials为每个请求附加token，凭据可以在运行时替换
+type authenticator struct {
+	mu       sync.Mutex
+	username string
+	password string
+	token    string
+	// auth 用于获取token，客户端创建后设置
+	auth clientv3.Auth
+}
+
+func newAuthenticator(username, password string) *authenticator {
+	return &authenticator{username: username, password: password}
+}
+
+// GetRequestMetadata 实现credentials.PerRPCCredentials接口
+func (a *authenticator) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token == "" {
+		return nil, nil
+	}
+	return map[string]string{rpctypes.TokenFieldNameGRPC: a.token}, nil
+}
+
+// RequireTransportSecurity 实现credentials.PerRPCCredentials接口
+func (a *authenticator) RequireTransportSecurity() bool {
+	return false
+}
+
+// refresh 使用当前凭据重新获取token
+func (a *authenticator) refresh(ctx context.Context) error {
+	a.mu.Lock()
+	username, password := a.username, a.password
+	a.mu.Unlock()
+	return a.authenticate(ctx, username, password)
+}
+
+// authenticate 使用给定凭据获取token，成功后替换当前凭据和token
+func (a *authenticator) authenticate(ctx context.Context, username, password string) error {
+	resp, err := a.auth.Authenticate(ctx, username, password)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.username, a.password, a.token = username, password, resp.Token
+	a.mu.Unlock()
+	return nil
+}
+
+// authenticateMethod 获取token的RPC，不能在它失败时再次重新认证
+const authenticateMethod = "/etcdserverpb.Auth/Authenticate"
+
+// unaryInterceptor token失效时重新认证并重试一次请求
+// clientv3只会为自己管理的凭据刷新token，其余情况下会一直重试到超时，调用方最终只能看到超时错误；
+// 该拦截器位于clientv3的重试拦截器之内，每次尝试失败时都能立即换上新token
+func (a *authenticator) unaryInterceptor(ctx context.Context, method string, req, reply any,
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if err == nil || method == authenticateMethod || !isAuthTokenError(rpctypes.Error(err)) {
+		return err
+	}
+	if refreshErr := a.refresh(ctx); refreshErr != nil {
+		return err
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// isAuthTokenError 是否为token过期或失效的错误，重新认证后可以重试
+func isAuthTokenError(err error) bool {
+	return errors.Is(err, rpctypes.ErrInvalidAuthToken) || errors.Is(err, rpctypes.ErrAuthOldRevision) ||
+		errors.Is(err, rpctypes.ErrUserEmpty)
+}
+
+// handleAuthError token失效时重新认证，返回是否已重新认证
+func (r *EtcdRegistry) handleAuthError(ctx context.Context, err error) bool {
+	if r.auth == nil || !isAuthTokenError(err) {
+		return false
+	}
+	if refreshErr := r.auth.refresh(ctx); refreshErr != nil {
+		r.opts.logger.Warn("etcd re-authentication failed", "error", refreshErr)
+		return false
+	}
+	r.opts.logger.Debug("etcd auth token refreshed", "error", err)
+	return true
+}
+
+// UpdateCredentials 替换连接etcd使用的用户名密码，例如密码定期轮换时
+// 新凭据认证成功后才会生效，失败时继续使用原凭据并返回错误；
+// 已有的租约和watch不受影响，切换期间因token失效失败的请求会重新认证后重试
+// 只适用于通过WithAuth配置且未使用客户端池的凭据
+func (r *EtcdRegistry) UpdateCredentials(username, password string) error {
+	if r.auth == nil {
+		return errors.New("update etcd credentials: registry was not created with WithAuth")
+	}
+	ctx, cancel := context.WithTimeout(r.ctx, r.opts.requestTimeout)
+	defer cancel()
+	if err := r.auth.authenticate(ctx, username, password); err != nil {
+		return wrapError("update-credentials", "", "", err)
+	}
+	return nil
+}
+
+// certReloader 保存可以在运行时重新加载的客户端证书
+type certReloader struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+}
+
+// load 从文件加载证书
+func (c *certReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("load etcd client certificate %s/%s: %w", c.certFile, c.keyFile, err)
+	}
+	c.cert.Store(&cert)
+	return nil
+}
+
+func (c *certReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return c.cert.Load(), nil
+}
+
+// ReloadTLS 重新读取WithTLSFiles配置的客户端证书和私钥，用于证书轮换
+// 新证书在之后建立的连接上生效，已有连接、租约和watch不受影响；读取失败时继续使用原证书
+func (r *EtcdRegistry) ReloadTLS() error {
+	if r.opts.tls.reloader == nil {
+		return errors.New("reload etcd TLS: no client certificate files configured")
+	}
+	return r.opts.tls.reloader.load()
+}
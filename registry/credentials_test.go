@@ -0,0 +1,108 @@
+// registry/credentials_test.go
+package registry
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+
+	"github.com/YuanJey/grpc-etcd/etcdtest"
+)
+
+// restartForNewTokens 重启etcd，simple token只保存在内存中，重启后原有token全部失效
+func restartForNewTokens(t *testing.T, srv *etcdtest.Server) {
+	t.Helper()
+	srv.Stop()
+	if err := srv.Restart(); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+}
+
+// newAuthRegistry 通过WithAuth而不是clientv3.Config中的用户名密码连接srv，由注册中心管理认证token
+func newAuthRegistry(t *testing.T, srv *etcdtest.Server, username, password string) *EtcdRegistry {
+	t.Helper()
+	config := srv.ClientConfig()
+	config.Username, config.Password = "", ""
+	r, err := NewEtcdRegistryWithConfig(config, testTTL, WithAuth(username, password), WithRequestTimeout(2*time.Second))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestAuthRegisterDiscoverWatch(t *testing.T) {
+	srv := etcdtest.Start(t, etcdtest.WithAuth("registry", "secret"))
+	service := testService(t)
+	r := newAuthRegistry(t, srv, "registry", "secret")
+
+	var watch watchRecorder
+	if err := r.Watch(service, watch.callback); err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+	eventually(t, "watch with auth", func() error { return watch.expect("10.0.0.1:80") })
+	services, err := r.Discover(service)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if err := expectAddrs(services, "10.0.0.1:80"); err != nil {
+		t.Fatal(err)
+	}
+
+	// token失效后自动重新认证，调用方不会看到ErrInvalidAuthToken
+	restartForNewTokens(t, srv)
+	eventually(t, "register after token invalidation", func() error {
+		err := r.RegisterService(&ServiceInfo{Name: service, Address: "10.0.0.2:80"})
+		if errors.Is(err, rpctypes.ErrInvalidAuthToken) {
+			t.Fatalf("register surfaced the auth token error: %v", err)
+		}
+		return err
+	})
+	eventually(t, "discover after token invalidation", func() error {
+		services, err := r.Discover(service)
+		if errors.Is(err, rpctypes.ErrInvalidAuthToken) {
+			t.Fatalf("discover surfaced the auth token error: %v", err)
+		}
+		if err != nil {
+			return err
+		}
+		return expectAddrs(services, "10.0.0.1:80", "10.0.0.2:80")
+	})
+	eventually(t, "watch after token invalidation", func() error { return watch.expect("10.0.0.1:80", "10.0.0.2:80") })
+
+	if err := r.Unregister(service, "10.0.0.1:80"); err != nil {
+		t.Fatalf("unregister: %v", err)
+	}
+	eventually(t, "watch after unregister", func() error { return watch.expect("10.0.0.2:80") })
+}
+
+func TestUpdateCredentials(t *testing.T) {
+	srv := etcdtest.Start(t, etcdtest.WithAuth("registry", "secret"))
+	service := testService(t)
+	r := newAuthRegistry(t, srv, "registry", "secret")
+
+	if _, err := srv.Client().UserChangePassword(testContext(t), "registry", "rotated"); err != nil {
+		t.Fatalf("change password: %v", err)
+	}
+	// 新凭据认证失败时保留原凭据
+	if err := r.UpdateCredentials("registry", "wrong"); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("update to wrong credentials: got %v, want ErrPermissionDenied", err)
+	}
+	if err := r.UpdateCredentials("registry", "rotated"); err != nil {
+		t.Fatalf("update credentials: %v", err)
+	}
+
+	// 之后重新认证使用新凭据
+	restartForNewTokens(t, srv)
+	eventually(t, "register with rotated credentials", func() error {
+		return r.RegisterService(&ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+	})
+
+	plain := newRegistryOn(t, sharedEtcd)
+	if err := plain.UpdateCredentials("registry", "secret"); err == nil {
+		t.Error("update credentials without WithAuth: got nil error")
+	}
+}
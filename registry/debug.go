@@ -0,0 +1,151 @@
+// registry/debug.go
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/YuanJey/grpc-etcd/pkg/config"
+)
+
+// DebugState 调试接口输出的内容
+type DebugState struct {
+	Stats RegistryStats `json:"stats"`
+	// Config 当前生效的配置及各配置段来源，见config.DumpJSON，密码和密钥已脱敏；未加载配置时为空
+	Config json.RawMessage `json:"config,omitempty"`
+	// ConfigError 输出配置失败的原因
+	ConfigError string `json:"configError,omitempty"`
+	// Service 和Instances 通过?service=指定时直接从etcd读取的实例，不经过缓存和watch
+	Service       string         `json:"service,omitempty"`
+	Instances     []*ServiceInfo `json:"instances,omitempty"`
+	InstanceError string         `json:"instanceError,omitempty"`
+}
+
+// DebugHandler 返回输出注册中心状态的http.Handler，适合挂载在内部管理端口上
+//
+// 默认输出HTML页面，?format=json或Accept: application/json时输出JSON；
+// ?service=<name>时额外直接从etcd读取该服务的全部实例，用于排查时与缓存和resolver的结果对比
+func DebugHandler(r *EtcdRegistry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		state := DebugState{Stats: r.Stats()}
+		// 加载后的配置总带有ConfigVersion，零值表示进程没有通过config包加载配置
+		loaded := config.Current().ConfigVersion != 0
+		if loaded {
+			if data, err := config.DumpJSON(); err != nil {
+				state.ConfigError = err.Error()
+			} else {
+				state.Config = data
+			}
+		}
+		if service := req.URL.Query().Get("service"); service != "" {
+			state.Service = service
+			instances, err := r.discoverFromEtcd(req.Context(), service)
+			if err != nil {
+				state.InstanceError = err.Error()
+			}
+			state.Instances = instances
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		if req.URL.Query().Get("format") == "json" || strings.Contains(req.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(state)
+			return
+		}
+
+		dump := "not loaded"
+		if loaded {
+			var err error
+			if dump, err = config.Dump(); err != nil {
+				dump = err.Error()
+			}
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		debugPage.Execute(w, struct {
+			DebugState
+			ConfigYAML string
+		}{state, dump})
+	})
+}
+
+// discoverFromEtcd 直接从etcd读取服务的全部实例，不使用Discover缓存，也不重试
+// 无法解码的注册信息会被跳过
+func (r *EtcdRegistry) discoverFromEtcd(ctx context.Context, serviceName string) ([]*ServiceInfo, error) {
+	ctx, cancel := r.opContext(ctx)
+	defer cancel()
+	ctx, cancelTimeout := context.WithTimeout(ctx, r.opts.requestTimeout)
+	defer cancelTimeout()
+
+	resp, err := r.kv.Get(ctx, servicePrefix(serviceName), clientv3.WithPrefix())
+	if err != nil {
+		return nil, wrapError("discover", serviceName, "", err)
+	}
+	services := make([]*ServiceInfo, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		if service, ok := r.decodeService(kv.Key, kv.Value); ok {
+			services = append(services, service)
+		}
+	}
+	return services, nil
+}
+
+var debugPage = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>registry</title>
+<style>body{font-family:monospace}table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:2px 6px;text-align:left}</style>
+</head>
+<body>
+<h1>registry</h1>
+<p>identity: {{.Stats.Identity}} · connectivity: {{.Stats.Connectivity}} · inflight ops: {{.Stats.InflightOps}} · queued ops: {{.Stats.QueuedOps}} · cache entries: {{.Stats.CacheEntries}} · key watches: {{.Stats.KeyWatches}} · <a href="?format=json">json</a></p>
+
+<h2>registrations</h2>
+<table>
+<tr><th>key</th><th>service</th><th>address</th><th>status</th><th>lease</th><th>ttl remaining</th><th>last keepalive</th><th>renewal interval</th><th>last interruption</th><th>failing</th></tr>
+{{range .Stats.Registrations}}<tr><td>{{.Key}}</td><td>{{.Service}}</td><td>{{.Address}}</td><td>{{.Status}}</td><td>{{printf "%x" .LeaseID}}</td><td>{{.TTLRemainingSeconds}}s</td><td>{{.LastKeepAlive.Format "2006-01-02 15:04:05"}}</td><td>{{printf "%.1f" .RenewalIntervalSeconds}}s</td><td>{{if not .LastInterruption.IsZero}}{{.LastInterruption.Format "2006-01-02 15:04:05"}} {{.LastInterruptionReason}}{{if .LastRecoverySeconds}} (recovered in {{printf "%.1f" .LastRecoverySeconds}}s){{end}}{{end}}</td><td>{{.Failing}}</td></tr>
+{{end}}</table>
+
+<h2>watches</h2>
+<table>
+<tr><th>service</th><th>prefix</th><th>subscribers</th><th>instances</th><th>revision</th><th>last event</th><th>error</th></tr>
+{{range .Stats.Watches}}<tr><td><a href="?service={{.Service}}">{{.Service}}</a></td><td>{{.Prefix}}</td><td>{{.Subscribers}}</td><td>{{.Instances}}</td><td>{{.Revision}}</td><td>{{if not .LastEvent.IsZero}}{{.LastEvent.Format "2006-01-02 15:04:05"}}{{end}}</td><td>{{.Error}}</td></tr>
+{{end}}</table>
+
+<h2>etcd ops</h2>
+<table>
+<tr><th>op</th><th>count</th><th>slow</th><th>p99</th></tr>
+{{range .Stats.OpLatency}}<tr><td>{{.Op}}</td><td>{{.Count}}</td><td>{{.Slow}}</td><td>{{printf "%.3f" .P99Seconds}}s</td></tr>
+{{end}}</table>
+
+<h2>errors</h2>
+<p>lease lost: {{.Stats.Errors.LeaseLost}} · re-register failures: {{.Stats.Errors.ReRegisterFailures}} · watch errors: {{.Stats.Errors.WatchErrors}} · hook panics: {{.Stats.Errors.HookPanics}}</p>
+<table>
+<tr><th>time</th><th>op</th><th>service</th><th>address</th><th>error</th></tr>
+{{range .Stats.RecentErrors}}<tr><td>{{.Time.Format "2006-01-02 15:04:05"}}</td><td>{{.Op}}</td><td>{{.Service}}</td><td>{{.Address}}</td><td>{{.Error}}</td></tr>
+{{end}}</table>
+
+<h2>history</h2>
+<table>
+<tr><th>time</th><th>kind</th><th>service</th><th>address</th><th>addresses</th><th>detail</th></tr>
+{{range .Stats.History}}<tr><td>{{.Time.Format "2006-01-02 15:04:05.000"}}</td><td>{{.Kind}}</td><td>{{.Service}}</td><td>{{.Address}}</td><td>{{if eq .Kind "resolver-update"}}{{.Addresses}}{{end}}</td><td>{{if .Stale}}stale {{end}}{{if .Fallback}}fallback {{end}}{{.Class}} {{.Error}}</td></tr>
+{{end}}</table>
+
+<h2>instances</h2>
+<form><input name="service" value="{{.Service}}" placeholder="service"> <button>read from etcd</button></form>
+{{if .Service}}{{if .InstanceError}}<p>{{.InstanceError}}</p>{{end}}
+<table>
+<tr><th>address</th><th>version</th><th>status</th><th>weight</th><th>zone</th><th>tags</th></tr>
+{{range .Instances}}<tr><td>{{.Address}}</td><td>{{.Version}}</td><td>{{.Status}}</td><td>{{.Weight}}</td><td>{{.Zone}}</td><td>{{.Tags}}</td></tr>
+{{end}}</table>{{end}}
+
+<h2>config</h2>
+<pre>{{.ConfigYAML}}</pre>
+</body>
+</html>
+`))
@@ -0,0 +1,100 @@
+// registry/dial.go
+package registry
+
+import (
+	"context"
+	"net/url"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/resolver"
+)
+
+// targetOption 修改Dial生成的target查询参数的拨号选项
+type targetOption struct {
+	grpc.EmptyDialOption
+	apply func(query url.Values)
+}
+
+// DialVersion 只连接指定版本的实例，等价于 ?version=
+func DialVersion(version string) grpc.DialOption {
+	return targetOption{apply: func(q url.Values) { q.Set("version", version) }}
+}
+
+// DialEnv 只连接指定环境的实例，等价于 ?env=
+func DialEnv(env string) grpc.DialOption {
+	return targetOption{apply: func(q url.Values) { q.Set("env", env) }}
+}
+
+// DialTag 只连接带有指定标签的实例，可多次使用，等价于 ?tag=
+func DialTag(tag string) grpc.DialOption {
+	return targetOption{apply: func(q url.Values) { q.Add("tag", tag) }}
+}
+
+// DialMetadata 只连接元数据匹配的实例，可多次使用，等价于 ?metadata=key:value
+func DialMetadata(key, value string) grpc.DialOption {
+	return targetOption{apply: func(q url.Values) { q.Add("metadata", key+":"+value) }}
+}
+
+// warmUpOption 开启预连接的拨号选项
+type warmUpOption struct {
+	grpc.EmptyDialOption
+}
+
+// DialWarmUp 拨号后立即与所有解析到的实例建立连接，并关闭空闲超时使连接一直保持，
+// 延迟敏感的客户端不再承担首个请求的建连开销；
+// 服务配置使用lb.WarmUpName时可通过lb.WarmUpStats查看已建立和未建立的连接数
+func DialWarmUp() grpc.DialOption {
+	return warmUpOption{}
+}
+
+// Target 返回用于拨号的服务target，例如 etcd:///svc
+func (r *EtcdRegistry) Target(serviceName string) string {
+	return r.Scheme() + ":///" + serviceName
+}
+
+// Dial 通过注册中心连接服务
+// 使用grpc.WithResolvers绑定本注册中心，无需全局注册resolver，也不会与其他实例的scheme冲突；
+// 默认使用round_robin，调用方的拨号选项在默认值之后生效；
+// DialVersion、DialTag等选项会转换为target查询参数
+func (r *EtcdRegistry) Dial(ctx context.Context, serviceName string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	return DialBuilder(ctx, r, serviceName, opts...)
+}
+
+// DialBuilder 同EtcdRegistry.Dial，通过任意resolver.Builder连接服务，target为 {scheme}:///{serviceName}，
+// 供Registry的其他实现（例如registrytest）复用同样的拨号默认值和过滤选项
+func DialBuilder(ctx context.Context, builder resolver.Builder, serviceName string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	query := url.Values{}
+	warmUp := false
+	dialOpts := []grpc.DialOption{
+		grpc.WithResolvers(builder),
+		grpc.WithDefaultServiceConfig(defaultServiceConfig),
+	}
+	for _, opt := range opts {
+		if t, ok := opt.(targetOption); ok {
+			t.apply(query)
+			continue
+		}
+		if _, ok := opt.(warmUpOption); ok {
+			warmUp = true
+			continue
+		}
+		dialOpts = append(dialOpts, opt)
+	}
+
+	target := builder.Scheme() + ":///" + serviceName
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	if warmUp {
+		dialOpts = append(dialOpts, grpc.WithIdleTimeout(0))
+	}
+	conn, err := grpc.DialContext(ctx, target, dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	if warmUp {
+		// 退出IDLE状态，round_robin等策略会与每个地址建立连接
+		conn.Connect()
+	}
+	return conn, nil
+}
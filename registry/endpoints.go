@@ -0,0 +1,149 @@
+// registry/endpoints.go
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// dnsSRVPrefix 通过SRV记录发现etcd节点，例如 dns+srv://etcd.example.com
+	dnsSRVPrefix = "dns+srv://"
+	// dnsPrefix 通过A/AAAA记录发现etcd节点，例如 dns://etcd.example.com:2379
+	dnsPrefix = "dns://"
+)
+
+// Member etcd集群成员
+type Member struct {
+	ID         uint64
+	Name       string
+	ClientURLs []string
+}
+
+// Endpoints 返回etcd客户端当前使用的节点地址，开启自动同步后会随集群成员变化
+func (r *EtcdRegistry) Endpoints() []string {
+	return r.client.Endpoints()
+}
+
+// Members 从etcd读取当前集群成员列表，用于排查连接问题
+func (r *EtcdRegistry) Members(ctx context.Context) ([]Member, error) {
+	resp, err := r.client.MemberList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]Member, 0, len(resp.Members))
+	for _, m := range resp.Members {
+		members = append(members, Member{ID: m.ID, Name: m.Name, ClientURLs: m.ClientURLs})
+	}
+	return members, nil
+}
+
+// hasDNSEndpoints 是否包含需要通过DNS解析的节点地址
+func hasDNSEndpoints(endpoints []string) bool {
+	for _, endpoint := range endpoints {
+		if strings.HasPrefix(endpoint, dnsSRVPrefix) || strings.HasPrefix(endpoint, dnsPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveEndpoints 将dns+srv://和dns://形式的节点地址解析为具体地址，其他地址原样保留
+// SRV记录依次查询_etcd-client-ssl._tcp和_etcd-client._tcp，与etcd的DNS发现约定一致
+func resolveEndpoints(ctx context.Context, endpoints []string, secure bool) ([]string, error) {
+	var resolved []string
+	for _, endpoint := range endpoints {
+		switch {
+		case strings.HasPrefix(endpoint, dnsSRVPrefix):
+			addrs, err := lookupSRV(ctx, strings.TrimPrefix(endpoint, dnsSRVPrefix), secure)
+			if err != nil {
+				return nil, err
+			}
+			resolved = append(resolved, addrs...)
+		case strings.HasPrefix(endpoint, dnsPrefix):
+			addrs, err := lookupHost(ctx, strings.TrimPrefix(endpoint, dnsPrefix), secure)
+			if err != nil {
+				return nil, err
+			}
+			resolved = append(resolved, addrs...)
+		default:
+			resolved = append(resolved, endpoint)
+		}
+	}
+	sort.Strings(resolved)
+	return resolved, nil
+}
+
+func lookupSRV(ctx context.Context, domain string, secure bool) ([]string, error) {
+	services := []string{"etcd-client"}
+	scheme := "http://"
+	if secure {
+		services = []string{"etcd-client-ssl", "etcd-client"}
+		scheme = "https://"
+	}
+	var lastErr error
+	for _, service := range services {
+		_, records, err := net.DefaultResolver.LookupSRV(ctx, service, "tcp", domain)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		addrs := make([]string, 0, len(records))
+		for _, record := range records {
+			addrs = append(addrs, scheme+net.JoinHostPort(strings.TrimSuffix(record.Target, "."), fmt.Sprint(record.Port)))
+		}
+		if len(addrs) > 0 {
+			return addrs, nil
+		}
+	}
+	return nil, fmt.Errorf("discover etcd endpoints via SRV records of %s: %v", domain, lastErr)
+}
+
+func lookupHost(ctx context.Context, hostPort string, secure bool) ([]string, error) {
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return nil, fmt.Errorf("invalid etcd DNS endpoint %q: %v", dnsPrefix+hostPort, err)
+	}
+	ips, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("discover etcd endpoints via DNS records of %s: %v", host, err)
+	}
+	scheme := "http://"
+	if secure {
+		scheme = "https://"
+	}
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, scheme+net.JoinHostPort(ip, port))
+	}
+	return addrs, nil
+}
+
+// syncDNSEndpoints 按自动同步间隔重新解析DNS节点地址，解析结果变化时更新客户端节点列表
+// 节点列表更新后clientv3的自动同步会继续根据集群成员列表修正
+func (r *EtcdRegistry) syncDNSEndpoints(endpoints []string, secure bool, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last, _ := resolveEndpoints(r.ctx, endpoints, secure)
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(r.ctx, r.opts.requestTimeout)
+		resolved, err := resolveEndpoints(ctx, endpoints, secure)
+		cancel()
+		if err != nil || len(resolved) == 0 || strings.Join(resolved, ",") == strings.Join(last, ",") {
+			continue
+		}
+		last = resolved
+		r.client.SetEndpoints(resolved...)
+	}
+}
@@ -0,0 +1,112 @@
+// registry/errors.go
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 注册中心错误类型，可通过errors.Is判断
+var (
+	// ErrNotRegistered 实例未注册
+	ErrNotRegistered = errors.New("service not registered")
+	// ErrAlreadyRegistered 实例已经通过本注册中心注册
+	ErrAlreadyRegistered = errors.New("service already registered")
+	// ErrNoInstances 服务没有任何实例
+	ErrNoInstances = errors.New("no service instances")
+	// ErrEtcdUnavailable etcd不可达或请求超时
+	ErrEtcdUnavailable = errors.New("etcd unavailable")
+	// ErrLeaseLost 注册使用的租约已过期或被撤销
+	ErrLeaseLost = errors.New("lease lost")
+	// ErrInvalidAddress 服务地址格式错误
+	ErrInvalidAddress = errors.New("invalid service address")
+	// ErrInvalidService 服务信息不合法，例如服务名为空
+	ErrInvalidService = errors.New("invalid service info")
+	// ErrPermissionDenied etcd认证失败或没有访问权限
+	ErrPermissionDenied = errors.New("etcd permission denied")
+)
+
+// Error 注册中心操作失败的详细信息
+// errors.Is既可以匹配Kind中的错误类型，也可以匹配Err中etcd返回的原始错误
+type Error struct {
+	// Op 失败的操作，例如register、discover
+	Op      string
+	Service string
+	Address string
+	// Kind 错误类型，为上面定义的Err*之一，无法归类时为nil
+	Kind error
+	// Err 底层错误
+	Err error
+}
+
+func (e *Error) Error() string {
+	msg := "registry: " + e.Op + " " + e.Service
+	if e.Address != "" {
+		msg += " at " + e.Address
+	}
+	switch {
+	case e.Kind != nil && e.Err != nil:
+		return fmt.Sprintf("%s: %v: %v", msg, e.Kind, e.Err)
+	case e.Kind != nil:
+		return fmt.Sprintf("%s: %v", msg, e.Kind)
+	default:
+		return fmt.Sprintf("%s: %v", msg, e.Err)
+	}
+}
+
+// Unwrap 返回错误类型和底层错误
+func (e *Error) Unwrap() []error {
+	var errs []error
+	if e.Kind != nil {
+		errs = append(errs, e.Kind)
+	}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	return errs
+}
+
+// wrapError 包装etcd返回的错误并归类，err为nil时返回nil
+func wrapError(op, service, address string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return &Error{Op: op, Service: service, Address: address, Kind: classifyError(err), Err: err}
+}
+
+// newError 构造不带底层错误的注册中心错误
+func newError(op, service, address string, kind error) error {
+	return &Error{Op: op, Service: service, Address: address, Kind: kind}
+}
+
+// classifyError 将etcd错误归类为注册中心错误类型，无法归类时返回nil
+func classifyError(err error) error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return nil
+	case errors.Is(err, rpctypes.ErrLeaseNotFound):
+		return ErrLeaseLost
+	case errors.Is(err, rpctypes.ErrPermissionDenied), errors.Is(err, rpctypes.ErrAuthFailed),
+		errors.Is(err, rpctypes.ErrInvalidAuthToken), errors.Is(err, rpctypes.ErrUserEmpty):
+		return ErrPermissionDenied
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, clientv3.ErrNoAvailableEndpoints):
+		return ErrEtcdUnavailable
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return ErrEtcdUnavailable
+	case codes.PermissionDenied, codes.Unauthenticated:
+		return ErrPermissionDenied
+	}
+	return nil
+}
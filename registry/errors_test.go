@@ -0,0 +1,162 @@
+// registry/errors_test.go
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/YuanJey/grpc-etcd/etcdtest"
+)
+
+func TestClassifyError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want error
+	}{
+		{err: rpctypes.ErrLeaseNotFound, want: ErrLeaseLost},
+		{err: rpctypes.ErrPermissionDenied, want: ErrPermissionDenied},
+		{err: rpctypes.ErrAuthFailed, want: ErrPermissionDenied},
+		{err: rpctypes.ErrInvalidAuthToken, want: ErrPermissionDenied},
+		{err: context.DeadlineExceeded, want: ErrEtcdUnavailable},
+		{err: clientv3.ErrNoAvailableEndpoints, want: ErrEtcdUnavailable},
+		{err: status.Error(codes.Unavailable, "connection refused"), want: ErrEtcdUnavailable},
+		{err: status.Error(codes.Unauthenticated, "bad token"), want: ErrPermissionDenied},
+		{err: fmt.Errorf("get: %w", context.DeadlineExceeded), want: ErrEtcdUnavailable},
+		{err: context.Canceled},
+		{err: errors.New("something else")},
+	} {
+		if got := classifyError(tc.err); got != tc.want {
+			t.Errorf("classifyError(%v): got %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestErrorIsAndAs(t *testing.T) {
+	err := wrapError("discover", "orders", "", rpctypes.ErrPermissionDenied)
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("errors.Is(%v, ErrPermissionDenied) = false", err)
+	}
+	// 原始etcd错误仍然可见
+	if !errors.Is(err, rpctypes.ErrPermissionDenied) {
+		t.Errorf("errors.Is(%v, rpctypes.ErrPermissionDenied) = false", err)
+	}
+	var e *Error
+	if !errors.As(err, &e) || e.Op != "discover" || e.Service != "orders" || e.Kind != ErrPermissionDenied {
+		t.Fatalf("errors.As: got %+v", e)
+	}
+	if want := "registry: discover orders: etcd permission denied: etcdserver: permission denied"; err.Error() != want {
+		t.Errorf("message: got %q, want %q", err.Error(), want)
+	}
+
+	// 已经包装过的错误不会重复包装
+	if again := wrapError("register", "users", "10.0.0.1:80", err); again != err {
+		t.Errorf("wrapped twice: %v", again)
+	}
+	if wrapError("register", "users", "", nil) != nil {
+		t.Error("wrapError(nil) returned an error")
+	}
+	if got := newError("unregister", "users", "10.0.0.1:80", ErrNotRegistered).Error(); got !=
+		"registry: unregister users at 10.0.0.1:80: service not registered" {
+		t.Errorf("message without cause: %q", got)
+	}
+}
+
+// expectError 检查err匹配kind且能取出op对应的*Error
+func expectError(t *testing.T, err, kind error, op string) {
+	t.Helper()
+	if !errors.Is(err, kind) {
+		t.Fatalf("%s: got %v, want %v", op, err, kind)
+	}
+	var e *Error
+	if !errors.As(err, &e) || e.Op != op {
+		t.Fatalf("%s: errors.As got %+v", op, e)
+	}
+}
+
+func TestOperationErrors(t *testing.T) {
+	service := testService(t)
+	r := newTestRegistry(t)
+
+	expectError(t, r.Unregister(service, "10.0.0.1:80"), ErrNotRegistered, "unregister")
+	_, err := r.Discover(service)
+	expectError(t, err, ErrNoInstances, "discover")
+
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+	expectError(t, r.RegisterService(&ServiceInfo{Name: service, Address: "10.0.0.1:80"}), ErrAlreadyRegistered, "register")
+	if err := r.RegisterService(&ServiceInfo{Name: service, Address: "no-port"}); !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("invalid address: got %v, want ErrInvalidAddress", err)
+	}
+	if err := r.RegisterService(&ServiceInfo{Name: "", Address: "10.0.0.2:80"}); !errors.Is(err, ErrInvalidService) {
+		t.Errorf("empty name: got %v, want ErrInvalidService", err)
+	}
+}
+
+func TestUpdateRejectsInvalidService(t *testing.T) {
+	service := testService(t)
+	r := newTestRegistry(t)
+	info := &ServiceInfo{Name: service, Address: "10.0.0.1:80", Version: "v1"}
+	mustRegister(t, r, info)
+	key := serviceKey(service, info.Address)
+	stored := func() string {
+		t.Helper()
+		resp, err := r.kv.Get(testContext(t), key)
+		if err != nil || len(resp.Kvs) != 1 {
+			t.Fatalf("get %s: %v, %v", key, resp, err)
+		}
+		return string(resp.Kvs[0].Value)
+	}
+	before := stored()
+
+	expectError(t, r.SetStatus(service, info.Address, "paused"), ErrInvalidService, "update")
+	expectError(t, r.UpdateServiceInfo(&ServiceInfo{Name: service, Address: info.Address, Weight: -1}), ErrInvalidService, "update")
+	if after := stored(); after != before {
+		t.Errorf("record changed by rejected updates:\n%s\n%s", before, after)
+	}
+
+	// 保存的是副本，调用方之后修改不影响心跳和重新注册使用的信息
+	update := &ServiceInfo{Name: service, Address: info.Address, Version: "v2"}
+	if err := r.UpdateServiceInfo(update); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	update.Version = "changed"
+	r.mu.Lock()
+	version := r.registrations[key].info.Version
+	r.mu.Unlock()
+	if version != "v2" {
+		t.Errorf("registration version: got %q, want v2", version)
+	}
+}
+
+func TestOperationErrorsWhileEtcdDown(t *testing.T) {
+	srv := etcdtest.Start(t)
+	service := testService(t)
+	r := newRegistryOn(t, srv, WithRequestTimeout(500*time.Millisecond), WithRetry(1, time.Millisecond, time.Millisecond))
+	srv.Stop()
+
+	_, err := r.Discover(service)
+	expectError(t, err, ErrEtcdUnavailable, "discover")
+	expectError(t, r.RegisterService(&ServiceInfo{Name: service, Address: "10.0.0.1:80"}), ErrEtcdUnavailable, "register")
+	if err := r.Watch(service, func([]*ServiceInfo) {}); !errors.Is(err, ErrEtcdUnavailable) {
+		t.Errorf("watch: got %v, want ErrEtcdUnavailable", err)
+	}
+}
+
+func TestBadCredentialsArePermissionDenied(t *testing.T) {
+	srv := etcdtest.Start(t, etcdtest.WithAuth("registry", "secret"))
+	r, err := NewEtcdRegistry(srv.Endpoints(), testTTL, WithAuth("registry", "wrong"))
+	if err == nil {
+		r.Close()
+		t.Fatal("wrong password: got nil error")
+	}
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("wrong password: got %v, want ErrPermissionDenied", err)
+	}
+}
@@ -0,0 +1,69 @@
+// registry/eventctx.go
+package registry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// 推送的来源，见EventInfo.Type
+const (
+	// WatchEventList 全量拉取，包括首次推送和watch中断后的重新拉取
+	WatchEventList = "list"
+	// WatchEventPut和WatchEventDelete 推送由一个或多个同类watch事件引起
+	WatchEventPut    = "put"
+	WatchEventDelete = "delete"
+	// WatchEventMixed 推送合并了不同类型的watch事件
+	WatchEventMixed = "mixed"
+)
+
+// EventInfo Watch回调和钩子ctx中携带的事件信息，下游工作可据此关联到引起它的注册中心事件
+type EventInfo struct {
+	// CorrelationID 每次回调生成的随机ID
+	CorrelationID string
+	// Revision 推送对应的etcd revision，钩子中为0
+	Revision int64
+	// Type Watch回调中为WatchEventList等推送来源，钩子中为钩子名，例如OnLeaseLost
+	Type string
+	// Registry 产生事件的注册中心标识，见Identity
+	Registry string
+}
+
+// eventInfoKey context中保存EventInfo的键
+type eventInfoKey struct{}
+
+// EventInfoFromContext 返回Watch回调或钩子ctx中的事件信息
+func EventInfoFromContext(ctx context.Context) (EventInfo, bool) {
+	info, ok := ctx.Value(eventInfoKey{}).(EventInfo)
+	return info, ok
+}
+
+// CorrelationID 返回ctx中的关联ID，不是Watch回调或钩子的ctx时返回空字符串
+func CorrelationID(ctx context.Context) string {
+	info, _ := EventInfoFromContext(ctx)
+	return info.CorrelationID
+}
+
+// eventContext 返回派生自注册中心生命周期、携带info和新span的ctx，info的关联ID和注册中心标识在这里填写
+func (r *EtcdRegistry) eventContext(spanName string, info EventInfo) (context.Context, Span) {
+	id := make([]byte, 8)
+	rand.Read(id)
+	info.CorrelationID = hex.EncodeToString(id)
+	info.Registry = r.opts.identity.String()
+	ctx, span := r.startSpan(context.WithValue(r.ctx, eventInfoKey{}, info), spanName)
+	span.SetAttributes("correlation_id", info.CorrelationID, LabelRegistry, info.Registry)
+	return ctx, span
+}
+
+// mergeEventType 合并两次推送的来源
+func mergeEventType(older, newer string) string {
+	switch {
+	case older == "" || older == newer:
+		return newer
+	case newer == "":
+		return older
+	default:
+		return WatchEventMixed
+	}
+}
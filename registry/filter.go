@@ -0,0 +1,110 @@
+// registry/filter.go
+package registry
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// Filter 服务实例过滤条件，空字段表示不限制
+type Filter struct {
+	Version string
+	Env     string
+	// Tags 实例需同时包含的标签
+	Tags []string
+	// Metadata 实例元数据需匹配的键值
+	Metadata map[string]string
+}
+
+// Match 判断服务实例是否满足过滤条件
+func (f Filter) Match(service *ServiceInfo) bool {
+	if f.Version != "" && service.Version != f.Version {
+		return false
+	}
+	if f.Env != "" && service.Env != f.Env {
+		return false
+	}
+	for _, tag := range f.Tags {
+		if !hasTag(service.Tags, tag) {
+			return false
+		}
+	}
+	for k, v := range f.Metadata {
+		if mv, ok := service.Metadata[k]; !ok || mv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply 返回满足过滤条件的服务实例
+func (f Filter) Apply(services []*ServiceInfo) []*ServiceInfo {
+	if f.empty() {
+		return services
+	}
+	var matched []*ServiceInfo
+	for _, service := range services {
+		if f.Match(service) {
+			matched = append(matched, service)
+		}
+	}
+	return matched
+}
+
+func (f Filter) empty() bool {
+	return f.Version == "" && f.Env == "" && len(f.Tags) == 0 && len(f.Metadata) == 0
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTargetFilter 解析resolver target中的过滤条件，规则见parseFilterQuery，
+// 供Registry的其他实现（例如registrytest）与etcd resolver保持一致
+func ParseTargetFilter(target resolver.Target) (Filter, error) {
+	return parseFilterQuery(target.URL.Query())
+}
+
+// parseFilterQuery 解析target中的查询参数，例如 etcd:///svc?version=v2&tag=canary
+// 支持 version、env、tag（可重复）、metadata=key:value（可重复），
+// 未知参数直接报错，避免拼写错误导致流量打到所有版本
+func parseFilterQuery(query url.Values) (Filter, error) {
+	var f Filter
+	for name, values := range query {
+		switch name {
+		case "version", "env":
+			if len(values) != 1 {
+				return Filter{}, fmt.Errorf("target query parameter %q must be specified once", name)
+			}
+			if name == "version" {
+				f.Version = values[0]
+			} else {
+				f.Env = values[0]
+			}
+		case "tag":
+			f.Tags = append(f.Tags, values...)
+		case "metadata":
+			for _, value := range values {
+				k, v, ok := strings.Cut(value, ":")
+				if !ok || k == "" {
+					return Filter{}, fmt.Errorf("target query parameter metadata=%q must be in key:value form", value)
+				}
+				if f.Metadata == nil {
+					f.Metadata = make(map[string]string)
+				}
+				f.Metadata[k] = v
+			}
+		default:
+			return Filter{}, fmt.Errorf("unknown target query parameter %q (supported: version, env, tag, metadata)", name)
+		}
+	}
+	return f, nil
+}
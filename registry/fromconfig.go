@@ -0,0 +1,167 @@
+// registry/fromconfig.go
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"net"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/YuanJey/grpc-etcd/pkg/config"
+)
+
+// NewEtcdRegistryFromConfig 按配置创建注册中心
+// 映射etcd地址、连接超时、用户名密码、TLS证书、加密密钥、scheme以及Registry部分的租约时长、命名空间、超时、重试、
+// watch合并窗口、缓存时间和审计，opts在配置之后生效；
+// 配置先经过config.Conf.Validate校验，etcd地址使用config.Etcd.Endpoints规范化后的形式
+func NewEtcdRegistryFromConfig(cfg config.Conf, opts ...Option) (*EtcdRegistry, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid registry config: %w", err)
+	}
+	settings, err := cfg.Registry.Settings()
+	if err != nil {
+		return nil, err
+	}
+
+	options := []Option{
+		WithDialTimeout(cfg.Etcd.DialTimeout.Std()),
+		WithRequestTimeout(settings.RequestTimeout),
+		WithRetry(settings.RetryAttempts, settings.RetryBaseDelay, settings.RetryMaxDelay),
+		WithWatchDebounce(settings.WatchDebounce),
+		WithDiscoverCacheTTL(settings.CacheTTL),
+	}
+	etcd := cfg.Etcd
+	if etcd.EtcdSchema != "" {
+		options = append(options, WithScheme(etcd.EtcdSchema))
+	}
+	if etcd.UserName != "" {
+		options = append(options, WithAuth(etcd.UserName, etcd.Password))
+	}
+	if etcd.CAFile != "" || etcd.CertFile != "" {
+		options = append(options, WithTLSFiles(etcd.CAFile, etcd.CertFile, etcd.KeyFile))
+	}
+	if etcd.InsecureSkipVerify {
+		options = append(options, WithInsecureSkipVerify())
+	}
+	if etcd.ServerNameOverride != "" {
+		options = append(options, WithTLSServerName(etcd.ServerNameOverride))
+	}
+	if etcd.SecretMode == config.SecretModeEncrypt {
+		options = append(options, WithEncryptionSecret(etcd.Secret))
+	}
+	if settings.Namespace != "" {
+		options = append(options, WithNamespace(settings.Namespace))
+	}
+	if settings.InstanceName != "" {
+		options = append(options, WithInstanceName(settings.InstanceName))
+	}
+	if settings.RegisteredBy {
+		options = append(options, WithRegisteredBy())
+	}
+	if settings.Audit {
+		options = append(options, WithAudit(settings.AuditActor), WithAuditRetention(settings.AuditMaxRecords, settings.AuditTTL))
+	}
+	options = append(options, opts...)
+
+	// 地址已在Validate中校验，这里只取规范化结果，未经Load的配置同样得到规范形式
+	endpoints, _ := etcd.Endpoints()
+	return NewEtcdRegistry(endpoints, int64(math.Ceil(settings.TTL.Seconds())), options...)
+}
+
+// FollowConfig 将config.Watch检测到的配置变化应用到注册中心，返回停止函数
+// etcd用户名密码变化时调用UpdateCredentials，客户端证书或私钥文件变化时调用ReloadTLS，
+// 失败时记录日志并继续使用原凭据；日志为NewLoggerFromConfig创建的ConfigLogger时同步日志级别；
+// etcd地址等其他变化需要重新创建注册中心
+func FollowConfig(r *EtcdRegistry) func() {
+	stopEtcd := config.OnEtcdChange(func(old, new config.Etcd) {
+		if old.UserName == new.UserName && old.Password == new.Password {
+			return
+		}
+		if err := r.UpdateCredentials(new.UserName, new.Password); err != nil {
+			r.opts.logger.Error("apply etcd credentials from config failed", "error", err)
+			return
+		}
+		r.opts.logger.Info("etcd credentials updated from config", "username", new.UserName)
+	})
+	stopFiles := config.OnFileChange(func(path string) {
+		etcd := config.Current().Etcd
+		if !sameFile(path, etcd.CertFile) && !sameFile(path, etcd.KeyFile) {
+			return
+		}
+		if err := r.ReloadTLS(); err != nil {
+			r.opts.logger.Error("reload etcd client certificate failed", "file", path, "error", err)
+			return
+		}
+		r.opts.logger.Info("etcd client certificate reloaded", "file", path)
+	})
+	stopLog := config.OnChange(func(old, new config.Conf) {
+		logger, ok := unwrapLogger(r.opts.logger).(*ConfigLogger)
+		if !ok || old.Log.Level == new.Log.Level {
+			return
+		}
+		if err := logger.SetLevel(new.Log.Level); err != nil {
+			r.opts.logger.Error("apply log level from config failed", "error", err)
+		}
+	})
+	return func() {
+		stopEtcd()
+		stopFiles()
+		stopLog()
+	}
+}
+
+// sameFile 比较绝对路径path与配置中可能为相对路径的file
+func sameFile(path, file string) bool {
+	if file == "" {
+		return false
+	}
+	abs, err := filepath.Abs(file)
+	return err == nil && abs == path
+}
+
+// RegisterConfiguredServices 以DetectAdvertiseIP确定的IP为地址（配置了cfg.RpcRegisterIP时使用它，见config.ResolveIP），为配置中每个服务的每个端口注册一个实例
+// 注册前先校验全部实例，任一不合法时不注册任何实例；任一注册失败时注销本次已注册的实例并返回错误
+func RegisterConfiguredServices(r *EtcdRegistry, cfg config.Conf) error {
+	detected, err := DetectAdvertiseIP(WithDetectConfig(cfg))
+	if err != nil {
+		return fmt.Errorf("register configured services: %w", err)
+	}
+	ip := detected.String()
+
+	var infos []*ServiceInfo
+	for _, id := range cfg.ServiceIDs() {
+		service, _ := cfg.Service(id)
+		if len(service.Ports) == 0 {
+			return wrapError("register", service.Name, "", fmt.Errorf("%w: service %s has no ports", ErrInvalidService, id))
+		}
+		for _, port := range service.Ports {
+			info := &ServiceInfo{
+				Name:     service.Name,
+				Address:  net.JoinHostPort(ip, strconv.Itoa(port)),
+				Version:  service.Version,
+				Weight:   service.Weight,
+				Tags:     slices.Clone(service.Tags),
+				Metadata: maps.Clone(service.Metadata),
+			}
+			if err := info.Validate(); err != nil {
+				return wrapError("register", info.Name, info.Address, err)
+			}
+			infos = append(infos, info)
+		}
+	}
+
+	for i, info := range infos {
+		if err := r.RegisterService(info); err != nil {
+			errs := []error{err}
+			for _, done := range infos[:i] {
+				errs = append(errs, r.Unregister(done.Name, done.Address))
+			}
+			return errors.Join(errs...)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+// registry/group.go
+package registry
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
+)
+
+// leaseGroup 共享同一租约的一组注册记录，创建后不再修改
+// 第一个成员运行心跳和重新注册，成员单独注销时租约保留给其他成员，全部注销后才撤销
+type leaseGroup struct {
+	members []*registration
+}
+
+// liveMembersLocked 返回与reg共享租约且仍在注册的记录，包括reg本身，调用方需持有r.mu
+func (r *EtcdRegistry) liveMembersLocked(reg *registration) []*registration {
+	members := []*registration{reg}
+	if reg.group != nil {
+		members = reg.group.members
+	}
+	live := make([]*registration, 0, len(members))
+	for _, member := range members {
+		if r.registrations[member.key] == member {
+			live = append(live, member)
+		}
+	}
+	return live
+}
+
+// liveMembers 同liveMembersLocked，自行加锁
+func (r *EtcdRegistry) liveMembers(reg *registration) []*registration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.liveMembersLocked(reg)
+}
+
+func containsRegistration(regs []*registration, reg *registration) bool {
+	return slices.Contains(regs, reg)
+}
+
+// RegisterServices 注册一组实例，所有实例共享同一个租约并在一个事务中写入，全部成功或全部失败
+// 适合同一进程在同一地址上提供多个gRPC服务的场景，租约丢失后也一起重新注册；
+// 可以用Unregister单独注销其中的实例，UnregisterServices在一个事务中注销全部实例
+func (r *EtcdRegistry) RegisterServices(ctx context.Context, infos []*ServiceInfo) (err error) {
+	if len(infos) == 0 {
+		return nil
+	}
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name
+	}
+	ctx, span := r.startSpan(ctx, SpanRegister)
+	span.SetAttributes("services", strings.Join(names, ","), "address", infos[0].Address)
+	defer func() { span.End(err) }()
+	opCtx, cancelOp := r.opContext(ctx)
+	defer cancelOp()
+
+	group := &leaseGroup{members: make([]*registration, len(infos))}
+	values := make([]string, len(infos))
+	keys := make(map[string]bool, len(infos))
+	for i, info := range infos {
+		if err := info.Validate(); err != nil {
+			return wrapError("register", info.Name, info.Address, err)
+		}
+		key := serviceKey(info.Name, info.Address)
+		if keys[key] {
+			return newError("register", info.Name, info.Address, ErrAlreadyRegistered)
+		}
+		keys[key] = true
+		if values[i], err = r.encodeStamped(info, time.Now(), time.Time{}); err != nil {
+			return wrapError("register", info.Name, info.Address, err)
+		}
+		group.members[i] = &registration{key: key, info: info, traceCtx: ctx, group: group}
+	}
+	owner := group.members[0]
+
+	r.mu.Lock()
+	for _, reg := range group.members {
+		if _, ok := r.registrations[reg.key]; ok {
+			r.mu.Unlock()
+			return newError("register", reg.info.Name, reg.info.Address, ErrAlreadyRegistered)
+		}
+	}
+	// 先占位，避免并发注册同一实例
+	for _, reg := range group.members {
+		r.registrations[reg.key] = reg
+		r.reportRegistrationsLocked(reg.info.Name)
+	}
+	r.mu.Unlock()
+	removeAll := func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for _, reg := range group.members {
+			if r.registrations[reg.key] == reg {
+				r.removeLocked(reg)
+			}
+		}
+	}
+
+	var grantResp *clientv3.LeaseGrantResponse
+	err = r.retry(opCtx, "grant", owner.info.Name, func(ctx context.Context) (err error) {
+		grantResp, err = r.lease.Grant(ctx, r.ttl)
+		return err
+	})
+	if err != nil {
+		removeAll()
+		return wrapError("register", owner.info.Name, owner.info.Address, err)
+	}
+
+	puts := make([]clientv3.Op, len(group.members))
+	for i, reg := range group.members {
+		puts[i] = clientv3.OpPut(reg.key, values[i], clientv3.WithLease(grantResp.ID))
+	}
+	err = r.retry(opCtx, "register", owner.info.Name, func(ctx context.Context) error {
+		_, err := r.kv.Txn(ctx).Then(puts...).Commit()
+		return err
+	})
+	if err != nil {
+		removeAll()
+		r.lease.Revoke(r.ctx, grantResp.ID)
+		return wrapError("register", owner.info.Name, owner.info.Address, err)
+	}
+
+	keepAliveCtx, cancel := context.WithCancel(r.ctx)
+	keepAliveChan, err := r.lease.KeepAlive(keepAliveCtx, grantResp.ID)
+	if err != nil {
+		cancel()
+		removeAll()
+		r.lease.Revoke(r.ctx, grantResp.ID)
+		r.opts.logger.Error("start keepalive failed",
+			"services", names, "address", owner.info.Address, "error", err)
+		return wrapError("keepalive", owner.info.Name, owner.info.Address, err)
+	}
+	r.mu.Lock()
+	if len(r.liveMembersLocked(owner)) != len(group.members) {
+		// 注册过程中有实例被Unregister或Close移除，整组放弃并撤销租约
+		closed := r.closed
+		for _, reg := range group.members {
+			if r.registrations[reg.key] == reg {
+				r.removeLocked(reg)
+			}
+		}
+		r.mu.Unlock()
+		cancel()
+		r.lease.Revoke(r.ctx, grantResp.ID)
+		if closed {
+			return wrapError("register", owner.info.Name, owner.info.Address, ErrRegistryClosed)
+		}
+		return newError("register", owner.info.Name, owner.info.Address, ErrNotRegistered)
+	}
+	now := time.Now()
+	owner.cancel = cancel
+	for _, reg := range group.members {
+		reg.leaseID = grantResp.ID
+		reg.cancel = cancel
+		reg.lastKeepAlive = now
+	}
+	r.mu.Unlock()
+	goLabeled(goroutineLabels(LabelOpKeepAlive, "service", owner.info.Name, "address", owner.info.Address), func() {
+		r.keepAlive(keepAliveCtx, owner, keepAliveChan)
+	})
+
+	span.SetAttributes("lease", int64(grantResp.ID))
+	r.opts.logger.Info("services registered",
+		"services", names, "address", owner.info.Address, "lease", int64(grantResp.ID))
+	for _, reg := range group.members {
+		r.writeAudit(opCtx, AuditRegister, reg.info)
+		r.fireRegister(r.registrationInfo(reg))
+	}
+	return nil
+}
+
+// UnregisterServices 在一个事务中删除一组实例并撤销它们的租约，客户端不会看到只注销了一部分的中间状态
+// 所有实例都不存在时返回ErrNotRegistered
+func (r *EtcdRegistry) UnregisterServices(ctx context.Context, infos []*ServiceInfo) (err error) {
+	if len(infos) == 0 {
+		return nil
+	}
+	ctx, span := r.startSpan(ctx, SpanUnregister)
+	span.SetAttributes("services", len(infos), "address", infos[0].Address)
+	defer func() { span.End(err) }()
+	ctx, cancel := r.opContext(ctx)
+	defer cancel()
+
+	deletes := make([]clientv3.Op, 0, len(infos))
+	popped := make([]*ServiceInfo, 0, len(infos))
+	leases := make(map[clientv3.LeaseID]bool)
+	r.mu.Lock()
+	for _, info := range infos {
+		key := serviceKey(info.Name, info.Address)
+		deletes = append(deletes, clientv3.OpDelete(key))
+		if reg, ok := r.registrations[key]; ok {
+			r.removeLocked(reg)
+			copied := *reg.info
+			popped = append(popped, &copied)
+			if len(r.liveMembersLocked(reg)) == 0 && reg.leaseID != 0 {
+				leases[reg.leaseID] = true
+			}
+		}
+	}
+	r.mu.Unlock()
+
+	for _, info := range popped {
+		r.markDeregistering(ctx, info)
+	}
+	var resp *clientv3.TxnResponse
+	err = r.retry(ctx, "unregister", infos[0].Name, func(ctx context.Context) (err error) {
+		resp, err = r.kv.Txn(ctx).Then(deletes...).Commit()
+		return err
+	})
+	if err != nil {
+		return wrapError("unregister", infos[0].Name, infos[0].Address, err)
+	}
+	for leaseID := range leases {
+		r.retry(ctx, "revoke", infos[0].Name, func(ctx context.Context) error {
+			_, err := r.lease.Revoke(ctx, leaseID)
+			return err
+		})
+	}
+	deleted := int64(0)
+	for _, op := range resp.Responses {
+		deleted += op.GetResponseDeleteRange().Deleted
+	}
+	if deleted == 0 && len(popped) == 0 {
+		return newError("unregister", infos[0].Name, infos[0].Address, ErrNotRegistered)
+	}
+	for _, info := range popped {
+		r.opts.logger.Info("service unregistered", "service", info.Name, "address", info.Address)
+		r.writeAudit(ctx, AuditDeregister, info)
+		r.fireDeregister(info, nil)
+	}
+	return nil
+}
+
+// registeredServices 返回本注册中心当前注册的全部实例信息的副本
+func (r *EtcdRegistry) registeredServices() []*ServiceInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	infos := make([]*ServiceInfo, 0, len(r.registrations))
+	for _, reg := range r.registrations {
+		info := *reg.info
+		infos = append(infos, &info)
+	}
+	return infos
+}
+
+// ServiceInfoProvider 提供已注册的gRPC服务，*grpc.Server实现了该接口
+type ServiceInfoProvider interface {
+	GetServiceInfo() map[string]grpc.ServiceInfo
+}
+
+// 默认跳过的gRPC服务名前缀，反射和健康检查服务不作为业务服务注册
+var skippedServicePrefixes = []string{"grpc.reflection.", "grpc.health."}
+
+// ServiceNameOption ServerServices选择服务名的配置项
+type ServiceNameOption func(*serviceNameFilter)
+
+type serviceNameFilter struct {
+	allow map[string]bool
+	deny  map[string]bool
+}
+
+// WithServiceNames 只注册列出的gRPC服务，未设置时注册全部服务
+func WithServiceNames(names ...string) ServiceNameOption {
+	return func(f *serviceNameFilter) {
+		if f.allow == nil {
+			f.allow = make(map[string]bool, len(names))
+		}
+		for _, name := range names {
+			f.allow[name] = true
+		}
+	}
+}
+
+// WithoutServiceNames 不注册列出的gRPC服务，优先于WithServiceNames
+func WithoutServiceNames(names ...string) ServiceNameOption {
+	return func(f *serviceNameFilter) {
+		if f.deny == nil {
+			f.deny = make(map[string]bool, len(names))
+		}
+		for _, name := range names {
+			f.deny[name] = true
+		}
+	}
+}
+
+// match 服务名是否需要注册，grpc.reflection和grpc.health下的服务只有在WithServiceNames中列出时才注册
+func (f *serviceNameFilter) match(name string) bool {
+	if f.deny[name] {
+		return false
+	}
+	if f.allow != nil {
+		return f.allow[name]
+	}
+	for _, prefix := range skippedServicePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// ServerServices 按srv上注册的gRPC服务生成注册信息，每个服务名（例如helloworld.Greeter）一条，按服务名排序
+// 除Name外的字段复制自template，Tags和Metadata为各自的副本
+func ServerServices(srv ServiceInfoProvider, template ServiceInfo, opts ...ServiceNameOption) []*ServiceInfo {
+	filter := &serviceNameFilter{}
+	for _, opt := range opts {
+		opt(filter)
+	}
+	names := make([]string, 0)
+	for name := range srv.GetServiceInfo() {
+		if filter.match(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	infos := make([]*ServiceInfo, len(names))
+	for i, name := range names {
+		info := template
+		info.Name = name
+		info.Addresses = slices.Clone(template.Addresses)
+		info.Tags = slices.Clone(template.Tags)
+		if template.Metadata != nil {
+			info.Metadata = make(map[string]string, len(template.Metadata))
+			for k, v := range template.Metadata {
+				info.Metadata[k] = v
+			}
+		}
+		infos[i] = &info
+	}
+	return infos
+}
+
+// RegisterServer 将srv上的gRPC服务按ServerServices逐个注册到template.Address，共享同一个租约
+// 返回注册的实例，注销时传给UnregisterServices；没有可注册的服务时返回错误
+func (r *EtcdRegistry) RegisterServer(ctx context.Context, srv ServiceInfoProvider, template ServiceInfo, opts ...ServiceNameOption) ([]*ServiceInfo, error) {
+	infos := ServerServices(srv, template, opts...)
+	if len(infos) == 0 {
+		return nil, fmt.Errorf("%w: grpc server at %s has no services to register", ErrInvalidService, template.Address)
+	}
+	if err := r.RegisterServices(ctx, infos); err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
@@ -0,0 +1,116 @@
+// registry/health.go
+package registry
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pingKey Ping读取的key，与etcd自身健康检查使用的key一致
+const pingKey = "health"
+
+// pingTimeout Ping的最长等待时间
+const pingTimeout = 2 * time.Second
+
+// ConnectivityState 注册实例的心跳状态
+type ConnectivityState int
+
+const (
+	// ConnectivityIdle 没有通过本注册中心注册的实例
+	ConnectivityIdle ConnectivityState = iota
+	// ConnectivityReady 所有注册实例的心跳正常
+	ConnectivityReady
+	// ConnectivityFailing 至少一个注册实例的心跳失败或租约已丢失
+	ConnectivityFailing
+)
+
+func (s ConnectivityState) String() string {
+	switch s {
+	case ConnectivityIdle:
+		return "IDLE"
+	case ConnectivityReady:
+		return "READY"
+	case ConnectivityFailing:
+		return "FAILING"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// healthState 最近一次后台etcd交互（心跳、拉取、watch事件）的结果
+type healthState struct {
+	mu      sync.Mutex
+	lastErr error
+	lastAt  time.Time
+	failure failureTracker
+	// threshold和onUnreachable 持续失败超过threshold时调用onUnreachable，创建时设置
+	threshold     time.Duration
+	onUnreachable func(since time.Time, err error)
+}
+
+// record 记录一次后台交互的结果
+func (h *healthState) record(err error) {
+	h.mu.Lock()
+	h.lastErr = err
+	h.lastAt = time.Now()
+	var unreachable bool
+	if err == nil {
+		h.failure.reset()
+	} else {
+		unreachable = h.failure.fail(h.lastAt, h.threshold)
+	}
+	since := h.failure.since
+	h.mu.Unlock()
+
+	if unreachable && h.onUnreachable != nil {
+		h.onUnreachable(since, err)
+	}
+}
+
+// Ping 通过一次线性一致读确认etcd连接可用，最多等待2s
+func (r *EtcdRegistry) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	_, err := r.kv.Get(ctx, pingKey)
+	r.health.record(err)
+	return wrapError("ping", "", "", err)
+}
+
+// Healthy 最近一次后台etcd交互（心跳、拉取、watch事件）是否成功，尚无交互时返回true
+func (r *EtcdRegistry) Healthy() bool {
+	r.health.mu.Lock()
+	defer r.health.mu.Unlock()
+	return r.health.lastErr == nil
+}
+
+// ConnectivityState 返回注册实例的心跳状态，用于区分etcd不可用和服务未注册
+func (r *EtcdRegistry) ConnectivityState() ConnectivityState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.registrations) == 0 {
+		return ConnectivityIdle
+	}
+	for _, reg := range r.registrations {
+		if reg.failing {
+			return ConnectivityFailing
+		}
+	}
+	return ConnectivityReady
+}
+
+// setKeepAliveResult 记录注册实例及其同组实例的心跳结果
+func (r *EtcdRegistry) setKeepAliveResult(reg *registration, err error) {
+	r.health.record(err)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, member := range r.liveMembersLocked(reg) {
+		member.failing = err != nil
+		if err == nil {
+			member.lastKeepAlive = time.Now()
+		}
+	}
+}
@@ -0,0 +1,206 @@
+// registry/healthfollow.go
+package registry
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// FollowHealth 默认的检查间隔和下线前的保持时间
+const (
+	DefaultHealthInterval = 5 * time.Second
+	DefaultHealthHoldTime = 15 * time.Second
+)
+
+// HealthChecker 返回服务当前的健康状态，返回错误按NOT_SERVING处理
+type HealthChecker func(ctx context.Context) (healthpb.HealthCheckResponse_ServingStatus, error)
+
+// healthCheckServer grpc_health_v1的Check方法，*health.Server实现了该接口
+type healthCheckServer interface {
+	Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error)
+}
+
+// HealthServerChecker 返回查询srv中service状态的HealthChecker，srv通常为*health.Server，service为空表示整个服务器
+func HealthServerChecker(srv healthCheckServer, service string) HealthChecker {
+	return func(ctx context.Context) (healthpb.HealthCheckResponse_ServingStatus, error) {
+		resp, err := srv.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			return healthpb.HealthCheckResponse_UNKNOWN, err
+		}
+		return resp.GetStatus(), nil
+	}
+}
+
+// HealthOption FollowHealth的配置项
+type HealthOption func(*healthFollowOptions)
+
+type healthFollowOptions struct {
+	interval time.Duration
+	holdTime time.Duration
+	withdraw bool
+}
+
+// WithHealthInterval 设置检查健康状态的间隔，默认DefaultHealthInterval
+func WithHealthInterval(d time.Duration) HealthOption {
+	return func(o *healthFollowOptions) {
+		o.interval = d
+	}
+}
+
+// WithHealthHoldTime 设置持续不健康多久后才修改注册，默认DefaultHealthHoldTime，0表示立即修改
+// 保持时间内恢复健康不会修改注册，避免一次较慢的依赖检查就把实例摘掉
+func WithHealthHoldTime(d time.Duration) HealthOption {
+	return func(o *healthFollowOptions) {
+		o.holdTime = d
+	}
+}
+
+// WithHealthWithdraw 不健康时删除实例，默认只将Status改为StatusDown并保留注册
+func WithHealthWithdraw() HealthOption {
+	return func(o *healthFollowOptions) {
+		o.withdraw = true
+	}
+}
+
+// FollowHealth 按check的结果维护info的注册，阻塞直到ctx结束，结束时注销实例并返回注销的错误
+//
+// 首次检查为SERVING时才注册；注册后持续不健康超过保持时间时将Status改为StatusDown
+// （设置WithHealthWithdraw时删除实例），恢复SERVING后立即恢复info原有的状态或重新注册。
+// 注册和修改失败时记录日志并在下一次检查时重试。
+// 同一实例已由其他调用方通过本注册中心注册时不接管该注册（不会修改或注销它），记录冲突并在之后的检查中重试注册
+func (r *EtcdRegistry) FollowHealth(ctx context.Context, info *ServiceInfo, check HealthChecker, opts ...HealthOption) error {
+	o := &healthFollowOptions{interval: DefaultHealthInterval, holdTime: DefaultHealthHoldTime}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.interval <= 0 {
+		return errors.New("invalid health check interval: must be positive")
+	}
+	f := &healthFollower{registry: r, info: info, opts: o}
+
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+	for {
+		f.check(ctx, check)
+		select {
+		case <-ctx.Done():
+			return f.stop()
+		case <-ticker.C:
+		}
+	}
+}
+
+// healthFollower FollowHealth的状态，只在FollowHealth所在的goroutine中使用
+type healthFollower struct {
+	registry *EtcdRegistry
+	info     *ServiceInfo
+	opts     *healthFollowOptions
+
+	// registered 实例已注册，down 已因不健康被改为StatusDown
+	registered bool
+	down       bool
+	// conflict 实例已由其他调用方注册，只在冲突开始时记录一次日志
+	conflict bool
+	// unhealthySince 本次不健康的开始时间，健康时为零值
+	unhealthySince time.Time
+}
+
+// check 执行一次健康检查并按结果修改注册
+func (f *healthFollower) check(ctx context.Context, check HealthChecker) {
+	logger := f.registry.opts.logger
+	checkCtx, cancel := context.WithTimeout(ctx, f.registry.opts.requestTimeout)
+	status, err := check(checkCtx)
+	cancel()
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err == nil && status == healthpb.HealthCheckResponse_SERVING {
+		f.unhealthySince = time.Time{}
+		f.recover(ctx)
+		return
+	}
+	if !f.registered || f.down {
+		return
+	}
+	now := time.Now()
+	if f.unhealthySince.IsZero() {
+		f.unhealthySince = now
+		logger.Warn("service not serving, waiting before withdrawing registration",
+			"service", f.info.Name, "address", f.info.Address, "status", status.String(), "error", err, "hold", f.opts.holdTime)
+	}
+	if now.Sub(f.unhealthySince) < f.opts.holdTime {
+		return
+	}
+	f.withdraw(ctx, status, err)
+}
+
+// recover 健康时注册实例或恢复其原有状态
+func (f *healthFollower) recover(ctx context.Context) {
+	logger := f.registry.opts.logger
+	switch {
+	case !f.registered:
+		err := f.registry.RegisterServiceContext(ctx, f.info)
+		if errors.Is(err, ErrAlreadyRegistered) {
+			if !f.conflict {
+				f.conflict = true
+				logger.Warn("service already registered by another caller, not taking over, will retry",
+					"service", f.info.Name, "address", f.info.Address)
+			}
+			return
+		}
+		if err != nil {
+			logger.Warn("register healthy service failed", "service", f.info.Name, "address", f.info.Address, "error", err)
+			return
+		}
+		f.registered = true
+		f.conflict = false
+		logger.Info("service serving, registered", "service", f.info.Name, "address", f.info.Address)
+	case f.down:
+		if err := f.registry.UpdateServiceInfoContext(ctx, f.info); err != nil {
+			logger.Warn("restore status of healthy service failed", "service", f.info.Name, "address", f.info.Address, "error", err)
+			return
+		}
+		f.down = false
+		logger.Info("service serving again, status restored", "service", f.info.Name, "address", f.info.Address)
+	}
+}
+
+// withdraw 持续不健康超过保持时间后下线实例
+func (f *healthFollower) withdraw(ctx context.Context, status healthpb.HealthCheckResponse_ServingStatus, checkErr error) {
+	logger := f.registry.opts.logger
+	since := f.unhealthySince
+	if f.opts.withdraw {
+		if err := f.registry.UnregisterContext(ctx, f.info.Name, f.info.Address); err != nil && !errors.Is(err, ErrNotRegistered) {
+			logger.Warn("withdraw unhealthy service failed", "service", f.info.Name, "address", f.info.Address, "error", err)
+			return
+		}
+		f.registered = false
+	} else {
+		down := *f.info
+		down.Status = StatusDown
+		if err := f.registry.UpdateServiceInfoContext(ctx, &down); err != nil {
+			logger.Warn("mark unhealthy service down failed", "service", f.info.Name, "address", f.info.Address, "error", err)
+			return
+		}
+		f.down = true
+	}
+	logger.Warn("service not serving, registration withdrawn",
+		"service", f.info.Name, "address", f.info.Address, "status", status.String(), "error", checkErr,
+		"since", since, "removed", f.opts.withdraw)
+}
+
+// stop FollowHealth结束时注销实例
+func (f *healthFollower) stop() error {
+	if !f.registered {
+		return nil
+	}
+	err := f.registry.Unregister(f.info.Name, f.info.Address)
+	if errors.Is(err, ErrNotRegistered) {
+		return nil
+	}
+	return err
+}
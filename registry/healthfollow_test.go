@@ -0,0 +1,204 @@
+// registry/healthfollow_test.go
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// switchChecker 可随时切换结果的健康检查，记录检查次数
+type switchChecker struct {
+	status atomic.Int32
+	calls  atomic.Int64
+}
+
+func newSwitchChecker(status healthpb.HealthCheckResponse_ServingStatus) *switchChecker {
+	c := &switchChecker{}
+	c.set(status)
+	return c
+}
+
+func (c *switchChecker) set(status healthpb.HealthCheckResponse_ServingStatus) {
+	c.status.Store(int32(status))
+}
+
+func (c *switchChecker) check(context.Context) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	c.calls.Add(1)
+	return healthpb.HealthCheckResponse_ServingStatus(c.status.Load()), nil
+}
+
+// waitChecks 等待再完成n次检查
+func (c *switchChecker) waitChecks(t *testing.T, n int64) {
+	t.Helper()
+	want := c.calls.Load() + n
+	eventually(t, "health checks", func() error {
+		if got := c.calls.Load(); got < want {
+			return fmt.Errorf("%d checks, want %d", got, want)
+		}
+		return nil
+	})
+}
+
+// followHealth 在goroutine中运行FollowHealth，返回的stop取消并等待其返回值
+func followHealth(t *testing.T, r *EtcdRegistry, info *ServiceInfo, check HealthChecker, opts ...HealthOption) (stop func() error) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- r.FollowHealth(ctx, info, check, opts...) }()
+	t.Cleanup(cancel)
+	return func() error {
+		cancel()
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(testTimeout):
+			t.Fatal("FollowHealth did not return after cancel")
+			return nil
+		}
+	}
+}
+
+// expectStatus 检查服务恰好有一个地址为addr、状态为status的实例
+func expectStatus(r *EtcdRegistry, service, addr, status string) func() error {
+	return func() error {
+		services, err := r.Discover(service)
+		if err != nil {
+			return err
+		}
+		if err := expectAddrs(services, addr); err != nil {
+			return err
+		}
+		if services[0].Status != status {
+			return fmt.Errorf("status %q, want %q", services[0].Status, status)
+		}
+		return nil
+	}
+}
+
+func TestFollowHealthFollowsServingStatus(t *testing.T) {
+	service := testService(t)
+	r := newTestRegistry(t)
+	other := newTestRegistry(t)
+	checker := newSwitchChecker(healthpb.HealthCheckResponse_NOT_SERVING)
+	info := &ServiceInfo{Name: service, Address: "10.0.0.1:80"}
+	stop := followHealth(t, r, info, checker.check, WithHealthInterval(20*time.Millisecond), WithHealthHoldTime(0))
+
+	// 未SERVING前不注册
+	checker.waitChecks(t, 3)
+	if _, err := other.Discover(service); !errors.Is(err, ErrNoInstances) {
+		t.Fatalf("discover before serving: got %v, want ErrNoInstances", err)
+	}
+
+	checker.set(healthpb.HealthCheckResponse_SERVING)
+	eventually(t, "registered when serving", expectStatus(other, service, info.Address, ""))
+	checker.set(healthpb.HealthCheckResponse_NOT_SERVING)
+	eventually(t, "marked down when not serving", expectStatus(other, service, info.Address, StatusDown))
+	checker.set(healthpb.HealthCheckResponse_SERVING)
+	eventually(t, "status restored when serving again", expectStatus(other, service, info.Address, ""))
+
+	if err := stop(); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if _, err := other.Discover(service); !errors.Is(err, ErrNoInstances) {
+		t.Fatalf("discover after stop: got %v, want ErrNoInstances", err)
+	}
+}
+
+func TestFollowHealthHoldTime(t *testing.T) {
+	service := testService(t)
+	r := newTestRegistry(t)
+	other := newTestRegistry(t)
+	checker := newSwitchChecker(healthpb.HealthCheckResponse_SERVING)
+	info := &ServiceInfo{Name: service, Address: "10.0.0.1:80"}
+	followHealth(t, r, info, checker.check,
+		WithHealthInterval(20*time.Millisecond), WithHealthHoldTime(time.Second), WithHealthWithdraw())
+	eventually(t, "registered when serving", expectStatus(other, service, info.Address, ""))
+
+	// 保持时间内恢复不修改注册
+	checker.set(healthpb.HealthCheckResponse_NOT_SERVING)
+	time.Sleep(300 * time.Millisecond)
+	checker.set(healthpb.HealthCheckResponse_SERVING)
+	time.Sleep(time.Second)
+	if err := expectStatus(other, service, info.Address, "")(); err != nil {
+		t.Fatalf("short outage within hold time: %v", err)
+	}
+
+	// 持续不健康超过保持时间后删除实例
+	checker.set(healthpb.HealthCheckResponse_NOT_SERVING)
+	eventually(t, "withdrawn after hold time", func() error {
+		if _, err := other.Discover(service); !errors.Is(err, ErrNoInstances) {
+			return fmt.Errorf("discover: got %v, want ErrNoInstances", err)
+		}
+		return nil
+	})
+}
+
+func TestFollowHealthDoesNotTakeOverRegistration(t *testing.T) {
+	service := testService(t)
+	r := newTestRegistry(t)
+	other := newTestRegistry(t)
+	info := &ServiceInfo{Name: service, Address: "10.0.0.1:80", Version: "owner"}
+	mustRegister(t, r, info)
+
+	checker := newSwitchChecker(healthpb.HealthCheckResponse_SERVING)
+	follow := &ServiceInfo{Name: service, Address: info.Address, Version: "follower"}
+	stop := followHealth(t, r, follow, checker.check, WithHealthInterval(20*time.Millisecond), WithHealthHoldTime(0))
+
+	// 冲突期间不修改已有注册，结束时也不注销它
+	checker.waitChecks(t, 3)
+	checker.set(healthpb.HealthCheckResponse_NOT_SERVING)
+	checker.waitChecks(t, 3)
+	if err := stop(); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	services, err := other.Discover(service)
+	if err != nil {
+		t.Fatalf("discover after stop: %v", err)
+	}
+	if len(services) != 1 || services[0].Version != "owner" || services[0].Status != "" {
+		t.Fatalf("registration of the owner changed: %+v", services[0])
+	}
+	if state := r.Readiness(service); !state.Ready {
+		t.Fatalf("owner not ready after follower stopped: %+v", state.Registrations)
+	}
+}
+
+func TestFollowHealthRetriesAfterConflict(t *testing.T) {
+	service := testService(t)
+	r := newTestRegistry(t)
+	other := newTestRegistry(t)
+	info := &ServiceInfo{Name: service, Address: "10.0.0.1:80", Version: "owner"}
+	mustRegister(t, r, info)
+
+	checker := newSwitchChecker(healthpb.HealthCheckResponse_SERVING)
+	follow := &ServiceInfo{Name: service, Address: info.Address, Version: "follower"}
+	stop := followHealth(t, r, follow, checker.check, WithHealthInterval(20*time.Millisecond))
+	checker.waitChecks(t, 3)
+
+	// 原注册方注销后重试注册成功，此后由FollowHealth负责注销
+	if err := r.Unregister(service, info.Address); err != nil {
+		t.Fatalf("unregister owner: %v", err)
+	}
+	eventually(t, "registered by follower", func() error {
+		services, err := other.Discover(service)
+		if err != nil {
+			return err
+		}
+		if services[0].Version != "follower" {
+			return fmt.Errorf("version %q, want follower", services[0].Version)
+		}
+		return nil
+	})
+	if err := stop(); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if _, err := other.Discover(service); !errors.Is(err, ErrNoInstances) {
+		t.Fatalf("discover after stop: got %v, want ErrNoInstances", err)
+	}
+}
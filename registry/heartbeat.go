@@ -0,0 +1,78 @@
+// registry/heartbeat.go
+package registry
+
+import (
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// minSafeTTL 建议的最短租约时长
+// etcd客户端每TTL/3发送一次心跳，更短的租约在etcd落盘变慢或网络抖动时来不及续约，注册会反复丢失
+const minSafeTTL = 5 * time.Second
+
+// lateKeepAliveFactor 心跳间隔超过TTL/3的倍数时视为心跳延迟
+const lateKeepAliveFactor = 2
+
+// HeartbeatAnomalyKind 心跳异常类型
+type HeartbeatAnomalyKind string
+
+const (
+	// AnomalyShortTTL 创建时租约时长短于建议的最短时长或不长于请求超时
+	AnomalyShortTTL HeartbeatAnomalyKind = "short-ttl"
+	// AnomalyTTLMismatch etcd续约返回的TTL与申请的不一致，例如被etcd的最短租约调整
+	AnomalyTTLMismatch HeartbeatAnomalyKind = "ttl-mismatch"
+	// AnomalyLateKeepAlive 两次心跳响应的间隔远长于TTL/3，通常是本地调度饥饿、GC停顿或时钟问题
+	AnomalyLateKeepAlive HeartbeatAnomalyKind = "late-keepalive"
+)
+
+// HeartbeatAnomaly 一次心跳异常及测得的数值
+type HeartbeatAnomaly struct {
+	Kind HeartbeatAnomalyKind
+	// Service和Address 发生异常的实例，AnomalyShortTTL时为空
+	Service string
+	Address string
+	// Expected和Measured 期望值与测得值：AnomalyShortTTL为建议的最短TTL和配置的TTL，
+	// AnomalyTTLMismatch为申请和实际的TTL，AnomalyLateKeepAlive为TTL/3和实际的心跳间隔
+	Expected time.Duration
+	Measured time.Duration
+}
+
+// checkTTL 创建时检查租约时长是否足以容忍心跳抖动
+func (r *EtcdRegistry) checkTTL() {
+	ttl := time.Duration(r.ttl) * time.Second
+	if ttl >= minSafeTTL && ttl > r.opts.requestTimeout {
+		return
+	}
+	r.opts.logger.Warn("lease ttl is too short for reliable keepalive, registrations may flap",
+		"ttl", ttl, "minSafeTTL", minSafeTTL, "keepAliveInterval", ttl/3, "requestTimeout", r.opts.requestTimeout)
+	r.fireHeartbeatAnomaly(HeartbeatAnomaly{Kind: AnomalyShortTTL, Expected: max(minSafeTTL, r.opts.requestTimeout+time.Second), Measured: ttl})
+}
+
+// checkKeepAlive 检查一次心跳响应，记录测得的续约间隔，发现异常时输出警告并触发OnHeartbeatAnomaly
+func (r *EtcdRegistry) checkKeepAlive(reg *registration, resp *clientv3.LeaseKeepAliveResponse, interval time.Duration) {
+	expected := time.Duration(r.ttl) * time.Second / 3
+
+	r.mu.Lock()
+	// 同一个TTL只报告一次，避免每次心跳都重复警告
+	mismatch := resp.TTL != r.ttl && resp.TTL != reg.grantedTTL
+	reg.renewalInterval, reg.grantedTTL = interval, resp.TTL
+	for _, member := range r.liveMembersLocked(reg) {
+		member.renewalInterval, member.grantedTTL = interval, resp.TTL
+	}
+	info := *reg.info
+	r.mu.Unlock()
+
+	if mismatch {
+		r.opts.logger.Warn("keepalive granted ttl differs from requested",
+			"service", info.Name, "address", info.Address, "key", reg.key, "requestedTTL", r.ttl, "grantedTTL", resp.TTL)
+		r.fireHeartbeatAnomaly(HeartbeatAnomaly{Kind: AnomalyTTLMismatch, Service: info.Name, Address: info.Address,
+			Expected: time.Duration(r.ttl) * time.Second, Measured: time.Duration(resp.TTL) * time.Second})
+	}
+	if interval > lateKeepAliveFactor*expected {
+		r.opts.logger.Warn("keepalive arrived late, lease is close to expiring",
+			"service", info.Name, "address", info.Address, "key", reg.key, "expectedInterval", expected, "interval", interval)
+		r.fireHeartbeatAnomaly(HeartbeatAnomaly{Kind: AnomalyLateKeepAlive, Service: info.Name, Address: info.Address,
+			Expected: expected, Measured: interval})
+	}
+}
@@ -0,0 +1,120 @@
+// registry/history.go
+package registry
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultHistorySize 每类事件默认保留的历史条数
+const DefaultHistorySize = 256
+
+// HistoryKind 事件历史的类型
+type HistoryKind string
+
+const (
+	// HistoryResolverUpdate resolver向gRPC推送了新状态，Addresses为推送的地址数
+	HistoryResolverUpdate HistoryKind = "resolver-update"
+	// HistoryResolverError resolver向gRPC上报了错误，Class为错误分类
+	HistoryResolverError HistoryKind = "resolver-error"
+	// HistoryWatchError 服务实例的拉取或watch出错
+	HistoryWatchError HistoryKind = "watch-error"
+	// HistoryWatchReestablished 出错后重新拉取成功
+	HistoryWatchReestablished HistoryKind = "watch-reestablished"
+	// HistoryLeaseLost 注册实例的租约丢失
+	HistoryLeaseLost HistoryKind = "lease-lost"
+	// HistoryReRegister 租约丢失后的一次重新注册，Error为空表示成功
+	HistoryReRegister HistoryKind = "re-register"
+)
+
+// HistoryEvent 事件历史中的一条记录
+type HistoryEvent struct {
+	Time    time.Time   `json:"time"`
+	Kind    HistoryKind `json:"kind"`
+	Service string      `json:"service,omitempty"`
+	Address string      `json:"address,omitempty"`
+	// Addresses resolver推送的地址数，仅HistoryResolverUpdate
+	Addresses int `json:"addresses,omitempty"`
+	// Stale和Fallback 推送的是etcd不可用时的缓存地址或静态兜底地址，仅HistoryResolverUpdate
+	Stale    bool `json:"stale,omitempty"`
+	Fallback bool `json:"fallback,omitempty"`
+	// Class resolver错误分类或心跳中断原因，仅HistoryResolverError和HistoryLeaseLost
+	Class string `json:"class,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// historyRing 固定容量的事件环，写入只做一次原子自增和一次原子指针写入，读取时复制快照
+// 容量为0时不记录
+type historyRing struct {
+	slots []atomic.Pointer[historyEntry]
+	next  atomic.Uint64
+}
+
+// historyEntry 带写入序号的记录，序号用于快照排序和丢弃读取期间被覆盖的槽位
+type historyEntry struct {
+	seq   uint64
+	event HistoryEvent
+}
+
+func newHistoryRing(size int) *historyRing {
+	return &historyRing{slots: make([]atomic.Pointer[historyEntry], size)}
+}
+
+// add 记录一条事件，超出容量时覆盖最旧的记录
+func (h *historyRing) add(event HistoryEvent) {
+	if len(h.slots) == 0 {
+		return
+	}
+	seq := h.next.Add(1) - 1
+	h.slots[seq%uint64(len(h.slots))].Store(&historyEntry{seq: seq, event: event})
+}
+
+// snapshot 返回当前记录，按写入顺序从旧到新排列
+func (h *historyRing) snapshot() []historyEntry {
+	entries := make([]historyEntry, 0, len(h.slots))
+	for i := range h.slots {
+		if entry := h.slots[i].Load(); entry != nil {
+			entries = append(entries, *entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+	return entries
+}
+
+// eventHistory 按子系统分开的事件环，每个子系统通常只有一个写入方，互不争用缓存行
+type eventHistory struct {
+	resolver *historyRing
+	watch    *historyRing
+	lease    *historyRing
+}
+
+func newEventHistory(size int) *eventHistory {
+	return &eventHistory{resolver: newHistoryRing(size), watch: newHistoryRing(size), lease: newHistoryRing(size)}
+}
+
+// list 合并各子系统的记录，按时间从旧到新排列
+func (h *eventHistory) list() []HistoryEvent {
+	var events []HistoryEvent
+	for _, ring := range []*historyRing{h.resolver, h.watch, h.lease} {
+		for _, entry := range ring.snapshot() {
+			events = append(events, entry.event)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events
+}
+
+// recordHistory 在ring中记录一条事件，时间在这里填写
+func recordHistory(ring *historyRing, event HistoryEvent) {
+	event.Time = time.Now()
+	ring.add(event)
+}
+
+// errorString err为nil时返回空字符串
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,151 @@
+// registry/hooks.go
+package registry
+
+import (
+	"context"
+	"fmt"
+)
+
+// Hooks 注册中心生命周期事件回调，未设置的回调会被忽略
+// 回调在独立goroutine中执行，不会阻塞心跳和watch，回调中的panic会被恢复并记录日志；
+// 需要关联ID或链路追踪span时使用ContextHooks
+type Hooks struct {
+	// OnRegister 实例注册成功
+	OnRegister func(service *ServiceInfo)
+	// OnDeregister 实例被Unregister注销或在关闭注册中心时注销，err为关闭时撤销租约的错误
+	OnDeregister func(service *ServiceInfo, err error)
+	// OnLeaseLost 实例的心跳启动失败或租约丢失，随后会自动重新注册
+	OnLeaseLost func(service *ServiceInfo, err error)
+	// OnReRegister 租约丢失后的一次重新注册结果，err为nil表示成功，失败时按退避继续重试
+	OnReRegister func(service *ServiceInfo, err error)
+	// OnWatchError 服务实例的拉取或watch出错，随后会按退避重新拉取
+	OnWatchError func(serviceName string, err error)
+	// OnWatchReestablished 拉取或watch出错后重新拉取成功，watch已恢复
+	OnWatchReestablished func(serviceName string)
+	// OnHeartbeatAnomaly 创建时租约时长过短，或心跳返回的TTL与申请的不一致、心跳间隔远长于TTL/3
+	OnHeartbeatAnomaly func(anomaly HeartbeatAnomaly)
+}
+
+// ContextHooks 同Hooks，回调额外收到一个ctx
+// ctx派生自注册中心的生命周期，携带EventInfo（关联ID和钩子名），设置了WithTracer时还携带本次回调的span
+type ContextHooks struct {
+	OnRegister           func(ctx context.Context, service *ServiceInfo)
+	OnDeregister         func(ctx context.Context, service *ServiceInfo, err error)
+	OnLeaseLost          func(ctx context.Context, service *ServiceInfo, err error)
+	OnReRegister         func(ctx context.Context, service *ServiceInfo, err error)
+	OnWatchError         func(ctx context.Context, serviceName string, err error)
+	OnWatchReestablished func(ctx context.Context, serviceName string)
+	OnHeartbeatAnomaly   func(ctx context.Context, anomaly HeartbeatAnomaly)
+}
+
+// withContext 将Hooks包装为忽略ctx的ContextHooks，未设置的回调保持为nil
+func (h Hooks) withContext() ContextHooks {
+	var c ContextHooks
+	if hook := h.OnRegister; hook != nil {
+		c.OnRegister = func(_ context.Context, service *ServiceInfo) { hook(service) }
+	}
+	if hook := h.OnDeregister; hook != nil {
+		c.OnDeregister = func(_ context.Context, service *ServiceInfo, err error) { hook(service, err) }
+	}
+	if hook := h.OnLeaseLost; hook != nil {
+		c.OnLeaseLost = func(_ context.Context, service *ServiceInfo, err error) { hook(service, err) }
+	}
+	if hook := h.OnReRegister; hook != nil {
+		c.OnReRegister = func(_ context.Context, service *ServiceInfo, err error) { hook(service, err) }
+	}
+	if hook := h.OnWatchError; hook != nil {
+		c.OnWatchError = func(_ context.Context, serviceName string, err error) { hook(serviceName, err) }
+	}
+	if hook := h.OnWatchReestablished; hook != nil {
+		c.OnWatchReestablished = func(_ context.Context, serviceName string) { hook(serviceName) }
+	}
+	if hook := h.OnHeartbeatAnomaly; hook != nil {
+		c.OnHeartbeatAnomaly = func(_ context.Context, anomaly HeartbeatAnomaly) { hook(anomaly) }
+	}
+	return c
+}
+
+// merge 用other中已设置的回调覆盖h中的同名回调
+func (h *ContextHooks) merge(other ContextHooks) {
+	if other.OnRegister != nil {
+		h.OnRegister = other.OnRegister
+	}
+	if other.OnDeregister != nil {
+		h.OnDeregister = other.OnDeregister
+	}
+	if other.OnLeaseLost != nil {
+		h.OnLeaseLost = other.OnLeaseLost
+	}
+	if other.OnReRegister != nil {
+		h.OnReRegister = other.OnReRegister
+	}
+	if other.OnWatchError != nil {
+		h.OnWatchError = other.OnWatchError
+	}
+	if other.OnWatchReestablished != nil {
+		h.OnWatchReestablished = other.OnWatchReestablished
+	}
+	if other.OnHeartbeatAnomaly != nil {
+		h.OnHeartbeatAnomaly = other.OnHeartbeatAnomaly
+	}
+}
+
+// fire 在独立goroutine中执行回调并恢复panic，回调的ctx携带关联ID和SpanHook
+func (r *EtcdRegistry) fire(name string, fn func(ctx context.Context)) {
+	goLabeled(goroutineLabels(LabelOpHook, "hook", name), func() {
+		ctx, span := r.eventContext(SpanHook, EventInfo{Type: name})
+		span.SetAttributes("hook", name)
+		defer func() {
+			var err error
+			if p := recover(); p != nil {
+				err = fmt.Errorf("%s panicked: %v", name, p)
+				r.recordError(&r.errorCounts.hookPanics, "hook", "", "", err)
+				r.opts.logger.Error("hook panicked", "hook", name, "panic", p)
+			}
+			span.End(err)
+		}()
+		fn(ctx)
+	})
+}
+
+func (r *EtcdRegistry) fireRegister(service *ServiceInfo) {
+	if hook := r.opts.hooks.OnRegister; hook != nil {
+		r.fire("OnRegister", func(ctx context.Context) { hook(ctx, service) })
+	}
+}
+
+func (r *EtcdRegistry) fireDeregister(service *ServiceInfo, err error) {
+	if hook := r.opts.hooks.OnDeregister; hook != nil {
+		r.fire("OnDeregister", func(ctx context.Context) { hook(ctx, service, err) })
+	}
+}
+
+func (r *EtcdRegistry) fireLeaseLost(service *ServiceInfo, err error) {
+	if hook := r.opts.hooks.OnLeaseLost; hook != nil {
+		r.fire("OnLeaseLost", func(ctx context.Context) { hook(ctx, service, err) })
+	}
+}
+
+func (r *EtcdRegistry) fireReRegister(service *ServiceInfo, err error) {
+	if hook := r.opts.hooks.OnReRegister; hook != nil {
+		r.fire("OnReRegister", func(ctx context.Context) { hook(ctx, service, err) })
+	}
+}
+
+func (r *EtcdRegistry) fireWatchError(serviceName string, err error) {
+	if hook := r.opts.hooks.OnWatchError; hook != nil {
+		r.fire("OnWatchError", func(ctx context.Context) { hook(ctx, serviceName, err) })
+	}
+}
+
+func (r *EtcdRegistry) fireWatchReestablished(serviceName string) {
+	if hook := r.opts.hooks.OnWatchReestablished; hook != nil {
+		r.fire("OnWatchReestablished", func(ctx context.Context) { hook(ctx, serviceName) })
+	}
+}
+
+func (r *EtcdRegistry) fireHeartbeatAnomaly(anomaly HeartbeatAnomaly) {
+	if hook := r.opts.hooks.OnHeartbeatAnomaly; hook != nil {
+		r.fire("OnHeartbeatAnomaly", func(ctx context.Context) { hook(ctx, anomaly) })
+	}
+}
@@ -0,0 +1,253 @@
+// registry/hooks_test.go
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/resolver"
+
+	"github.com/YuanJey/grpc-etcd/etcdtest"
+)
+
+// hookEvent 一次钩子回调
+type hookEvent struct {
+	hook    string
+	service string
+	address string
+	err     error
+}
+
+// hookRecorder 记录所有钩子回调
+type hookRecorder struct {
+	mu        sync.Mutex
+	events    []hookEvent
+	anomalies []HeartbeatAnomaly
+}
+
+func (h *hookRecorder) record(hook, service, address string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, hookEvent{hook: hook, service: service, address: address, err: err})
+}
+
+// hooks 返回记录到h的Hooks
+func (h *hookRecorder) hooks() Hooks {
+	return Hooks{
+		OnRegister: func(s *ServiceInfo) { h.record("OnRegister", s.Name, s.Address, nil) },
+		OnDeregister: func(s *ServiceInfo, err error) {
+			h.record("OnDeregister", s.Name, s.Address, err)
+		},
+		OnLeaseLost: func(s *ServiceInfo, err error) { h.record("OnLeaseLost", s.Name, s.Address, err) },
+		OnReRegister: func(s *ServiceInfo, err error) {
+			h.record("OnReRegister", s.Name, s.Address, err)
+		},
+		OnWatchError:         func(name string, err error) { h.record("OnWatchError", name, "", err) },
+		OnWatchReestablished: func(name string) { h.record("OnWatchReestablished", name, "", nil) },
+		OnHeartbeatAnomaly: func(a HeartbeatAnomaly) {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			h.anomalies = append(h.anomalies, a)
+		},
+	}
+}
+
+// wait 等待service收到hook回调并返回第一次回调
+func (h *hookRecorder) wait(t *testing.T, hook, service string) hookEvent {
+	t.Helper()
+	var event hookEvent
+	eventually(t, hook, func() error {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for _, e := range h.events {
+			if e.hook == hook && e.service == service {
+				event = e
+				return nil
+			}
+		}
+		return fmt.Errorf("%s not fired for %s, got %+v", hook, service, h.events)
+	})
+	return event
+}
+
+// count 返回service收到hook回调的次数
+func (h *hookRecorder) count(hook, service string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for _, e := range h.events {
+		if e.hook == hook && e.service == service {
+			n++
+		}
+	}
+	return n
+}
+
+// revokeLease 绕过注册中心直接撤销service实例的租约
+func revokeLease(t *testing.T, srv *etcdtest.Server, service string) {
+	t.Helper()
+	ctx := testContext(t)
+	resp, err := srv.Client().Get(ctx, servicePrefix(service), clientv3.WithPrefix())
+	if err != nil || len(resp.Kvs) == 0 {
+		t.Fatalf("get %s: %d keys, %v", service, len(resp.Kvs), err)
+	}
+	if _, err := srv.Client().Revoke(ctx, clientv3.LeaseID(resp.Kvs[0].Lease)); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+}
+
+func TestHooksRegisterAndDeregister(t *testing.T) {
+	var h hookRecorder
+	service := testService(t)
+	r, err := NewEtcdRegistryWithConfig(sharedEtcd.ClientConfig(), testTTL, WithHooks(h.hooks()))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	defer r.Close()
+
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+	if e := h.wait(t, "OnRegister", service); e.address != "10.0.0.1:80" {
+		t.Errorf("OnRegister address: got %s", e.address)
+	}
+	if err := r.Unregister(service, "10.0.0.1:80"); err != nil {
+		t.Fatalf("unregister: %v", err)
+	}
+	if e := h.wait(t, "OnDeregister", service); e.address != "10.0.0.1:80" || e.err != nil {
+		t.Errorf("OnDeregister after Unregister: got %+v", e)
+	}
+
+	// 关闭时注销剩余的实例
+	other := testService(t)
+	mustRegister(t, r, &ServiceInfo{Name: other, Address: "10.0.0.2:80"})
+	if err := r.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if e := h.wait(t, "OnDeregister", other); e.err != nil {
+		t.Errorf("OnDeregister on Close: got %v", e.err)
+	}
+	// 注册失败时不触发OnRegister
+	if err := r.RegisterService(&ServiceInfo{Name: other, Address: "10.0.0.3:80"}); err == nil {
+		t.Fatal("register after close: got nil error")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := h.count("OnRegister", other); n != 1 {
+		t.Errorf("OnRegister for %s: got %d, want 1", other, n)
+	}
+}
+
+func TestHooksLeaseLostAndReRegister(t *testing.T) {
+	var h hookRecorder
+	service := testService(t)
+	r := newTestRegistry(t, WithHooks(h.hooks()))
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+
+	revokeLease(t, sharedEtcd, service)
+	lost := h.wait(t, "OnLeaseLost", service)
+	if !errors.Is(lost.err, ErrLeaseLost) {
+		t.Errorf("OnLeaseLost error: got %v, want ErrLeaseLost", lost.err)
+	}
+	if e := h.wait(t, "OnReRegister", service); e.err != nil || e.address != "10.0.0.1:80" {
+		t.Errorf("OnReRegister: got %+v", e)
+	}
+	eventually(t, "instance written back", func() error {
+		services, err := r.Discover(service)
+		if err != nil {
+			return err
+		}
+		return expectAddrs(services, "10.0.0.1:80")
+	})
+	if got := r.Stats().Errors.LeaseLost; got == 0 {
+		t.Error("Stats lease lost: got 0")
+	}
+}
+
+func TestHooksWatchErrorAndReestablished(t *testing.T) {
+	var h hookRecorder
+	srv := etcdtest.Start(t)
+	service := testService(t)
+	r := newRegistryOn(t, srv, WithHooks(h.hooks()), WithRequestTimeout(500*time.Millisecond))
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+	cc, rsv := buildResolver(t, r, r.Target(service))
+	waitAddrs(t, cc, "10.0.0.1:80")
+
+	// etcd宕机时watch通道不报错，由ResolveNow的探测发现故障
+	srv.Stop()
+	rsv.ResolveNow(resolver.ResolveNowOptions{})
+	if e := h.wait(t, "OnWatchError", service); e.err == nil {
+		t.Error("OnWatchError: got nil error")
+	}
+	if n := h.count("OnWatchReestablished", service); n != 0 {
+		t.Errorf("OnWatchReestablished while etcd is down: got %d", n)
+	}
+	if err := srv.Restart(); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	h.wait(t, "OnWatchReestablished", service)
+}
+
+func TestHooksShortTTLAnomaly(t *testing.T) {
+	var h hookRecorder
+	r, err := NewEtcdRegistryWithConfig(sharedEtcd.ClientConfig(), 1, WithHooks(h.hooks()))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	defer r.Close()
+	eventually(t, "short ttl anomaly", func() error {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for _, a := range h.anomalies {
+			if a.Kind == AnomalyShortTTL && a.Measured == time.Second {
+				return nil
+			}
+		}
+		return fmt.Errorf("got %+v", h.anomalies)
+	})
+}
+
+func TestContextHooksCarryEventInfo(t *testing.T) {
+	service := testService(t)
+	infos := make(chan EventInfo, 1)
+	r := newTestRegistry(t, WithContextHooks(ContextHooks{
+		OnRegister: func(ctx context.Context, s *ServiceInfo) {
+			info, _ := EventInfoFromContext(ctx)
+			infos <- info
+		},
+	}))
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+	select {
+	case info := <-infos:
+		if info.Type != "OnRegister" || info.CorrelationID == "" {
+			t.Errorf("event info: got %+v", info)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("OnRegister not fired")
+	}
+}
+
+func TestHookPanicIsRecovered(t *testing.T) {
+	service := testService(t)
+	r := newTestRegistry(t, WithHooks(Hooks{
+		OnRegister: func(*ServiceInfo) { panic("boom") },
+	}))
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+	eventually(t, "hook panic counted", func() error {
+		if got := r.Stats().Errors.HookPanics; got != 1 {
+			return fmt.Errorf("hook panics: got %d, want 1", got)
+		}
+		return nil
+	})
+	// 钩子panic不影响注册中心
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.2:80"})
+	services, err := r.Discover(service)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if err := expectAddrs(services, "10.0.0.1:80", "10.0.0.2:80"); err != nil {
+		t.Fatal(err)
+	}
+}
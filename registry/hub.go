@@ -0,0 +1,591 @@
+// registry/hub.go
+package registry
+
+import (
+	"context"
+	"math/rand"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// watchUpdate 一次推送给订阅者的服务快照
+type watchUpdate struct {
+	services []*ServiceInfo
+	revision int64
+	// eventType 推送的来源，取值见WatchEventList等
+	eventType string
+	// events 上次推送以来watch事件中带写入时间的变化，订阅者回调返回后统计可见延迟
+	events []visibilityEvent
+	// err 最近一次拉取失败的错误，services为失败前最后一次成功的结果
+	err error
+}
+
+// watchHub 按服务key前缀复用etcd watch，多个订阅者共享同一条watch流
+type watchHub struct {
+	registry *EtcdRegistry
+
+	mu          sync.Mutex
+	watchers    map[string]*serviceWatcher
+	keyWatchers map[string]*keyWatcher
+}
+
+func newWatchHub(r *EtcdRegistry) *watchHub {
+	return &watchHub{
+		registry:    r,
+		watchers:    make(map[string]*serviceWatcher),
+		keyWatchers: make(map[string]*keyWatcher),
+	}
+}
+
+// subscribe 订阅指定key前缀下的服务实例变化，返回取消订阅函数
+// 首次拉取在后台进行并持续重试，订阅者在首次拉取完成（成功或失败）后收到第一次推送
+func (h *watchHub) subscribe(prefix string, callback func(watchUpdate)) func() {
+	h.mu.Lock()
+	w, ok := h.watchers[prefix]
+	if !ok {
+		ctx, cancel := context.WithCancel(h.registry.ctx)
+		w = &serviceWatcher{
+			hub:         h,
+			prefix:      prefix,
+			ctx:         ctx,
+			cancel:      cancel,
+			subscribers: make(map[uint64]*subscriber[watchUpdate]),
+			instances:   make(map[string]*ServiceInfo),
+			resolveNow:  make(chan struct{}, 1),
+			loaded:      make(chan struct{}),
+			reported:    -1,
+		}
+		h.watchers[prefix] = w
+		goLabeled(goroutineLabels(LabelOpWatch, "service", serviceNameFromPrefix(prefix)), w.run)
+	}
+	sub := w.add(callback)
+	h.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { h.unsubscribe(w, sub) })
+	}
+}
+
+// firstList 等待服务的首次拉取完成并返回其错误
+func (h *watchHub) firstList(prefix string) error {
+	h.mu.Lock()
+	w, ok := h.watchers[prefix]
+	h.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	select {
+	case <-w.loaded:
+		return w.lastErr()
+	case <-w.ctx.Done():
+		return w.ctx.Err()
+	}
+}
+
+// resolveNow 请求立即重新解析服务：拉取出错时立即重试，watch中时探测etcd是否可达，
+// 不可达时中断watch，由run重新拉取并把错误推送给订阅者
+func (h *watchHub) resolveNow(prefix string) {
+	h.mu.Lock()
+	w, ok := h.watchers[prefix]
+	h.mu.Unlock()
+
+	if ok {
+		select {
+		case w.resolveNow <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// watching 当前是否在监听该服务
+func (h *watchHub) watching(prefix string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.watchers[prefix]
+	return ok
+}
+
+// forceRefresh 中断当前watch并立即全量拉取，用于watch疑似卡死的场景
+// 同一服务在minInterval内只会执行一次，返回是否触发了刷新
+func (h *watchHub) forceRefresh(prefix string, minInterval time.Duration) bool {
+	h.mu.Lock()
+	w, ok := h.watchers[prefix]
+	h.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if time.Since(w.lastForced) < minInterval {
+		return false
+	}
+	w.lastForced = time.Now()
+	if w.watchCancel != nil {
+		// watch结束后run会立即重新拉取并重建watch
+		w.watchCancel()
+	} else {
+		select {
+		case w.resolveNow <- struct{}{}:
+		default:
+		}
+	}
+	return true
+}
+
+// unsubscribe 移除订阅者，最后一个订阅者离开时停止watch
+func (h *watchHub) unsubscribe(w *serviceWatcher, sub *subscriber[watchUpdate]) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub.stop()
+	w.mu.Lock()
+	delete(w.subscribers, sub.id)
+	empty := len(w.subscribers) == 0
+	w.mu.Unlock()
+
+	if empty && h.watchers[w.prefix] == w {
+		delete(h.watchers, w.prefix)
+		w.cancel()
+		if deleter, ok := h.registry.opts.metrics.(MetricsDeleter); ok {
+			deleter.DeleteGauge(MetricWatchInstances, serviceLabels(serviceNameFromPrefix(w.prefix)))
+		}
+	}
+}
+
+// serviceWatcher 维护单个服务的实例列表及其订阅者
+type serviceWatcher struct {
+	hub *watchHub
+	// prefix 服务实例的etcd key前缀
+	prefix string
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu          sync.Mutex
+	nextID      uint64
+	subscribers map[uint64]*subscriber[watchUpdate]
+	instances   map[string]*ServiceInfo
+	revision    int64
+	err         error
+	// events 上次推送以来的可见延迟事件，由w.mu保护
+	events []visibilityEvent
+	// eventType 上次推送以来的推送来源，由w.mu保护
+	eventType string
+	// reported 上次上报的实例数，-1表示尚未成功拉取，由w.mu保护
+	reported int
+
+	resolveNow chan struct{}
+	// loaded 首次拉取完成后关闭
+	loaded chan struct{}
+	// watchCancel 取消当前watch，由w.mu保护
+	watchCancel context.CancelFunc
+	// lastForced 最近一次强制刷新的时间，由w.mu保护
+	lastForced time.Time
+	// lastEvent 最近一次收到watch事件的时间，由w.mu保护
+	lastEvent time.Time
+}
+
+// add 添加订阅者，首次拉取已完成时立即推送当前快照
+func (w *serviceWatcher) add(callback func(watchUpdate)) *subscriber[watchUpdate] {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.nextID++
+	sub := newSubscriber(w.nextID, goroutineLabels(LabelOpDispatch, "service", serviceNameFromPrefix(w.prefix)), func(update watchUpdate) {
+		callback(update)
+		w.hub.registry.observeVisibility(update.events)
+	})
+	sub.merge = mergeWatchUpdates
+	w.subscribers[sub.id] = sub
+	select {
+	case <-w.loaded:
+		update := w.snapshotLocked()
+		update.eventType = WatchEventList
+		sub.notify(update)
+	default:
+	}
+	return sub
+}
+
+// lastErr 最近一次拉取的错误
+func (w *serviceWatcher) lastErr() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// relist 全量拉取服务实例，返回拉取时的revision
+// 失败时保留已有实例并记录错误
+func (w *serviceWatcher) relist() (rev int64, err error) {
+	// 后台刷新没有调用方span，每次拉取是一个根span
+	ctx, span := w.hub.registry.startSpan(w.ctx, SpanRefresh)
+	span.SetAttributes("service", serviceNameFromPrefix(w.prefix), "prefix", w.prefix)
+	defer func() { span.End(err) }()
+	ctx, cancel := context.WithTimeout(ctx, w.hub.registry.opts.requestTimeout)
+	defer cancel()
+
+	resp, err := w.hub.registry.kv.Get(ctx, w.prefix, clientv3.WithPrefix())
+	if w.ctx.Err() == nil {
+		w.hub.registry.health.record(err)
+	}
+	if err != nil {
+		// token失效时重新认证，下一次重试即可成功
+		w.hub.registry.handleAuthError(w.ctx, err)
+		w.mu.Lock()
+		w.err = err
+		w.mu.Unlock()
+		return 0, err
+	}
+
+	instances := make(map[string]*ServiceInfo, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		service, ok := w.hub.registry.decodeService(kv.Key, kv.Value)
+		if !ok {
+			continue
+		}
+		instances[string(kv.Key)] = service
+	}
+
+	w.mu.Lock()
+	w.instances = instances
+	w.revision = resp.Header.Revision
+	w.eventType = mergeEventType(w.eventType, WatchEventList)
+	w.err = nil
+	w.mu.Unlock()
+	span.SetAttributes("instances", len(instances), "revision", resp.Header.Revision)
+
+	return resp.Header.Revision, nil
+}
+
+// run 拉取服务实例后持续watch，watch中断或拉取失败时按退避重新全量拉取
+// 每次拉取的结果（包括失败）都会推送给订阅者
+func (w *serviceWatcher) run() {
+	rev, err := w.relist()
+	close(w.loaded)
+	w.broadcast()
+
+	attempt := 0
+	var failure failureTracker
+	for {
+		if err == nil {
+			attempt = 0
+			failure.reset()
+			w.watch(rev)
+			if w.ctx.Err() != nil {
+				return
+			}
+			w.hub.registry.opts.metrics.IncCounter(MetricWatchRestarts, serviceLabels(serviceNameFromPrefix(w.prefix)), 1)
+		} else {
+			w.checkFailure(&failure, err)
+			if !retryWait(w.ctx, w.resolveNow, attempt) {
+				return
+			}
+			attempt++
+		}
+
+		rev, err = w.relist()
+		if err == nil {
+			name := serviceNameFromPrefix(w.prefix)
+			recordHistory(w.hub.registry.history.watch, HistoryEvent{Kind: HistoryWatchReestablished, Service: name})
+			w.hub.registry.fireWatchReestablished(name)
+		}
+		w.broadcast()
+	}
+}
+
+// checkFailure 记录一次拉取失败，持续失败超过阈值时发送ErrorWatchFailed
+func (w *serviceWatcher) checkFailure(failure *failureTracker, err error) {
+	r := w.hub.registry
+	if w.ctx.Err() != nil || !failure.fail(time.Now(), r.opts.failureThreshold) {
+		return
+	}
+	name := serviceNameFromPrefix(w.prefix)
+	r.opts.logger.Error("service watch keeps failing", "service", name, "prefix", w.prefix, "since", failure.since, "error", err)
+	r.errs.send(RegistryError{Kind: ErrorWatchFailed, Service: name, Err: err, Since: failure.since})
+}
+
+// retryWait 按指数退避等待第attempt次重试或提前唤醒，ctx结束时返回false
+func retryWait(ctx context.Context, wake <-chan struct{}, attempt int) bool {
+	timer := time.NewTimer(retryDelay(attempt))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-wake:
+		return true
+	case <-timer.C:
+		return true
+	}
+}
+
+// retryDelay 重试间隔，从500ms开始翻倍，最长30s，并加入最多20%的随机抖动
+func retryDelay(attempt int) time.Duration {
+	const (
+		base     = 500 * time.Millisecond
+		maxDelay = 30 * time.Second
+	)
+	delay := base
+	for i := 0; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay/5)+1))
+}
+
+// watch 从指定revision之后开始监听，直到watch通道关闭或出错
+func (w *serviceWatcher) watch(rev int64) {
+	ctx, cancel := context.WithCancel(w.ctx)
+	w.mu.Lock()
+	w.watchCancel = cancel
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		w.watchCancel = nil
+		w.mu.Unlock()
+		cancel()
+	}()
+
+	// WithRequireLeader 使集群失去leader时watch立即报错，而不是一直静默等待
+	watchChan := w.hub.registry.watcher.Watch(clientv3.WithRequireLeader(ctx), w.prefix,
+		clientv3.WithPrefix(), clientv3.WithRev(rev+1))
+
+	// 设置了watchDebounce时，事件到达后等待一个窗口再推送，窗口内的事件合并为一次推送
+	debounce := w.hub.registry.opts.watchDebounce
+	var (
+		timer   *time.Timer
+		flush   <-chan time.Time
+		pending bool
+	)
+	defer func() {
+		// watch结束后run会重新全量拉取并推送，未推送的事件不会丢失
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-flush:
+			flush, pending = nil, false
+			w.broadcast()
+			continue
+		case <-w.resolveNow:
+			// etcd整体不可达时watch通道既不关闭也不报错，通过一次读请求确认连接
+			if err := w.probe(); err != nil {
+				w.reportError("watch probe", err)
+				return
+			}
+			continue
+		case watchResp, ok := <-watchChan:
+			if !ok {
+				return
+			}
+			if watchResp.Err() != nil {
+				w.hub.registry.health.record(watchResp.Err())
+				w.hub.registry.handleAuthError(w.ctx, watchResp.Err())
+				w.reportError("watch", watchResp.Err())
+				return
+			}
+			w.hub.registry.health.record(nil)
+			if len(watchResp.Events) == 0 {
+				continue
+			}
+			w.apply(watchResp)
+		}
+
+		if debounce <= 0 {
+			w.broadcast()
+			continue
+		}
+		if !pending {
+			pending = true
+			if timer == nil {
+				timer = time.NewTimer(debounce)
+			} else {
+				timer.Reset(debounce)
+			}
+			flush = timer.C
+		}
+	}
+}
+
+// probe 通过一次只读取数量的请求确认etcd可达
+func (w *serviceWatcher) probe() error {
+	ctx, cancel := context.WithTimeout(w.ctx, w.hub.registry.opts.requestTimeout)
+	defer cancel()
+	_, err := w.hub.registry.kv.Get(ctx, w.prefix, clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if w.ctx.Err() == nil {
+		w.hub.registry.health.record(err)
+	}
+	return err
+}
+
+// apply 将watch事件应用到实例列表
+func (w *serviceWatcher) apply(watchResp clientv3.WatchResponse) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	logger := w.hub.registry.opts.logger
+	_, noop := w.hub.registry.opts.metrics.(noopMetrics)
+	w.hub.registry.opts.metrics.IncCounter(MetricWatchEvents,
+		serviceLabels(serviceNameFromPrefix(w.prefix)), float64(len(watchResp.Events)))
+	for _, event := range watchResp.Events {
+		key := string(event.Kv.Key)
+		logger.Debug("service watch event",
+			"service", serviceNameFromPrefix(w.prefix), "key", key, "type", event.Type.String(), "revision", event.Kv.ModRevision)
+		switch event.Type {
+		case clientv3.EventTypePut:
+			service, ok := w.hub.registry.decodeService(event.Kv.Key, event.Kv.Value)
+			if !ok {
+				delete(w.instances, key)
+				continue
+			}
+			w.instances[key] = service
+			if visible, ok := visibilityEventOf(event, service); ok && !noop {
+				w.events = append(w.events, visible)
+			}
+		case clientv3.EventTypeDelete:
+			delete(w.instances, key)
+		}
+		eventType := WatchEventPut
+		if event.Type == clientv3.EventTypeDelete {
+			eventType = WatchEventDelete
+		}
+		w.eventType = mergeEventType(w.eventType, eventType)
+	}
+	w.revision = watchResp.Header.Revision
+	w.lastEvent = time.Now()
+}
+
+// reportError 记录拉取或watch错误并触发OnWatchError回调
+func (w *serviceWatcher) reportError(op string, err error) {
+	name := serviceNameFromPrefix(w.prefix)
+	w.hub.registry.recordError(&w.hub.registry.errorCounts.watchErrors, op, name, "", err)
+	recordHistory(w.hub.registry.history.watch, HistoryEvent{Kind: HistoryWatchError, Service: name, Error: op + ": " + err.Error()})
+	w.hub.registry.opts.logger.Warn("service "+op+" failed", "service", name, "prefix", w.prefix, "error", err)
+	w.hub.registry.fireWatchError(name, wrapError(op, name, "", err))
+}
+
+// serviceNameFromPrefix 从 .../services/<name>/ 形式的前缀中取出服务名
+func serviceNameFromPrefix(prefix string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return prefix[strings.LastIndex(prefix, "/")+1:]
+}
+
+// broadcast 将当前快照推送给所有订阅者
+func (w *serviceWatcher) broadcast() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	update := w.snapshotLocked()
+	update.events, w.events = w.events, nil
+	update.eventType, w.eventType = w.eventType, ""
+	w.reportInstancesLocked(len(update.services))
+	for _, sub := range w.subscribers {
+		sub.notify(update)
+	}
+}
+
+// reportInstancesLocked 上报当前实例数，实例数从非零变为零时计数，调用方需持有w.mu
+// 拉取出错期间实例列表可能已过期，不上报
+func (w *serviceWatcher) reportInstancesLocked(count int) {
+	if w.err != nil {
+		return
+	}
+	metrics := w.hub.registry.opts.metrics
+	labels := serviceLabels(serviceNameFromPrefix(w.prefix))
+	metrics.SetGauge(MetricWatchInstances, labels, float64(count))
+	if count == 0 && w.reported > 0 {
+		metrics.IncCounter(MetricWatchZeroInstances, labels, 1)
+	}
+	w.reported = count
+}
+
+// snapshotLocked 按key排序生成快照，调用方需持有w.mu
+func (w *serviceWatcher) snapshotLocked() watchUpdate {
+	keys := make([]string, 0, len(w.instances))
+	for key := range w.instances {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	services := make([]*ServiceInfo, 0, len(keys))
+	for _, key := range keys {
+		service := *w.instances[key]
+		services = append(services, &service)
+	}
+	return watchUpdate{services: services, revision: w.revision, err: w.err}
+}
+
+// subscriber 单个订阅者，在独立goroutine中串行回调，只保留最新一次未处理的推送
+type subscriber[T any] struct {
+	id       uint64
+	callback func(T)
+	// merge 合并尚未处理的推送和新推送，为nil时直接用新推送覆盖，创建后、首次推送前设置
+	merge func(older, newer T) T
+
+	mu      sync.Mutex
+	pending *T
+	wake    chan struct{}
+	done    chan struct{}
+}
+
+// newSubscriber 创建订阅者并启动回调goroutine，labels为回调goroutine的pprof标签
+func newSubscriber[T any](id uint64, labels pprof.LabelSet, callback func(T)) *subscriber[T] {
+	sub := &subscriber[T]{
+		id:       id,
+		callback: callback,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	goLabeled(labels, sub.loop)
+	return sub
+}
+
+// notify 投递推送，不阻塞调用方
+func (s *subscriber[T]) notify(update T) {
+	s.mu.Lock()
+	if s.pending != nil && s.merge != nil {
+		update = s.merge(*s.pending, update)
+	}
+	s.pending = &update
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscriber[T]) loop() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		}
+
+		s.mu.Lock()
+		update := s.pending
+		s.pending = nil
+		s.mu.Unlock()
+
+		if update != nil {
+			s.callback(*update)
+		}
+	}
+}
+
+func (s *subscriber[T]) stop() {
+	close(s.done)
+}
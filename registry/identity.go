@@ -0,0 +1,103 @@
+// registry/identity.go
+package registry
+
+import (
+	"fmt"
+	"os"
+)
+
+// MetadataRegisteredBy 开启WithRegisteredBy时写入ServiceInfo.Metadata的键，值为写入方注册中心的Identity，
+// 用于从残留的key追查写入它的进程；不参与Equal比较，也不影响resolver的去重和推送
+const MetadataRegisteredBy = "registeredBy"
+
+// LabelRegistry 日志和指标中注册中心标识的键，设置了WithMetrics时所有指标都带有该标签
+const LabelRegistry = "registry"
+
+// Identity 注册中心实例的标识，多个进程共用一个etcd时用于区分日志、钩子和指标的来源
+type Identity struct {
+	// Name 通过WithInstanceName设置的名称，可以为空
+	Name     string
+	Hostname string
+	PID      int
+}
+
+// String 返回 name@hostname:pid，未设置名称时为 hostname:pid
+func (id Identity) String() string {
+	s := fmt.Sprintf("%s:%d", id.Hostname, id.PID)
+	if id.Name != "" {
+		s = id.Name + "@" + s
+	}
+	return s
+}
+
+// newIdentity 返回当前进程的标识，主机名读取失败时为空
+func newIdentity(name string) Identity {
+	hostname, _ := os.Hostname()
+	return Identity{Name: name, Hostname: hostname, PID: os.Getpid()}
+}
+
+// Identity 返回注册中心实例的标识
+func (r *EtcdRegistry) Identity() Identity {
+	return r.opts.identity
+}
+
+// identityLogger 为每条日志追加注册中心标识
+type identityLogger struct {
+	logger   Logger
+	identity string
+}
+
+func (l *identityLogger) Debug(msg string, keyvals ...any) { l.logger.Debug(msg, l.with(keyvals)...) }
+func (l *identityLogger) Info(msg string, keyvals ...any)  { l.logger.Info(msg, l.with(keyvals)...) }
+func (l *identityLogger) Warn(msg string, keyvals ...any)  { l.logger.Warn(msg, l.with(keyvals)...) }
+func (l *identityLogger) Error(msg string, keyvals ...any) { l.logger.Error(msg, l.with(keyvals)...) }
+
+func (l *identityLogger) with(keyvals []any) []any {
+	return append(keyvals[:len(keyvals):len(keyvals)], LabelRegistry, l.identity)
+}
+
+// identityMetrics 为每个指标追加LabelRegistry标签
+type identityMetrics struct {
+	metrics  Metrics
+	identity string
+}
+
+func (m *identityMetrics) IncCounter(name string, labels map[string]string, delta float64) {
+	m.metrics.IncCounter(name, m.with(labels), delta)
+}
+
+func (m *identityMetrics) SetGauge(name string, labels map[string]string, value float64) {
+	m.metrics.SetGauge(name, m.with(labels), value)
+}
+
+func (m *identityMetrics) ObserveHistogram(name string, labels map[string]string, value float64) {
+	m.metrics.ObserveHistogram(name, m.with(labels), value)
+}
+
+// DeleteGauge 实现MetricsDeleter接口，下层不支持删除时忽略
+func (m *identityMetrics) DeleteGauge(name string, labels map[string]string) {
+	if deleter, ok := m.metrics.(MetricsDeleter); ok {
+		deleter.DeleteGauge(name, m.with(labels))
+	}
+}
+
+// with 返回加上LabelRegistry的标签副本，不修改调用方的map
+func (m *identityMetrics) with(labels map[string]string) map[string]string {
+	out := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		out[k] = v
+	}
+	out[LabelRegistry] = m.identity
+	return out
+}
+
+// stampRegisteredBy 返回Metadata中写入了注册中心标识的副本，不修改info
+func (r *EtcdRegistry) stampRegisteredBy(info *ServiceInfo) *ServiceInfo {
+	stamped := *info
+	stamped.Metadata = make(map[string]string, len(info.Metadata)+1)
+	for k, v := range info.Metadata {
+		stamped.Metadata[k] = v
+	}
+	stamped.Metadata[MetadataRegisteredBy] = r.opts.identity.String()
+	return &stamped
+}
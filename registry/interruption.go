@@ -0,0 +1,71 @@
+// registry/interruption.go
+package registry
+
+import (
+	"context"
+	"time"
+)
+
+// 心跳中断的原因，作为MetricKeepAliveInterruptions的reason标签
+const (
+	// InterruptionClosed 心跳通道被关闭，租约仍然存在，通常是与etcd的心跳流断开
+	InterruptionClosed = "closed"
+	// InterruptionNilResponse 心跳通道收到nil响应
+	InterruptionNilResponse = "nil-response"
+	// InterruptionLeaseExpired 心跳结束时租约已过期或被撤销
+	InterruptionLeaseExpired = "lease-expired"
+	// InterruptionError 心跳结束后无法查询租约状态，通常是etcd不可达
+	InterruptionError = "error"
+)
+
+// LabelReason 心跳中断原因的指标标签
+const LabelReason = "reason"
+
+// classifyInterruption 心跳结束后查询一次租约状态，细分通道关闭的原因
+func (r *EtcdRegistry) classifyInterruption(ctx context.Context, reg *registration, reason string) string {
+	r.mu.Lock()
+	leaseID := reg.leaseID
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, r.opts.requestTimeout)
+	defer cancel()
+	resp, err := r.lease.TimeToLive(ctx, leaseID)
+	switch {
+	case err != nil:
+		if classifyError(err) == ErrLeaseLost {
+			return InterruptionLeaseExpired
+		}
+		return InterruptionError
+	case resp.TTL <= 0:
+		return InterruptionLeaseExpired
+	}
+	return reason
+}
+
+// recordInterruption 记录一次心跳中断，恢复时长从now开始计算
+func (r *EtcdRegistry) recordInterruption(reg *registration, serviceName, reason string, now time.Time) {
+	r.opts.metrics.IncCounter(MetricKeepAliveInterruptions, map[string]string{LabelService: serviceName, LabelReason: reason}, 1)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reg.lastInterruption = now
+	reg.interruptionReason = reason
+	if reg.interruptedAt.IsZero() {
+		reg.interruptedAt = now
+	}
+}
+
+// confirmRecovery 中断后的新心跳通道收到第一次响应时上报恢复时长
+func (r *EtcdRegistry) confirmRecovery(reg *registration, serviceName string, now time.Time) {
+	r.mu.Lock()
+	interruptedAt := reg.interruptedAt
+	reg.interruptedAt = time.Time{}
+	if !interruptedAt.IsZero() {
+		reg.lastRecovery = now.Sub(interruptedAt)
+	}
+	r.mu.Unlock()
+
+	if !interruptedAt.IsZero() {
+		r.opts.metrics.ObserveHistogram(MetricKeepAliveRecovery, serviceLabels(serviceName), now.Sub(interruptedAt).Seconds())
+	}
+}
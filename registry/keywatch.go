@@ -0,0 +1,157 @@
+// registry/keywatch.go
+package registry
+
+import (
+	"context"
+	"sync"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// keyUpdate 单个控制key的最新值
+type keyUpdate struct {
+	value  []byte
+	exists bool
+	// err 最近一次读取失败的错误，value和exists为失败前最后一次成功的结果
+	err error
+}
+
+// watchKey 订阅单个key的变化，订阅后立即推送当前值，返回取消订阅函数
+// 同一个key的多个订阅者共享一条watch
+func (h *watchHub) watchKey(key string, callback func(keyUpdate)) func() {
+	h.mu.Lock()
+	w, ok := h.keyWatchers[key]
+	if !ok {
+		ctx, cancel := context.WithCancel(h.registry.ctx)
+		w = &keyWatcher{
+			hub:         h,
+			key:         key,
+			ctx:         ctx,
+			cancel:      cancel,
+			subscribers: make(map[uint64]*subscriber[keyUpdate]),
+		}
+		h.keyWatchers[key] = w
+		goLabeled(goroutineLabels(LabelOpKeyWatch, "key", key), w.run)
+	}
+
+	w.mu.Lock()
+	w.nextID++
+	sub := newSubscriber(w.nextID, goroutineLabels(LabelOpDispatch, "key", key), callback)
+	w.subscribers[sub.id] = sub
+	if w.loaded {
+		sub.notify(w.current)
+	}
+	w.mu.Unlock()
+	h.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { h.unwatchKey(w, sub) })
+	}
+}
+
+// unwatchKey 移除订阅者，最后一个订阅者离开时停止watch
+func (h *watchHub) unwatchKey(w *keyWatcher, sub *subscriber[keyUpdate]) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub.stop()
+	w.mu.Lock()
+	delete(w.subscribers, sub.id)
+	empty := len(w.subscribers) == 0
+	w.mu.Unlock()
+
+	if empty && h.keyWatchers[w.key] == w {
+		delete(h.keyWatchers, w.key)
+		w.cancel()
+	}
+}
+
+// keyWatcher 维护单个key的当前值及其订阅者
+type keyWatcher struct {
+	hub    *watchHub
+	key    string
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu          sync.Mutex
+	nextID      uint64
+	subscribers map[uint64]*subscriber[keyUpdate]
+	current     keyUpdate
+	loaded      bool
+}
+
+// run 读取key后持续watch，出错时间隔重试
+func (w *keyWatcher) run() {
+	attempt := 0
+	for {
+		rev, err := w.get()
+		w.broadcast()
+		if err == nil {
+			attempt = 0
+			w.watch(rev)
+		} else {
+			attempt++
+		}
+		if w.ctx.Err() != nil || !retryWait(w.ctx, nil, attempt) {
+			return
+		}
+	}
+}
+
+func (w *keyWatcher) get() (int64, error) {
+	ctx, cancel := context.WithTimeout(w.ctx, w.hub.registry.opts.requestTimeout)
+	defer cancel()
+
+	resp, err := w.hub.registry.kv.Get(ctx, w.key)
+	if err != nil && w.ctx.Err() == nil {
+		w.hub.registry.opts.logger.Warn("key get failed", "key", w.key, "error", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.loaded = true
+	if err != nil {
+		w.current.err = err
+		return 0, err
+	}
+	w.current = keyUpdate{}
+	if len(resp.Kvs) > 0 {
+		w.current.value = resp.Kvs[0].Value
+		w.current.exists = true
+	}
+	return resp.Header.Revision, nil
+}
+
+func (w *keyWatcher) watch(rev int64) {
+	watchChan := w.hub.registry.watcher.Watch(clientv3.WithRequireLeader(w.ctx), w.key, clientv3.WithRev(rev+1))
+	for watchResp := range watchChan {
+		if watchResp.Err() != nil {
+			w.hub.registry.opts.logger.Warn("key watch failed", "key", w.key, "error", watchResp.Err())
+			return
+		}
+		if len(watchResp.Events) == 0 {
+			continue
+		}
+
+		event := watchResp.Events[len(watchResp.Events)-1]
+		w.mu.Lock()
+		if event.Type == clientv3.EventTypePut {
+			w.current = keyUpdate{value: event.Kv.Value, exists: true}
+		} else {
+			w.current = keyUpdate{}
+		}
+		w.mu.Unlock()
+
+		w.broadcast()
+	}
+}
+
+func (w *keyWatcher) broadcast() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, sub := range w.subscribers {
+		sub.notify(w.current)
+	}
+}
@@ -0,0 +1,37 @@
+// registry/labels.go
+package registry
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// 后台goroutine的pprof标签op取值
+const (
+	LabelOpKeepAlive    = "keepalive"
+	LabelOpWatch        = "watch"
+	LabelOpKeyWatch     = "key-watch"
+	LabelOpDispatch     = "dispatch"
+	LabelOpHook         = "hook"
+	LabelOpLeaseMetrics = "lease-metrics"
+	LabelOpDNSSync      = "dns-sync"
+	LabelOpLogSampling  = "log-sampling"
+	LabelOpServe        = "serve"
+)
+
+// goroutineLabels 后台goroutine的pprof标签，registry固定为etcd，keyvals为额外的键值对，值为空的键被省略
+func goroutineLabels(op string, keyvals ...string) pprof.LabelSet {
+	labels := []string{"registry", "etcd", "op", op}
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if keyvals[i+1] != "" {
+			labels = append(labels, keyvals[i], keyvals[i+1])
+		}
+	}
+	return pprof.Labels(labels...)
+}
+
+// goLabeled 在带labels的新goroutine中执行fn，goroutine和CPU profile可据此区分心跳、watch和回调所属的服务
+// 标签不继承创建者的标签，避免调用方请求goroutine上的标签被带入长期运行的后台goroutine
+func goLabeled(labels pprof.LabelSet, fn func()) {
+	go pprof.Do(context.Background(), labels, func(context.Context) { fn() })
+}
@@ -0,0 +1,92 @@
+// registry/labels_test.go
+package registry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// profileLabels 返回当前goroutine profile中所有goroutine的标签行
+func profileLabels(t *testing.T) []string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		t.Fatalf("goroutine profile: %v", err)
+	}
+	var labels []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(line), "# labels: "); ok {
+			labels = append(labels, rest)
+		}
+	}
+	return labels
+}
+
+// expectLabeledGoroutine 等待profile中出现带全部keyvals标签的goroutine
+func expectLabeledGoroutine(t *testing.T, keyvals ...string) {
+	t.Helper()
+	eventually(t, fmt.Sprint("goroutine labelled ", keyvals), func() error {
+		labels := profileLabels(t)
+	next:
+		for _, line := range labels {
+			for i := 0; i+1 < len(keyvals); i += 2 {
+				if !strings.Contains(line, fmt.Sprintf("%q:%q", keyvals[i], keyvals[i+1])) {
+					continue next
+				}
+			}
+			return nil
+		}
+		return fmt.Errorf("not found in %d labelled goroutines: %v", len(labels), labels)
+	})
+}
+
+func TestBackgroundGoroutineLabels(t *testing.T) {
+	service := testService(t)
+	// 钩子阻塞直到测试结束，使其goroutine出现在profile中
+	release := make(chan struct{})
+	r := newTestRegistry(t, WithHooks(Hooks{OnRegister: func(*ServiceInfo) { <-release }}))
+	defer close(release)
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+	// 回调阻塞直到测试结束，使分发goroutine停在回调中
+	if err := r.Watch(service, func([]*ServiceInfo) { <-release }); err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+
+	expectLabeledGoroutine(t, "registry", "etcd", "op", LabelOpKeepAlive, "service", service, "address", "10.0.0.1:80")
+	expectLabeledGoroutine(t, "registry", "etcd", "op", LabelOpWatch, "service", service)
+	expectLabeledGoroutine(t, "registry", "etcd", "op", LabelOpDispatch, "service", service)
+	expectLabeledGoroutine(t, "registry", "etcd", "op", LabelOpHook, "hook", "OnRegister")
+}
+
+func TestGoroutineLabelsSkipEmptyValues(t *testing.T) {
+	var got []string
+	pprof.ForLabels(pprof.WithLabels(context.Background(), goroutineLabels(LabelOpKeyWatch, "key", "/routing/a", "service", "")),
+		func(key, value string) bool {
+			got = append(got, key+"="+value)
+			return true
+		})
+	want := "key=/routing/a op=key-watch registry=etcd"
+	if strings.Join(slices.Sorted(slices.Values(got)), " ") != want {
+		t.Errorf("labels: got %v, want %s", got, want)
+	}
+}
+
+func TestGoroutineLabelsNotInherited(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	pprof.Do(context.Background(), pprof.Labels("request", "caller"), func(context.Context) {
+		goLabeled(goroutineLabels(LabelOpServe, "service", "not-inherited"), func() { <-release })
+	})
+	expectLabeledGoroutine(t, "op", LabelOpServe, "service", "not-inherited")
+	// 调用方goroutine上的标签不会被带入后台goroutine
+	for _, line := range profileLabels(t) {
+		if strings.Contains(line, `"not-inherited"`) && strings.Contains(line, `"request"`) {
+			t.Errorf("background goroutine inherited the caller's labels: %s", line)
+		}
+	}
+}
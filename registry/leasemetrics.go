@@ -0,0 +1,90 @@
+// registry/leasemetrics.go
+package registry
+
+import (
+	"context"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// leaseMetricLost 租约丢失或正在重新注册时租约指标的取值
+const leaseMetricLost = -1
+
+// registrationLabels 单个注册实例的指标标签
+func registrationLabels(serviceName, address string) map[string]string {
+	return map[string]string{LabelService: serviceName, LabelAddress: address}
+}
+
+// sampleLeases 按周期上报每个注册实例的租约剩余时长和心跳间隔，注册中心关闭时退出
+func (r *EtcdRegistry) sampleLeases(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		r.reportLeaseMetrics()
+	}
+}
+
+// reportLeaseMetrics 对每个注册实例调用一次TimeToLive并上报指标
+func (r *EtcdRegistry) reportLeaseMetrics() {
+	type sample struct {
+		labels        map[string]string
+		leaseID       clientv3.LeaseID
+		lastKeepAlive time.Time
+		failing       bool
+	}
+	r.mu.Lock()
+	samples := make([]sample, 0, len(r.registrations))
+	for _, reg := range r.registrations {
+		samples = append(samples, sample{
+			labels:        registrationLabels(reg.info.Name, reg.info.Address),
+			leaseID:       reg.leaseID,
+			lastKeepAlive: reg.lastKeepAlive,
+			failing:       reg.failing,
+		})
+	}
+	r.mu.Unlock()
+
+	metrics := r.opts.metrics
+	for _, s := range samples {
+		if s.failing || s.leaseID == 0 {
+			r.reportLeaseLost(s.labels)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(r.ctx, r.opts.requestTimeout)
+		resp, err := r.lease.TimeToLive(ctx, s.leaseID)
+		cancel()
+		if r.ctx.Err() != nil {
+			return
+		}
+		// 租约已过期时etcd返回TTL为-1，与丢失状态的取值一致
+		ttl := float64(leaseMetricLost)
+		if err == nil {
+			ttl = float64(resp.TTL)
+		}
+		metrics.SetGauge(MetricLeaseTTLRemaining, s.labels, ttl)
+		metrics.SetGauge(MetricKeepAliveAge, s.labels, time.Since(s.lastKeepAlive).Seconds())
+	}
+}
+
+// reportLeaseLost 将实例的租约指标设置为丢失状态
+func (r *EtcdRegistry) reportLeaseLost(labels map[string]string) {
+	r.opts.metrics.SetGauge(MetricLeaseTTLRemaining, labels, leaseMetricLost)
+	r.opts.metrics.SetGauge(MetricKeepAliveAge, labels, leaseMetricLost)
+}
+
+// deleteLeaseMetrics 实例注销后删除其租约指标，Metrics未实现MetricsDeleter时保留最后的取值
+func (r *EtcdRegistry) deleteLeaseMetrics(serviceName, address string) {
+	deleter, ok := r.opts.metrics.(MetricsDeleter)
+	if !ok {
+		return
+	}
+	labels := registrationLabels(serviceName, address)
+	deleter.DeleteGauge(MetricLeaseTTLRemaining, labels)
+	deleter.DeleteGauge(MetricKeepAliveAge, labels)
+}
@@ -0,0 +1,175 @@
+// registry/limiter.go
+package registry
+
+import (
+	"context"
+	"sync/atomic"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// limiter 限制同时进行的etcd请求数的信号量
+type limiter struct {
+	sem      chan struct{}
+	inflight atomic.Int64
+	queued   atomic.Int64
+	metrics  Metrics
+}
+
+func newLimiter(n int, metrics Metrics) *limiter {
+	return &limiter{sem: make(chan struct{}, n), metrics: metrics}
+}
+
+// acquire 获取一个请求名额，ctx结束时放弃等待并返回ctx的错误
+func (l *limiter) acquire(ctx context.Context) error {
+	select {
+	case l.sem <- struct{}{}:
+	default:
+		l.setGauge(MetricEtcdOpsQueued, l.queued.Add(1))
+		select {
+		case l.sem <- struct{}{}:
+			l.setGauge(MetricEtcdOpsQueued, l.queued.Add(-1))
+		case <-ctx.Done():
+			l.setGauge(MetricEtcdOpsQueued, l.queued.Add(-1))
+			return ctx.Err()
+		}
+	}
+	l.setGauge(MetricEtcdOpsInflight, l.inflight.Add(1))
+	return nil
+}
+
+// release 归还请求名额
+func (l *limiter) release() {
+	l.setGauge(MetricEtcdOpsInflight, l.inflight.Add(-1))
+	<-l.sem
+}
+
+func (l *limiter) setGauge(name string, value int64) {
+	l.metrics.SetGauge(name, nil, float64(value))
+}
+
+// OpStats 返回当前正在进行和排队等待的etcd请求数，未设置WithMaxConcurrentOps时均为0
+func (r *EtcdRegistry) OpStats() (inflight, queued int64) {
+	if r.limiter == nil {
+		return 0, 0
+	}
+	return r.limiter.inflight.Load(), r.limiter.queued.Load()
+}
+
+// limitedKV 受并发限制的KV
+type limitedKV struct {
+	clientv3.KV
+	limiter *limiter
+}
+
+func (kv *limitedKV) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	if err := kv.limiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer kv.limiter.release()
+	return kv.KV.Put(ctx, key, val, opts...)
+}
+
+func (kv *limitedKV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	if err := kv.limiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer kv.limiter.release()
+	return kv.KV.Get(ctx, key, opts...)
+}
+
+func (kv *limitedKV) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	if err := kv.limiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer kv.limiter.release()
+	return kv.KV.Delete(ctx, key, opts...)
+}
+
+func (kv *limitedKV) Compact(ctx context.Context, rev int64, opts ...clientv3.CompactOption) (*clientv3.CompactResponse, error) {
+	if err := kv.limiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer kv.limiter.release()
+	return kv.KV.Compact(ctx, rev, opts...)
+}
+
+func (kv *limitedKV) Do(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error) {
+	if err := kv.limiter.acquire(ctx); err != nil {
+		return clientv3.OpResponse{}, err
+	}
+	defer kv.limiter.release()
+	return kv.KV.Do(ctx, op)
+}
+
+func (kv *limitedKV) Txn(ctx context.Context) clientv3.Txn {
+	return &limitedTxn{Txn: kv.KV.Txn(ctx), ctx: ctx, limiter: kv.limiter}
+}
+
+// limitedTxn 在Commit时获取请求名额的事务
+type limitedTxn struct {
+	clientv3.Txn
+	ctx     context.Context
+	limiter *limiter
+}
+
+func (txn *limitedTxn) If(cs ...clientv3.Cmp) clientv3.Txn {
+	txn.Txn = txn.Txn.If(cs...)
+	return txn
+}
+
+func (txn *limitedTxn) Then(ops ...clientv3.Op) clientv3.Txn {
+	txn.Txn = txn.Txn.Then(ops...)
+	return txn
+}
+
+func (txn *limitedTxn) Else(ops ...clientv3.Op) clientv3.Txn {
+	txn.Txn = txn.Txn.Else(ops...)
+	return txn
+}
+
+func (txn *limitedTxn) Commit() (*clientv3.TxnResponse, error) {
+	if err := txn.limiter.acquire(txn.ctx); err != nil {
+		return nil, err
+	}
+	defer txn.limiter.release()
+	return txn.Txn.Commit()
+}
+
+// limitedLease 受并发限制的Lease，KeepAlive心跳流不受限制
+type limitedLease struct {
+	clientv3.Lease
+	limiter *limiter
+}
+
+func (l *limitedLease) Grant(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	if err := l.limiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer l.limiter.release()
+	return l.Lease.Grant(ctx, ttl)
+}
+
+func (l *limitedLease) Revoke(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error) {
+	if err := l.limiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer l.limiter.release()
+	return l.Lease.Revoke(ctx, id)
+}
+
+func (l *limitedLease) TimeToLive(ctx context.Context, id clientv3.LeaseID, opts ...clientv3.LeaseOption) (*clientv3.LeaseTimeToLiveResponse, error) {
+	if err := l.limiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer l.limiter.release()
+	return l.Lease.TimeToLive(ctx, id, opts...)
+}
+
+func (l *limitedLease) Leases(ctx context.Context) (*clientv3.LeaseLeasesResponse, error) {
+	if err := l.limiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer l.limiter.release()
+	return l.Lease.Leases(ctx)
+}
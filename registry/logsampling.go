@@ -0,0 +1,142 @@
+// registry/logsampling.go
+package registry
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 日志级别，用于采样时区分
+const (
+	logDebug = iota
+	logInfo
+	logWarn
+	logError
+)
+
+// sampledLogger 按日志位置采样的Logger，日志位置以消息文本区分，注册中心内部的消息都是固定文本
+// 每个周期内每个位置只输出前first条，其余丢弃并在周期结束时输出一条带丢弃数的汇总
+type sampledLogger struct {
+	logger   Logger
+	first    int
+	interval time.Duration
+	// minLevel 低于该级别的日志才采样
+	minLevel int
+
+	mu    sync.Mutex
+	sites map[string]*sampledSite
+}
+
+// sampledSite 单个日志位置在当前周期内的计数
+type sampledSite struct {
+	level      int
+	count      int
+	suppressed int
+}
+
+func newSampledLogger(logger Logger, first int, interval time.Duration, sampleWarn bool) *sampledLogger {
+	minLevel := logWarn
+	if sampleWarn {
+		minLevel = logError + 1
+	}
+	return &sampledLogger{
+		logger:   logger,
+		first:    first,
+		interval: interval,
+		minLevel: minLevel,
+		sites:    make(map[string]*sampledSite),
+	}
+}
+
+func (l *sampledLogger) Debug(msg string, keyvals ...any) {
+	if l.allow(logDebug, msg) {
+		l.logger.Debug(msg, keyvals...)
+	}
+}
+
+func (l *sampledLogger) Info(msg string, keyvals ...any) {
+	if l.allow(logInfo, msg) {
+		l.logger.Info(msg, keyvals...)
+	}
+}
+
+func (l *sampledLogger) Warn(msg string, keyvals ...any) {
+	if l.allow(logWarn, msg) {
+		l.logger.Warn(msg, keyvals...)
+	}
+}
+
+func (l *sampledLogger) Error(msg string, keyvals ...any) {
+	if l.allow(logError, msg) {
+		l.logger.Error(msg, keyvals...)
+	}
+}
+
+// allow 当前周期内该位置是否还可以输出
+func (l *sampledLogger) allow(level int, msg string) bool {
+	if level >= l.minLevel {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	site, ok := l.sites[msg]
+	if !ok {
+		site = &sampledSite{level: level}
+		l.sites[msg] = site
+	}
+	site.count++
+	if site.count <= l.first {
+		return true
+	}
+	site.suppressed++
+	return false
+}
+
+// run 每个周期输出丢弃汇总并重新计数，ctx结束时输出最后一次汇总后退出
+func (l *sampledLogger) run(ctx context.Context) {
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			l.flush()
+			return
+		case <-ticker.C:
+			l.flush()
+		}
+	}
+}
+
+// flush 为本周期有丢弃的位置各输出一条汇总，级别与被丢弃的日志相同
+func (l *sampledLogger) flush() {
+	l.mu.Lock()
+	sites := l.sites
+	l.sites = make(map[string]*sampledSite, len(sites))
+	l.mu.Unlock()
+
+	for msg, site := range sites {
+		if site.suppressed == 0 {
+			continue
+		}
+		keyvals := []any{"site", msg, "suppressed", site.suppressed, "interval", l.interval}
+		switch site.level {
+		case logDebug:
+			l.logger.Debug("log messages suppressed", keyvals...)
+		case logInfo:
+			l.logger.Info("log messages suppressed", keyvals...)
+		case logWarn:
+			l.logger.Warn("log messages suppressed", keyvals...)
+		default:
+			l.logger.Error("log messages suppressed", keyvals...)
+		}
+	}
+}
+
+// unwrapLogger 返回采样前的Logger
+func unwrapLogger(logger Logger) Logger {
+	if sampled, ok := logger.(*sampledLogger); ok {
+		return sampled.logger
+	}
+	return logger
+}
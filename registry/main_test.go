@@ -0,0 +1,208 @@
+// registry/main_test.go
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+
+	"github.com/YuanJey/grpc-etcd/etcdtest"
+	"github.com/YuanJey/grpc-etcd/resolvertest"
+)
+
+const (
+	// testTTL 测试注册实例的租约时长（秒）
+	testTTL = 5
+	// testTimeout 等待异步结果收敛的最长时间
+	testTimeout = 15 * time.Second
+)
+
+// sharedEtcd 不会被停止的测试共用的嵌入式etcd，各测试使用不同的服务名互不干扰
+var sharedEtcd *etcdtest.Server
+
+// serviceSeq 生成不重复的服务名
+var serviceSeq atomic.Int64
+
+func TestMain(m *testing.M) {
+	srv, err := etcdtest.New()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	sharedEtcd = srv
+	code := m.Run()
+	srv.Close()
+	os.Exit(code)
+}
+
+// newTestRegistry 连接共享etcd创建注册中心，测试结束时关闭
+func newTestRegistry(t *testing.T, opts ...Option) *EtcdRegistry {
+	t.Helper()
+	return newRegistryOn(t, sharedEtcd, opts...)
+}
+
+// newRegistryOn 连接srv创建注册中心，测试结束时关闭
+func newRegistryOn(t *testing.T, srv *etcdtest.Server, opts ...Option) *EtcdRegistry {
+	t.Helper()
+	r, err := NewEtcdRegistryWithConfig(srv.ClientConfig(), testTTL, opts...)
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+// testService 返回当前测试专用的服务名
+func testService(t *testing.T) string {
+	name := strings.NewReplacer("/", "-", " ", "-").Replace(t.Name())
+	return fmt.Sprintf("%s-%d", strings.ToLower(name), serviceSeq.Add(1))
+}
+
+// testContext 返回testTimeout后超时的context，测试结束时取消
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// eventually 在testTimeout内反复检查check，始终失败时终止测试
+func eventually(t *testing.T, what string, check func() error) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for {
+		err := check()
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: %v", what, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// mustRegister 注册实例，失败时终止测试
+func mustRegister(t *testing.T, r *EtcdRegistry, info *ServiceInfo) {
+	t.Helper()
+	if err := r.RegisterService(info); err != nil {
+		t.Fatalf("register %s at %s: %v", info.Name, info.Address, err)
+	}
+}
+
+// buildResolver 通过resolvertest创建target的resolver，测试结束时关闭
+func buildResolver(t *testing.T, builder resolver.Builder, target string) (*resolvertest.ClientConn, resolver.Resolver) {
+	t.Helper()
+	cc, rsv, err := resolvertest.Build(builder, target)
+	if err != nil {
+		t.Fatalf("build resolver for %s: %v", target, err)
+	}
+	t.Cleanup(rsv.Close)
+	return cc, rsv
+}
+
+// waitAddrs 等待resolver推送的地址恰好为addrs，不关心顺序
+func waitAddrs(t *testing.T, cc *resolvertest.ClientConn, addrs ...string) resolver.State {
+	t.Helper()
+	want := slices.Sorted(slices.Values(addrs))
+	state, err := cc.WaitForState(testContext(t), func(state resolver.State) bool {
+		return slices.Equal(slices.Sorted(slices.Values(resolvertest.Addrs(state))), want)
+	})
+	if err != nil {
+		last, _ := cc.LastState()
+		t.Fatalf("resolver addresses: got %v, want %v: %v", resolvertest.Addrs(last), want, err)
+	}
+	return state
+}
+
+// watchRecorder 记录Watch回调收到的最新实例列表
+type watchRecorder struct {
+	mu    sync.Mutex
+	calls int
+	last  []*ServiceInfo
+}
+
+func (w *watchRecorder) callback(services []*ServiceInfo) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.calls++
+	w.last = services
+}
+
+// expect 检查最新实例地址与want相同，不关心顺序
+func (w *watchRecorder) expect(want ...string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return expectAddrs(w.last, want...)
+}
+
+// expectAddrs 检查实例地址与want相同，不关心顺序
+func expectAddrs(services []*ServiceInfo, want ...string) error {
+	got := make([]string, 0, len(services))
+	for _, service := range services {
+		got = append(got, service.Address)
+	}
+	slices.Sort(got)
+	want = slices.Sorted(slices.Values(want))
+	if !slices.Equal(got, want) {
+		return fmt.Errorf("got instances %v, want %v", got, want)
+	}
+	return nil
+}
+
+// backend 记录收到请求数的健康检查服务
+type backend struct {
+	healthpb.UnimplementedHealthServer
+	addr  string
+	calls atomic.Int64
+}
+
+func (b *backend) Check(context.Context, *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	b.calls.Add(1)
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+// startBackend 在本机临时端口启动后端，测试结束时停止
+func startBackend(t *testing.T) *backend {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	b := &backend{addr: lis.Addr().String()}
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, b)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return b
+}
+
+// dialHealth 通过r拨号service，返回health客户端和连接，测试结束时关闭连接
+func dialHealth(t *testing.T, r *EtcdRegistry, service string) (healthpb.HealthClient, *grpc.ClientConn) {
+	t.Helper()
+	conn, err := r.Dial(context.Background(), service, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial %s: %v", service, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn), conn
+}
+
+// checkOnce 发起一次等待就绪的健康检查
+func checkOnce(t *testing.T, client healthpb.HealthClient) {
+	t.Helper()
+	if _, err := client.Check(testContext(t), &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true)); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+// registry/metrics.go
+package registry
+
+// 指标名称
+const (
+	// MetricResolverUpdates resolver调用UpdateState的次数
+	MetricResolverUpdates = "resolver_updates_total"
+	// MetricResolverUpdatesSuppressed 与上次状态相同而省略的推送次数
+	MetricResolverUpdatesSuppressed = "resolver_updates_suppressed_total"
+	// MetricResolverErrors resolver调用ReportError的次数，按class标签区分错误分类，取值见ResolverErrorClass
+	MetricResolverErrors = "resolver_errors_total"
+	// MetricResolverAddresses resolver当前推送的地址数
+	MetricResolverAddresses = "resolver_addresses"
+	// MetricResolverLastRefresh resolver最近一次成功从etcd刷新的Unix时间（秒），
+	// 用当前时间减去该值即为距上次成功刷新的秒数
+	MetricResolverLastRefresh = "resolver_last_refresh_timestamp_seconds"
+	// MetricEtcdOpsInflight 当前正在进行的etcd请求数，仅在设置WithMaxConcurrentOps时上报
+	MetricEtcdOpsInflight = "etcd_ops_inflight"
+	// MetricEtcdOpsQueued 当前排队等待的etcd请求数，仅在设置WithMaxConcurrentOps时上报
+	MetricEtcdOpsQueued = "etcd_ops_queued"
+	// MetricRegistrations 本注册中心当前持有的注册实例数
+	MetricRegistrations = "registrations"
+	// MetricLeaseRenewals 租约心跳成功的次数
+	MetricLeaseRenewals = "lease_renewals_total"
+	// MetricLeaseLost 租约丢失的次数
+	MetricLeaseLost = "lease_lost_total"
+	// MetricReRegisterAttempts 租约丢失后重新注册的尝试次数，按result标签区分成功和失败
+	MetricReRegisterAttempts = "reregister_attempts_total"
+	// MetricDiscoverCalls Discover的调用次数
+	MetricDiscoverCalls = "discover_total"
+	// MetricDiscoverErrors Discover返回错误的次数，包括没有实例
+	MetricDiscoverErrors = "discover_errors_total"
+	// MetricDiscoverDuration Discover的耗时（秒）
+	MetricDiscoverDuration = "discover_duration_seconds"
+	// MetricWatchEvents 服务watch收到的事件数
+	MetricWatchEvents = "watch_events_total"
+	// MetricWatchRestarts 服务watch中断后重新建立的次数
+	MetricWatchRestarts = "watch_restarts_total"
+	// MetricWatchInstances 本进程watch（包括resolver）的服务当前发现的实例数，包括非up状态的实例
+	MetricWatchInstances = "watch_instances"
+	// MetricWatchZeroInstances watch的服务实例数从非零变为零的次数
+	MetricWatchZeroInstances = "watch_zero_instances_total"
+	// MetricLeaseTTLRemaining 注册实例租约的剩余秒数，通过TimeToLive周期采样，
+	// 租约丢失或正在重新注册时为-1
+	MetricLeaseTTLRemaining = "lease_ttl_remaining_seconds"
+	// MetricKeepAliveAge 距注册实例最近一次心跳成功的秒数，租约丢失或正在重新注册时为-1
+	MetricKeepAliveAge = "keepalive_age_seconds"
+	// MetricKeepAliveInterruptions 注册实例心跳中断的次数，按reason标签区分原因，取值见InterruptionClosed等
+	MetricKeepAliveInterruptions = "keepalive_interruptions_total"
+	// MetricKeepAliveRecovery 心跳中断到重新注册后的新租约收到第一次心跳的秒数
+	MetricKeepAliveRecovery = "keepalive_recovery_seconds"
+	// MetricEtcdOpDuration etcd KV和租约请求的耗时（秒），按op标签区分请求类型，不包括排队等待的时间
+	MetricEtcdOpDuration = "etcd_op_duration_seconds"
+	// MetricEtcdSlowOps 耗时超过WithSlowOpThreshold阈值的etcd请求数，按op标签区分请求类型
+	MetricEtcdSlowOps = "etcd_slow_ops_total"
+	// MetricRegistrationVisibility 实例注册写入到watch推送送达订阅者（resolver的UpdateState或Watch回调返回）的秒数，
+	// 需要写入方开启WithVisibilityTracking，包含两端的时钟偏差
+	MetricRegistrationVisibility = "registration_visibility_seconds"
+	// MetricDeregistrationVisibility 实例注销到推送中移除该实例送达订阅者的秒数，条件同上
+	MetricDeregistrationVisibility = "deregistration_visibility_seconds"
+)
+
+// 指标标签
+const (
+	LabelService = "service"
+	LabelScheme  = "scheme"
+	LabelResult  = "result"
+	LabelAddress = "address"
+	LabelOp      = "op"
+	LabelClass   = "class"
+)
+
+// 指标result标签的取值
+const (
+	ResultOK    = "ok"
+	ResultError = "error"
+)
+
+// serviceLabels 只带服务名的指标标签
+func serviceLabels(serviceName string) map[string]string {
+	return map[string]string{LabelService: serviceName}
+}
+
+// resultLabel err为nil时返回ResultOK，否则返回ResultError
+func resultLabel(err error) string {
+	if err != nil {
+		return ResultError
+	}
+	return ResultOK
+}
+
+// Metrics 注册中心指标接收器，实现需要保证并发安全
+// 核心包不依赖任何具体的监控系统，由调用方通过WithMetrics接入
+type Metrics interface {
+	// IncCounter 计数器增加delta
+	IncCounter(name string, labels map[string]string, delta float64)
+	// SetGauge 设置仪表盘当前值
+	SetGauge(name string, labels map[string]string, value float64)
+	// ObserveHistogram 记录一次分布观测值
+	ObserveHistogram(name string, labels map[string]string, value float64)
+}
+
+// MetricsDeleter 可选接口，Metrics实现后注册中心在实例注销时删除其仪表盘，避免残留过期的时间序列
+type MetricsDeleter interface {
+	DeleteGauge(name string, labels map[string]string)
+}
+
+// noopMetrics 默认的空指标接收器
+type noopMetrics struct{}
+
+func (noopMetrics) IncCounter(string, map[string]string, float64)       {}
+func (noopMetrics) SetGauge(string, map[string]string, float64)         {}
+func (noopMetrics) ObserveHistogram(string, map[string]string, float64) {}
@@ -0,0 +1,345 @@
+// registry/multi.go
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// Registry 注册中心接口，EtcdRegistry和MultiRegistry均实现该接口
+type Registry interface {
+	Register(serviceName, address, version string) error
+	RegisterService(serviceInfo *ServiceInfo) error
+	Unregister(serviceName, address string) error
+	Discover(serviceName string) ([]*ServiceInfo, error)
+	Watch(serviceName string, callback func([]*ServiceInfo)) error
+	Close() error
+}
+
+var (
+	_ Registry         = (*EtcdRegistry)(nil)
+	_ Registry         = (*MultiRegistry)(nil)
+	_ resolver.Builder = (*MultiRegistry)(nil)
+)
+
+// PartialError 部分注册中心操作失败，其余注册中心的结果仍然有效
+type PartialError struct {
+	// Errors 按注册中心下标记录的错误
+	Errors map[int]error
+}
+
+func (e *PartialError) Error() string {
+	indexes := make([]int, 0, len(e.Errors))
+	for i := range e.Errors {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	parts := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		parts = append(parts, fmt.Sprintf("registry %d: %v", i, e.Errors[i]))
+	}
+	return "partial registry failure: " + strings.Join(parts, "; ")
+}
+
+// Unwrap 支持errors.Is/errors.As检查各注册中心的错误
+func (e *PartialError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// MultiRegistry 联合多个etcd注册中心，适用于集群迁移期间需要同时看到两边实例的场景
+// 注册会写入所有注册中心，发现和监听返回各注册中心实例按地址去重后的并集，
+// 某个注册中心不可用时继续使用其他注册中心的实例并报告部分失败
+type MultiRegistry struct {
+	registries []*EtcdRegistry
+}
+
+// NewMultiRegistry 创建联合注册中心，resolver使用第一个注册中心的scheme
+func NewMultiRegistry(registries ...*EtcdRegistry) (*MultiRegistry, error) {
+	if len(registries) == 0 {
+		return nil, errors.New("multi registry requires at least one registry")
+	}
+	return &MultiRegistry{registries: registries}, nil
+}
+
+// each 在每个注册中心上执行fn，全部失败时返回聚合错误，部分失败时返回*PartialError
+func (m *MultiRegistry) each(fn func(i int, r *EtcdRegistry) error) error {
+	partial := &PartialError{Errors: make(map[int]error)}
+	for i, r := range m.registries {
+		if err := fn(i, r); err != nil {
+			partial.Errors[i] = err
+		}
+	}
+	switch len(partial.Errors) {
+	case 0:
+		return nil
+	case len(m.registries):
+		return errors.Join(partial.Unwrap()...)
+	default:
+		return partial
+	}
+}
+
+// Register 在所有注册中心注册服务
+func (m *MultiRegistry) Register(serviceName, address, version string) error {
+	return m.RegisterService(&ServiceInfo{Name: serviceName, Address: address, Version: version})
+}
+
+// RegisterService 在所有注册中心注册服务
+func (m *MultiRegistry) RegisterService(serviceInfo *ServiceInfo) error {
+	return m.each(func(_ int, r *EtcdRegistry) error {
+		return r.RegisterService(serviceInfo)
+	})
+}
+
+// Unregister 在所有注册中心注销服务
+func (m *MultiRegistry) Unregister(serviceName, address string) error {
+	return m.each(func(_ int, r *EtcdRegistry) error {
+		return r.Unregister(serviceName, address)
+	})
+}
+
+// Discover 返回所有注册中心实例的并集，按地址去重，靠前的注册中心优先
+// 返回*PartialError时services仍包含可用注册中心的实例
+func (m *MultiRegistry) Discover(serviceName string) ([]*ServiceInfo, error) {
+	lists := make([][]*ServiceInfo, len(m.registries))
+	err := m.each(func(i int, r *EtcdRegistry) error {
+		services, err := r.Discover(serviceName)
+		if errors.Is(err, ErrNoInstances) {
+			// 某个集群没有实例不算失败
+			return nil
+		}
+		lists[i] = services
+		return err
+	})
+	var partial *PartialError
+	if err != nil && !errors.As(err, &partial) {
+		return nil, err
+	}
+	merged := mergeServices(lists)
+	if len(merged) == 0 && err == nil {
+		return nil, newError("discover", serviceName, "", ErrNoInstances)
+	}
+	return merged, err
+}
+
+// Watch 监听所有注册中心的服务变化，任一注册中心变化时回调合并后的实例列表
+// 只要有一个注册中心首次获取成功即开始监听并返回*PartialError，
+// 首次获取失败的注册中心在后台按退避重试，恢复后其实例并入回调结果
+func (m *MultiRegistry) Watch(serviceName string, callback func([]*ServiceInfo)) error {
+	var mu sync.Mutex
+	lists := make([][]*ServiceInfo, len(m.registries))
+	delivery := newSubscriber(0, goroutineLabels(LabelOpDispatch, "service", serviceName), callback)
+	callbacks := make([]func([]*ServiceInfo), len(m.registries))
+	for i := range m.registries {
+		callbacks[i] = func(services []*ServiceInfo) {
+			mu.Lock()
+			lists[i] = services
+			merged := mergeServices(lists)
+			mu.Unlock()
+			delivery.notify(merged)
+		}
+	}
+
+	err := m.each(func(i int, r *EtcdRegistry) error {
+		return r.Watch(serviceName, callbacks[i])
+	})
+	var partial *PartialError
+	if err != nil && !errors.As(err, &partial) {
+		delivery.stop()
+		return err
+	}
+	if partial != nil {
+		for i := range partial.Errors {
+			r := m.registries[i]
+			goLabeled(goroutineLabels(LabelOpWatch, "service", serviceName), func() {
+				retryWatch(r, serviceName, callbacks[i])
+			})
+		}
+	}
+	return err
+}
+
+// retryWatch 按退避重试首次获取失败的Watch，直到成功或注册中心关闭
+func retryWatch(r *EtcdRegistry, serviceName string, callback func([]*ServiceInfo)) {
+	for attempt := 0; retryWait(r.ctx, nil, attempt); attempt++ {
+		err := r.Watch(serviceName, callback)
+		if err == nil || errors.Is(err, ErrRegistryClosed) {
+			return
+		}
+		r.opts.logger.Warn("multi registry watch retry failed", "service", serviceName, "attempt", attempt+1, "error", err)
+	}
+}
+
+// Close 关闭所有注册中心
+func (m *MultiRegistry) Close() error {
+	return m.each(func(_ int, r *EtcdRegistry) error {
+		return r.Close()
+	})
+}
+
+// mergeServices 按地址合并多个实例列表，靠前的列表优先
+func mergeServices(lists [][]*ServiceInfo) []*ServiceInfo {
+	seen := make(map[string]bool)
+	var merged []*ServiceInfo
+	for _, services := range lists {
+		for _, service := range services {
+			if seen[service.Address] {
+				continue
+			}
+			seen[service.Address] = true
+			merged = append(merged, service)
+		}
+	}
+	return merged
+}
+
+// Scheme 实现resolver.Builder接口
+func (m *MultiRegistry) Scheme() string {
+	return m.registries[0].Scheme()
+}
+
+// Build 实现resolver.Builder接口，为每个注册中心创建子resolver并合并其推送
+func (m *MultiRegistry) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	mr := &multiResolver{
+		cc:     cc,
+		states: make([]*resolver.State, len(m.registries)),
+		errs:   make([]error, len(m.registries)),
+	}
+	for i, r := range m.registries {
+		child, err := r.Build(target, &multiClientConn{ClientConn: cc, parent: mr, index: i}, opts)
+		if err != nil {
+			mr.Close()
+			return nil, err
+		}
+		mr.children = append(mr.children, child)
+	}
+	return mr, nil
+}
+
+// multiResolver 合并多个子resolver的推送
+type multiResolver struct {
+	cc       resolver.ClientConn
+	children []resolver.Resolver
+
+	mu     sync.Mutex
+	closed bool
+	states []*resolver.State
+	errs   []error
+}
+
+// multiClientConn 子resolver使用的ClientConn，把推送转交给multiResolver
+type multiClientConn struct {
+	resolver.ClientConn
+	parent *multiResolver
+	index  int
+}
+
+// UpdateState 实现resolver.ClientConn接口
+func (c *multiClientConn) UpdateState(state resolver.State) error {
+	c.parent.mu.Lock()
+	defer c.parent.mu.Unlock()
+
+	c.parent.states[c.index] = &state
+	c.parent.errs[c.index] = nil
+	return c.parent.pushLocked()
+}
+
+// ReportError 实现resolver.ClientConn接口
+func (c *multiClientConn) ReportError(err error) {
+	c.parent.mu.Lock()
+	defer c.parent.mu.Unlock()
+
+	c.parent.errs[c.index] = err
+	if c.parent.closed {
+		return
+	}
+	c.parent.cc.ReportError(c.parent.errorLocked())
+}
+
+// pushLocked 按地址去重合并所有子resolver的状态并推送，调用方需持有mu
+// 服务配置和状态属性取第一个提供了它们的注册中心
+func (r *multiResolver) pushLocked() error {
+	if r.closed {
+		return nil
+	}
+
+	var merged resolver.State
+	seenAddrs := make(map[string]bool)
+	seenEndpoints := make(map[string]bool)
+	for _, state := range r.states {
+		if state == nil {
+			continue
+		}
+		for _, addr := range state.Addresses {
+			if !seenAddrs[addr.Addr] {
+				seenAddrs[addr.Addr] = true
+				merged.Addresses = append(merged.Addresses, addr)
+			}
+		}
+		for _, endpoint := range state.Endpoints {
+			if len(endpoint.Addresses) == 0 || seenEndpoints[endpoint.Addresses[0].Addr] {
+				continue
+			}
+			seenEndpoints[endpoint.Addresses[0].Addr] = true
+			merged.Endpoints = append(merged.Endpoints, endpoint)
+		}
+		if merged.ServiceConfig == nil {
+			merged.ServiceConfig = state.ServiceConfig
+		}
+		if merged.Attributes == nil {
+			merged.Attributes = state.Attributes
+		}
+	}
+	sort.Slice(merged.Addresses, func(i, j int) bool { return merged.Addresses[i].Addr < merged.Addresses[j].Addr })
+	sort.Slice(merged.Endpoints, func(i, j int) bool {
+		return merged.Endpoints[i].Addresses[0].Addr < merged.Endpoints[j].Addresses[0].Addr
+	})
+
+	err := r.cc.UpdateState(merged)
+	if partialErr := r.errorLocked(); partialErr != nil {
+		r.cc.ReportError(partialErr)
+	}
+	return err
+}
+
+// errorLocked 汇总子resolver的错误，调用方需持有mu
+func (r *multiResolver) errorLocked() error {
+	partial := &PartialError{Errors: make(map[int]error)}
+	for i, err := range r.errs {
+		if err != nil {
+			partial.Errors[i] = err
+		}
+	}
+	if len(partial.Errors) == 0 {
+		return nil
+	}
+	return partial
+}
+
+// ResolveNow 实现resolver.Resolver接口
+func (r *multiResolver) ResolveNow(options resolver.ResolveNowOptions) {
+	for _, child := range r.children {
+		child.ResolveNow(options)
+	}
+}
+
+// Close 实现resolver.Resolver接口
+func (r *multiResolver) Close() {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+
+	for _, child := range r.children {
+		child.Close()
+	}
+}
@@ -0,0 +1,86 @@
+// registry/multi_test.go
+package registry
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/YuanJey/grpc-etcd/etcdtest"
+)
+
+func TestMultiRegistryWatchRecoversFailedCluster(t *testing.T) {
+	srv := etcdtest.Start(t)
+	service := testService(t)
+	a := newTestRegistry(t)
+	b := newRegistryOn(t, srv, WithRequestTimeout(500*time.Millisecond))
+	mustRegister(t, a, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+	mustRegister(t, newRegistryOn(t, srv), &ServiceInfo{Name: service, Address: "10.0.0.2:80"})
+
+	m, err := NewMultiRegistry(a, b)
+	if err != nil {
+		t.Fatalf("new multi registry: %v", err)
+	}
+	srv.Stop()
+
+	var watch watchRecorder
+	err = m.Watch(service, watch.callback)
+	var partial *PartialError
+	if !errors.As(err, &partial) || len(partial.Errors) != 1 || partial.Errors[1] == nil {
+		t.Fatalf("watch with one cluster down: got %v, want PartialError for registry 1", err)
+	}
+	eventually(t, "instances of the healthy cluster", func() error { return watch.expect("10.0.0.1:80") })
+
+	// 宕机的集群恢复后继续重试，无需重新调用Watch
+	if err := srv.Restart(); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	eventually(t, "instances of both clusters", func() error { return watch.expect("10.0.0.1:80", "10.0.0.2:80") })
+}
+
+func TestMultiRegistryWatchAllDown(t *testing.T) {
+	srv := etcdtest.Start(t)
+	r := newRegistryOn(t, srv, WithRequestTimeout(500*time.Millisecond))
+	m, err := NewMultiRegistry(r)
+	if err != nil {
+		t.Fatalf("new multi registry: %v", err)
+	}
+	srv.Stop()
+
+	var partial *PartialError
+	if err := m.Watch(testService(t), func([]*ServiceInfo) {}); err == nil || errors.As(err, &partial) {
+		t.Fatalf("watch with every cluster down: got %v, want a plain error", err)
+	}
+}
+
+func TestMultiRegistryDiscoverPartial(t *testing.T) {
+	srv := etcdtest.Start(t)
+	service := testService(t)
+	a := newTestRegistry(t)
+	b := newRegistryOn(t, srv, WithRequestTimeout(500*time.Millisecond))
+	mustRegister(t, a, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+	mustRegister(t, b, &ServiceInfo{Name: service, Address: "10.0.0.1:80", Version: "v2"})
+	mustRegister(t, b, &ServiceInfo{Name: service, Address: "10.0.0.2:80"})
+
+	m, err := NewMultiRegistry(a, b)
+	if err != nil {
+		t.Fatalf("new multi registry: %v", err)
+	}
+	eventually(t, "union deduplicated by address", func() error {
+		services, err := m.Discover(service)
+		if err != nil {
+			return err
+		}
+		return expectAddrs(services, "10.0.0.1:80", "10.0.0.2:80")
+	})
+
+	srv.Stop()
+	services, err := m.Discover(service)
+	var partial *PartialError
+	if !errors.As(err, &partial) {
+		t.Fatalf("discover with one cluster down: got %v, want PartialError", err)
+	}
+	if err := expectAddrs(services, "10.0.0.1:80"); err != nil {
+		t.Errorf("discover with one cluster down: %v", err)
+	}
+}
@@ -0,0 +1,666 @@
+// registry/options.go
+package registry
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-semver/semver"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// defaultServiceConfig resolver默认下发的服务配置，使用round_robin在实例间均衡
+const defaultServiceConfig = `{"loadBalancingConfig":[{"round_robin":{}}]}`
+
+// options 注册中心可选配置
+type options struct {
+	scheme        string
+	serviceConfig string
+	// requestTimeout 单次etcd请求超时时间
+	requestTimeout time.Duration
+	// watchDebounce 合并watch事件的时间窗口，0表示每个事件立即推送
+	watchDebounce time.Duration
+	// cacheTTL Discover结果的缓存时间，0表示不缓存
+	cacheTTL time.Duration
+	// subsetSize 每个客户端最多连接的实例数，0表示不限制
+	subsetSize int
+	// clientID 子集选择使用的稳定客户端标识
+	clientID string
+	// fallbackAddresses 按服务名配置的静态兜底地址
+	fallbackAddresses map[string][]string
+	// metrics 指标接收器
+	metrics Metrics
+	// leaseMetricsInterval 采样租约剩余时长和心跳间隔指标的周期，0表示不采样
+	leaseMetricsInterval time.Duration
+	// authorities target中authority到etcd key前缀的映射
+	authorities map[string]string
+	// healthCheckServiceName 服务配置中healthCheckConfig使用的服务名，为空表示不设置
+	healthCheckServiceName string
+	// tls 连接etcd使用的TLS配置
+	tls tlsOptions
+	// username和password etcd用户名密码认证
+	username string
+	password string
+	// dialTimeout 连接etcd的超时时间
+	dialTimeout time.Duration
+	// keepAliveTime和keepAliveTimeout etcd连接的gRPC keepalive参数，用于及时发现半开连接
+	keepAliveTime    time.Duration
+	keepAliveTimeout time.Duration
+	// maxCallSendMsgSize和maxCallRecvMsgSize etcd请求消息大小上限，0表示使用etcd客户端默认值
+	maxCallSendMsgSize int
+	maxCallRecvMsgSize int
+	// ownsClient NewEtcdRegistryWithClient创建的注册中心是否在Close时关闭客户端
+	ownsClient bool
+	// namespace 所有key的命名空间前缀
+	namespace string
+	// autoSyncInterval 自动同步etcd集群成员列表的间隔，0表示不同步
+	autoSyncInterval time.Duration
+	// retry 同步etcd请求的重试策略
+	retry retryPolicy
+	// maxConcurrentOps 同时进行的etcd KV和租约请求上限，0表示不限制
+	maxConcurrentOps int
+	// slowOpThreshold 慢请求阈值，0表示不检测
+	slowOpThreshold time.Duration
+	// visibilityTracking 注册和注销时写入时间戳，见WithVisibilityTracking
+	visibilityTracking bool
+	// historySize 每类事件保留的历史条数，0表示不记录
+	historySize int
+	// failureThreshold 后台故障持续多久后发送到Errors通道，0表示不发送
+	failureThreshold time.Duration
+	// instanceName 和identity 注册中心标识，identity在newOptions中生成
+	instanceName string
+	identity     Identity
+	// stampRegisteredBy 写入的服务信息元数据中带上注册中心标识，见WithRegisteredBy
+	stampRegisteredBy bool
+	// logger 日志，newOptions中包装为追加注册中心标识的日志
+	logger Logger
+	// logSampleFirst、logSampleInterval和logSampleWarn 日志采样，见WithLogSampling
+	logSampleFirst    int
+	logSampleInterval time.Duration
+	logSampleWarn     bool
+	// tracer 链路追踪
+	tracer Tracer
+	// auditEnabled 和audit 注册变更审计，见WithAudit
+	auditEnabled bool
+	audit        auditOptions
+	// hooks 后台事件回调，Hooks被包装为ContextHooks
+	hooks ContextHooks
+	// skipPreflight 创建时不做权限预检
+	skipPreflight bool
+	// encryptionKey 注册信息的AES密钥，为空表示不加密
+	encryptionKey []byte
+	// pool 共享etcd客户端的客户端池
+	pool *ClientPool
+	// minServerVersion 要求的etcd最低版本，为nil表示不检查
+	minServerVersion *semver.Version
+	// versionWarnOnly 版本过低时只记录日志
+	versionWarnOnly bool
+	minVersionErr   error
+	// dialOptions 传给etcd客户端的额外gRPC拨号选项
+	dialOptions []grpc.DialOption
+	// transportCreds 自定义的etcd连接传输层凭据
+	transportCreds credentials.TransportCredentials
+}
+
+// Option 注册中心配置项
+type Option func(*options)
+
+func defaultOptions() *options {
+	return &options{
+		scheme:         "etcd",
+		serviceConfig:  defaultServiceConfig,
+		requestTimeout: 5 * time.Second,
+		metrics:        noopMetrics{},
+
+		leaseMetricsInterval: 10 * time.Second,
+
+		dialTimeout:      5 * time.Second,
+		keepAliveTime:    30 * time.Second,
+		keepAliveTimeout: 10 * time.Second,
+		slowOpThreshold:  500 * time.Millisecond,
+		failureThreshold: 30 * time.Second,
+		historySize:      DefaultHistorySize,
+
+		audit: auditOptions{maxRecords: DefaultAuditMaxRecords},
+
+		retry:  defaultRetryPolicy(),
+		logger: noopLogger{},
+		tracer: noopTracer{},
+	}
+}
+
+// WithServiceConfig 设置resolver下发的服务配置JSON，传空字符串表示不下发
+// resolver下发的配置优先级高于grpc.WithDefaultServiceConfig，
+// 希望使用拨号时指定的默认配置时应传空字符串关闭
+func WithServiceConfig(serviceConfigJSON string) Option {
+	return func(o *options) {
+		o.serviceConfig = serviceConfigJSON
+	}
+}
+
+// WithoutServiceConfig 关闭resolver下发的服务配置
+func WithoutServiceConfig() Option {
+	return WithServiceConfig("")
+}
+
+// WithScheme 设置resolver的scheme，默认为"etcd"
+// 多个注册中心实例（例如生产集群和影子集群）同时注册到gRPC时需使用不同的scheme
+func WithScheme(scheme string) Option {
+	return func(o *options) {
+		o.scheme = strings.ToLower(scheme)
+	}
+}
+
+// WithRequestTimeout 设置单次etcd请求的超时时间，默认5s
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.requestTimeout = timeout
+	}
+}
+
+// WithWatchDebounce 在收到watch事件后等待d再推送，期间的多个事件合并为一次推送，
+// 用于大规模滚动发布时减少resolver更新次数；默认0表示立即推送
+func WithWatchDebounce(d time.Duration) Option {
+	return func(o *options) {
+		o.watchDebounce = d
+	}
+}
+
+// WithDiscoverCacheTTL 缓存Discover的结果ttl时长，期间的调用不访问etcd，
+// 实例变化最多延迟ttl才能被Discover看到；默认0表示不缓存，Watch和resolver不受影响
+func WithDiscoverCacheTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.cacheTTL = ttl
+	}
+}
+
+// WithSubsetSize 每个客户端只连接最多n个实例，用于避免大规模服务下的全连接网格
+// 子集按客户端标识通过rendezvous哈希确定，成员变化时只替换必要的实例；
+// Discover仍返回全部实例
+func WithSubsetSize(n int) Option {
+	return func(o *options) {
+		o.subsetSize = n
+	}
+}
+
+// WithClientID 设置子集选择使用的稳定客户端标识，默认使用主机名
+func WithClientID(id string) Option {
+	return func(o *options) {
+		o.clientID = id
+	}
+}
+
+// WithFallbackAddresses 按服务名设置静态兜底地址
+// etcd中服务没有实例，或etcd不可用且没有缓存结果时，resolver改用这些地址，
+// 一旦发现实例立即切回；兜底地址可通过IsFallbackAddress识别
+func WithFallbackAddresses(fallback map[string][]string) Option {
+	return func(o *options) {
+		o.fallbackAddresses = make(map[string][]string, len(fallback))
+		for service, addrs := range fallback {
+			o.fallbackAddresses[service] = append([]string(nil), addrs...)
+		}
+	}
+}
+
+// WithMetrics 设置指标接收器，注册中心和resolver的指标都会写入其中
+func WithMetrics(m Metrics) Option {
+	return func(o *options) {
+		if m == nil {
+			m = noopMetrics{}
+		}
+		o.metrics = m
+	}
+}
+
+// WithEventHistory 设置事件历史中resolver推送、watch和租约三类事件各自保留的条数，默认DefaultHistorySize，0表示不记录
+// 事件历史通过Stats和DebugHandler查看，用于事后排查某一时刻客户端看到的实例数
+func WithEventHistory(size int) Option {
+	return func(o *options) {
+		o.historySize = size
+	}
+}
+
+// WithInstanceName 设置注册中心标识中的名称，标识为 name@hostname:pid，默认只有主机名和PID
+// 标识带在每条日志（键LabelRegistry）、每个指标标签、钩子和Watch回调的EventInfo中，
+// 一个进程中有多个注册中心实例时用于区分它们
+func WithInstanceName(name string) Option {
+	return func(o *options) {
+		o.instanceName = name
+	}
+}
+
+// WithRegisteredBy 注册和更新实例时在元数据中写入MetadataRegisteredBy，值为注册中心标识，
+// 用于从etcd中残留的key追查写入它的进程；该键不参与ServiceInfo.Equal比较
+func WithRegisteredBy() Option {
+	return func(o *options) {
+		o.stampRegisteredBy = true
+	}
+}
+
+// WithLeaseMetricsInterval 设置采样租约剩余时长和心跳间隔指标的周期，默认10s，0表示不采样
+// 每次采样对每个注册实例调用一次TimeToLive，只在设置了WithMetrics时进行
+func WithLeaseMetricsInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.leaseMetricsInterval = interval
+	}
+}
+
+// WithAuthorities 设置target中authority到etcd key前缀的映射，
+// 例如 {"staging": "/staging"} 使 etcd://staging/svc 解析 /staging/services/svc/ 下的实例，
+// 这样一个注册到gRPC的resolver即可服务多个环境；authority为空的target不加前缀
+func WithAuthorities(authorities map[string]string) Option {
+	return func(o *options) {
+		o.authorities = make(map[string]string, len(authorities))
+		for authority, prefix := range authorities {
+			o.authorities[authority] = strings.TrimSuffix(prefix, "/")
+		}
+	}
+}
+
+// WithHealthCheckServiceName 在resolver下发的服务配置中加入healthCheckConfig，
+// 配合客户端导入google.golang.org/grpc/health开启gRPC客户端健康检查；
+// etcd中的服务配置已包含healthCheckConfig时保持不变，WithoutServiceConfig时不生效
+func WithHealthCheckServiceName(serviceName string) Option {
+	return func(o *options) {
+		o.healthCheckServiceName = serviceName
+	}
+}
+
+// WithTLSFiles 使用证书文件通过TLS连接etcd
+// caFile为空时使用系统根证书；certFile和keyFile用于双向认证，需同时提供或同时为空
+func WithTLSFiles(caFile, certFile, keyFile string) Option {
+	return func(o *options) {
+		o.tls.caFile = caFile
+		o.tls.certFile = certFile
+		o.tls.keyFile = keyFile
+	}
+}
+
+// WithTLSConfig 使用已构造的tls.Config连接etcd，适用于自定义PKI
+// 同时使用WithTLSFiles时，文件中的证书会加入该配置的副本
+func WithTLSConfig(config *tls.Config) Option {
+	return func(o *options) {
+		o.tls.config = config
+	}
+}
+
+// WithInsecureSkipVerify 连接etcd时不校验服务端证书，只应在测试环境使用
+func WithInsecureSkipVerify() Option {
+	return func(o *options) {
+		o.tls.insecureSkipVerify = true
+	}
+}
+
+// WithAuth 使用用户名密码连接开启了认证的etcd，凭据错误时创建注册中心失败
+// 认证token过期时注册中心会自动重新认证并重试请求，调用方不会收到ErrInvalidAuthToken；
+// 凭据可以通过UpdateCredentials在运行时替换
+func WithAuth(username, password string) Option {
+	return func(o *options) {
+		o.username = username
+		o.password = password
+	}
+}
+
+// WithDialTimeout 设置连接etcd的超时时间，默认5s
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.dialTimeout = timeout
+	}
+}
+
+// WithDialKeepAlive 设置etcd连接的keepalive间隔和超时时间，默认30s和10s
+// 对端无响应超过interval+timeout后连接会被关闭并重连，interval为0表示关闭keepalive
+func WithDialKeepAlive(interval, timeout time.Duration) Option {
+	return func(o *options) {
+		o.keepAliveTime = interval
+		o.keepAliveTimeout = timeout
+	}
+}
+
+// WithMaxCallMsgSize 设置etcd请求发送和接收消息的大小上限，0表示使用etcd客户端默认值
+func WithMaxCallMsgSize(send, recv int) Option {
+	return func(o *options) {
+		o.maxCallSendMsgSize = send
+		o.maxCallRecvMsgSize = recv
+	}
+}
+
+// WithClientOwnership 由注册中心接管NewEtcdRegistryWithClient传入的客户端，Close时一并关闭
+func WithClientOwnership() Option {
+	return func(o *options) {
+		o.ownsClient = true
+	}
+}
+
+// WithNamespace 将注册中心读写和监听的所有key置于指定命名空间下，例如"/team-a"，
+// 配合etcd按前缀授权的角色使用；只使用该注册中心访问时命名空间对调用方透明
+func WithNamespace(prefix string) Option {
+	return func(o *options) {
+		o.namespace = strings.TrimSuffix(prefix, "/")
+	}
+}
+
+// WithAutoSyncInterval 按间隔从etcd同步集群成员列表，集群扩缩容或替换节点后客户端仍能连接
+// 节点地址使用dns+srv://或dns://形式时，每个间隔也会重新解析DNS
+func WithAutoSyncInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.autoSyncInterval = interval
+	}
+}
+
+// WithRetry 设置同步etcd请求（注册、注销、发现、更新等）的重试次数和退避间隔，
+// 默认最多尝试3次，间隔从100ms开始翻倍，最长1s；attempts为1表示不重试
+func WithRetry(attempts int, baseDelay, maxDelay time.Duration) Option {
+	return func(o *options) {
+		o.retry.attempts = attempts
+		o.retry.baseDelay = baseDelay
+		o.retry.maxDelay = maxDelay
+	}
+}
+
+// WithRetryClassifier 设置判断错误是否可以重试的函数，默认为IsRetriable
+func WithRetryClassifier(retriable func(error) bool) Option {
+	return func(o *options) {
+		if retriable == nil {
+			retriable = IsRetriable
+		}
+		o.retry.retriable = retriable
+	}
+}
+
+// WithMaxConcurrentOps 限制同时进行的etcd KV和租约请求数，超出的请求排队等待，
+// 等待期间遵守请求的ctx；心跳流和watch流不受限制，避免发现流量挤占心跳；
+// 默认0表示不限制
+func WithMaxConcurrentOps(n int) Option {
+	return func(o *options) {
+		o.maxConcurrentOps = n
+	}
+}
+
+// WithSlowOpThreshold 设置etcd慢请求阈值，默认500ms，0表示不检测
+// 耗时达到阈值的KV和租约请求会输出Warn日志并增加etcd_slow_ops_total计数；
+// 所有请求的耗时无论是否超过阈值都会记录，p99见Stats中的OpLatency
+func WithSlowOpThreshold(threshold time.Duration) Option {
+	return func(o *options) {
+		o.slowOpThreshold = threshold
+	}
+}
+
+// WithVisibilityTracking 在注册写入中记录注册时间，注销时先写入带注销时间的down状态再删除，
+// 读取方据此上报registration_visibility_seconds和deregistration_visibility_seconds，用于统计变更对客户端可见的SLO；
+// 每次注销多一次etcd写入，默认关闭
+func WithVisibilityTracking() Option {
+	return func(o *options) {
+		o.visibilityTracking = true
+	}
+}
+
+// WithFailureThreshold 设置后台故障持续多久后作为持续性错误发送到Errors通道，默认30s，0表示不发送
+// 适用于重新注册、服务watch拉取和后台etcd交互的持续失败
+func WithFailureThreshold(threshold time.Duration) Option {
+	return func(o *options) {
+		o.failureThreshold = threshold
+	}
+}
+
+// WithAudit 开启注册变更审计，RegisterService、Unregister、UpdateServiceInfo和Close注销实例成功后
+// 在/services-audit/{name}/下追加一条记录操作者、操作、key和时间的审计记录，通过ReadAudit读取；
+// actor为空时使用注册中心标识，见Identity；租约丢失后的自动重新注册不记录
+func WithAudit(actor string) Option {
+	return func(o *options) {
+		o.auditEnabled = true
+		o.audit.actor = actor
+	}
+}
+
+// WithAuditRetention 设置每个服务保留的审计记录数和单条记录的保留时长，
+// 默认保留DefaultAuditMaxRecords条且不限时长；maxRecords为0表示不按条数删除，ttl为0表示不按时长删除，
+// 两者不能同时为0，避免审计前缀无限增长
+func WithAuditRetention(maxRecords int, ttl time.Duration) Option {
+	return func(o *options) {
+		o.audit.maxRecords = maxRecords
+		o.audit.ttl = ttl
+	}
+}
+
+// WithLogSampling 按日志位置对Debug和Info日志采样：每个interval内每个位置只输出前first条，
+// 其余丢弃，并在周期结束时输出一条带丢弃数的汇总；适用于watch事件、resolver推送等高频日志，默认不采样
+// Warn和Error默认不采样，需要时通过WithWarnLogSampling开启
+func WithLogSampling(first int, interval time.Duration) Option {
+	return func(o *options) {
+		o.logSampleFirst = first
+		o.logSampleInterval = interval
+	}
+}
+
+// WithWarnLogSampling 让WithLogSampling的采样同时作用于Warn和Error日志
+func WithWarnLogSampling() Option {
+	return func(o *options) {
+		o.logSampleWarn = true
+	}
+}
+
+// WithLogger 设置日志，默认丢弃所有日志；slog和zap可通过logadapter包一行接入
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		if logger == nil {
+			logger = noopLogger{}
+		}
+		o.logger = logger
+	}
+}
+
+// WithTracer 设置链路追踪，默认不追踪；OpenTelemetry可通过oteltrace包接入
+func WithTracer(tracer Tracer) Option {
+	return func(o *options) {
+		if tracer == nil {
+			tracer = noopTracer{}
+		}
+		o.tracer = tracer
+	}
+}
+
+// WithHooks 设置后台事件回调，回调在独立goroutine中执行
+// 可以与WithContextHooks同时使用，同一事件的回调以后设置的为准
+func WithHooks(hooks Hooks) Option {
+	return func(o *options) {
+		o.hooks.merge(hooks.withContext())
+	}
+}
+
+// WithContextHooks 设置带ctx的后台事件回调，见ContextHooks
+func WithContextHooks(hooks ContextHooks) Option {
+	return func(o *options) {
+		o.hooks.merge(hooks)
+	}
+}
+
+// WithoutPreflight 创建注册中心时跳过权限预检
+// 默认会创建并撤销一个短租约、写入并删除一个探测key，凭据缺少权限时创建失败
+func WithoutPreflight() Option {
+	return func(o *options) {
+		o.skipPreflight = true
+	}
+}
+
+// WithEncryptionKey 使用AES-GCM加密写入etcd的注册信息，key必须是16、24或32字节
+// 读取时自动识别明文和密文，迁移期间未加密的旧注册仍可读取；无法解密的注册会被跳过并记录日志
+func WithEncryptionKey(key []byte) Option {
+	return func(o *options) {
+		o.encryptionKey = append([]byte(nil), key...)
+	}
+}
+
+// WithEncryptionSecret 使用从secret派生的AES-256密钥加密注册信息，例如配置中的Etcd.Secret
+// 同一服务的所有注册方和发现方需使用相同的secret
+func WithEncryptionSecret(secret string) Option {
+	return func(o *options) {
+		if secret == "" {
+			o.encryptionKey = nil
+			return
+		}
+		o.encryptionKey = deriveKey(secret)
+	}
+}
+
+// WithClientPool 从客户端池获取etcd客户端，节点地址、凭据和TLS配置相同的注册中心共享同一个客户端
+// 注册中心关闭时归还客户端，最后一个使用者关闭时客户端才会关闭；对NewEtcdRegistryWithClient不生效
+func WithClientPool(pool *ClientPool) Option {
+	return func(o *options) {
+		o.pool = pool
+	}
+}
+
+// WithMinServerVersion 创建注册中心时检查etcd集群版本不低于minVersion（例如"3.4.0"），
+// 版本过低或无法查询时创建失败；warnOnly为true时只通过日志告警
+func WithMinServerVersion(minVersion string, warnOnly bool) Option {
+	return func(o *options) {
+		o.minServerVersion, o.minVersionErr = nil, nil
+		v, err := semver.NewVersion(minVersion)
+		if err != nil {
+			o.minVersionErr = fmt.Errorf("invalid minimum etcd server version %q: %v", minVersion, err)
+			return
+		}
+		o.minServerVersion = v
+		o.versionWarnOnly = warnOnly
+	}
+}
+
+// WithDialOptions 为etcd客户端追加gRPC拨号选项，例如统一的客户端拦截器
+// 传输层安全需通过WithTLSFiles、WithTLSConfig或WithTransportCredentials配置，
+// 不要在这里传入grpc.WithTransportCredentials，否则会覆盖TLS配置
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) {
+		o.dialOptions = append(o.dialOptions, opts...)
+	}
+}
+
+// WithTLSServerName 覆盖校验etcd证书使用的服务端名称，适用于etcd位于SNI名称与节点IP不同的负载均衡之后
+// 未配置其他TLS选项时使用系统根证书
+func WithTLSServerName(serverName string) Option {
+	return func(o *options) {
+		o.tls.serverName = serverName
+	}
+}
+
+// WithTransportCredentials 使用自定义的传输层凭据连接etcd，不能与TLS相关选项同时使用
+func WithTransportCredentials(creds credentials.TransportCredentials) Option {
+	return func(o *options) {
+		o.transportCreds = creds
+	}
+}
+
+// validate 校验配置项
+func (o *options) validate() error {
+	if err := validateScheme(o.scheme); err != nil {
+		return err
+	}
+	if o.username == "" && o.password != "" {
+		return fmt.Errorf("invalid etcd auth: password given without username")
+	}
+	if o.transportCreds != nil && o.tls.enabled() {
+		return fmt.Errorf("conflicting etcd transport security: WithTransportCredentials cannot be combined with TLS options")
+	}
+	if o.minVersionErr != nil {
+		return o.minVersionErr
+	}
+	if _, err := newCodec(o.encryptionKey); err != nil {
+		return err
+	}
+	if o.retry.attempts < 1 || o.retry.baseDelay <= 0 || o.retry.maxDelay < o.retry.baseDelay {
+		return fmt.Errorf("invalid retry policy: attempts must be at least 1 and 0 < baseDelay <= maxDelay")
+	}
+	if o.autoSyncInterval < 0 {
+		return fmt.Errorf("invalid auto sync interval %v: must not be negative", o.autoSyncInterval)
+	}
+	if o.dialTimeout < 0 || o.keepAliveTime < 0 || o.keepAliveTimeout < 0 {
+		return fmt.Errorf("invalid etcd dial options: timeouts must not be negative")
+	}
+	if o.maxCallSendMsgSize < 0 || o.maxCallRecvMsgSize < 0 {
+		return fmt.Errorf("invalid etcd message size limits: must not be negative")
+	}
+	if o.requestTimeout <= 0 {
+		return fmt.Errorf("invalid request timeout %v: must be positive", o.requestTimeout)
+	}
+	if o.watchDebounce < 0 || o.cacheTTL < 0 {
+		return fmt.Errorf("invalid watch debounce or cache TTL: must not be negative")
+	}
+	if o.leaseMetricsInterval < 0 {
+		return fmt.Errorf("invalid lease metrics interval %v: must not be negative", o.leaseMetricsInterval)
+	}
+	if o.audit.maxRecords < 0 || o.audit.ttl < 0 {
+		return fmt.Errorf("invalid audit retention %d records, %v: must not be negative", o.audit.maxRecords, o.audit.ttl)
+	}
+	if o.audit.maxRecords == 0 && o.audit.ttl == 0 {
+		return fmt.Errorf("invalid audit retention: at least one of max records and ttl must be set")
+	}
+	if o.historySize < 0 {
+		return fmt.Errorf("invalid event history size %d: must not be negative", o.historySize)
+	}
+	if o.failureThreshold < 0 {
+		return fmt.Errorf("invalid failure threshold %v: must not be negative", o.failureThreshold)
+	}
+	if o.logSampleFirst < 0 || o.logSampleInterval < 0 {
+		return fmt.Errorf("invalid log sampling %d per %v: must not be negative", o.logSampleFirst, o.logSampleInterval)
+	}
+	if (o.logSampleFirst > 0) != (o.logSampleInterval > 0) {
+		return fmt.Errorf("invalid log sampling %d per %v: first and interval must be set together", o.logSampleFirst, o.logSampleInterval)
+	}
+	if o.slowOpThreshold < 0 {
+		return fmt.Errorf("invalid slow op threshold %v: must not be negative", o.slowOpThreshold)
+	}
+	if o.maxConcurrentOps < 0 {
+		return fmt.Errorf("invalid max concurrent ops %d: must not be negative", o.maxConcurrentOps)
+	}
+	if o.subsetSize < 0 {
+		return fmt.Errorf("invalid subset size %d: must not be negative", o.subsetSize)
+	}
+	if _, err := withHealthCheckConfig(o.serviceConfig, o.healthCheckServiceName); err != nil {
+		return fmt.Errorf("invalid service config: %v", err)
+	}
+	return nil
+}
+
+// withHealthCheckConfig 向服务配置JSON中加入healthCheckConfig，已存在时保持不变
+func withHealthCheckConfig(serviceConfigJSON, serviceName string) (string, error) {
+	if serviceConfigJSON == "" || serviceName == "" {
+		return serviceConfigJSON, nil
+	}
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(serviceConfigJSON), &config); err != nil {
+		return "", err
+	}
+	if _, ok := config["healthCheckConfig"]; ok {
+		return serviceConfigJSON, nil
+	}
+	healthCheck, err := json.Marshal(map[string]string{"serviceName": serviceName})
+	if err != nil {
+		return "", err
+	}
+	config["healthCheckConfig"] = healthCheck
+	out, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// validateScheme 按RFC 3986校验scheme：ALPHA *( ALPHA / DIGIT / "+" / "-" / "." )
+func validateScheme(scheme string) error {
+	if scheme == "" {
+		return fmt.Errorf("invalid resolver scheme: empty")
+	}
+	for i, c := range scheme {
+		switch {
+		case c >= 'a' && c <= 'z':
+		case i > 0 && (c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return fmt.Errorf("invalid resolver scheme %q: must start with a letter followed by letters, digits, '+', '-' or '.'", scheme)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+// registry/outage_test.go
+package registry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+
+	"github.com/YuanJey/grpc-etcd/etcdtest"
+	"github.com/YuanJey/grpc-etcd/resolvertest"
+)
+
+// isWatchError 匹配etcd不可用时resolver上报的ResolverErrorWatch
+func isWatchError(err error) bool {
+	var resolverErr *ResolverError
+	return errors.As(err, &resolverErr) && resolverErr.Class == ResolverErrorWatch
+}
+
+func TestResolverReportsEtcdDownAtBuild(t *testing.T) {
+	srv := etcdtest.Start(t)
+	service := testService(t)
+	r := newRegistryOn(t, srv, WithRequestTimeout(500*time.Millisecond))
+	other := newRegistryOn(t, srv)
+	mustRegister(t, other, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+
+	srv.Stop()
+	cc, _ := buildResolver(t, r, r.Target(service))
+	if _, err := cc.WaitForError(testContext(t), isWatchError); err != nil {
+		t.Fatalf("build while etcd is down: %v", err)
+	}
+	if state, ok := cc.LastState(); ok {
+		t.Fatalf("pushed state %v before the first successful resolve", state)
+	}
+
+	// etcd恢复后按退避重试成功，无需重新创建resolver
+	if err := srv.Restart(); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	waitAddrs(t, cc, "10.0.0.1:80")
+}
+
+func TestResolverReportsEtcdOutageWhileWatching(t *testing.T) {
+	srv := etcdtest.Start(t)
+	service := testService(t)
+	r := newRegistryOn(t, srv, WithRequestTimeout(500*time.Millisecond))
+	other := newRegistryOn(t, srv)
+	mustRegister(t, other, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+
+	cc, rsv := buildResolver(t, r, r.Target(service))
+	waitAddrs(t, cc, "10.0.0.1:80")
+
+	// watch建立后etcd宕机，watch通道本身不会报错，gRPC按退避调用的ResolveNow必须探测出故障
+	srv.Stop()
+	rsv.ResolveNow(resolver.ResolveNowOptions{})
+	if _, err := cc.WaitForError(testContext(t), isWatchError); err != nil {
+		t.Fatalf("etcd stopped while watching: %v", err)
+	}
+	if r.Healthy() {
+		t.Errorf("health after outage: got healthy")
+	}
+
+	if err := srv.Restart(); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	mustRegister(t, other, &ServiceInfo{Name: service, Address: "10.0.0.2:80"})
+	waitAddrs(t, cc, "10.0.0.1:80", "10.0.0.2:80")
+}
+
+func TestResolveNowWhileHealthyKeepsWatch(t *testing.T) {
+	service := testService(t)
+	r := newTestRegistry(t)
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+
+	cc, rsv := buildResolver(t, r, r.Target(service))
+	waitAddrs(t, cc, "10.0.0.1:80")
+	for range 5 {
+		rsv.ResolveNow(resolver.ResolveNowOptions{})
+	}
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.2:80"})
+	waitAddrs(t, cc, "10.0.0.1:80", "10.0.0.2:80")
+	if errs := cc.Errors(); len(errs) > 0 {
+		t.Errorf("ResolveNow with etcd up reported errors: %v", errs)
+	}
+}
+
+// allStale 匹配地址非空且全部标记为过期的状态
+func allStale(state resolver.State) bool {
+	if len(state.Addresses) == 0 || len(state.Endpoints) != len(state.Addresses) {
+		return false
+	}
+	for i := range state.Addresses {
+		if !IsStaleAddress(state.Addresses[i]) || !IsStaleEndpoint(state.Endpoints[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestResolverKeepsStaleAddressesDuringOutage(t *testing.T) {
+	srv := etcdtest.Start(t)
+	service := testService(t)
+	r := newRegistryOn(t, srv, WithRequestTimeout(500*time.Millisecond))
+	other := newRegistryOn(t, srv)
+	mustRegister(t, other, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+	mustRegister(t, other, &ServiceInfo{Name: service, Address: "10.0.0.2:80"})
+
+	cc, rsv := buildResolver(t, r, r.Target(service))
+	waitAddrs(t, cc, "10.0.0.1:80", "10.0.0.2:80")
+
+	srv.Stop()
+	rsv.ResolveNow(resolver.ResolveNowOptions{})
+	state, err := cc.WaitForState(testContext(t), allStale)
+	if err != nil {
+		last, _ := cc.LastState()
+		t.Fatalf("stale state during outage: last %v: %v", resolvertest.Addrs(last), err)
+	}
+	if got := resolvertest.Addrs(state); !resolvertest.HasAddrs("10.0.0.1:80", "10.0.0.2:80")(state) {
+		t.Errorf("stale addresses: got %v", got)
+	}
+	if _, err := cc.WaitForError(testContext(t), isWatchError); err != nil {
+		t.Fatalf("error alongside stale addresses: %v", err)
+	}
+	// 持续故障期间的重试只上报错误，不推送空列表
+	rsv.ResolveNow(resolver.ResolveNowOptions{})
+	time.Sleep(time.Second)
+	for _, state := range cc.States() {
+		if len(state.Addresses) == 0 {
+			t.Fatalf("empty state pushed during outage, states %d", len(cc.States()))
+		}
+	}
+
+	if err := srv.Restart(); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	if _, err := cc.WaitForState(testContext(t), func(state resolver.State) bool {
+		return len(state.Addresses) == 2 && !IsStaleAddress(state.Addresses[0]) && !IsStaleAddress(state.Addresses[1])
+	}); err != nil {
+		t.Fatalf("fresh state after restart: %v", err)
+	}
+}
+
+func TestResolverPushesEmptyOnlyWhenEtcdSaysZero(t *testing.T) {
+	service := testService(t)
+	r := newTestRegistry(t)
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+
+	cc, _ := buildResolver(t, r, r.Target(service))
+	waitAddrs(t, cc, "10.0.0.1:80")
+	if err := r.Unregister(service, "10.0.0.1:80"); err != nil {
+		t.Fatalf("unregister: %v", err)
+	}
+	waitAddrs(t, cc)
+	if _, err := cc.WaitForError(testContext(t), func(err error) bool {
+		var resolverErr *ResolverError
+		return errors.As(err, &resolverErr) && resolverErr.Class == ResolverErrorNoInstances
+	}); err != nil {
+		t.Fatalf("zero instances error: %v", err)
+	}
+}
+
+func TestDialWhileEtcdDown(t *testing.T) {
+	srv := etcdtest.Start(t)
+	service := testService(t)
+	b := startBackend(t)
+	r := newRegistryOn(t, srv, WithRequestTimeout(500*time.Millisecond))
+	other := newRegistryOn(t, srv)
+
+	// etcd不可用时拨号也会成功，etcd恢复后按退避重试解析，无需重新拨号
+	srv.Stop()
+	client, conn := dialHealth(t, r, service)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+	cancel()
+	if err == nil {
+		t.Fatal("check while etcd is down: got nil error")
+	}
+
+	if err := srv.Restart(); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	mustRegister(t, other, &ServiceInfo{Name: service, Address: b.addr})
+	checkOnce(t, client)
+	if b.calls.Load() == 0 {
+		t.Errorf("backend received no calls through %s", conn.Target())
+	}
+}
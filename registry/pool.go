@@ -0,0 +1,84 @@
+// registry/pool.go
+package registry
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// ClientPool 在多个注册中心实例之间共享etcd客户端，按节点地址和凭据区分
+// 客户端按引用计数管理，最后一个使用它的注册中心关闭时才关闭客户端
+type ClientPool struct {
+	mu      sync.Mutex
+	clients map[string]*pooledClient
+}
+
+type pooledClient struct {
+	client *clientv3.Client
+	refs   int
+}
+
+// NewClientPool 创建etcd客户端池
+func NewClientPool() *ClientPool {
+	return &ClientPool{clients: make(map[string]*pooledClient)}
+}
+
+// Len 当前池中的客户端数量
+func (p *ClientPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.clients)
+}
+
+// acquire 返回与配置匹配的共享客户端，不存在时创建；返回的release用于归还
+func (p *ClientPool) acquire(key string, config clientv3.Config) (*clientv3.Client, func() error, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pc, ok := p.clients[key]
+	if !ok {
+		cli, err := clientv3.New(config)
+		if err != nil {
+			return nil, nil, err
+		}
+		pc = &pooledClient{client: cli}
+		p.clients[key] = pc
+	}
+	pc.refs++
+
+	var once sync.Once
+	release := func() error {
+		var err error
+		once.Do(func() { err = p.release(key, pc) })
+		return err
+	}
+	return pc.client, release, nil
+}
+
+func (p *ClientPool) release(key string, pc *pooledClient) error {
+	p.mu.Lock()
+	pc.refs--
+	if pc.refs > 0 {
+		p.mu.Unlock()
+		return nil
+	}
+	if p.clients[key] == pc {
+		delete(p.clients, key)
+	}
+	p.mu.Unlock()
+	return pc.client.Close()
+}
+
+// poolKey 根据节点地址、凭据和TLS配置生成客户端池的key，密码只参与哈希
+func poolKey(config clientv3.Config, tls tlsOptions) string {
+	endpoints := append([]string(nil), config.Endpoints...)
+	sort.Strings(endpoints)
+	credentials := sha256.Sum256([]byte(config.Username + "\x00" + config.Password))
+	return fmt.Sprintf("%s|%x|%p|%s|%s|%s|%t", strings.Join(endpoints, ","), credentials,
+		tls.config, tls.caFile, tls.certFile, tls.keyFile, tls.insecureSkipVerify)
+}
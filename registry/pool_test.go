@@ -0,0 +1,121 @@
+// registry/pool_test.go
+package registry
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/YuanJey/grpc-etcd/etcdtest"
+)
+
+// newPooledRegistry 通过pool连接endpoints创建注册中心，调用方负责关闭
+func newPooledRegistry(t *testing.T, pool *ClientPool, endpoints []string) *EtcdRegistry {
+	t.Helper()
+	r, err := NewEtcdRegistry(endpoints, testTTL, WithClientPool(pool))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	return r
+}
+
+func TestClientPoolSharesClient(t *testing.T) {
+	pool := NewClientPool()
+	endpoints := sharedEtcd.Endpoints()
+	service := testService(t)
+
+	const n = 5
+	registries := make([]*EtcdRegistry, n)
+	for i := range registries {
+		// 节点顺序不同也使用同一个客户端
+		eps := slices.Clone(endpoints)
+		if i%2 == 1 {
+			slices.Reverse(eps)
+		}
+		registries[i] = newPooledRegistry(t, pool, eps)
+	}
+	if got := pool.Len(); got != 1 {
+		t.Fatalf("pool clients: got %d, want 1", got)
+	}
+	cli := registries[0].client
+	for _, r := range registries[1:] {
+		if r.client != cli {
+			t.Fatal("registries in one pool use different clients")
+		}
+	}
+
+	// 关闭其余注册中心（包括重复关闭）后客户端仍然可用
+	for _, r := range registries[:n-1] {
+		for range 2 {
+			if err := r.Close(); err != nil {
+				t.Fatalf("close: %v", err)
+			}
+		}
+	}
+	if got := pool.Len(); got != 1 {
+		t.Fatalf("pool clients with one registry left: got %d, want 1", got)
+	}
+	last := registries[n-1]
+	mustRegister(t, last, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+	if _, err := last.Discover(service); err != nil {
+		t.Fatalf("discover on the last registry: %v", err)
+	}
+
+	// 最后一个注册中心关闭时关闭客户端
+	if err := last.Close(); err != nil {
+		t.Fatalf("close last: %v", err)
+	}
+	if got := pool.Len(); got != 0 {
+		t.Errorf("pool clients after the last close: got %d, want 0", got)
+	}
+	if _, err := cli.Get(testContext(t), "health"); err == nil {
+		t.Error("pooled client still usable after the last close")
+	}
+
+	// 池清空后再次获取时创建新客户端
+	r := newPooledRegistry(t, pool, endpoints)
+	defer r.Close()
+	if r.client == cli {
+		t.Error("closed client handed out again")
+	}
+}
+
+func TestClientPoolSeparatesClusters(t *testing.T) {
+	pool := NewClientPool()
+	other := etcdtest.Start(t)
+	a := newPooledRegistry(t, pool, sharedEtcd.Endpoints())
+	defer a.Close()
+	b := newPooledRegistry(t, pool, other.Endpoints())
+	defer b.Close()
+	if got := pool.Len(); got != 2 || a.client == b.client {
+		t.Errorf("different endpoints: pool clients %d, shared %v", got, a.client == b.client)
+	}
+}
+
+func TestPoolKey(t *testing.T) {
+	base := clientv3.Config{Endpoints: []string{"a:2379", "b:2379"}, Username: "u", Password: "p"}
+	key := poolKey(base, tlsOptions{})
+	reordered := base
+	reordered.Endpoints = []string{"b:2379", "a:2379"}
+	if poolKey(reordered, tlsOptions{}) != key {
+		t.Error("endpoint order changed the pool key")
+	}
+	for name, config := range map[string]clientv3.Config{
+		"password":  {Endpoints: base.Endpoints, Username: "u", Password: "other"},
+		"username":  {Endpoints: base.Endpoints, Username: "v", Password: "p"},
+		"endpoints": {Endpoints: []string{"a:2379"}, Username: "u", Password: "p"},
+	} {
+		if poolKey(config, tlsOptions{}) == key {
+			t.Errorf("different %s produced the same pool key", name)
+		}
+	}
+	if poolKey(base, tlsOptions{caFile: "ca.pem"}) == key {
+		t.Error("different TLS files produced the same pool key")
+	}
+	// 密码只参与哈希，不会以明文出现在key中
+	if secret := poolKey(clientv3.Config{Password: "hunter2"}, tlsOptions{}); strings.Contains(secret, "hunter2") {
+		t.Errorf("pool key contains the password: %s", secret)
+	}
+}
@@ -0,0 +1,96 @@
+// registry/ports.go
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// verifyDialTimeout 校验端口监听时单次连接的超时
+const verifyDialTimeout = time.Second
+
+// PortOption RegisterPorts的配置项
+type PortOption func(*portOptions)
+
+type portOptions struct {
+	verifyListening bool
+}
+
+// WithVerifyListening 注册前连接host上的每个端口，连接失败的端口不注册，记录在PortRegistration.Skipped中
+func WithVerifyListening() PortOption {
+	return func(o *portOptions) {
+		o.verifyListening = true
+	}
+}
+
+// PortRegistration RegisterPorts注册的一组实例
+type PortRegistration struct {
+	registry *EtcdRegistry
+	// Services 注册的实例，按端口顺序
+	Services []*ServiceInfo
+	// Skipped 开启WithVerifyListening时未监听而跳过的端口及原因
+	Skipped map[int]error
+}
+
+// Unregister 在一个事务中注销全部实例，见UnregisterServices
+func (p *PortRegistration) Unregister(ctx context.Context) error {
+	return p.registry.UnregisterServices(ctx, p.Services)
+}
+
+// RegisterPorts 为serviceName在host的每个端口注册一个实例，所有实例共享同一个租约，见RegisterServices
+// 端口通常来自配置中的端口列表，例如config.Conf.RpcPort.GatewayPort；
+// 开启WithVerifyListening时跳过无法连接的端口并记录日志，全部端口都被跳过时返回错误
+func RegisterPorts(ctx context.Context, reg *EtcdRegistry, serviceName, host string, ports []int, version string, opts ...PortOption) (*PortRegistration, error) {
+	o := &portOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if len(ports) == 0 {
+		return nil, wrapError("register", serviceName, host, fmt.Errorf("%w: no ports", ErrInvalidService))
+	}
+
+	p := &PortRegistration{registry: reg, Skipped: make(map[int]error)}
+	seen := make(map[int]bool, len(ports))
+	for _, port := range ports {
+		if seen[port] {
+			return nil, wrapError("register", serviceName, host, fmt.Errorf("%w: duplicate port %d", ErrInvalidService, port))
+		}
+		seen[port] = true
+		address := net.JoinHostPort(host, strconv.Itoa(port))
+		if o.verifyListening {
+			if err := verifyListening(ctx, address); err != nil {
+				reg.opts.logger.Warn("port not listening, skipping registration", "service", serviceName, "address", address, "error", err)
+				p.Skipped[port] = err
+				continue
+			}
+		}
+		p.Services = append(p.Services, &ServiceInfo{Name: serviceName, Address: address, Version: version})
+	}
+	if len(p.Services) == 0 {
+		errs := make([]error, 0, len(p.Skipped))
+		for _, port := range ports {
+			errs = append(errs, fmt.Errorf("port %d: %w", port, p.Skipped[port]))
+		}
+		return nil, wrapError("register", serviceName, host, fmt.Errorf("no port is listening: %w", errors.Join(errs...)))
+	}
+	if err := reg.RegisterServices(ctx, p.Services); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// verifyListening 连接address确认有进程在监听
+func verifyListening(ctx context.Context, address string) error {
+	ctx, cancel := context.WithTimeout(ctx, verifyDialTimeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
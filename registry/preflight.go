@@ -0,0 +1,105 @@
+// registry/preflight.go
+package registry
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// preflightPrefix 权限预检使用的探测key前缀，位于服务实例前缀下以匹配按前缀授权的角色
+const preflightPrefix = "/services/.preflight/"
+
+// PreflightError 权限预检失败，列出所有缺失的权限
+type PreflightError struct {
+	// Failures 按检查项记录的错误，检查项为lease grant、put、delete、lease revoke
+	Failures map[string]error
+}
+
+func (e *PreflightError) Error() string {
+	checks := make([]string, 0, len(e.Failures))
+	for _, check := range preflightChecks {
+		if err, ok := e.Failures[check]; ok {
+			checks = append(checks, fmt.Sprintf("%s: %v", check, err))
+		}
+	}
+	return "registry preflight failed, missing etcd permissions: " + strings.Join(checks, "; ")
+}
+
+// Unwrap 返回所有检查项的错误
+func (e *PreflightError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failures))
+	for _, check := range preflightChecks {
+		if err, ok := e.Failures[check]; ok {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// 预检的检查项
+const (
+	checkLeaseGrant  = "lease grant"
+	checkPut         = "put"
+	checkDelete      = "delete"
+	checkLeaseRevoke = "lease revoke"
+)
+
+var preflightChecks = []string{checkLeaseGrant, checkPut, checkDelete, checkLeaseRevoke}
+
+// runPreflight 执行创建时的检查（集群版本和权限预检），失败时关闭注册中心
+func (r *EtcdRegistry) runPreflight() error {
+	if err := r.checkServerVersion(); err != nil {
+		r.Close()
+		return err
+	}
+	if r.opts.skipPreflight {
+		return nil
+	}
+	if err := r.preflight(); err != nil {
+		r.Close()
+		return err
+	}
+	return nil
+}
+
+// preflight 确认当前凭据可以创建和撤销租约、写入和删除服务key，
+// 避免只读凭据直到第一次注册时才暴露问题；探测key按进程区分，检查结束后删除
+func (r *EtcdRegistry) preflight() error {
+	ctx, cancel := context.WithTimeout(r.ctx, r.opts.requestTimeout)
+	defer cancel()
+
+	key := fmt.Sprintf("%s%s-%d-%x", preflightPrefix, r.opts.clientID, os.Getpid(), rand.Uint32())
+	failures := make(map[string]error)
+
+	grant, err := r.lease.Grant(ctx, 5)
+	if err != nil {
+		failures[checkLeaseGrant] = err
+	}
+
+	var putOpts []clientv3.OpOption
+	if grant != nil {
+		// 删除失败时探测key随租约过期
+		putOpts = append(putOpts, clientv3.WithLease(grant.ID))
+	}
+	if _, err := r.kv.Put(ctx, key, "preflight", putOpts...); err != nil {
+		failures[checkPut] = fmt.Errorf("%s: %w", key, err)
+	} else if _, err := r.kv.Delete(ctx, key); err != nil {
+		failures[checkDelete] = fmt.Errorf("%s: %w", key, err)
+	}
+
+	if grant != nil {
+		if _, err := r.lease.Revoke(ctx, grant.ID); err != nil {
+			failures[checkLeaseRevoke] = err
+		}
+	}
+
+	if len(failures) > 0 {
+		return &PreflightError{Failures: failures}
+	}
+	return nil
+}
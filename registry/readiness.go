@@ -0,0 +1,138 @@
+// registry/readiness.go
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+)
+
+// 注册实例未就绪的原因
+const (
+	// ReadinessClosed 注册中心已关闭
+	ReadinessClosed = "registry closed"
+	// ReadinessNotRegistered 列出的服务没有通过本注册中心注册任何实例
+	ReadinessNotRegistered = "not registered"
+	// ReadinessRegistering 注册尚未完成，key和心跳尚未建立
+	ReadinessRegistering = "registering"
+	// ReadinessKeepAliveFailing 心跳失败或租约已丢失，正在重新注册
+	ReadinessKeepAliveFailing = "keepalive failing"
+	// ReadinessHeartbeatStale 最近一次心跳成功距今已超过TTL，租约可能已经过期
+	ReadinessHeartbeatStale = "heartbeat stale"
+	// ReadinessNotUp 实例状态为draining或down，不接收流量
+	ReadinessNotUp = "status not up"
+)
+
+// ReadinessState 注册实例的就绪状态，ReadinessHandler以JSON输出
+type ReadinessState struct {
+	Ready bool `json:"ready"`
+	// Reason 注册中心整体未就绪的原因，例如ReadinessClosed
+	Reason        string              `json:"reason,omitempty"`
+	Registrations []RegistrationCheck `json:"registrations"`
+}
+
+// RegistrationCheck 单个服务或注册实例的就绪检查结果
+type RegistrationCheck struct {
+	Service string `json:"service"`
+	// Address 和Key 服务没有任何注册实例时为空
+	Address string `json:"address,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Ready   bool   `json:"ready"`
+	// Reason 未就绪的原因，取值见ReadinessNotRegistered等；Detail 补充说明
+	Reason        string    `json:"reason,omitempty"`
+	Detail        string    `json:"detail,omitempty"`
+	LastKeepAlive time.Time `json:"lastKeepAlive"`
+}
+
+// Readiness 根据注册记录和心跳状态判断services的注册实例是否全部就绪，只读取内存中的状态，不访问etcd
+// 列出的每个服务至少要有一个注册实例，且每个实例都已写入key、心跳正常、最近一次心跳在TTL之内、状态为up；
+// services为空时检查全部注册实例，没有任何注册实例时未就绪
+func (r *EtcdRegistry) Readiness(services ...string) ReadinessState {
+	now := time.Now()
+	ttl := time.Duration(r.ttl) * time.Second
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ReadinessState{Reason: ReadinessClosed, Registrations: []RegistrationCheck{}}
+	}
+	checks := make([]RegistrationCheck, 0, len(r.registrations))
+	registered := make(map[string]bool)
+	for _, reg := range r.registrations {
+		if len(services) > 0 && !slices.Contains(services, reg.info.Name) {
+			continue
+		}
+		registered[reg.info.Name] = true
+		checks = append(checks, checkRegistration(reg, now, ttl))
+	}
+	r.mu.Unlock()
+
+	for _, service := range services {
+		if !registered[service] {
+			checks = append(checks, RegistrationCheck{Service: service, Reason: ReadinessNotRegistered})
+		}
+	}
+	sort.Slice(checks, func(i, j int) bool {
+		if checks[i].Service != checks[j].Service {
+			return checks[i].Service < checks[j].Service
+		}
+		return checks[i].Address < checks[j].Address
+	})
+
+	state := ReadinessState{Ready: len(checks) > 0, Registrations: checks}
+	if len(checks) == 0 {
+		state.Reason = ReadinessNotRegistered
+	}
+	for _, check := range checks {
+		state.Ready = state.Ready && check.Ready
+	}
+	return state
+}
+
+// checkRegistration 检查单个注册实例，调用方需持有r.mu
+func checkRegistration(reg *registration, now time.Time, ttl time.Duration) RegistrationCheck {
+	check := RegistrationCheck{
+		Service:       reg.info.Name,
+		Address:       reg.info.Address,
+		Key:           reg.key,
+		LastKeepAlive: reg.lastKeepAlive,
+	}
+	switch {
+	case reg.leaseID == 0:
+		check.Reason = ReadinessRegistering
+	case reg.failing:
+		check.Reason = ReadinessKeepAliveFailing
+		if !reg.lastInterruption.IsZero() {
+			check.Detail = fmt.Sprintf("interrupted %s ago: %s",
+				now.Sub(reg.lastInterruption).Round(time.Second), reg.interruptionReason)
+		}
+	case now.Sub(reg.lastKeepAlive) > ttl:
+		check.Reason = ReadinessHeartbeatStale
+		check.Detail = fmt.Sprintf("last keepalive %s ago exceeds TTL %s", now.Sub(reg.lastKeepAlive).Round(time.Second), ttl)
+	case !reg.info.IsUp():
+		check.Reason = ReadinessNotUp
+		check.Detail = "status " + reg.info.Status
+	default:
+		check.Ready = true
+	}
+	return check
+}
+
+// ReadinessHandler 返回Kubernetes就绪探针使用的http.Handler，services的注册实例全部就绪时返回200，否则返回503，
+// 响应体均为ReadinessState的JSON，列出每个注册实例是否就绪及原因；判断规则见Readiness，探针不会访问etcd
+func ReadinessHandler(r *EtcdRegistry, services ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		state := r.Readiness(services...)
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Type", "application/json")
+		if state.Ready {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(state)
+	})
+}
@@ -0,0 +1,127 @@
+// registry/refresh.go
+package registry
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// forceRefreshInterval 同一服务两次强制刷新之间的最小间隔
+const forceRefreshInterval = 5 * time.Second
+
+// ErrRefreshRateLimited 距上次强制刷新时间过短
+var ErrRefreshRateLimited = errors.New("force refresh rate limited")
+
+// ForceRefresh 绕过watch缓存直接从etcd全量拉取服务实例并重建watch，
+// 用于watch疑似卡死但Discover正常的情况；同一服务5秒内最多执行一次
+// 当前进程没有监听该服务时不做任何事
+func (r *EtcdRegistry) ForceRefresh(serviceName string) error {
+	return r.forceRefresh(servicePrefix(serviceName))
+}
+
+// forceRefresh 强制刷新指定key前缀下的服务实例
+func (r *EtcdRegistry) forceRefresh(prefix string) error {
+	if !r.hub.forceRefresh(prefix, forceRefreshInterval) && r.hub.watching(prefix) {
+		return ErrRefreshRateLimited
+	}
+	return nil
+}
+
+// RefreshOnUnavailableUnaryInterceptor 在window时间内出现threshold次Unavailable错误时，
+// 对该连接的目标服务调用ForceRefresh；服务名从ClientConn的target解析
+func (r *EtcdRegistry) RefreshOnUnavailableUnaryInterceptor(threshold int, window time.Duration) grpc.UnaryClientInterceptor {
+	detector := newUnavailableDetector(r, threshold, window)
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		detector.observe(cc.Target(), err)
+		return err
+	}
+}
+
+// RefreshOnUnavailableStreamInterceptor 流式调用版本的RefreshOnUnavailableUnaryInterceptor，
+// 只统计建立流时的错误
+func (r *EtcdRegistry) RefreshOnUnavailableStreamInterceptor(threshold int, window time.Duration) grpc.StreamClientInterceptor {
+	detector := newUnavailableDetector(r, threshold, window)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		detector.observe(cc.Target(), err)
+		return stream, err
+	}
+}
+
+// unavailableDetector 按服务key前缀统计滑动窗口内的Unavailable错误
+type unavailableDetector struct {
+	registry  *EtcdRegistry
+	threshold int
+	window    time.Duration
+
+	mu       sync.Mutex
+	failures map[string][]time.Time
+}
+
+func newUnavailableDetector(r *EtcdRegistry, threshold int, window time.Duration) *unavailableDetector {
+	if threshold <= 0 {
+		threshold = 1
+	}
+	return &unavailableDetector{
+		registry:  r,
+		threshold: threshold,
+		window:    window,
+		failures:  make(map[string][]time.Time),
+	}
+}
+
+func (d *unavailableDetector) observe(target string, err error) {
+	if status.Code(err) != codes.Unavailable {
+		return
+	}
+	prefix, ok := d.servicePrefix(target)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	d.mu.Lock()
+	recent := d.failures[prefix][:0]
+	for _, t := range d.failures[prefix] {
+		if now.Sub(t) < d.window {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+	trigger := len(recent) >= d.threshold
+	if trigger {
+		recent = recent[:0]
+	}
+	d.failures[prefix] = recent
+	d.mu.Unlock()
+
+	if trigger {
+		d.registry.forceRefresh(prefix)
+	}
+}
+
+// servicePrefix 从target中解析服务实例的key前缀，target不属于本注册中心时返回false
+func (d *unavailableDetector) servicePrefix(target string) (string, bool) {
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme != d.registry.Scheme() {
+		return "", false
+	}
+	name := strings.TrimPrefix(u.Path, "/")
+	if name == "" {
+		name = u.Opaque
+	}
+	keyPrefix, err := d.registry.authorityPrefix(u.Host)
+	if err != nil || name == "" {
+		return "", false
+	}
+	return keyPrefix + servicePrefix(name), true
+}
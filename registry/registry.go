@@ -3,12 +3,18 @@ package registry
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	clientv3 "go.etcd.io/etcd/client/v3"
-	"google.golang.org/grpc/resolver"
+	"go.etcd.io/etcd/client/v3/namespace"
+	"google.golang.org/grpc"
 )
 
 // ServiceInfo 服务信息结构体
@@ -16,198 +22,882 @@ type ServiceInfo struct {
 	Name    string `json:"name"`
 	Address string `json:"address"`
 	Version string `json:"version"`
+	// Addresses 同一实例的其他可达地址（例如双栈主机的IPv6地址），Address为首选地址
+	Addresses []string `json:"addresses,omitempty"`
+	// Weight 负载均衡权重，0表示默认权重
+	Weight int `json:"weight,omitempty"`
+	// Zone 实例所在可用区
+	Zone string `json:"zone,omitempty"`
+	// ServerName TLS校验使用的服务端名称
+	ServerName string `json:"serverName,omitempty"`
+	// Env 实例所属环境
+	Env string `json:"env,omitempty"`
+	// Tags 实例标签
+	Tags []string `json:"tags,omitempty"`
+	// Metadata 自定义元数据，开启WithRegisteredBy时包含写入方的MetadataRegisteredBy
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Status 注册状态，非up状态的实例不会被resolver推送，为空表示up
+	Status string `json:"status,omitempty"`
+	// RegisteredAt和DeregisteredAt 开启WithVisibilityTracking时注册中心写入的注册和注销Unix毫秒时间，
+	// 读取方据此统计变更对客户端可见的延迟，不参与Equal比较
+	RegisteredAt   int64 `json:"registeredAt,omitempty"`
+	DeregisteredAt int64 `json:"deregisteredAt,omitempty"`
+}
+
+// Equal 比较两个服务信息是否相同，供resolver.Address属性比较使用
+// 注册中心写入的RegisteredAt、DeregisteredAt和元数据MetadataRegisteredBy不参与比较，
+// 同一实例由不同进程重新注册时不会引起resolver推送
+func (s *ServiceInfo) Equal(o any) bool {
+	other, ok := o.(*ServiceInfo)
+	if !ok {
+		return false
+	}
+	if s == nil || other == nil {
+		return s == other
+	}
+	if s.Name != other.Name || s.Address != other.Address || s.Version != other.Version ||
+		s.Weight != other.Weight || s.Zone != other.Zone || s.ServerName != other.ServerName ||
+		s.Env != other.Env || s.Status != other.Status || len(s.Tags) != len(other.Tags) ||
+		comparableMetadataLen(s.Metadata) != comparableMetadataLen(other.Metadata) ||
+		len(s.Addresses) != len(other.Addresses) {
+		return false
+	}
+	for i := range s.Addresses {
+		if s.Addresses[i] != other.Addresses[i] {
+			return false
+		}
+	}
+	for i := range s.Tags {
+		if s.Tags[i] != other.Tags[i] {
+			return false
+		}
+	}
+	for k, v := range s.Metadata {
+		if k == MetadataRegisteredBy {
+			continue
+		}
+		if ov, ok := other.Metadata[k]; !ok || ov != v {
+			return false
+		}
+	}
+	return true
+}
+
+// comparableMetadataLen 返回参与Equal比较的元数据个数
+func comparableMetadataLen(metadata map[string]string) int {
+	if _, ok := metadata[MetadataRegisteredBy]; ok {
+		return len(metadata) - 1
+	}
+	return len(metadata)
 }
 
 // EtcdRegistry etcd注册中心结构体
+// 所有导出方法都可以在多个goroutine中并发调用，Close可以重复调用；
+// Watch回调和resolver推送都不在注册中心内部锁内执行，回调中可以再次调用注册中心的方法
 type EtcdRegistry struct {
 	client *clientv3.Client
-	lease  clientv3.Lease
-	ttl    int64
-	kv     clientv3.KV
-	ctx    context.Context
-	cancel context.CancelFunc
+	// ownsClient Close时是否关闭client
+	ownsClient bool
+	// release 从客户端池获取client时用于归还
+	release   func() error
+	closeOnce sync.Once
+	lease     clientv3.Lease
+	ttl       int64
+	kv        clientv3.KV
+	// watcher 所有watch都通过它建立，配置命名空间时会自动加上前缀
+	watcher clientv3.Watcher
+	ctx     context.Context
+	cancel  context.CancelFunc
+	hub     *watchHub
+	opts    *options
+
+	mu sync.Mutex
+	// registrations 通过本注册中心注册的实例，按key索引
+	registrations map[string]*registration
+	health        healthState
+	// closed 关闭后不再接受新的请求，由mu保护
+	closed bool
+	// inflight 进行中的同步请求
+	inflight      sync.WaitGroup
+	inflightCount atomic.Int64
+	// codec 注册信息的序列化和加密
+	codec *codec
+	// auth WithAuth配置的凭据，未配置时为nil
+	auth *authenticator
+	// limiter WithMaxConcurrentOps配置的并发限制，未配置时为nil
+	limiter *limiter
+	// latency etcd请求耗时统计
+	latency *opLatency
+	// cache Discover结果缓存
+	cache *discoverCache
+	// errorCounts 后台错误计数，见Stats
+	errorCounts errorCounters
+	// recentErrors 最近的后台错误
+	recentErrors recentErrors
+	// history 最近的推送、watch和租约事件，见WithEventHistory
+	history *eventHistory
+	// errs 持续性后台错误通道，见Errors
+	errs *errorChannel
 }
 
 // NewEtcdRegistry 创建etcd注册中心实例
-func NewEtcdRegistry(endpoints []string, ttl int64) (*EtcdRegistry, error) {
-	cli, err := clientv3.New(clientv3.Config{
-		Endpoints:   endpoints,
-		DialTimeout: 5 * time.Second,
-	})
+func NewEtcdRegistry(endpoints []string, ttl int64, opts ...Option) (*EtcdRegistry, error) {
+	return NewEtcdRegistryWithConfig(clientv3.Config{Endpoints: endpoints}, ttl, opts...)
+}
+
+// NewEtcdRegistryWithConfig 使用完整的etcd客户端配置创建注册中心实例
+// 配置中未设置的字段（例如DialTimeout、TLS）使用配置项中的值或默认值，已设置的字段原样使用
+func NewEtcdRegistryWithConfig(config clientv3.Config, ttl int64, opts ...Option) (*EtcdRegistry, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.fillClientConfig(&config); err != nil {
+		return nil, err
+	}
+	dnsEndpoints := config.Endpoints
+	if hasDNSEndpoints(dnsEndpoints) {
+		ctx, cancel := context.WithTimeout(context.Background(), o.requestTimeout)
+		config.Endpoints, err = resolveEndpoints(ctx, dnsEndpoints, config.TLS != nil)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+	}
+	var auth *authenticator
+	if o.username != "" && config.Username == "" {
+		if o.pool != nil {
+			// 共享客户端的凭据不能单独替换，交给clientv3管理
+			config.Username, config.Password = o.username, o.password
+		} else {
+			auth = newAuthenticator(o.username, o.password)
+			config.DialOptions = append(config.DialOptions,
+				grpc.WithPerRPCCredentials(auth), grpc.WithChainUnaryInterceptor(auth.unaryInterceptor))
+		}
+	}
+	var registry *EtcdRegistry
+	if o.pool != nil {
+		cli, release, err := o.pool.acquire(poolKey(config, o.tls), config)
+		if err != nil {
+			return nil, err
+		}
+		registry = newEtcdRegistry(cli, ttl, o, false)
+		registry.release = release
+	} else {
+		cli, err := clientv3.New(config)
+		if err != nil {
+			return nil, err
+		}
+		registry = newEtcdRegistry(cli, ttl, o, true)
+	}
+	if auth != nil {
+		auth.auth = registry.client.Auth
+		registry.auth = auth
+		ctx, cancel := context.WithTimeout(registry.ctx, o.requestTimeout)
+		err := auth.refresh(ctx)
+		cancel()
+		if err != nil {
+			registry.Close()
+			return nil, wrapError("authenticate", "", "", fmt.Errorf("as %q: %w", o.username, err))
+		}
+	}
+	if err := registry.runPreflight(); err != nil {
+		return nil, err
+	}
+	if hasDNSEndpoints(dnsEndpoints) && config.AutoSyncInterval > 0 {
+		goLabeled(goroutineLabels(LabelOpDNSSync), func() {
+			registry.syncDNSEndpoints(dnsEndpoints, config.TLS != nil, config.AutoSyncInterval)
+		})
+	}
+	return registry, nil
+}
+
+// NewEtcdRegistryWithClient 复用已有的etcd客户端创建注册中心实例
+// 默认Close不会关闭该客户端，客户端由调用方负责关闭；使用WithClientOwnership时由注册中心关闭
+// 连接相关的配置项（TLS、认证、超时等）对已有客户端不生效
+func NewEtcdRegistryWithClient(cli *clientv3.Client, ttl int64, opts ...Option) (*EtcdRegistry, error) {
+	if cli == nil {
+		return nil, fmt.Errorf("etcd client must not be nil")
+	}
+	o, err := newOptions(opts)
 	if err != nil {
 		return nil, err
 	}
+	registry := newEtcdRegistry(cli, ttl, o, o.ownsClient)
+	if err := registry.runPreflight(); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
 
+// newOptions 应用并校验配置项
+func newOptions(opts []Option) (*options, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	// validate已经校验过服务配置JSON
+	o.serviceConfig, _ = withHealthCheckConfig(o.serviceConfig, o.healthCheckServiceName)
+	if o.clientID == "" {
+		o.clientID, _ = os.Hostname()
+	}
+	o.identity = newIdentity(o.instanceName)
+	o.logger = &identityLogger{logger: o.logger, identity: o.identity.String()}
+	if _, noop := o.metrics.(noopMetrics); !noop {
+		o.metrics = &identityMetrics{metrics: o.metrics, identity: o.identity.String()}
+	}
+	if o.logSampleInterval > 0 {
+		o.logger = newSampledLogger(o.logger, o.logSampleFirst, o.logSampleInterval, o.logSampleWarn)
+	}
+	if o.auditEnabled && o.audit.actor == "" {
+		o.audit.actor = o.identity.String()
+	}
+	return o, nil
+}
+
+func newEtcdRegistry(cli *clientv3.Client, ttl int64, o *options, ownsClient bool) *EtcdRegistry {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	registry := &EtcdRegistry{
-		client: cli,
-		lease:  clientv3.NewLease(cli),
-		ttl:    ttl,
-		kv:     clientv3.NewKV(cli),
-		ctx:    ctx,
-		cancel: cancel,
+		client:     cli,
+		ownsClient: ownsClient,
+		lease:      clientv3.NewLease(cli),
+		ttl:        ttl,
+		kv:         clientv3.NewKV(cli),
+		watcher:    clientv3.NewWatcher(cli),
+		ctx:        ctx,
+		cancel:     cancel,
+		opts:       o,
+
+		registrations: make(map[string]*registration),
 	}
-
-	return registry, nil
+	// validate已经校验过密钥
+	registry.codec, _ = newCodec(o.encryptionKey)
+	registry.history = newEventHistory(o.historySize)
+	// 耗时在命名空间和并发限制之内记录，日志中的key包含命名空间前缀，耗时不包括排队等待
+	registry.latency = newOpLatency(o)
+	registry.kv = &timedKV{KV: registry.kv, latency: registry.latency}
+	registry.lease = &timedLease{Lease: registry.lease, latency: registry.latency}
+	if o.namespace != "" {
+		// 注册中心读写的所有key都透明地加上命名空间前缀，便于按前缀授权
+		registry.kv = namespace.NewKV(registry.kv, o.namespace)
+		registry.lease = namespace.NewLease(registry.lease, o.namespace)
+		registry.watcher = namespace.NewWatcher(registry.watcher, o.namespace)
+	}
+	if o.maxConcurrentOps > 0 {
+		registry.limiter = newLimiter(o.maxConcurrentOps, o.metrics)
+		registry.kv = &limitedKV{KV: registry.kv, limiter: registry.limiter}
+		registry.lease = &limitedLease{Lease: registry.lease, limiter: registry.limiter}
+	}
+	registry.errs = newErrorChannel(errorChannelSize)
+	registry.health.threshold = o.failureThreshold
+	registry.health.onUnreachable = func(since time.Time, err error) {
+		registry.opts.logger.Error("etcd unreachable", "since", since, "error", err)
+		registry.errs.send(RegistryError{Kind: ErrorEtcdUnreachable, Err: err, Since: since})
+	}
+	registry.cache = newDiscoverCache(o.cacheTTL)
+	registry.hub = newWatchHub(registry)
+	registry.checkTTL()
+	if sampled, ok := o.logger.(*sampledLogger); ok {
+		goLabeled(goroutineLabels(LabelOpLogSampling), func() { sampled.run(ctx) })
+	}
+	if _, noop := o.metrics.(noopMetrics); !noop && o.leaseMetricsInterval > 0 {
+		goLabeled(goroutineLabels(LabelOpLeaseMetrics), func() { registry.sampleLeases(o.leaseMetricsInterval) })
+	}
+	return registry
 }
 
 // Register 注册服务
 func (r *EtcdRegistry) Register(serviceName, address, version string) error {
-	serviceInfo := &ServiceInfo{
+	return r.RegisterService(&ServiceInfo{
 		Name:    serviceName,
 		Address: address,
 		Version: version,
-	}
+	})
+}
+
+// RegisterService 使用完整的服务信息注册服务
+// 同一实例重复注册返回ErrAlreadyRegistered，地址格式错误返回ErrInvalidAddress，
+// 其他字段不合法时返回ErrInvalidService，规则见ServiceInfo.Validate
+func (r *EtcdRegistry) RegisterService(serviceInfo *ServiceInfo) error {
+	return r.RegisterServiceContext(context.Background(), serviceInfo)
+}
 
-	value, err := json.Marshal(serviceInfo)
+// RegisterServiceContext 同RegisterService，ctx用于取消注册请求和链路追踪，注册成功后心跳不受ctx影响
+func (r *EtcdRegistry) RegisterServiceContext(ctx context.Context, serviceInfo *ServiceInfo) (err error) {
+	key := serviceKey(serviceInfo.Name, serviceInfo.Address)
+	ctx, span := r.startSpan(ctx, SpanRegister)
+	span.SetAttributes("service", serviceInfo.Name, "address", serviceInfo.Address, "key", key)
+	defer func() { span.End(err) }()
+	opCtx, cancelOp := r.opContext(ctx)
+	defer cancelOp()
+
+	if err := serviceInfo.Validate(); err != nil {
+		return wrapError("register", serviceInfo.Name, serviceInfo.Address, err)
+	}
+	value, err := r.encodeStamped(serviceInfo, time.Now(), time.Time{})
 	if err != nil {
-		return err
+		return wrapError("register", serviceInfo.Name, serviceInfo.Address, err)
 	}
 
+	r.mu.Lock()
+	if _, ok := r.registrations[key]; ok {
+		r.mu.Unlock()
+		return newError("register", serviceInfo.Name, serviceInfo.Address, ErrAlreadyRegistered)
+	}
+	// 先占位，避免并发注册同一实例
+	reg := &registration{key: key, info: serviceInfo, traceCtx: ctx}
+	r.registrations[key] = reg
+	r.reportRegistrationsLocked(serviceInfo.Name)
+	r.mu.Unlock()
+
 	// 创建租约
-	grantResp, err := r.lease.Grant(r.ctx, r.ttl)
-	if err != nil {
+	var grantResp *clientv3.LeaseGrantResponse
+	err = r.retry(opCtx, "grant", serviceInfo.Name, func(ctx context.Context) (err error) {
+		grantResp, err = r.lease.Grant(ctx, r.ttl)
 		return err
+	})
+	if err != nil {
+		r.removeRegistration(reg)
+		return wrapError("register", serviceInfo.Name, serviceInfo.Address, err)
 	}
 
-	key := fmt.Sprintf("/services/%s/%s", serviceName, address)
-
 	// 注册服务，带租约
-	_, err = r.kv.Put(r.ctx, key, string(value), clientv3.WithLease(grantResp.ID))
-	if err != nil {
+	err = r.retry(opCtx, "register", serviceInfo.Name, func(ctx context.Context) error {
+		_, err := r.kv.Put(ctx, key, value, clientv3.WithLease(grantResp.ID))
 		return err
+	})
+	if err != nil {
+		r.removeRegistration(reg)
+		return wrapError("register", serviceInfo.Name, serviceInfo.Address, err)
 	}
 
-	// 启动心跳保持租约
-	go r.keepAlive(grantResp.ID, key, string(value))
+	// 启动心跳保持租约，注销时停止；启动失败直接返回给调用方
+	keepAliveCtx, cancel := context.WithCancel(r.ctx)
+	keepAliveChan, err := r.lease.KeepAlive(keepAliveCtx, grantResp.ID)
+	if err != nil {
+		cancel()
+		r.removeRegistration(reg)
+		r.lease.Revoke(r.ctx, grantResp.ID)
+		r.opts.logger.Error("start keepalive failed",
+			"service", serviceInfo.Name, "address", serviceInfo.Address, "key", key, "error", err)
+		return wrapError("keepalive", serviceInfo.Name, serviceInfo.Address, err)
+	}
+	r.mu.Lock()
+	if r.registrations[key] != reg {
+		// 注册过程中被Unregister或Close移除，撤销租约以删除刚写入的key
+		closed := r.closed
+		r.mu.Unlock()
+		cancel()
+		r.lease.Revoke(r.ctx, grantResp.ID)
+		if closed {
+			return wrapError("register", serviceInfo.Name, serviceInfo.Address, ErrRegistryClosed)
+		}
+		return newError("register", serviceInfo.Name, serviceInfo.Address, ErrNotRegistered)
+	}
+	reg.leaseID = grantResp.ID
+	reg.cancel = cancel
+	reg.lastKeepAlive = time.Now()
+	r.mu.Unlock()
+	goLabeled(goroutineLabels(LabelOpKeepAlive, "service", serviceInfo.Name, "address", serviceInfo.Address), func() {
+		r.keepAlive(keepAliveCtx, reg, keepAliveChan)
+	})
 
+	span.SetAttributes("lease", int64(grantResp.ID))
+	r.opts.logger.Info("service registered",
+		"service", serviceInfo.Name, "address", serviceInfo.Address, "key", key, "lease", int64(grantResp.ID))
+	r.writeAudit(opCtx, AuditRegister, serviceInfo)
+	r.fireRegister(r.registrationInfo(reg))
 	return nil
 }
 
-// keepAlive 保持租约活跃
-func (r *EtcdRegistry) keepAlive(leaseID clientv3.LeaseID, key, value string) {
-	// 启动keepalive
-	keepAliveChan, err := r.lease.KeepAlive(r.ctx, leaseID)
-	if err != nil {
-		fmt.Printf("keep alive error: %v\n", err)
-		return
+// registration 通过本注册中心注册的实例
+type registration struct {
+	key     string
+	info    *ServiceInfo
+	leaseID clientv3.LeaseID
+	// cancel 停止心跳
+	cancel context.CancelFunc
+	// lastKeepAlive 最近一次心跳成功的时间
+	lastKeepAlive time.Time
+	// traceCtx 注册时的ctx，后台的租约丢失和重新注册span链接到其中的span，创建后不再修改
+	traceCtx context.Context
+	// failing 心跳是否失败或租约已丢失
+	failing bool
+	// renewalInterval 最近两次心跳响应的间隔
+	renewalInterval time.Duration
+	// grantedTTL 最近一次心跳响应中etcd返回的TTL（秒）
+	grantedTTL int64
+	// lastInterruption 和interruptionReason 最近一次心跳中断的时间和原因
+	lastInterruption   time.Time
+	interruptionReason string
+	// interruptedAt 尚未恢复的中断开始时间，恢复后清零；lastRecovery 最近一次从中断到恢复的时长
+	interruptedAt time.Time
+	lastRecovery  time.Duration
+	// group 通过RegisterServices注册时共享同一租约的注册记录，单独注册时为nil
+	group *leaseGroup
+}
+
+// removeRegistration 移除注册记录并停止心跳，返回记录是否仍存在
+func (r *EtcdRegistry) removeRegistration(reg *registration) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.registrations[reg.key] != reg {
+		return false
 	}
+	r.removeLocked(reg)
+	return true
+}
+
+// popRegistration 按key移除注册记录并停止心跳，返回其租约和实例信息的副本
+// 同组的其他实例仍在注册时租约需要保留，返回的租约为0
+func (r *EtcdRegistry) popRegistration(key string) (clientv3.LeaseID, *ServiceInfo, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reg, ok := r.registrations[key]
+	if !ok {
+		return 0, nil, false
+	}
+	r.removeLocked(reg)
+	info := *reg.info
+	if len(r.liveMembersLocked(reg)) > 0 {
+		return 0, &info, true
+	}
+	return reg.leaseID, &info, true
+}
+
+// removeLocked 移除注册记录，同组的实例全部移除后停止心跳，调用方需持有r.mu
+func (r *EtcdRegistry) removeLocked(reg *registration) {
+	delete(r.registrations, reg.key)
+	if reg.cancel != nil && len(r.liveMembersLocked(reg)) == 0 {
+		reg.cancel()
+	}
+	r.reportRegistrationsLocked(reg.info.Name)
+	r.deleteLeaseMetrics(reg.info.Name, reg.info.Address)
+}
+
+// reportRegistrationsLocked 上报服务当前的注册实例数，调用方需持有r.mu
+func (r *EtcdRegistry) reportRegistrationsLocked(serviceName string) {
+	count := 0
+	for _, reg := range r.registrations {
+		if reg.info.Name == serviceName {
+			count++
+		}
+	}
+	r.opts.metrics.SetGauge(MetricRegistrations, serviceLabels(serviceName), float64(count))
+}
 
-	// 监听keepalive响应
+// keepAlive 保持租约活跃，租约丢失时按退避重新注册，直到注销或注册中心关闭
+func (r *EtcdRegistry) keepAlive(ctx context.Context, reg *registration, keepAliveChan <-chan *clientv3.LeaseKeepAliveResponse) {
 	for {
-		select {
-		case <-r.ctx.Done():
+		reason, err := r.drainKeepAlive(ctx, reg, keepAliveChan)
+		if ctx.Err() != nil {
 			return
-		case resp := <-keepAliveChan:
+		}
+
+		now := time.Now()
+		info := r.registrationInfo(reg)
+		reason = r.classifyInterruption(ctx, reg, reason)
+		r.recordInterruption(reg, info.Name, reason, now)
+		r.setKeepAliveResult(reg, err)
+		_, span := r.startSpan(context.Background(), SpanLeaseLost, reg.traceCtx)
+		span.SetAttributes("service", info.Name, "address", info.Address, "key", reg.key, "reason", reason)
+		span.End(err)
+		// 同组的实例共享租约，逐个记录租约丢失
+		for _, member := range r.liveMembers(reg) {
+			info := r.registrationInfo(member)
+			r.opts.metrics.IncCounter(MetricLeaseLost, serviceLabels(info.Name), 1)
+			r.recordError(&r.errorCounts.leaseLost, "keepalive", info.Name, info.Address, err)
+			r.reportLeaseLost(registrationLabels(info.Name, info.Address))
+			recordHistory(r.history.lease, HistoryEvent{Kind: HistoryLeaseLost, Service: info.Name, Address: info.Address, Class: reason, Error: errorString(err)})
+			r.opts.logger.Warn("lease lost, re-registering",
+				"service", info.Name, "address", info.Address, "key", member.key, "reason", reason, "error", err)
+			r.fireLeaseLost(info, wrapError("keepalive", info.Name, info.Address, err))
+		}
+
+		keepAliveChan = r.reRegister(ctx, reg)
+		if keepAliveChan == nil {
+			return
+		}
+	}
+}
+
+// drainKeepAlive 消费心跳响应，返回心跳中断的原因和租约丢失的错误，ctx结束时返回nil错误
+// 中断后的新通道收到第一次响应时确认恢复
+func (r *EtcdRegistry) drainKeepAlive(ctx context.Context, reg *registration, keepAliveChan <-chan *clientv3.LeaseKeepAliveResponse) (string, error) {
+	name := r.registrationInfo(reg).Name
+	labels := serviceLabels(name)
+	last := time.Now()
+	for first := true; ; first = false {
+		select {
+		case <-ctx.Done():
+			return "", nil
+		case resp, ok := <-keepAliveChan:
+			if !ok {
+				return InterruptionClosed, ErrLeaseLost
+			}
 			if resp == nil {
-				// 租约已过期，尝试重新注册
-				fmt.Printf("lease expired, try to re-register service %s\n", key)
-				// 这里可以添加重新注册逻辑
-				return
+				return InterruptionNilResponse, ErrLeaseLost
+			}
+			now := time.Now()
+			if first {
+				r.confirmRecovery(reg, name, now)
 			}
+			r.checkKeepAlive(reg, resp, now.Sub(last))
+			last = now
+			r.setKeepAliveResult(reg, nil)
+			r.opts.metrics.IncCounter(MetricLeaseRenewals, labels, 1)
 		}
 	}
 }
 
-// Unregister 注销服务
+// reRegister 使用新租约重新写入实例并启动心跳，失败时按退避重试
+// 返回新的心跳通道，ctx结束或实例已注销时返回nil
+func (r *EtcdRegistry) reRegister(ctx context.Context, reg *registration) <-chan *clientv3.LeaseKeepAliveResponse {
+	_, span := r.startSpan(context.Background(), SpanReRegister, reg.traceCtx)
+	var lastErr error
+	defer func() { span.End(lastErr) }()
+	var failure failureTracker
+
+	for attempt := 0; ; attempt++ {
+		if !retryWait(ctx, nil, attempt) {
+			return nil
+		}
+		info := r.registrationInfo(reg)
+		if attempt == 0 {
+			span.SetAttributes("service", info.Name, "address", info.Address, "key", reg.key)
+		}
+		keepAliveChan, err := r.reRegisterOnce(ctx, reg)
+		if ctx.Err() != nil || (err == nil && keepAliveChan == nil) {
+			span.AddEvent("abandoned", "attempts", attempt+1)
+			return nil
+		}
+		// 同组实例一起重新注册，逐个记录结果
+		for _, member := range r.liveMembers(reg) {
+			info := r.registrationInfo(member)
+			r.opts.metrics.IncCounter(MetricReRegisterAttempts,
+				map[string]string{LabelService: info.Name, LabelResult: resultLabel(err)}, 1)
+			r.fireReRegister(info, err)
+			if err != nil {
+				recordHistory(r.history.lease, HistoryEvent{Kind: HistoryReRegister, Service: info.Name, Address: info.Address, Error: err.Error()})
+				r.recordError(&r.errorCounts.reRegisterFailures, "re-register", info.Name, info.Address, err)
+				continue
+			}
+			recordHistory(r.history.lease, HistoryEvent{Kind: HistoryReRegister, Service: info.Name, Address: info.Address})
+			r.opts.logger.Info("re-registered",
+				"service", info.Name, "address", info.Address, "key", member.key, "attempts", attempt+1)
+		}
+		if err != nil {
+			r.opts.logger.Warn("re-register failed",
+				"service", info.Name, "address", info.Address, "key", reg.key, "attempt", attempt+1, "error", err)
+			span.AddEvent("attempt failed", "attempt", attempt+1, "error", err.Error())
+			lastErr = err
+			if failure.fail(time.Now(), r.opts.failureThreshold) {
+				r.opts.logger.Error("re-register keeps failing",
+					"service", info.Name, "address", info.Address, "key", reg.key, "since", failure.since, "error", err)
+				r.errs.send(RegistryError{Kind: ErrorReRegisterExhausted, Service: info.Name, Address: info.Address, Err: err, Since: failure.since})
+			}
+			continue
+		}
+		lastErr = nil
+		span.SetAttributes("attempts", attempt+1)
+		return keepAliveChan
+	}
+}
+
+// reRegisterOnce 申请新租约、写入实例并启动心跳，同组的实例在一个事务中写入同一个新租约
+// 实例已全部注销时返回nil通道和nil错误
+func (r *EtcdRegistry) reRegisterOnce(ctx context.Context, reg *registration) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	members := r.liveMembers(reg)
+	if len(members) == 0 {
+		return nil, nil
+	}
+	info := r.registrationInfo(reg)
+	values := make([]string, len(members))
+	for i, member := range members {
+		value, err := r.encodeStamped(r.registrationInfo(member), time.Now(), time.Time{})
+		if err != nil {
+			return nil, wrapError("re-register", info.Name, info.Address, err)
+		}
+		values[i] = value
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, r.opts.requestTimeout)
+	defer cancel()
+	grantResp, err := r.lease.Grant(reqCtx, r.ttl)
+	if err != nil {
+		return nil, wrapError("re-register", info.Name, info.Address, err)
+	}
+	puts := make([]clientv3.Op, len(members))
+	for i, member := range members {
+		puts[i] = clientv3.OpPut(member.key, values[i], clientv3.WithLease(grantResp.ID))
+	}
+	if _, err := r.kv.Txn(reqCtx).Then(puts...).Commit(); err != nil {
+		r.lease.Revoke(r.ctx, grantResp.ID)
+		return nil, wrapError("re-register", info.Name, info.Address, err)
+	}
+	keepAliveChan, err := r.lease.KeepAlive(ctx, grantResp.ID)
+	if err != nil {
+		r.lease.Revoke(r.ctx, grantResp.ID)
+		return nil, wrapError("keepalive", info.Name, info.Address, err)
+	}
+
+	r.mu.Lock()
+	live := r.liveMembersLocked(reg)
+	if len(live) == 0 {
+		// 重新注册期间被注销，撤销新租约
+		r.mu.Unlock()
+		r.lease.Revoke(r.ctx, grantResp.ID)
+		return nil, nil
+	}
+	for _, member := range live {
+		member.leaseID = grantResp.ID
+		member.failing = false
+		member.lastKeepAlive = time.Now()
+	}
+	r.mu.Unlock()
+	// 重新注册期间单独注销的同组实例又被写回，需要再次删除
+	for _, member := range members {
+		if !containsRegistration(live, member) {
+			r.kv.Delete(reqCtx, member.key)
+		}
+	}
+	r.health.record(nil)
+	return keepAliveChan, nil
+}
+
+// registrationInfo 返回注册记录当前实例信息的副本
+func (r *EtcdRegistry) registrationInfo(reg *registration) *ServiceInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info := *reg.info
+	return &info
+}
+
+// Unregister 注销服务，实例不存在时返回ErrNotRegistered
 func (r *EtcdRegistry) Unregister(serviceName, address string) error {
-	key := fmt.Sprintf("/services/%s/%s", serviceName, address)
-	_, err := r.kv.Delete(r.ctx, key)
-	return err
+	return r.UnregisterContext(context.Background(), serviceName, address)
+}
+
+// UnregisterContext 同Unregister，ctx用于取消注销请求和链路追踪
+func (r *EtcdRegistry) UnregisterContext(ctx context.Context, serviceName, address string) (err error) {
+	key := serviceKey(serviceName, address)
+	ctx, span := r.startSpan(ctx, SpanUnregister)
+	span.SetAttributes("service", serviceName, "address", address, "key", key)
+	defer func() { span.End(err) }()
+	ctx, cancel := r.opContext(ctx)
+	defer cancel()
+
+	leaseID, info, tracked := r.popRegistration(key)
+	if !tracked {
+		info = &ServiceInfo{Name: serviceName, Address: address}
+	}
+
+	if tracked {
+		r.markDeregistering(ctx, info)
+	}
+	var resp *clientv3.DeleteResponse
+	err = r.retry(ctx, "unregister", serviceName, func(ctx context.Context) (err error) {
+		resp, err = r.kv.Delete(ctx, key)
+		return err
+	})
+	if err != nil {
+		return wrapError("unregister", serviceName, address, err)
+	}
+	if leaseID != 0 {
+		// 租约只属于这一个实例（或同组的其他实例均已注销），撤销失败时等待其自然过期
+		r.retry(ctx, "revoke", serviceName, func(ctx context.Context) error {
+			_, err := r.lease.Revoke(ctx, leaseID)
+			return err
+		})
+	}
+	if resp.Deleted == 0 && !tracked {
+		return newError("unregister", serviceName, address, ErrNotRegistered)
+	}
+	r.opts.logger.Info("service unregistered", "service", serviceName, "address", address, "key", key)
+	r.writeAudit(ctx, AuditDeregister, info)
+	r.fireDeregister(info, nil)
+	return nil
 }
 
-// Discover 发现服务
+// Discover 发现服务，服务没有任何实例时返回ErrNoInstances
 func (r *EtcdRegistry) Discover(serviceName string) ([]*ServiceInfo, error) {
-	prefix := fmt.Sprintf("/services/%s/", serviceName)
-	resp, err := r.kv.Get(r.ctx, prefix, clientv3.WithPrefix())
+	return r.DiscoverContext(context.Background(), serviceName)
+}
+
+// DiscoverContext 同Discover，ctx用于取消请求和链路追踪
+func (r *EtcdRegistry) DiscoverContext(ctx context.Context, serviceName string) ([]*ServiceInfo, error) {
+	start := time.Now()
+	ctx, span := r.startSpan(ctx, SpanDiscover)
+	span.SetAttributes("service", serviceName, "prefix", servicePrefix(serviceName))
+	services, err := r.discover(ctx, serviceName)
+	span.SetAttributes("instances", len(services))
+	span.End(err)
+
+	labels := serviceLabels(serviceName)
+	r.opts.metrics.IncCounter(MetricDiscoverCalls, labels, 1)
 	if err != nil {
-		return nil, err
+		r.opts.metrics.IncCounter(MetricDiscoverErrors, labels, 1)
+	}
+	r.opts.metrics.ObserveHistogram(MetricDiscoverDuration, labels, time.Since(start).Seconds())
+	return services, err
+}
+
+func (r *EtcdRegistry) discover(ctx context.Context, serviceName string) ([]*ServiceInfo, error) {
+	if services, ok := r.cache.get(serviceName); ok {
+		spanFromContext(ctx).SetAttributes("cached", true)
+		return services, nil
+	}
+	ctx, cancel := r.opContext(ctx)
+	defer cancel()
+	prefix := servicePrefix(serviceName)
+	var resp *clientv3.GetResponse
+	err := r.retry(ctx, "discover", serviceName, func(ctx context.Context) (err error) {
+		resp, err = r.kv.Get(ctx, prefix, clientv3.WithPrefix())
+		return err
+	})
+	if err != nil {
+		return nil, wrapError("discover", serviceName, "", err)
 	}
 
 	var services []*ServiceInfo
 	for _, kv := range resp.Kvs {
-		var service ServiceInfo
-		if err := json.Unmarshal(kv.Value, &service); err != nil {
+		service, ok := r.decodeService(kv.Key, kv.Value)
+		if !ok {
 			continue
 		}
-		services = append(services, &service)
+		services = append(services, service)
 	}
+	if len(services) == 0 {
+		return nil, newError("discover", serviceName, "", ErrNoInstances)
+	}
+	r.cache.put(serviceName, services)
 
 	return services, nil
 }
 
-// Watch 监听服务变化
+// Watch 监听服务变化，回调在独立goroutine中串行执行
+// 初次获取服务列表失败时返回错误且不再监听
 func (r *EtcdRegistry) Watch(serviceName string, callback func([]*ServiceInfo)) error {
-	prefix := fmt.Sprintf("/services/%s/", serviceName)
-
-	go func() {
-		watchChan := r.client.Watch(r.ctx, prefix, clientv3.WithPrefix())
-		for {
-			select {
-			case <-r.ctx.Done():
-				return
-			case watchResp := <-watchChan:
-				for _, event := range watchResp.Events {
-					fmt.Printf("Service changed: %s %s\n", event.Type, event.Kv.Key)
-					// 服务变更时重新获取服务列表
-					services, err := r.Discover(serviceName)
-					if err == nil {
-						callback(services)
-					}
-				}
-			}
+	return r.WatchContext(serviceName, func(_ context.Context, services []*ServiceInfo) { callback(services) })
+}
+
+// WatchContext 同Watch，回调额外收到一个ctx
+// ctx派生自注册中心的生命周期，携带EventInfo（etcd revision、推送来源和关联ID），
+// 设置了WithTracer时还携带本次回调的SpanWatchCallback span，回调返回后span结束
+func (r *EtcdRegistry) WatchContext(serviceName string, callback func(ctx context.Context, services []*ServiceInfo)) error {
+	if r.isClosed() {
+		return wrapError("watch", serviceName, "", ErrRegistryClosed)
+	}
+	unsubscribe := r.hub.subscribe(servicePrefix(serviceName), func(update watchUpdate) {
+		if update.err != nil {
+			return
 		}
-	}()
+		ctx, span := r.eventContext(SpanWatchCallback, EventInfo{Revision: update.revision, Type: update.eventType})
+		span.SetAttributes("service", serviceName, "revision", update.revision, "type", update.eventType, "instances", len(update.services))
+		defer span.End(nil)
+		callback(ctx, update.services)
+	})
+	if err := r.hub.firstList(servicePrefix(serviceName)); err != nil {
+		unsubscribe()
+		return wrapError("watch", serviceName, "", err)
+	}
+	return nil
+}
 
-	// 初始化获取一次服务列表
-	services, err := r.Discover(serviceName)
-	if err != nil {
+// Validate 校验服务信息：服务名非空且不含"/"，地址为host:port或unix:路径，其他地址同样合法，
+// 权重不为负，标签和元数据的key非空，状态为空或StatusUp、StatusDraining、StatusDown之一
+// 地址错误返回ErrInvalidAddress，其余返回ErrInvalidService
+func (s *ServiceInfo) Validate() error {
+	if s.Name == "" || strings.Contains(s.Name, "/") {
+		return fmt.Errorf("%w: name %q must be non-empty and must not contain '/'", ErrInvalidService, s.Name)
+	}
+	if err := validateAddress(s.Address); err != nil {
 		return err
 	}
-	callback(services)
+	for _, address := range s.Addresses {
+		if err := validateAddress(address); err != nil {
+			return err
+		}
+	}
+	if s.Weight < 0 {
+		return fmt.Errorf("%w: weight %d must not be negative", ErrInvalidService, s.Weight)
+	}
+	for _, tag := range s.Tags {
+		if tag == "" {
+			return fmt.Errorf("%w: empty tag", ErrInvalidService)
+		}
+	}
+	for key := range s.Metadata {
+		if key == "" {
+			return fmt.Errorf("%w: empty metadata key", ErrInvalidService)
+		}
+	}
+	switch s.Status {
+	case "", StatusUp, StatusDraining, StatusDown:
+	default:
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidService, s.Status)
+	}
+	return nil
+}
 
+// validateAddress 校验服务地址，支持host:port和unix:路径
+func validateAddress(address string) error {
+	if strings.HasPrefix(address, "unix:") {
+		if strings.TrimPrefix(strings.TrimPrefix(address, "unix:"), "//") == "" {
+			return fmt.Errorf("%w %q: missing unix socket path", ErrInvalidAddress, address)
+		}
+		return nil
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w %q: %v", ErrInvalidAddress, address, err)
+	}
+	if host == "" || port == "" {
+		return fmt.Errorf("%w %q: host and port must not be empty", ErrInvalidAddress, address)
+	}
 	return nil
 }
 
-// Close 关闭注册中心
+// Close 关闭注册中心并注销本注册中心注册的所有实例，最多等待3s，重复调用是安全的
+// 通过NewEtcdRegistryWithClient传入的客户端默认不会被关闭
 func (r *EtcdRegistry) Close() error {
-	r.cancel()
-	return r.client.Close()
+	return r.CloseWithTimeout(defaultCloseTimeout)
 }
 
-// Build 实现resolver.Builder接口
-func (r *EtcdRegistry) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
-	serviceName := target.Endpoint()
-	rsv := &etcdResolver{
-		registry: r,
-		cc:       cc,
+// authorityPrefix 返回target中authority对应的etcd key前缀，authority为空时返回空字符串
+func (r *EtcdRegistry) authorityPrefix(authority string) (string, error) {
+	if authority == "" {
+		return "", nil
 	}
-
-	err := r.Watch(serviceName, func(services []*ServiceInfo) {
-		var addrs []resolver.Address
-		for _, service := range services {
-			addrs = append(addrs, resolver.Address{Addr: service.Address})
+	prefix, ok := r.opts.authorities[authority]
+	if !ok {
+		configured := make([]string, 0, len(r.opts.authorities))
+		for name := range r.opts.authorities {
+			configured = append(configured, name)
 		}
-		cc.UpdateState(resolver.State{Addresses: addrs})
-	})
-
-	return rsv, err
+		sort.Strings(configured)
+		return "", fmt.Errorf("unknown target authority %q, configured authorities: [%s]",
+			authority, strings.Join(configured, ", "))
+	}
+	return prefix, nil
 }
 
-// Scheme 实现resolver.Builder接口
-func (r *EtcdRegistry) Scheme() string {
-	return "etcd"
+// servicePrefix 服务实例key前缀
+func servicePrefix(serviceName string) string {
+	return fmt.Sprintf("/services/%s/", serviceName)
 }
 
-// etcdResolver 实现resolver.Resolver接口
-type etcdResolver struct {
-	registry *EtcdRegistry
-	cc       resolver.ClientConn
+// serviceConfigKey 服务的gRPC服务配置在etcd中的key
+func serviceConfigKey(serviceName string) string {
+	return fmt.Sprintf("/services-config/%s", serviceName)
 }
 
-// ResolveNow 实现resolver.Resolver接口
-func (r *etcdResolver) ResolveNow(options resolver.ResolveNowOptions) {}
-
-// Close 实现resolver.Resolver接口
-func (r *etcdResolver) Close() {}
+// serviceKey 服务实例key
+func serviceKey(serviceName, address string) string {
+	return servicePrefix(serviceName) + address
+}
@@ -0,0 +1,188 @@
+// registry/registry_test.go
+package registry
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/YuanJey/grpc-etcd/etcdtest"
+)
+
+// fileOptions 按etcdtest.Server.Config的用户名密码和证书文件生成选项，走与配置文件相同的WithAuth和WithTLSFiles路径
+func fileOptions(srv *etcdtest.Server) []Option {
+	etcd := srv.Config()
+	var opts []Option
+	if etcd.UserName != "" {
+		opts = append(opts, WithAuth(etcd.UserName, etcd.Password))
+	}
+	if etcd.CAFile != "" {
+		opts = append(opts, WithTLSFiles(etcd.CAFile, etcd.CertFile, etcd.KeyFile))
+	}
+	return opts
+}
+
+func TestEtcdRegistrySecurityModes(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []etcdtest.Option
+	}{
+		{name: "plain"},
+		{name: "auth", opts: []etcdtest.Option{etcdtest.WithAuth("registry", "secret")}},
+		{name: "tls", opts: []etcdtest.Option{etcdtest.WithTLS()}},
+		{name: "mtls", opts: []etcdtest.Option{etcdtest.WithClientCertAuth()}},
+		{name: "auth+tls", opts: []etcdtest.Option{etcdtest.WithAuth("registry", "secret"), etcdtest.WithTLS()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := etcdtest.Start(t, tc.opts...)
+			service := testService(t)
+
+			r, err := NewEtcdRegistry(srv.Endpoints(), testTTL, fileOptions(srv)...)
+			if err != nil {
+				t.Fatalf("new registry: %v", err)
+			}
+			defer r.Close()
+			mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+
+			// 另一个进程通过ClientConfig连接，能够看到注册结果
+			other := newRegistryOn(t, srv)
+			eventually(t, "discover over "+tc.name, func() error {
+				services, err := other.Discover(service)
+				if err != nil {
+					return err
+				}
+				return expectAddrs(services, "10.0.0.1:80")
+			})
+			cc, _ := buildResolver(t, other, other.Target(service))
+			waitAddrs(t, cc, "10.0.0.1:80")
+		})
+	}
+}
+
+func TestEtcdRegistryRejectsBadCredentials(t *testing.T) {
+	srv := etcdtest.Start(t, etcdtest.WithAuth("registry", "secret"))
+	if r, err := NewEtcdRegistry(srv.Endpoints(), testTTL, WithAuth("registry", "wrong")); err == nil {
+		r.Close()
+		t.Fatal("wrong password: got nil error")
+	}
+	if r, err := NewEtcdRegistry(srv.Endpoints(), testTTL); err == nil {
+		r.Close()
+		t.Fatal("missing credentials: got nil error")
+	}
+}
+
+func TestEtcdRegistryRejectsUntrustedServer(t *testing.T) {
+	srv := etcdtest.Start(t, etcdtest.WithTLS())
+	// 不信任测试CA时TLS握手失败，预检报错
+	r, err := NewEtcdRegistry(srv.Endpoints(), testTTL, WithTLSFiles("", "", ""), WithTLSServerName("localhost"),
+		WithDialTimeout(time.Second), WithRequestTimeout(time.Second))
+	if err == nil {
+		r.Close()
+		t.Fatal("untrusted server certificate: got nil error")
+	}
+}
+
+func TestEtcdRegistrySurvivesRestart(t *testing.T) {
+	srv := etcdtest.Start(t)
+	service := testService(t)
+	r := newRegistryOn(t, srv, WithRequestTimeout(time.Second))
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+
+	var watch watchRecorder
+	if err := r.Watch(service, watch.callback); err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	eventually(t, "watch before restart", func() error { return watch.expect("10.0.0.1:80") })
+
+	srv.Stop()
+	time.Sleep(2 * time.Second)
+	if err := srv.Restart(); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+
+	// 重启后心跳恢复，watch重新建立并收到新实例
+	other := newRegistryOn(t, srv)
+	mustRegister(t, other, &ServiceInfo{Name: service, Address: "10.0.0.2:80"})
+	eventually(t, "watch after restart", func() error { return watch.expect("10.0.0.1:80", "10.0.0.2:80") })
+	eventually(t, "registration kept after restart", func() error {
+		services, err := other.Discover(service)
+		if err != nil {
+			return err
+		}
+		return expectAddrs(services, "10.0.0.1:80", "10.0.0.2:80")
+	})
+	eventually(t, "ready after restart", func() error {
+		if state := r.Readiness(service); !state.Ready {
+			return fmt.Errorf("not ready: %+v", state.Registrations)
+		}
+		return nil
+	})
+}
+
+func TestNewEtcdRegistryWithClientKeepsSharedClient(t *testing.T) {
+	cli, err := sharedEtcd.NewClient()
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	defer cli.Close()
+	service := testService(t)
+
+	first, err := NewEtcdRegistryWithClient(cli, testTTL)
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	second, err := NewEtcdRegistryWithClient(cli, testTTL)
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	defer second.Close()
+	mustRegister(t, first, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+	mustRegister(t, second, &ServiceInfo{Name: service, Address: "10.0.0.2:80"})
+	var watch watchRecorder
+	if err := second.Watch(service, watch.callback); err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+
+	// 关闭不拥有客户端的注册中心只注销自己的实例，客户端和共用它的其他注册中心不受影响，重复关闭无副作用
+	for range 2 {
+		if err := first.Close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+	}
+	eventually(t, "watch on the other registry", func() error { return watch.expect("10.0.0.2:80") })
+	if _, err := cli.Get(testContext(t), "health"); err != nil {
+		t.Fatalf("shared client after close: %v", err)
+	}
+	mustRegister(t, second, &ServiceInfo{Name: service, Address: "10.0.0.3:80"})
+	eventually(t, "registration on the other registry", func() error { return watch.expect("10.0.0.2:80", "10.0.0.3:80") })
+}
+
+func TestNewEtcdRegistryWithClientOwnership(t *testing.T) {
+	cli, err := sharedEtcd.NewClient()
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	r, err := NewEtcdRegistryWithClient(cli, testTTL, WithClientOwnership())
+	if err != nil {
+		cli.Close()
+		t.Fatalf("new registry: %v", err)
+	}
+	mustRegister(t, r, &ServiceInfo{Name: testService(t), Address: "10.0.0.1:80"})
+
+	if err := r.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if _, err := cli.Get(testContext(t), "health"); err == nil {
+		t.Fatal("owned client still usable after close")
+	}
+	// 再次关闭不会重复关闭客户端
+	if err := r.Close(); err != nil {
+		t.Errorf("second close: %v", err)
+	}
+}
+
+func TestNewEtcdRegistryWithNilClient(t *testing.T) {
+	if _, err := NewEtcdRegistryWithClient(nil, testTTL); err == nil {
+		t.Fatal("nil client: got nil error")
+	}
+}
@@ -0,0 +1,369 @@
+// registry/resolver.go
+package registry
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// Build 实现resolver.Builder接口
+// 每次调用都会创建独立的resolver，拥有自己的context、订阅和最近一次状态，
+// 关闭其中一个ClientConn不会影响其他连接
+// target可以携带查询参数过滤实例，例如 etcd:///svc?version=v2&tag=canary，
+// authority通过WithAuthorities选择etcd key前缀，例如 etcd://staging/svc
+func (r *EtcdRegistry) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	if r.isClosed() {
+		return nil, ErrRegistryClosed
+	}
+	filter, err := ParseTargetFilter(target)
+	if err != nil {
+		return nil, err
+	}
+	keyPrefix, err := r.authorityPrefix(target.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(r.ctx)
+	rsv := &etcdResolver{
+		registry:    r,
+		cc:          cc,
+		serviceName: target.Endpoint(),
+		keyPrefix:   keyPrefix,
+		filter:      filter,
+		ctx:         ctx,
+		cancel:      cancel,
+		labels: map[string]string{
+			LabelService: target.Endpoint(),
+			LabelScheme:  r.Scheme(),
+		},
+	}
+	// 拨号时通过grpc.WithDisableServiceConfig禁用服务配置时不再下发
+	if !opts.DisableServiceConfig && r.opts.serviceConfig != "" {
+		rsv.serviceConfig = cc.ParseServiceConfig(r.opts.serviceConfig)
+	}
+
+	// 首次解析在后台进行，Build总是返回可用的resolver；
+	// 解析失败时通过ReportError上报并按退避重试，etcd恢复后无需重新拨号即可使用
+	rsv.unsubscribes = append(rsv.unsubscribes,
+		r.hub.subscribe(keyPrefix+servicePrefix(rsv.serviceName), rsv.update),
+		r.hub.watchKey(keyPrefix+trafficSplitKey(rsv.serviceName), rsv.updateSplit),
+		r.hub.watchKey(keyPrefix+activeVersionKey(rsv.serviceName), rsv.updateActiveVersion))
+	if !opts.DisableServiceConfig {
+		rsv.unsubscribes = append(rsv.unsubscribes,
+			r.hub.watchKey(keyPrefix+serviceConfigKey(rsv.serviceName), rsv.updateServiceConfig))
+	}
+
+	return rsv, nil
+}
+
+// Scheme 实现resolver.Builder接口
+func (r *EtcdRegistry) Scheme() string {
+	return r.opts.scheme
+}
+
+// RegisterResolver 将注册中心注册为全局gRPC resolver，返回用于拼接target的scheme
+// 与resolver.Register一样只应在初始化阶段调用
+func (r *EtcdRegistry) RegisterResolver() string {
+	resolver.Register(r)
+	return r.Scheme()
+}
+
+// etcdResolver 实现resolver.Resolver接口
+type etcdResolver struct {
+	registry    *EtcdRegistry
+	cc          resolver.ClientConn
+	serviceName string
+	// keyPrefix target authority对应的etcd key前缀
+	keyPrefix    string
+	filter       Filter
+	ctx          context.Context
+	cancel       context.CancelFunc
+	unsubscribes []func()
+	// labels 指标标签
+	labels map[string]string
+	// serviceConfig 注册中心默认下发的服务配置，可能为nil
+	serviceConfig *serviceconfig.ParseResult
+
+	mu sync.Mutex
+	// discovered 最近一次成功解析并按target过滤后的实例
+	discovered []*ServiceInfo
+	// services 应用版本切换后实际推送的实例
+	services []*ServiceInfo
+	// resolved 是否已经成功解析过，之前不推送任何状态
+	resolved bool
+	// stale 当前推送的地址是否为etcd不可用期间沿用的旧结果
+	stale bool
+	// split 从/routing/{service}/split读取的流量划分
+	split TrafficSplit
+	// remoteConfig 从/services-config/{service}读取的服务配置，优先于默认配置
+	remoteConfig *serviceconfig.ParseResult
+	// activeVersion 从/routing/{service}/active-version读取的当前生效版本，为空表示不限制
+	activeVersion string
+	// last 最近一次推送的状态，相同状态不重复推送
+	last   resolver.State
+	pushed bool
+}
+
+// update 收到服务快照后推送给ClientConn
+func (r *etcdResolver) update(update watchUpdate) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ctx.Err() != nil {
+		return
+	}
+	// 非up状态的实例即使开启了gRPC健康检查也不拨号
+	services := upServices(r.filter.Apply(update.services))
+	if update.err != nil {
+		// etcd不可用时继续使用最近一次成功的地址并标记为过期，绝不因此推送空列表
+		if !r.stale && len(services) > 0 {
+			r.discovered = services
+			r.resolved = true
+			r.stale = true
+			r.refresh()
+		} else if !r.resolved && len(r.fallbackAddresses()) > 0 {
+			// 没有任何缓存结果时使用静态兜底地址
+			r.resolved = true
+			r.push()
+		}
+		// 上报错误后gRPC会按退避调用ResolveNow，错误持续期间每次重试失败都会再次上报
+		r.reportError(watchErrorClass(update.err), update.err)
+		return
+	}
+
+	r.registry.opts.metrics.SetGauge(MetricResolverLastRefresh, r.labels, float64(time.Now().Unix()))
+
+	// 只有etcd明确返回零个实例时才会推送空列表
+	r.discovered = services
+	r.resolved = true
+	r.stale = false
+	r.refresh()
+}
+
+// updateActiveVersion 蓝绿切换的生效版本变化时重新推送状态，key删除后恢复为全部版本
+func (r *etcdResolver) updateActiveVersion(update keyUpdate) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ctx.Err() != nil || update.err != nil {
+		return
+	}
+	r.activeVersion = ""
+	if update.exists {
+		r.activeVersion = strings.TrimSpace(string(update.value))
+	}
+	if r.resolved {
+		r.refresh()
+	}
+}
+
+// refresh 按生效版本筛选实例后推送，调用方需持有r.mu
+// 生效版本没有任何实例时保留之前推送的地址并上报错误，避免误操作切走全部流量
+func (r *etcdResolver) refresh() {
+	services := r.discovered
+	if r.activeVersion != "" {
+		active := Filter{Version: r.activeVersion}.Apply(services)
+		if len(active) == 0 && len(services) > 0 {
+			r.reportError(ResolverErrorNoActiveVersion,
+				fmt.Errorf("active version %q has no instances, keeping previous addresses", r.activeVersion))
+			if r.pushed {
+				return
+			}
+			// 尚未推送过任何地址时没有可保留的结果，先使用全部版本
+			active = services
+		}
+		services = active
+	}
+	r.services = services
+	r.push()
+	if len(services) == 0 && len(r.fallbackAddresses()) == 0 {
+		r.reportError(ResolverErrorNoInstances, nil)
+	}
+}
+
+// updateSplit 流量划分变化时重新推送状态，格式错误时保留之前的划分
+func (r *etcdResolver) updateSplit(update keyUpdate) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ctx.Err() != nil || update.err != nil {
+		return
+	}
+	var split TrafficSplit
+	if update.exists {
+		var err error
+		if split, err = parseTrafficSplit(update.value); err != nil {
+			return
+		}
+	}
+	r.split = split
+	if r.resolved {
+		r.push()
+	}
+}
+
+// updateServiceConfig etcd中的服务配置变化时重新推送状态
+// 配置无效时上报错误并保留之前生效的配置，key删除后恢复默认配置
+func (r *etcdResolver) updateServiceConfig(update keyUpdate) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ctx.Err() != nil || update.err != nil {
+		return
+	}
+	var config *serviceconfig.ParseResult
+	if update.exists {
+		js, err := withHealthCheckConfig(string(update.value), r.registry.opts.healthCheckServiceName)
+		if err != nil {
+			r.reportError(ResolverErrorServiceConfig, fmt.Errorf("%s: %v", r.keyPrefix+serviceConfigKey(r.serviceName), err))
+			return
+		}
+		config = r.cc.ParseServiceConfig(js)
+		if config.Err != nil {
+			r.reportError(ResolverErrorServiceConfig, fmt.Errorf("%s: %v", r.keyPrefix+serviceConfigKey(r.serviceName), config.Err))
+			return
+		}
+	}
+	r.remoteConfig = config
+	if r.resolved {
+		r.push()
+	}
+}
+
+// push 根据当前实例构造resolver.State并推送给ClientConn，调用方需持有r.mu
+func (r *etcdResolver) push() {
+	var addrs []resolver.Address
+	services := dedupServices(r.services)
+	if r.registry.opts.subsetSize > 0 {
+		services = selectSubset(services, r.registry.opts.clientID, r.registry.opts.subsetSize)
+	}
+	// 每个实例对应一个Endpoint，同时展开到Addresses以兼容只读取Addresses的旧balancer
+	endpoints := make([]resolver.Endpoint, 0, len(services))
+	for _, service := range services {
+		endpoint := newEndpoint(service, r.stale)
+		for _, addr := range endpoint.Addresses {
+			if r.stale {
+				addr = markStale(addr)
+			}
+			addrs = append(addrs, addr)
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	// 没有发现任何实例时退回静态兜底地址
+	if len(services) == 0 {
+		for _, fallback := range r.fallbackAddresses() {
+			service := &ServiceInfo{Name: r.serviceName, Address: fallback}
+			endpoint := newEndpoint(service, false)
+			endpoint.Attributes = endpoint.Attributes.WithValue(fallbackKey{}, true)
+			addrs = append(addrs, markFallback(endpoint.Addresses[0]))
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	state := resolver.State{Addresses: addrs, Endpoints: endpoints, ServiceConfig: r.serviceConfig}
+	if r.remoteConfig != nil {
+		state.ServiceConfig = r.remoteConfig
+	}
+	state = withTrafficSplit(state, r.split)
+	metrics := r.registry.opts.metrics
+	if _, noop := metrics.(noopMetrics); !noop {
+		state.Attributes = state.Attributes.WithValue(metricsKey{}, metrics)
+	}
+	if r.pushed && stateEqual(r.last, state) {
+		metrics.IncCounter(MetricResolverUpdatesSuppressed, r.labels, 1)
+		return
+	}
+	r.last = state
+	r.pushed = true
+	metrics.IncCounter(MetricResolverUpdates, r.labels, 1)
+	metrics.SetGauge(MetricResolverAddresses, r.labels, float64(len(state.Addresses)))
+	recordHistory(r.registry.history.resolver, HistoryEvent{Kind: HistoryResolverUpdate, Service: r.serviceName,
+		Addresses: len(state.Addresses), Stale: r.stale, Fallback: len(services) == 0 && len(addrs) > 0})
+	r.registry.opts.logger.Debug("resolver state updated",
+		"service", r.serviceName, "addresses", len(state.Addresses), "stale", r.stale, "fallback", len(services) == 0)
+	if err := r.cc.UpdateState(state); err != nil {
+		r.registry.opts.logger.Warn("resolver state rejected", "service", r.serviceName, "error", err)
+	}
+}
+
+// reportError 将错误按class包装为ResolverError后向ClientConn上报并计数，调用方需持有r.mu
+func (r *etcdResolver) reportError(class ResolverErrorClass, err error) {
+	labels := maps.Clone(r.labels)
+	labels[LabelClass] = string(class)
+	r.registry.opts.metrics.IncCounter(MetricResolverErrors, labels, 1)
+	r.registry.opts.logger.Warn("resolver error", "service", r.serviceName, "class", string(class), "error", err)
+	recordHistory(r.registry.history.resolver, HistoryEvent{Kind: HistoryResolverError, Service: r.serviceName, Class: string(class), Error: errorString(err)})
+	r.cc.ReportError(&ResolverError{Class: class, Service: r.serviceName, Err: err})
+}
+
+// fallbackAddresses 当前服务配置的静态兜底地址
+func (r *etcdResolver) fallbackAddresses() []string {
+	return r.registry.opts.fallbackAddresses[r.serviceName]
+}
+
+// dedupServices 按地址去重并排序，避免etcd中key顺序变化或重复注册导致子连接抖动
+// 同一地址存在多条注册（例如不同版本或新旧key格式）时保留权重最高的一条，权重相同时取版本号较大的
+func dedupServices(services []*ServiceInfo) []*ServiceInfo {
+	byAddr := make(map[string]*ServiceInfo, len(services))
+	for _, service := range services {
+		existing, ok := byAddr[service.Address]
+		if !ok || service.Weight > existing.Weight ||
+			service.Weight == existing.Weight && service.Version > existing.Version {
+			byAddr[service.Address] = service
+		}
+	}
+
+	deduped := make([]*ServiceInfo, 0, len(byAddr))
+	for _, service := range byAddr {
+		deduped = append(deduped, service)
+	}
+	sort.Slice(deduped, func(i, j int) bool { return deduped[i].Address < deduped[j].Address })
+	return deduped
+}
+
+// stateEqual 判断两次推送的状态是否相同
+func stateEqual(a, b resolver.State) bool {
+	if len(a.Addresses) != len(b.Addresses) || a.ServiceConfig != b.ServiceConfig || !a.Attributes.Equal(b.Attributes) {
+		return false
+	}
+	for i := range a.Addresses {
+		if !a.Addresses[i].Equal(b.Addresses[i]) {
+			return false
+		}
+	}
+	if len(a.Endpoints) != len(b.Endpoints) {
+		return false
+	}
+	for i := range a.Endpoints {
+		if !a.Endpoints[i].Attributes.Equal(b.Endpoints[i].Attributes) {
+			return false
+		}
+	}
+	// Endpoint中的地址与Addresses一一对应，上面已经比较过
+	return true
+}
+
+// ResolveNow 实现resolver.Resolver接口
+func (r *etcdResolver) ResolveNow(options resolver.ResolveNowOptions) {
+	r.registry.hub.resolveNow(r.keyPrefix + servicePrefix(r.serviceName))
+}
+
+// Close 实现resolver.Resolver接口
+func (r *etcdResolver) Close() {
+	r.cancel()
+	for _, unsubscribe := range r.unsubscribes {
+		unsubscribe()
+	}
+
+	// 等待正在进行的推送结束，保证Close返回后不再调用ClientConn
+	r.mu.Lock()
+	r.mu.Unlock()
+}
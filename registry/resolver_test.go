@@ -0,0 +1,440 @@
+// registry/resolver_test.go
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+
+	"github.com/YuanJey/grpc-etcd/etcdtest"
+	"github.com/YuanJey/grpc-etcd/resolvertest"
+)
+
+// isResolverError 匹配指定class的ResolverError
+func isResolverError(class ResolverErrorClass) func(error) bool {
+	return func(err error) bool {
+		var resolverErr *ResolverError
+		return errors.As(err, &resolverErr) && resolverErr.Class == class
+	}
+}
+
+// configJSON 返回状态中resolvertest解析的服务配置JSON，没有服务配置时为空
+func configJSON(state resolver.State) string {
+	if state.ServiceConfig == nil {
+		return ""
+	}
+	config, _ := state.ServiceConfig.Config.(*resolvertest.Config)
+	if config == nil {
+		return ""
+	}
+	return config.JSON
+}
+
+func TestResolverTargetFilters(t *testing.T) {
+	service := testService(t)
+	r := newTestRegistry(t)
+	for _, info := range []*ServiceInfo{
+		{Name: service, Address: "10.0.0.1:80", Version: "v1", Env: "prod"},
+		{Name: service, Address: "10.0.0.2:80", Version: "v2", Env: "prod", Tags: []string{"canary"}},
+		{Name: service, Address: "10.0.0.3:80", Version: "v2", Env: "staging", Tags: []string{"canary", "arm"},
+			Metadata: map[string]string{"region": "eu"}},
+		{Name: service, Address: "10.0.0.4:80", Version: "v2", Env: "prod", Status: StatusDraining},
+	} {
+		mustRegister(t, r, info)
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		// draining实例在任何过滤条件下都不推送
+		{query: "", want: []string{"10.0.0.1:80", "10.0.0.2:80", "10.0.0.3:80"}},
+		{query: "?version=v2", want: []string{"10.0.0.2:80", "10.0.0.3:80"}},
+		{query: "?env=prod", want: []string{"10.0.0.1:80", "10.0.0.2:80"}},
+		{query: "?tag=canary", want: []string{"10.0.0.2:80", "10.0.0.3:80"}},
+		{query: "?tag=canary&tag=arm", want: []string{"10.0.0.3:80"}},
+		{query: "?metadata=region:eu", want: []string{"10.0.0.3:80"}},
+		{query: "?version=v2&env=prod", want: []string{"10.0.0.2:80"}},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			cc, _ := buildResolver(t, r, r.Target(service)+tc.query)
+			waitAddrs(t, cc, tc.want...)
+		})
+	}
+
+	// 过滤后没有实例时推送空列表并上报ResolverErrorNoInstances
+	cc, _ := buildResolver(t, r, r.Target(service)+"?version=v3")
+	waitAddrs(t, cc)
+	if _, err := cc.WaitForError(testContext(t), isResolverError(ResolverErrorNoInstances)); err != nil {
+		t.Fatalf("filter without matches: %v", err)
+	}
+}
+
+func TestResolverRejectsInvalidTargetQuery(t *testing.T) {
+	r := newTestRegistry(t)
+	for _, query := range []string{"?versoin=v2", "?version=v1&version=v2", "?metadata=region"} {
+		if _, rsv, err := resolvertest.Build(r, r.Target("svc")+query); err == nil {
+			rsv.Close()
+			t.Errorf("target query %q: got nil error", query)
+		}
+	}
+}
+
+func TestResolverFallbackAddresses(t *testing.T) {
+	service := testService(t)
+	r := newTestRegistry(t, WithFallbackAddresses(map[string][]string{service: {"192.168.0.1:80"}}))
+	isFallback := func(state resolver.State) bool {
+		return len(state.Addresses) == 1 && IsFallbackAddress(state.Addresses[0]) && IsFallbackEndpoint(state.Endpoints[0])
+	}
+
+	// etcd中没有实例时使用兜底地址，且不上报没有实例的错误
+	cc, _ := buildResolver(t, r, r.Target(service))
+	state := waitAddrs(t, cc, "192.168.0.1:80")
+	if !isFallback(state) {
+		t.Fatalf("fallback address not marked: %v", state)
+	}
+	if errs := cc.Errors(); len(errs) > 0 {
+		t.Errorf("errors with fallback addresses: %v", errs)
+	}
+
+	// 发现实例后立即切回，实例全部消失后再次使用兜底地址
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+	state = waitAddrs(t, cc, "10.0.0.1:80")
+	if IsFallbackAddress(state.Addresses[0]) {
+		t.Errorf("discovered address marked as fallback")
+	}
+	if err := r.Unregister(service, "10.0.0.1:80"); err != nil {
+		t.Fatalf("unregister: %v", err)
+	}
+	if _, err := cc.WaitForState(testContext(t), isFallback); err != nil {
+		t.Fatalf("fallback after the last instance left: %v", err)
+	}
+}
+
+func TestResolverFallbackWhileEtcdDown(t *testing.T) {
+	srv := etcdtest.Start(t)
+	service := testService(t)
+	r := newRegistryOn(t, srv, WithRequestTimeout(500*time.Millisecond),
+		WithFallbackAddresses(map[string][]string{service: {"192.168.0.1:80"}}))
+	other := newRegistryOn(t, srv)
+
+	// 没有任何缓存结果时etcd不可用，使用兜底地址同时上报watch错误
+	srv.Stop()
+	cc, _ := buildResolver(t, r, r.Target(service))
+	state := waitAddrs(t, cc, "192.168.0.1:80")
+	if !IsFallbackAddress(state.Addresses[0]) || IsStaleAddress(state.Addresses[0]) {
+		t.Errorf("fallback while etcd is down: fallback %v, stale %v",
+			IsFallbackAddress(state.Addresses[0]), IsStaleAddress(state.Addresses[0]))
+	}
+	if _, err := cc.WaitForError(testContext(t), isWatchError); err != nil {
+		t.Fatalf("error alongside fallback addresses: %v", err)
+	}
+
+	if err := srv.Restart(); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	mustRegister(t, other, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+	waitAddrs(t, cc, "10.0.0.1:80")
+}
+
+func TestResolverActiveVersion(t *testing.T) {
+	service := testService(t)
+	r := newTestRegistry(t)
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.1:80", Version: "v1"})
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.2:80", Version: "v2"})
+	cc, _ := buildResolver(t, r, r.Target(service))
+	waitAddrs(t, cc, "10.0.0.1:80", "10.0.0.2:80")
+
+	if err := r.SetActiveVersion(service, "v2"); err != nil {
+		t.Fatalf("set active version: %v", err)
+	}
+	waitAddrs(t, cc, "10.0.0.2:80")
+
+	// 生效版本没有实例时保留之前的地址并上报错误
+	pushed := len(cc.States())
+	if err := r.SetActiveVersion(service, "v3"); err != nil {
+		t.Fatalf("set active version: %v", err)
+	}
+	if _, err := cc.WaitForError(testContext(t), isResolverError(ResolverErrorNoActiveVersion)); err != nil {
+		t.Fatalf("active version without instances: %v", err)
+	}
+	if got := len(cc.States()); got != pushed {
+		t.Errorf("states pushed for an active version without instances: %d", got-pushed)
+	}
+
+	// 生效版本的实例上线后切换过去
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.3:80", Version: "v3"})
+	waitAddrs(t, cc, "10.0.0.3:80")
+
+	if err := r.ClearActiveVersion(service); err != nil {
+		t.Fatalf("clear active version: %v", err)
+	}
+	waitAddrs(t, cc, "10.0.0.1:80", "10.0.0.2:80", "10.0.0.3:80")
+}
+
+func TestResolverTrafficSplit(t *testing.T) {
+	service := testService(t)
+	r := newTestRegistry(t)
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.1:80", Version: "v1"})
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.2:80", Version: "v2"})
+	cc, _ := buildResolver(t, r, r.Target(service))
+	waitAddrs(t, cc, "10.0.0.1:80", "10.0.0.2:80")
+
+	split := TrafficSplit{"v2": 10}
+	if err := r.SetTrafficSplit(service, split); err != nil {
+		t.Fatalf("set traffic split: %v", err)
+	}
+	if _, err := cc.WaitForState(testContext(t), func(state resolver.State) bool {
+		got, ok := TrafficSplitFromState(state.Attributes)
+		return ok && maps.Equal(got, split)
+	}); err != nil {
+		t.Fatalf("traffic split in state: %v", err)
+	}
+	if err := r.SetTrafficSplit(service, TrafficSplit{"v2": 120}); err == nil {
+		t.Errorf("invalid traffic split: got nil error")
+	}
+
+	if err := r.DeleteTrafficSplit(service); err != nil {
+		t.Fatalf("delete traffic split: %v", err)
+	}
+	if _, err := cc.WaitForState(testContext(t), func(state resolver.State) bool {
+		_, ok := TrafficSplitFromState(state.Attributes)
+		return !ok && len(state.Addresses) == 2
+	}); err != nil {
+		t.Fatalf("traffic split removed from state: %v", err)
+	}
+}
+
+func TestResolverServicesConfig(t *testing.T) {
+	service := testService(t)
+	r := newTestRegistry(t)
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+	cc, _ := buildResolver(t, r, r.Target(service))
+	if state := waitAddrs(t, cc, "10.0.0.1:80"); configJSON(state) != defaultServiceConfig {
+		t.Fatalf("default service config: got %q", configJSON(state))
+	}
+
+	// /services-config/{service}优先于默认配置
+	remote := `{"loadBalancingConfig":[{"pick_first":{}}]}`
+	put := func(value string) {
+		t.Helper()
+		if _, err := r.kv.Put(testContext(t), serviceConfigKey(service), value); err != nil {
+			t.Fatalf("put service config: %v", err)
+		}
+	}
+	hasConfig := func(js string) func(resolver.State) bool {
+		return func(state resolver.State) bool { return configJSON(state) == js }
+	}
+	put(remote)
+	if _, err := cc.WaitForState(testContext(t), hasConfig(remote)); err != nil {
+		t.Fatalf("service config from etcd: %v", err)
+	}
+
+	// 无效配置上报错误并保留之前生效的配置
+	put("{not json")
+	if _, err := cc.WaitForError(testContext(t), isResolverError(ResolverErrorServiceConfig)); err != nil {
+		t.Fatalf("invalid service config: %v", err)
+	}
+	if state, _ := cc.LastState(); configJSON(state) != remote {
+		t.Errorf("service config after an invalid update: got %q, want %q", configJSON(state), remote)
+	}
+
+	// 删除后恢复默认配置
+	if _, err := r.kv.Delete(testContext(t), serviceConfigKey(service)); err != nil {
+		t.Fatalf("delete service config: %v", err)
+	}
+	if _, err := cc.WaitForState(testContext(t), hasConfig(defaultServiceConfig)); err != nil {
+		t.Fatalf("default service config after delete: %v", err)
+	}
+}
+
+func TestResolverDisableServiceConfig(t *testing.T) {
+	service := testService(t)
+	r := newTestRegistry(t)
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+	if _, err := r.kv.Put(testContext(t), serviceConfigKey(service), `{"loadBalancingConfig":[{"pick_first":{}}]}`); err != nil {
+		t.Fatalf("put service config: %v", err)
+	}
+
+	u, err := url.Parse(r.Target(service))
+	if err != nil {
+		t.Fatalf("parse target: %v", err)
+	}
+	cc := resolvertest.NewClientConn()
+	rsv, err := r.Build(resolver.Target{URL: *u}, cc, resolver.BuildOptions{DisableServiceConfig: true})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	defer rsv.Close()
+	if state := waitAddrs(t, cc, "10.0.0.1:80"); state.ServiceConfig != nil {
+		t.Errorf("service config with DisableServiceConfig: got %q", configJSON(state))
+	}
+}
+
+func TestResolverIsolatedPerBuild(t *testing.T) {
+	service := testService(t)
+	r := newTestRegistry(t)
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+
+	// 同一服务的两个resolver各自订阅，关闭其中一个不影响另一个
+	closed, closedRsv := buildResolver(t, r, r.Target(service))
+	open, _ := buildResolver(t, r, r.Target(service))
+	waitAddrs(t, closed, "10.0.0.1:80")
+	waitAddrs(t, open, "10.0.0.1:80")
+	closedRsv.Close()
+	pushed := len(closed.States())
+
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.2:80"})
+	waitAddrs(t, open, "10.0.0.1:80", "10.0.0.2:80")
+	if got := len(closed.States()); got != pushed {
+		t.Errorf("closed resolver received %d states", got-pushed)
+	}
+}
+
+func TestDialIsolatedPerClientConn(t *testing.T) {
+	orders, users := testService(t), testService(t)
+	r := newTestRegistry(t)
+	orderBackend, userBackend, newUserBackend := startBackend(t), startBackend(t), startBackend(t)
+	mustRegister(t, r, &ServiceInfo{Name: orders, Address: orderBackend.addr})
+	mustRegister(t, r, &ServiceInfo{Name: users, Address: userBackend.addr})
+
+	ordersClient, ordersConn := dialHealth(t, r, orders)
+	usersClient, _ := dialHealth(t, r, users)
+	_, otherUsersConn := dialHealth(t, r, users)
+	checkOnce(t, ordersClient)
+	checkOnce(t, usersClient)
+
+	// 关闭另一个服务和同一服务的其他连接后，剩下的连接仍然跟随注册变化
+	ordersConn.Close()
+	otherUsersConn.Close()
+	mustRegister(t, r, &ServiceInfo{Name: users, Address: newUserBackend.addr})
+	if err := r.Unregister(users, userBackend.addr); err != nil {
+		t.Fatalf("unregister: %v", err)
+	}
+	eventually(t, "requests moved to the new instance", func() error {
+		before := userBackend.calls.Load()
+		for range 5 {
+			checkOnce(t, usersClient)
+		}
+		if newUserBackend.calls.Load() == 0 || userBackend.calls.Load() != before {
+			return fmt.Errorf("old instance %d calls, new instance %d calls", userBackend.calls.Load(), newUserBackend.calls.Load())
+		}
+		return nil
+	})
+}
+
+func TestResolverDedupsAndSortsAddresses(t *testing.T) {
+	service := testService(t)
+	r := newTestRegistry(t)
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.3:80"})
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.1:80", Version: "v2", Weight: 5})
+	// 旧格式key下同一地址的另一条注册
+	legacy, err := r.encodeStamped(&ServiceInfo{Name: service, Address: "10.0.0.1:80", Version: "v1", Weight: 1}, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if _, err := r.kv.Put(testContext(t), servicePrefix(service)+"v1/10.0.0.1:80", legacy); err != nil {
+		t.Fatalf("put legacy key: %v", err)
+	}
+
+	cc, _ := buildResolver(t, r, r.Target(service))
+	state := waitAddrs(t, cc, "10.0.0.1:80", "10.0.0.3:80")
+	if got := resolvertest.Addrs(state); !slices.Equal(got, []string{"10.0.0.1:80", "10.0.0.3:80"}) {
+		t.Errorf("addresses not sorted: %v", got)
+	}
+	if len(state.Endpoints) != 2 {
+		t.Fatalf("endpoints: got %d, want 2", len(state.Endpoints))
+	}
+	// 同一地址保留权重最高的一条
+	if info, ok := ServiceInfoFromAddress(state.Addresses[0]); !ok || info.Weight != 5 || info.Version != "v2" {
+		t.Errorf("deduplicated registration: got %+v", info)
+	}
+
+	// 内容相同的写入不会重复推送
+	pushed := len(cc.States())
+	if _, err := r.kv.Put(testContext(t), servicePrefix(service)+"v1/10.0.0.1:80", legacy); err != nil {
+		t.Fatalf("rewrite legacy key: %v", err)
+	}
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.2:80"})
+	waitAddrs(t, cc, "10.0.0.1:80", "10.0.0.2:80", "10.0.0.3:80")
+	if got := len(cc.States()) - pushed; got != 1 {
+		t.Errorf("states pushed for an unchanged rewrite plus one registration: got %d, want 1", got)
+	}
+}
+
+func TestResolverHealthCheckConfig(t *testing.T) {
+	service := testService(t)
+	r := newTestRegistry(t, WithHealthCheckServiceName("grpc.health.v1.Health"))
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+	cc, _ := buildResolver(t, r, r.Target(service))
+	state := waitAddrs(t, cc, "10.0.0.1:80")
+	want := `{"healthCheckConfig":{"serviceName":"grpc.health.v1.Health"},"loadBalancingConfig":[{"round_robin":{}}]}`
+	if got := configJSON(state); got != want {
+		t.Errorf("default service config: got %s, want %s", got, want)
+	}
+
+	// etcd中的服务配置同样加入healthCheckConfig，已包含时保持不变
+	for _, tc := range []struct{ value, want string }{
+		{
+			value: `{"loadBalancingConfig":[{"pick_first":{}}]}`,
+			want:  `{"healthCheckConfig":{"serviceName":"grpc.health.v1.Health"},"loadBalancingConfig":[{"pick_first":{}}]}`,
+		},
+		{
+			value: `{"healthCheckConfig":{"serviceName":"custom"}}`,
+			want:  `{"healthCheckConfig":{"serviceName":"custom"}}`,
+		},
+	} {
+		if _, err := r.kv.Put(testContext(t), serviceConfigKey(service), tc.value); err != nil {
+			t.Fatalf("put service config: %v", err)
+		}
+		if _, err := cc.WaitForState(testContext(t), func(state resolver.State) bool { return configJSON(state) == tc.want }); err != nil {
+			last, _ := cc.LastState()
+			t.Fatalf("service config %s: got %s, want %s", tc.value, configJSON(last), tc.want)
+		}
+	}
+}
+
+func TestDrainingStopsNewRPCs(t *testing.T) {
+	service := testService(t)
+	r := newTestRegistry(t)
+	draining, serving := startBackend(t), startBackend(t)
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: draining.addr})
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: serving.addr})
+	client, _ := dialHealth(t, r, service)
+	eventually(t, "both instances serving", func() error {
+		checkOnce(t, client)
+		if draining.calls.Load() == 0 || serving.calls.Load() == 0 {
+			return fmt.Errorf("calls %d and %d", draining.calls.Load(), serving.calls.Load())
+		}
+		return nil
+	})
+
+	// 未开启客户端健康检查时也不再向draining实例发送新请求
+	cc, _ := buildResolver(t, r, r.Target(service))
+	waitAddrs(t, cc, draining.addr, serving.addr)
+	if err := r.SetStatus(service, draining.addr, StatusDraining); err != nil {
+		t.Fatalf("set status: %v", err)
+	}
+	waitAddrs(t, cc, serving.addr)
+	eventually(t, "draining instance left the picker", func() error {
+		before := draining.calls.Load()
+		checkOnce(t, client)
+		if draining.calls.Load() != before {
+			return fmt.Errorf("draining instance still receives calls")
+		}
+		return nil
+	})
+	before := draining.calls.Load()
+	for range 20 {
+		checkOnce(t, client)
+	}
+	if got := draining.calls.Load() - before; got != 0 {
+		t.Errorf("draining instance received %d new calls", got)
+	}
+}
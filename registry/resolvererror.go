@@ -0,0 +1,53 @@
+// registry/resolvererror.go
+package registry
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ResolverErrorClass resolver上报给gRPC的错误分类，同时作为resolver_errors_total的class标签，
+// gRPC日志、channelz和监控面板使用同一套取值
+type ResolverErrorClass string
+
+const (
+	// ResolverErrorWatch 从etcd拉取或watch实例失败，正在按退避重新建立watch，期间沿用之前的地址
+	ResolverErrorWatch ResolverErrorClass = "watch re-establishing"
+	// ResolverErrorPermission etcd认证失败或没有读取服务前缀的权限
+	ResolverErrorPermission ResolverErrorClass = "permission denied"
+	// ResolverErrorNoInstances etcd中服务没有任何可用实例，且没有配置兜底地址
+	ResolverErrorNoInstances ResolverErrorClass = "zero instances"
+	// ResolverErrorNoActiveVersion 蓝绿切换的生效版本没有任何实例，保留之前推送的地址
+	ResolverErrorNoActiveVersion ResolverErrorClass = "no instances of active version"
+	// ResolverErrorServiceConfig etcd中的服务配置无效，保留之前生效的配置
+	ResolverErrorServiceConfig ResolverErrorClass = "invalid service config"
+)
+
+// ResolverError resolver上报给gRPC的错误，格式为 "etcd-resolver: <class> for service <name>: <原因>"
+type ResolverError struct {
+	Class   ResolverErrorClass
+	Service string
+	// Err 底层错误，可能为nil
+	Err error
+}
+
+func (e *ResolverError) Error() string {
+	msg := fmt.Sprintf("etcd-resolver: %s for service %s", e.Class, e.Service)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap 返回底层错误
+func (e *ResolverError) Unwrap() error {
+	return e.Err
+}
+
+// watchErrorClass 按etcd错误类型区分watch失败的分类
+func watchErrorClass(err error) ResolverErrorClass {
+	if errors.Is(err, ErrPermissionDenied) || classifyError(err) == ErrPermissionDenied {
+		return ResolverErrorPermission
+	}
+	return ResolverErrorWatch
+}
@@ -0,0 +1,171 @@
+// registry/resolvererror_test.go
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/resolver"
+
+	"github.com/YuanJey/grpc-etcd/etcdtest"
+	"github.com/YuanJey/grpc-etcd/resolvertest"
+)
+
+// errorCounter 记录resolver_errors_total，按service和class统计
+type errorCounter struct {
+	mu     sync.Mutex
+	counts map[string]float64
+}
+
+func (c *errorCounter) IncCounter(name string, labels map[string]string, delta float64) {
+	if name != MetricResolverErrors {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil {
+		c.counts = make(map[string]float64)
+	}
+	c.counts[labels[LabelService]+"/"+labels[LabelClass]] += delta
+}
+
+func (c *errorCounter) SetGauge(string, map[string]string, float64)         {}
+func (c *errorCounter) ObserveHistogram(string, map[string]string, float64) {}
+
+// expect 等待service的class错误被计数
+func (c *errorCounter) expect(t *testing.T, service string, class ResolverErrorClass) {
+	t.Helper()
+	eventually(t, "resolver error metric "+string(class), func() error {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.counts[service+"/"+string(class)] == 0 {
+			return fmt.Errorf("no %s/%s in %v", service, class, c.counts)
+		}
+		return nil
+	})
+}
+
+// expectReported 等待cc收到service的class错误，检查错误信息以稳定的前缀开头
+func expectReported(t *testing.T, cc *resolvertest.ClientConn, service string, class ResolverErrorClass) *ResolverError {
+	t.Helper()
+	err, werr := cc.WaitForError(testContext(t), isResolverError(class))
+	if werr != nil {
+		t.Fatalf("waiting for %q: %v, got %v", class, werr, cc.Errors())
+	}
+	prefix := fmt.Sprintf("etcd-resolver: %s for service %s", class, service)
+	if !strings.HasPrefix(err.Error(), prefix) {
+		t.Errorf("message: got %q, want prefix %q", err.Error(), prefix)
+	}
+	var resolverErr *ResolverError
+	errors.As(err, &resolverErr)
+	return resolverErr
+}
+
+func TestResolverErrorMessage(t *testing.T) {
+	for _, tc := range []struct {
+		err  *ResolverError
+		want string
+	}{
+		{&ResolverError{Class: ResolverErrorNoInstances, Service: "orders"},
+			"etcd-resolver: zero instances for service orders"},
+		{&ResolverError{Class: ResolverErrorWatch, Service: "orders", Err: ErrEtcdUnavailable},
+			"etcd-resolver: watch re-establishing for service orders: etcd unavailable"},
+		{&ResolverError{Class: ResolverErrorPermission, Service: "orders", Err: errors.New("denied")},
+			"etcd-resolver: permission denied for service orders: denied"},
+		{&ResolverError{Class: ResolverErrorNoActiveVersion, Service: "orders"},
+			"etcd-resolver: no instances of active version for service orders"},
+		{&ResolverError{Class: ResolverErrorServiceConfig, Service: "orders", Err: errors.New("bad json")},
+			"etcd-resolver: invalid service config for service orders: bad json"},
+	} {
+		if got := tc.err.Error(); got != tc.want {
+			t.Errorf("got %q, want %q", got, tc.want)
+		}
+	}
+	err := &ResolverError{Class: ResolverErrorWatch, Service: "orders", Err: ErrEtcdUnavailable}
+	if !errors.Is(err, ErrEtcdUnavailable) {
+		t.Error("ResolverError does not unwrap to its cause")
+	}
+}
+
+func TestWatchErrorClass(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want ResolverErrorClass
+	}{
+		{rpctypes.ErrPermissionDenied, ResolverErrorPermission},
+		{wrapError("watch", "orders", "", rpctypes.ErrAuthFailed), ResolverErrorPermission},
+		{clientv3.ErrNoAvailableEndpoints, ResolverErrorWatch},
+		{errors.New("connection reset"), ResolverErrorWatch},
+	} {
+		if got := watchErrorClass(tc.err); got != tc.want {
+			t.Errorf("watchErrorClass(%v): got %q, want %q", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestResolverErrorClassZeroInstances(t *testing.T) {
+	var metrics errorCounter
+	service := testService(t)
+	r := newTestRegistry(t, WithMetrics(&metrics))
+	cc, _ := buildResolver(t, r, r.Target(service))
+	expectReported(t, cc, service, ResolverErrorNoInstances)
+	metrics.expect(t, service, ResolverErrorNoInstances)
+}
+
+func TestResolverErrorClassWatch(t *testing.T) {
+	var metrics errorCounter
+	srv := etcdtest.Start(t)
+	service := testService(t)
+	r := newRegistryOn(t, srv, WithMetrics(&metrics), WithRequestTimeout(500*time.Millisecond))
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+	cc, rsv := buildResolver(t, r, r.Target(service))
+	waitAddrs(t, cc, "10.0.0.1:80")
+
+	srv.Stop()
+	rsv.ResolveNow(resolver.ResolveNowOptions{})
+	if err := expectReported(t, cc, service, ResolverErrorWatch); err.Err == nil {
+		t.Error("watch error without a cause")
+	}
+	metrics.expect(t, service, ResolverErrorWatch)
+}
+
+func TestResolverErrorClassPermission(t *testing.T) {
+	var metrics errorCounter
+	srv := etcdtest.Start(t, etcdtest.WithAuth("registry", "secret"))
+	service := testService(t)
+	// reader只能读取其他前缀
+	ctx := testContext(t)
+	admin := srv.Client()
+	for _, step := range []func() error{
+		func() error { _, err := admin.RoleAdd(ctx, "elsewhere"); return err },
+		func() error {
+			_, err := admin.RoleGrantPermission(ctx, "elsewhere", "/elsewhere/", clientv3.GetPrefixRangeEnd("/elsewhere/"), clientv3.PermissionType(clientv3.PermRead))
+			return err
+		},
+		func() error { _, err := admin.UserAdd(ctx, "reader", "pw"); return err },
+		func() error { _, err := admin.UserGrantRole(ctx, "reader", "elsewhere"); return err },
+	} {
+		if err := step(); err != nil {
+			t.Fatalf("set up reader: %v", err)
+		}
+	}
+	config := srv.ClientConfig()
+	config.Username, config.Password = "", ""
+	r, err := NewEtcdRegistryWithConfig(config, testTTL, WithAuth("reader", "pw"), WithoutPreflight(), WithMetrics(&metrics))
+	if err != nil {
+		t.Fatalf("new registry: %v", err)
+	}
+	defer r.Close()
+
+	cc, _ := buildResolver(t, r, r.Target(service))
+	if err := expectReported(t, cc, service, ResolverErrorPermission); classifyError(err.Err) != ErrPermissionDenied {
+		t.Errorf("permission error cause: got %v, want an etcd permission error", err.Err)
+	}
+	metrics.expect(t, service, ResolverErrorPermission)
+}
@@ -0,0 +1,106 @@
+// registry/retry.go
+package registry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// retryPolicy 同步etcd请求的重试策略
+type retryPolicy struct {
+	// attempts 最多尝试次数，包括第一次
+	attempts  int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	// retriable 判断错误是否可以重试
+	retriable func(error) bool
+}
+
+func defaultRetryPolicy() retryPolicy {
+	return retryPolicy{
+		attempts:  3,
+		baseDelay: 100 * time.Millisecond,
+		maxDelay:  time.Second,
+		retriable: IsRetriable,
+	}
+}
+
+// delay 第attempt次重试前的等待时间，按指数增长并加入最多20%的随机抖动
+func (p retryPolicy) delay(attempt int) time.Duration {
+	delay := p.baseDelay
+	for i := 0; i < attempt && delay < p.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.maxDelay {
+		delay = p.maxDelay
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay/5)+1))
+}
+
+// IsRetriable 默认的重试判断：只有etcd暂时不可达的错误才重试，
+// 认证失败、参数错误、租约不存在和主动取消都不会重试
+func IsRetriable(err error) bool {
+	switch {
+	case err == nil, errors.Is(err, context.Canceled):
+		return false
+	case errors.Is(err, rpctypes.ErrLeaseNotFound), errors.Is(err, rpctypes.ErrPermissionDenied),
+		errors.Is(err, rpctypes.ErrAuthFailed), errors.Is(err, rpctypes.ErrUserEmpty):
+		return false
+	}
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.PermissionDenied, codes.Unauthenticated, codes.FailedPrecondition:
+		return false
+	}
+	return errors.Is(classifyError(err), ErrEtcdUnavailable)
+}
+
+// retry 按重试策略执行同步etcd请求，每次重试前以debug级别记录日志
+// op为操作名称，service用于日志字段；每次尝试受WithRequestTimeout限制，etcd不可达时不会一直阻塞；
+// ctx结束时停止重试并返回最后一次的错误
+// 注册中心关闭后返回ErrRegistryClosed，关闭时会等待进行中的请求结束
+func (r *EtcdRegistry) retry(ctx context.Context, op, service string, fn func(ctx context.Context) error) error {
+	if err := r.begin(); err != nil {
+		return err
+	}
+	defer r.end()
+
+	policy := r.opts.retry
+	var err error
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, r.opts.requestTimeout)
+		err = fn(attemptCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if attempt+1 >= policy.attempts {
+			return err
+		}
+		if r.handleAuthError(ctx, err) {
+			// 重新认证后立即重试
+			continue
+		}
+		if !policy.retriable(err) {
+			return err
+		}
+
+		delay := policy.delay(attempt)
+		r.opts.logger.Debug("retrying etcd operation",
+			"op", op, "service", service, "attempt", attempt+1, "delay", delay, "error", err)
+		spanFromContext(ctx).AddEvent("retry",
+			"op", op, "attempt", attempt+1, "delay", delay.String(), "error", err.Error())
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// registry/routing.go
+package registry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// activeVersionKey 服务蓝绿切换生效版本在etcd中的key
+func activeVersionKey(serviceName string) string {
+	return fmt.Sprintf("/routing/%s/active-version", serviceName)
+}
+
+// SetActiveVersion 设置服务当前生效的版本，所有客户端的resolver只会推送该版本的实例
+func (r *EtcdRegistry) SetActiveVersion(serviceName, version string) error {
+	version = strings.TrimSpace(version)
+	if version == "" {
+		return fmt.Errorf("active version of service %s must not be empty, use ClearActiveVersion to serve all versions", serviceName)
+	}
+	return r.retry(r.ctx, "set-active-version", serviceName, func(ctx context.Context) error {
+		_, err := r.kv.Put(ctx, activeVersionKey(serviceName), version)
+		return err
+	})
+}
+
+// GetActiveVersion 读取服务当前生效的版本，未设置时ok为false
+func (r *EtcdRegistry) GetActiveVersion(serviceName string) (version string, ok bool, err error) {
+	var resp *clientv3.GetResponse
+	err = r.retry(r.ctx, "get-active-version", serviceName, func(ctx context.Context) (err error) {
+		resp, err = r.kv.Get(ctx, activeVersionKey(serviceName))
+		return err
+	})
+	if err != nil {
+		return "", false, err
+	}
+	if len(resp.Kvs) == 0 {
+		return "", false, nil
+	}
+	return strings.TrimSpace(string(resp.Kvs[0].Value)), true, nil
+}
+
+// ClearActiveVersion 删除服务的生效版本，恢复为推送全部版本
+func (r *EtcdRegistry) ClearActiveVersion(serviceName string) error {
+	return r.retry(r.ctx, "clear-active-version", serviceName, func(ctx context.Context) error {
+		_, err := r.kv.Delete(ctx, activeVersionKey(serviceName))
+		return err
+	})
+}
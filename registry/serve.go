@@ -0,0 +1,176 @@
+// registry/serve.go
+package registry
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// ServeAndRegister 默认的排空等待和强制停止超时
+const (
+	DefaultDrainPeriod = 5 * time.Second
+	DefaultStopTimeout = 30 * time.Second
+)
+
+// ServeOption ServeAndRegister的配置项
+type ServeOption func(*serveOptions)
+
+type serveOptions struct {
+	drainPeriod time.Duration
+	stopTimeout time.Duration
+	signals     []os.Signal
+	// serverServices 不为nil时按srv上的gRPC服务注册，见WithServerServices
+	serverServices []ServiceNameOption
+}
+
+// WithDrainPeriod 设置注销后、GracefulStop前的等待时长，供客户端收到注销推送并停止发送新请求，默认DefaultDrainPeriod
+func WithDrainPeriod(d time.Duration) ServeOption {
+	return func(o *serveOptions) {
+		o.drainPeriod = d
+	}
+}
+
+// WithStopTimeout 设置GracefulStop的最长等待时间，超时后调用Stop强制关闭连接，默认DefaultStopTimeout，0表示不限制
+func WithStopTimeout(d time.Duration) ServeOption {
+	return func(o *serveOptions) {
+		o.stopTimeout = d
+	}
+}
+
+// WithServerServices 按srv上注册的gRPC服务名逐个注册，info作为除Name外其他字段的模板，见RegisterServer
+// 所有服务共享一个租约，退出时在一个事务中一起注销
+func WithServerServices(opts ...ServiceNameOption) ServeOption {
+	return func(o *serveOptions) {
+		o.serverServices = append([]ServiceNameOption{}, opts...)
+	}
+}
+
+// WithShutdownSignals 设置触发优雅退出的信号，默认SIGTERM和os.Interrupt，不传参数表示不监听信号
+func WithShutdownSignals(signals ...os.Signal) ServeOption {
+	return func(o *serveOptions) {
+		o.signals = signals
+	}
+}
+
+// ServeAndRegister 在lis上运行srv并注册info，阻塞直到ctx结束、收到退出信号或Serve出错
+//
+// 只在srv开始接受连接后才注册，避免客户端连到尚未服务的地址；
+// 退出时先注销实例，等待排空时长让客户端移除该地址，再调用GracefulStop，超过强制停止超时后调用Stop。
+// ctx结束或收到信号时正常退出返回注销的错误，Serve出错时先注销再返回Serve的错误
+func ServeAndRegister(ctx context.Context, srv *grpc.Server, lis net.Listener, info ServiceInfo, reg *EtcdRegistry, opts ...ServeOption) error {
+	o := &serveOptions{
+		drainPeriod: DefaultDrainPeriod,
+		stopTimeout: DefaultStopTimeout,
+		signals:     []os.Signal{syscall.SIGTERM, os.Interrupt},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if len(o.signals) > 0 {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, o.signals...)
+		defer stop()
+	}
+	logger := reg.opts.logger
+
+	accepting := &acceptingListener{Listener: lis, accepting: make(chan struct{})}
+	serveErr := make(chan error, 1)
+	goLabeled(goroutineLabels(LabelOpServe, "service", info.Name, "address", info.Address), func() {
+		serveErr <- srv.Serve(accepting)
+	})
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+		srv.Stop()
+		<-serveErr
+		return nil
+	case <-accepting.accepting:
+	}
+
+	infos := []*ServiceInfo{&info}
+	if o.serverServices != nil {
+		var err error
+		if infos, err = reg.RegisterServer(ctx, srv, info, o.serverServices...); err != nil {
+			srv.Stop()
+			<-serveErr
+			return err
+		}
+	} else if err := reg.RegisterServiceContext(ctx, &info); err != nil {
+		srv.Stop()
+		<-serveErr
+		return err
+	}
+	unregister := func() error {
+		err := reg.UnregisterServices(context.Background(), infos)
+		if errors.Is(err, ErrNotRegistered) {
+			return nil
+		}
+		return err
+	}
+
+	select {
+	case err := <-serveErr:
+		// Serve异常退出时监听已关闭，仍需尽快注销以免客户端持续连接失败
+		logger.Error("grpc server stopped unexpectedly, deregistering",
+			"service", info.Name, "address", info.Address, "error", err)
+		if unregisterErr := unregister(); unregisterErr != nil {
+			logger.Warn("deregister after serve failure failed", "service", info.Name, "address", info.Address, "error", unregisterErr)
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("shutting down grpc server, deregistering",
+		"service", info.Name, "address", info.Address, "drain", o.drainPeriod, "cause", context.Cause(ctx))
+	err := unregister()
+	if o.drainPeriod > 0 {
+		time.Sleep(o.drainPeriod)
+	}
+	stopCtx := context.Background()
+	if o.stopTimeout > 0 {
+		var cancel context.CancelFunc
+		stopCtx, cancel = context.WithTimeout(stopCtx, o.stopTimeout)
+		defer cancel()
+	}
+	gracefulStop(stopCtx, srv, logger)
+	<-serveErr
+	return err
+}
+
+// gracefulStop 调用GracefulStop，ctx结束后调用Stop中断仍在进行的请求
+func gracefulStop(ctx context.Context, srv *grpc.Server, logger Logger) {
+	done := make(chan struct{})
+	goLabeled(goroutineLabels(LabelOpServe), func() {
+		srv.GracefulStop()
+		close(done)
+	})
+	select {
+	case <-done:
+	case <-ctx.Done():
+		logger.Warn("graceful stop timed out, stopping grpc server", "cause", context.Cause(ctx))
+		srv.Stop()
+		<-done
+	}
+}
+
+// acceptingListener 在第一次Accept时关闭accepting，表示Serve已开始接受连接
+type acceptingListener struct {
+	net.Listener
+	once      sync.Once
+	accepting chan struct{}
+}
+
+func (l *acceptingListener) Accept() (net.Conn, error) {
+	l.once.Do(func() { close(l.accepting) })
+	return l.Listener.Accept()
+}
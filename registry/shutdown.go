@@ -0,0 +1,229 @@
+// registry/shutdown.go
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// ShutdownPhase 优雅退出的阶段，按取值从小到大依次执行
+type ShutdownPhase int
+
+const (
+	// PhaseWithdraw 从服务发现中摘除实例，客户端不再选择本进程
+	PhaseWithdraw ShutdownPhase = iota
+	// PhaseDrain 等待客户端收到摘除推送并停止发送新请求
+	PhaseDrain
+	// PhaseStopServing 停止接受连接并等待进行中的请求结束
+	PhaseStopServing
+	// PhaseCleanup 关闭注册中心、数据库连接等资源
+	PhaseCleanup
+
+	numShutdownPhases = iota
+)
+
+// DefaultPhaseTimeout 每个阶段默认的超时时间
+const DefaultPhaseTimeout = 30 * time.Second
+
+func (p ShutdownPhase) String() string {
+	switch p {
+	case PhaseWithdraw:
+		return "withdraw"
+	case PhaseDrain:
+		return "drain"
+	case PhaseStopServing:
+		return "stop-serving"
+	case PhaseCleanup:
+		return "cleanup"
+	default:
+		return fmt.Sprintf("phase(%d)", int(p))
+	}
+}
+
+// ShutdownOption Shutdown的配置项
+type ShutdownOption func(*Shutdown)
+
+// WithPhaseTimeout 设置阶段的超时时间，默认DefaultPhaseTimeout；超时后ctx被取消，进入下一阶段
+func WithPhaseTimeout(phase ShutdownPhase, timeout time.Duration) ShutdownOption {
+	return func(s *Shutdown) {
+		if phase >= 0 && phase < numShutdownPhases {
+			s.timeouts[phase] = timeout
+		}
+	}
+}
+
+// WithTriggerSignals 设置Wait监听的退出信号，默认SIGTERM和os.Interrupt，不传参数表示不监听信号
+func WithTriggerSignals(signals ...os.Signal) ShutdownOption {
+	return func(s *Shutdown) {
+		s.signals = signals
+	}
+}
+
+// WithShutdownLogger 设置记录各阶段执行情况的日志，默认不记录
+func WithShutdownLogger(logger Logger) ShutdownOption {
+	return func(s *Shutdown) {
+		if logger == nil {
+			logger = noopLogger{}
+		}
+		s.logger = logger
+	}
+}
+
+// Shutdown 按阶段协调优雅退出，可以在多个goroutine中并发调用
+//
+// 各阶段依次执行，同一阶段的步骤按添加顺序执行；步骤出错或panic时记录错误并继续执行后续步骤和阶段，
+// 全部阶段结束后返回汇总的错误
+type Shutdown struct {
+	timeouts [numShutdownPhases]time.Duration
+	signals  []os.Signal
+	logger   Logger
+
+	mu    sync.Mutex
+	steps [numShutdownPhases][]shutdownStep
+
+	once sync.Once
+	err  error
+}
+
+type shutdownStep struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// NewShutdown 创建退出协调器
+func NewShutdown(opts ...ShutdownOption) *Shutdown {
+	s := &Shutdown{
+		signals: []os.Signal{syscall.SIGTERM, os.Interrupt},
+		logger:  noopLogger{},
+	}
+	for i := range s.timeouts {
+		s.timeouts[i] = DefaultPhaseTimeout
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Add 在phase中添加一个步骤，ctx在阶段超时后取消
+func (s *Shutdown) Add(phase ShutdownPhase, name string, fn func(ctx context.Context) error) {
+	if phase < 0 || phase >= numShutdownPhases {
+		panic(fmt.Sprintf("registry: invalid shutdown phase %d", int(phase)))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.steps[phase] = append(s.steps[phase], shutdownStep{name: name, fn: fn})
+}
+
+// Withdraw 在PhaseWithdraw中注销reg上的实例，一个事务内完成；不传infos时注销reg当前注册的全部实例
+func (s *Shutdown) Withdraw(reg *EtcdRegistry, infos ...*ServiceInfo) {
+	s.Add(PhaseWithdraw, "withdraw registrations", func(ctx context.Context) error {
+		targets := infos
+		if len(targets) == 0 {
+			targets = reg.registeredServices()
+		}
+		err := reg.UnregisterServices(ctx, targets)
+		if errors.Is(err, ErrNotRegistered) {
+			return nil
+		}
+		return err
+	})
+}
+
+// DrainFor 在PhaseDrain中等待d，ctx提前结束时不再等待
+func (s *Shutdown) DrainFor(d time.Duration) {
+	s.Add(PhaseDrain, "drain", func(ctx context.Context) error {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		return nil
+	})
+}
+
+// StopServer 在PhaseStopServing中调用srv.GracefulStop，阶段超时后调用Stop强制关闭连接
+func (s *Shutdown) StopServer(srv *grpc.Server) {
+	s.Add(PhaseStopServing, "stop grpc server", func(ctx context.Context) error {
+		gracefulStop(ctx, srv, s.logger)
+		return nil
+	})
+}
+
+// CloseRegistry 在PhaseCleanup中关闭reg，等待时间为阶段剩余的时间
+func (s *Shutdown) CloseRegistry(reg *EtcdRegistry) {
+	s.Add(PhaseCleanup, "close registry", func(ctx context.Context) error {
+		timeout := defaultCloseTimeout
+		if deadline, ok := ctx.Deadline(); ok {
+			timeout = time.Until(deadline)
+		}
+		return reg.CloseWithTimeout(timeout)
+	})
+}
+
+// Wait 阻塞直到ctx结束或收到退出信号，然后执行Run并返回其结果
+func (s *Shutdown) Wait(ctx context.Context) error {
+	if len(s.signals) > 0 {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, s.signals...)
+		defer stop()
+	}
+	<-ctx.Done()
+	s.logger.Info("shutdown triggered", "cause", context.Cause(ctx))
+	return s.Run()
+}
+
+// Run 依次执行各阶段，只执行一次，重复调用返回第一次的结果
+func (s *Shutdown) Run() error {
+	s.once.Do(func() {
+		s.mu.Lock()
+		steps := s.steps
+		s.mu.Unlock()
+
+		var errs []error
+		for phase, phaseSteps := range steps {
+			errs = append(errs, s.runPhase(ShutdownPhase(phase), phaseSteps)...)
+		}
+		s.err = errors.Join(errs...)
+	})
+	return s.err
+}
+
+// runPhase 执行一个阶段的步骤，返回出错步骤的错误
+func (s *Shutdown) runPhase(phase ShutdownPhase, steps []shutdownStep) []error {
+	if len(steps) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeouts[phase])
+	defer cancel()
+
+	start := time.Now()
+	var errs []error
+	for _, step := range steps {
+		if err := runStep(ctx, step); err != nil {
+			s.logger.Warn("shutdown step failed", "phase", phase.String(), "step", step.name, "error", err)
+			errs = append(errs, fmt.Errorf("shutdown %s: %s: %w", phase, step.name, err))
+		}
+	}
+	s.logger.Info("shutdown phase finished", "phase", phase.String(), "steps", len(steps), "errors", len(errs), "duration", time.Since(start))
+	return errs
+}
+
+// runStep 执行步骤，panic作为错误返回
+func runStep(ctx context.Context, step shutdownStep) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panicked: %v", p)
+		}
+	}()
+	return step.fn(ctx)
+}
@@ -0,0 +1,102 @@
+// registry/slog.go
+package registry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/YuanJey/grpc-etcd/pkg/config"
+)
+
+// ConfigLogger 按config.Log创建的日志，基于log/slog，级别可以在运行时修改
+type ConfigLogger struct {
+	logger *slog.Logger
+	level  *slog.LevelVar
+	closer io.Closer
+}
+
+// NewLoggerFromConfig 按日志配置创建注册中心日志，通过WithLogger使用
+// Output为文件时以追加方式打开，不再使用时应调用Close；配合FollowConfig时修改级别无需重新创建注册中心
+func NewLoggerFromConfig(cfg config.Log) (*ConfigLogger, error) {
+	level := new(slog.LevelVar)
+	if err := setLevel(level, cfg.Level); err != nil {
+		return nil, err
+	}
+
+	var out io.Writer
+	var closer io.Closer
+	switch cfg.Output {
+	case "", "stderr":
+		out = os.Stderr
+	case "stdout":
+		out = os.Stdout
+	default:
+		file, err := os.OpenFile(cfg.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("open log output: %w", err)
+		}
+		out, closer = file, file
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch cfg.Format {
+	case "", config.LogFormatConsole:
+		handler = slog.NewTextHandler(out, opts)
+	case config.LogFormatJSON:
+		handler = slog.NewJSONHandler(out, opts)
+	default:
+		if closer != nil {
+			closer.Close()
+		}
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+	return &ConfigLogger{logger: slog.New(handler), level: level, closer: closer}, nil
+}
+
+// SetLevel 修改日志级别
+func (l *ConfigLogger) SetLevel(level string) error {
+	return setLevel(l.level, level)
+}
+
+// Close 关闭日志文件，输出到stdout或stderr时不做任何事
+func (l *ConfigLogger) Close() error {
+	if l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+func (l *ConfigLogger) Debug(msg string, keyvals ...any) {
+	l.logger.Log(context.Background(), slog.LevelDebug, msg, keyvals...)
+}
+
+func (l *ConfigLogger) Info(msg string, keyvals ...any) {
+	l.logger.Log(context.Background(), slog.LevelInfo, msg, keyvals...)
+}
+
+func (l *ConfigLogger) Warn(msg string, keyvals ...any) {
+	l.logger.Log(context.Background(), slog.LevelWarn, msg, keyvals...)
+}
+
+func (l *ConfigLogger) Error(msg string, keyvals ...any) {
+	l.logger.Log(context.Background(), slog.LevelError, msg, keyvals...)
+}
+
+// setLevel 解析级别名称，空字符串表示info
+func setLevel(v *slog.LevelVar, level string) error {
+	if level == "" {
+		v.Set(slog.LevelInfo)
+		return nil
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.ToLower(level))); err != nil {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+	v.Set(l)
+	return nil
+}
@@ -0,0 +1,223 @@
+// registry/slowops.go
+package registry
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// etcd请求类型，用作op标签和OpLatencyStats.Op
+const (
+	OpPut           = "put"
+	OpGet           = "get"
+	OpDelete        = "delete"
+	OpCompact       = "compact"
+	OpDo            = "do"
+	OpTxn           = "txn"
+	OpGrant         = "grant"
+	OpRevoke        = "revoke"
+	OpTimeToLive    = "time_to_live"
+	OpLeases        = "leases"
+	OpKeepAliveOnce = "keepalive_once"
+)
+
+// latencyWindow 计算p99使用的每类请求最近耗时样本数
+const latencyWindow = 512
+
+// OpLatencyStats 一类etcd请求的耗时统计
+type OpLatencyStats struct {
+	Op string `json:"op"`
+	// Count 和Slow 创建以来的请求数和超过慢请求阈值的请求数
+	Count uint64 `json:"count"`
+	Slow  uint64 `json:"slow"`
+	// P99Seconds 最近latencyWindow次请求耗时的p99
+	P99Seconds float64 `json:"p99Seconds"`
+}
+
+// opLatency 按请求类型记录etcd请求耗时
+type opLatency struct {
+	threshold time.Duration
+	metrics   Metrics
+	logger    Logger
+
+	mu  sync.Mutex
+	ops map[string]*latencySamples
+}
+
+// latencySamples 一类请求的计数和最近耗时的环形缓冲
+type latencySamples struct {
+	count   uint64
+	slow    uint64
+	samples []time.Duration
+	next    int
+}
+
+func newOpLatency(o *options) *opLatency {
+	return &opLatency{
+		threshold: o.slowOpThreshold,
+		metrics:   o.metrics,
+		logger:    o.logger,
+		ops:       make(map[string]*latencySamples),
+	}
+}
+
+// observe 记录一次从start开始的请求，超过阈值时输出警告并增加慢请求计数
+func (l *opLatency) observe(op, key string, start time.Time) {
+	d := time.Since(start)
+	slow := l.threshold > 0 && d >= l.threshold
+
+	l.mu.Lock()
+	s, ok := l.ops[op]
+	if !ok {
+		s = &latencySamples{}
+		l.ops[op] = s
+	}
+	s.count++
+	if slow {
+		s.slow++
+	}
+	if len(s.samples) < latencyWindow {
+		s.samples = append(s.samples, d)
+	} else {
+		s.samples[s.next] = d
+		s.next = (s.next + 1) % latencyWindow
+	}
+	l.mu.Unlock()
+
+	labels := map[string]string{LabelOp: op}
+	l.metrics.ObserveHistogram(MetricEtcdOpDuration, labels, d.Seconds())
+	if !slow {
+		return
+	}
+	l.metrics.IncCounter(MetricEtcdSlowOps, labels, 1)
+	keyvals := []any{"op", op, "duration", d, "threshold", l.threshold}
+	if key != "" {
+		keyvals = append(keyvals, "key", key)
+	}
+	l.logger.Warn("slow etcd operation", keyvals...)
+}
+
+// stats 返回按请求类型排序的耗时统计
+func (l *opLatency) stats() []OpLatencyStats {
+	l.mu.Lock()
+	stats := make([]OpLatencyStats, 0, len(l.ops))
+	samples := make([][]time.Duration, 0, len(l.ops))
+	for op, s := range l.ops {
+		stats = append(stats, OpLatencyStats{Op: op, Count: s.count, Slow: s.slow})
+		samples = append(samples, slices.Clone(s.samples))
+	}
+	l.mu.Unlock()
+
+	// 排序在锁外进行，避免阻塞正在记录耗时的请求
+	for i, durations := range samples {
+		stats[i].P99Seconds = percentile(durations, 0.99).Seconds()
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Op < stats[j].Op })
+	return stats
+}
+
+// percentile 返回样本的p分位数，会对样本原地排序
+func percentile(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	slices.Sort(durations)
+	return durations[int(float64(len(durations)-1)*p)]
+}
+
+// timedKV 记录每次请求耗时的KV
+type timedKV struct {
+	clientv3.KV
+	latency *opLatency
+}
+
+func (kv *timedKV) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	defer kv.latency.observe(OpPut, key, time.Now())
+	return kv.KV.Put(ctx, key, val, opts...)
+}
+
+func (kv *timedKV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	defer kv.latency.observe(OpGet, key, time.Now())
+	return kv.KV.Get(ctx, key, opts...)
+}
+
+func (kv *timedKV) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	defer kv.latency.observe(OpDelete, key, time.Now())
+	return kv.KV.Delete(ctx, key, opts...)
+}
+
+func (kv *timedKV) Compact(ctx context.Context, rev int64, opts ...clientv3.CompactOption) (*clientv3.CompactResponse, error) {
+	defer kv.latency.observe(OpCompact, "", time.Now())
+	return kv.KV.Compact(ctx, rev, opts...)
+}
+
+func (kv *timedKV) Do(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error) {
+	defer kv.latency.observe(OpDo, string(op.KeyBytes()), time.Now())
+	return kv.KV.Do(ctx, op)
+}
+
+func (kv *timedKV) Txn(ctx context.Context) clientv3.Txn {
+	return &timedTxn{Txn: kv.KV.Txn(ctx), latency: kv.latency}
+}
+
+// timedTxn 在Commit时记录耗时的事务
+type timedTxn struct {
+	clientv3.Txn
+	latency *opLatency
+}
+
+func (txn *timedTxn) If(cs ...clientv3.Cmp) clientv3.Txn {
+	txn.Txn = txn.Txn.If(cs...)
+	return txn
+}
+
+func (txn *timedTxn) Then(ops ...clientv3.Op) clientv3.Txn {
+	txn.Txn = txn.Txn.Then(ops...)
+	return txn
+}
+
+func (txn *timedTxn) Else(ops ...clientv3.Op) clientv3.Txn {
+	txn.Txn = txn.Txn.Else(ops...)
+	return txn
+}
+
+func (txn *timedTxn) Commit() (*clientv3.TxnResponse, error) {
+	defer txn.latency.observe(OpTxn, "", time.Now())
+	return txn.Txn.Commit()
+}
+
+// timedLease 记录每次请求耗时的Lease，KeepAlive心跳流不记录
+type timedLease struct {
+	clientv3.Lease
+	latency *opLatency
+}
+
+func (l *timedLease) Grant(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	defer l.latency.observe(OpGrant, "", time.Now())
+	return l.Lease.Grant(ctx, ttl)
+}
+
+func (l *timedLease) Revoke(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error) {
+	defer l.latency.observe(OpRevoke, "", time.Now())
+	return l.Lease.Revoke(ctx, id)
+}
+
+func (l *timedLease) TimeToLive(ctx context.Context, id clientv3.LeaseID, opts ...clientv3.LeaseOption) (*clientv3.LeaseTimeToLiveResponse, error) {
+	defer l.latency.observe(OpTimeToLive, "", time.Now())
+	return l.Lease.TimeToLive(ctx, id, opts...)
+}
+
+func (l *timedLease) Leases(ctx context.Context) (*clientv3.LeaseLeasesResponse, error) {
+	defer l.latency.observe(OpLeases, "", time.Now())
+	return l.Lease.Leases(ctx)
+}
+
+func (l *timedLease) KeepAliveOnce(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseKeepAliveResponse, error) {
+	defer l.latency.observe(OpKeepAliveOnce, "", time.Now())
+	return l.Lease.KeepAliveOnce(ctx, id)
+}
@@ -0,0 +1,108 @@
+// registry/split.go
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+)
+
+// TrafficSplit 按版本划分流量的百分比，例如 {"v2":10} 表示10%流量发往v2，
+// 剩余流量发往未列出的其他版本；所有版本都列出时按比例划分
+type TrafficSplit map[string]float64
+
+// Validate 校验百分比范围
+func (s TrafficSplit) Validate() error {
+	var total float64
+	for version, percent := range s {
+		if percent < 0 || percent > 100 {
+			return fmt.Errorf("traffic split for version %q must be within [0, 100], got %v", version, percent)
+		}
+		total += percent
+	}
+	if total > 100 {
+		return fmt.Errorf("traffic split percentages sum to %v, must not exceed 100", total)
+	}
+	return nil
+}
+
+// parseTrafficSplit 解析流量划分JSON
+func parseTrafficSplit(value []byte) (TrafficSplit, error) {
+	var split TrafficSplit
+	if err := json.Unmarshal(value, &split); err != nil {
+		return nil, fmt.Errorf("invalid traffic split: %v", err)
+	}
+	if err := split.Validate(); err != nil {
+		return nil, err
+	}
+	return split, nil
+}
+
+// trafficSplitKey 服务流量划分在etcd中的key
+func trafficSplitKey(serviceName string) string {
+	return fmt.Sprintf("/routing/%s/split", serviceName)
+}
+
+// SetTrafficSplit 写入服务的流量划分，所有监听该服务的客户端会实时生效
+func (r *EtcdRegistry) SetTrafficSplit(serviceName string, split TrafficSplit) error {
+	if err := split.Validate(); err != nil {
+		return err
+	}
+	value, err := json.Marshal(split)
+	if err != nil {
+		return err
+	}
+	return r.retry(r.ctx, "set-traffic-split", serviceName, func(ctx context.Context) error {
+		_, err := r.kv.Put(ctx, trafficSplitKey(serviceName), string(value))
+		return err
+	})
+}
+
+// DeleteTrafficSplit 删除服务的流量划分
+func (r *EtcdRegistry) DeleteTrafficSplit(serviceName string) error {
+	return r.retry(r.ctx, "delete-traffic-split", serviceName, func(ctx context.Context) error {
+		_, err := r.kv.Delete(ctx, trafficSplitKey(serviceName))
+		return err
+	})
+}
+
+// trafficSplitAttrKey resolver.State属性中保存流量划分的key
+type trafficSplitAttrKey struct{}
+
+// TrafficSplitFromState 读取resolver随resolver.State下发的流量划分
+func TrafficSplitFromState(attrs *attributes.Attributes) (TrafficSplit, bool) {
+	split, ok := attrs.Value(trafficSplitAttrKey{}).(*trafficSplitValue)
+	if !ok || split == nil {
+		return nil, false
+	}
+	return split.split, true
+}
+
+// trafficSplitValue 包装TrafficSplit以支持attributes比较
+type trafficSplitValue struct {
+	split TrafficSplit
+}
+
+// Equal 供attributes比较使用
+func (v *trafficSplitValue) Equal(o any) bool {
+	other, ok := o.(*trafficSplitValue)
+	if !ok || len(v.split) != len(other.split) {
+		return false
+	}
+	for version, percent := range v.split {
+		if op, ok := other.split[version]; !ok || op != percent {
+			return false
+		}
+	}
+	return true
+}
+
+func withTrafficSplit(state resolver.State, split TrafficSplit) resolver.State {
+	if split != nil {
+		state.Attributes = state.Attributes.WithValue(trafficSplitAttrKey{}, &trafficSplitValue{split: split})
+	}
+	return state
+}
@@ -0,0 +1,229 @@
+// registry/stats.go
+package registry
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RegistryStats 注册中心内部状态快照，可直接序列化为JSON用于调试接口
+type RegistryStats struct {
+	// Identity 注册中心标识，见Identity.String
+	Identity string `json:"identity"`
+	// Connectivity 注册实例的心跳状态，取值同ConnectivityState.String
+	Connectivity string `json:"connectivity"`
+	// Registrations 通过本注册中心注册的实例，按key排序
+	Registrations []RegistrationStats `json:"registrations"`
+	// Watches 活跃的服务watch，按前缀排序
+	Watches []WatchStats `json:"watches"`
+	// KeyWatches 活跃的单key watch数，例如路由版本和流量划分
+	KeyWatches int `json:"keyWatches"`
+	// CacheEntries Discover缓存中的服务数
+	CacheEntries int `json:"cacheEntries"`
+	// InflightOps和QueuedOps 进行中和排队的etcd请求数，见OpStats
+	InflightOps int64 `json:"inflightOps"`
+	QueuedOps   int64 `json:"queuedOps"`
+	// OpLatency 按请求类型的etcd请求耗时统计，按Op排序
+	OpLatency []OpLatencyStats `json:"opLatency"`
+	// Errors 创建以来的后台错误计数
+	Errors ErrorStats `json:"errors"`
+	// RecentErrors 最近的后台错误，从旧到新排列，最多保留recentErrorLimit条
+	RecentErrors []BackgroundError `json:"recentErrors"`
+	// History 最近的resolver推送、watch和租约事件，按时间从旧到新排列，见WithEventHistory
+	History []HistoryEvent `json:"history"`
+}
+
+// RegistrationStats 单个注册实例的状态
+type RegistrationStats struct {
+	Key     string `json:"key"`
+	Service string `json:"service"`
+	Address string `json:"address"`
+	Status  string `json:"status,omitempty"`
+	LeaseID int64  `json:"leaseId"`
+	// TTLRemainingSeconds 按最近一次心跳估算的租约剩余秒数，不访问etcd
+	TTLRemainingSeconds int64     `json:"ttlRemainingSeconds"`
+	LastKeepAlive       time.Time `json:"lastKeepAlive"`
+	// RenewalIntervalSeconds 测得的最近两次心跳响应间隔，正常约为TTL/3
+	RenewalIntervalSeconds float64 `json:"renewalIntervalSeconds"`
+	// GrantedTTLSeconds 最近一次心跳响应中etcd返回的TTL
+	GrantedTTLSeconds int64 `json:"grantedTtlSeconds"`
+	Failing           bool  `json:"failing"`
+	// LastInterruption 和LastInterruptionReason 最近一次心跳中断的时间和原因，取值见InterruptionClosed等，没有中断过时为零值
+	LastInterruption       time.Time `json:"lastInterruption"`
+	LastInterruptionReason string    `json:"lastInterruptionReason,omitempty"`
+	// LastRecoverySeconds 最近一次从心跳中断到新租约收到第一次心跳的秒数，尚未恢复过时为0
+	LastRecoverySeconds float64 `json:"lastRecoverySeconds,omitempty"`
+}
+
+// WatchStats 单个服务watch的状态
+type WatchStats struct {
+	Service     string `json:"service"`
+	Prefix      string `json:"prefix"`
+	Subscribers int    `json:"subscribers"`
+	Instances   int    `json:"instances"`
+	// LastEvent 最近一次收到watch事件的时间，尚未收到时为零值
+	LastEvent time.Time `json:"lastEvent"`
+	Revision  int64     `json:"revision"`
+	// Error 最近一次拉取失败的原因，拉取成功后清空
+	Error string `json:"error,omitempty"`
+}
+
+// ErrorStats 后台错误计数
+type ErrorStats struct {
+	LeaseLost          uint64 `json:"leaseLost"`
+	ReRegisterFailures uint64 `json:"reRegisterFailures"`
+	WatchErrors        uint64 `json:"watchErrors"`
+	HookPanics         uint64 `json:"hookPanics"`
+	// ErrorsDropped Errors通道因消费不及时丢弃的错误数
+	ErrorsDropped uint64 `json:"errorsDropped"`
+}
+
+// recentErrorLimit 最多保留的最近后台错误数
+const recentErrorLimit = 32
+
+// BackgroundError 一次后台错误，例如租约丢失、重新注册失败和watch出错
+type BackgroundError struct {
+	Time    time.Time `json:"time"`
+	Op      string    `json:"op"`
+	Service string    `json:"service,omitempty"`
+	Address string    `json:"address,omitempty"`
+	Error   string    `json:"error"`
+}
+
+// recentErrors 最近后台错误的环形缓冲
+type recentErrors struct {
+	mu      sync.Mutex
+	entries []BackgroundError
+	next    int
+}
+
+// add 记录一次错误，超出上限时覆盖最旧的记录
+func (e *recentErrors) add(entry BackgroundError) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.entries) < recentErrorLimit {
+		e.entries = append(e.entries, entry)
+		return
+	}
+	e.entries[e.next] = entry
+	e.next = (e.next + 1) % recentErrorLimit
+}
+
+// list 返回从旧到新排列的错误副本
+func (e *recentErrors) list() []BackgroundError {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	list := make([]BackgroundError, 0, len(e.entries))
+	list = append(list, e.entries[e.next:]...)
+	return append(list, e.entries[:e.next]...)
+}
+
+// recordError 增加错误计数并记录到最近错误中
+func (r *EtcdRegistry) recordError(counter *atomic.Uint64, op, service, address string, err error) {
+	counter.Add(1)
+	r.recentErrors.add(BackgroundError{Time: time.Now(), Op: op, Service: service, Address: address, Error: err.Error()})
+}
+
+// errorCounters 后台错误计数器
+type errorCounters struct {
+	leaseLost          atomic.Uint64
+	reRegisterFailures atomic.Uint64
+	watchErrors        atomic.Uint64
+	hookPanics         atomic.Uint64
+}
+
+// Stats 返回注册中心内部状态快照
+// 只读取内存中的记录，依次持有各自的锁，适合每隔几秒调用一次
+func (r *EtcdRegistry) Stats() RegistryStats {
+	stats := RegistryStats{
+		Identity:      r.opts.identity.String(),
+		Connectivity:  r.ConnectivityState().String(),
+		Registrations: r.registrationStats(),
+		Errors: ErrorStats{
+			LeaseLost:          r.errorCounts.leaseLost.Load(),
+			ReRegisterFailures: r.errorCounts.reRegisterFailures.Load(),
+			WatchErrors:        r.errorCounts.watchErrors.Load(),
+			HookPanics:         r.errorCounts.hookPanics.Load(),
+			ErrorsDropped:      r.ErrorsDropped(),
+		},
+		RecentErrors: r.recentErrors.list(),
+		History:      r.history.list(),
+	}
+	stats.Watches, stats.KeyWatches = r.hub.stats()
+	stats.CacheEntries = r.cache.len()
+	stats.InflightOps, stats.QueuedOps = r.OpStats()
+	stats.OpLatency = r.latency.stats()
+	return stats
+}
+
+// registrationStats 返回按key排序的注册实例状态
+func (r *EtcdRegistry) registrationStats() []RegistrationStats {
+	now := time.Now()
+	ttl := time.Duration(r.ttl) * time.Second
+
+	r.mu.Lock()
+	stats := make([]RegistrationStats, 0, len(r.registrations))
+	for _, reg := range r.registrations {
+		remaining := int64(0)
+		if !reg.failing && !reg.lastKeepAlive.IsZero() {
+			remaining = max(int64(reg.lastKeepAlive.Add(ttl).Sub(now).Seconds()), 0)
+		}
+		stats = append(stats, RegistrationStats{
+			Key:                    reg.key,
+			Service:                reg.info.Name,
+			Address:                reg.info.Address,
+			Status:                 reg.info.Status,
+			LeaseID:                int64(reg.leaseID),
+			TTLRemainingSeconds:    remaining,
+			LastKeepAlive:          reg.lastKeepAlive,
+			RenewalIntervalSeconds: reg.renewalInterval.Seconds(),
+			GrantedTTLSeconds:      reg.grantedTTL,
+			LastInterruption:       reg.lastInterruption,
+			LastInterruptionReason: reg.interruptionReason,
+			LastRecoverySeconds:    reg.lastRecovery.Seconds(),
+			Failing:                reg.failing,
+		})
+	}
+	r.mu.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Key < stats[j].Key })
+	return stats
+}
+
+// stats 返回按前缀排序的服务watch状态和单key watch数
+func (h *watchHub) stats() ([]WatchStats, int) {
+	h.mu.Lock()
+	watchers := make([]*serviceWatcher, 0, len(h.watchers))
+	for _, w := range h.watchers {
+		watchers = append(watchers, w)
+	}
+	keyWatches := len(h.keyWatchers)
+	h.mu.Unlock()
+
+	stats := make([]WatchStats, 0, len(watchers))
+	for _, w := range watchers {
+		stats = append(stats, w.stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Prefix < stats[j].Prefix })
+	return stats, keyWatches
+}
+
+// stats 返回服务watch的状态
+func (w *serviceWatcher) stats() WatchStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stats := WatchStats{
+		Service:     serviceNameFromPrefix(w.prefix),
+		Prefix:      w.prefix,
+		Subscribers: len(w.subscribers),
+		Instances:   len(w.instances),
+		LastEvent:   w.lastEvent,
+		Revision:    w.revision,
+	}
+	if w.err != nil {
+		stats.Error = w.err.Error()
+	}
+	return stats
+}
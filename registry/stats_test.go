@@ -0,0 +1,134 @@
+// registry/stats_test.go
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStatsSnapshot(t *testing.T) {
+	service := testService(t)
+	r := newTestRegistry(t, WithDiscoverCacheTTL(time.Minute), WithEventHistory(16))
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.2:80"})
+	if err := r.SetStatus(service, "10.0.0.2:80", StatusDraining); err != nil {
+		t.Fatalf("set status: %v", err)
+	}
+	var watch watchRecorder
+	if err := r.Watch(service, watch.callback); err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	if _, err := r.Discover(service); err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	var stats RegistryStats
+	eventually(t, "stats", func() error {
+		stats = r.Stats()
+		if len(stats.Registrations) != 2 {
+			return fmt.Errorf("registrations: %+v", stats.Registrations)
+		}
+		for _, reg := range stats.Registrations {
+			if reg.LastKeepAlive.IsZero() || reg.TTLRemainingSeconds <= 0 || reg.GrantedTTLSeconds != testTTL {
+				return fmt.Errorf("registration without keepalive: %+v", reg)
+			}
+		}
+		if len(stats.Watches) != 1 || stats.Watches[0].Instances != 2 {
+			return fmt.Errorf("watches: %+v", stats.Watches)
+		}
+		return nil
+	})
+
+	first, second := stats.Registrations[0], stats.Registrations[1]
+	if first.Key > second.Key {
+		t.Errorf("registrations not sorted by key: %s, %s", first.Key, second.Key)
+	}
+	for _, reg := range stats.Registrations {
+		if reg.Service != service || reg.LeaseID == 0 || reg.Failing || reg.TTLRemainingSeconds > testTTL {
+			t.Errorf("registration: %+v", reg)
+		}
+		if want := map[string]string{"10.0.0.1:80": "", "10.0.0.2:80": StatusDraining}[reg.Address]; reg.Status != want {
+			t.Errorf("%s status: got %q, want %q", reg.Address, reg.Status, want)
+		}
+	}
+	watchStats := stats.Watches[0]
+	if watchStats.Service != service || watchStats.Prefix != servicePrefix(service) ||
+		watchStats.Subscribers < 1 || watchStats.Revision == 0 || watchStats.Error != "" {
+		t.Errorf("watch: %+v", watchStats)
+	}
+	if stats.CacheEntries != 1 {
+		t.Errorf("cache entries: got %d, want 1", stats.CacheEntries)
+	}
+	if stats.Identity != r.Identity().String() || stats.Connectivity == "" {
+		t.Errorf("identity %q, connectivity %q", stats.Identity, stats.Connectivity)
+	}
+	if stats.Errors != (ErrorStats{}) || len(stats.RecentErrors) != 0 {
+		t.Errorf("errors without failures: %+v %+v", stats.Errors, stats.RecentErrors)
+	}
+	if len(stats.OpLatency) == 0 {
+		t.Error("no op latency")
+	}
+}
+
+func TestStatsJSON(t *testing.T) {
+	service := testService(t)
+	r := newTestRegistry(t, WithEventHistory(16))
+	mustRegister(t, r, &ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+	if err := r.Watch(service, func([]*ServiceInfo) {}); err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	stats := r.Stats()
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	// 字段名是调试接口的约定，改名会影响依赖它的工具
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	for _, key := range []string{"identity", "connectivity", "registrations", "watches", "keyWatches",
+		"cacheEntries", "inflightOps", "queuedOps", "opLatency", "errors", "recentErrors", "history"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("field %s missing from %s", key, data)
+		}
+	}
+	var registrations []map[string]any
+	if err := json.Unmarshal(fields["registrations"], &registrations); err != nil || len(registrations) != 1 {
+		t.Fatalf("registrations: %v, %s", err, fields["registrations"])
+	}
+	for _, key := range []string{"key", "service", "address", "leaseId", "ttlRemainingSeconds", "lastKeepAlive", "failing"} {
+		if _, ok := registrations[0][key]; !ok {
+			t.Errorf("registration field %s missing: %v", key, registrations[0])
+		}
+	}
+	var errorCounts map[string]uint64
+	if err := json.Unmarshal(fields["errors"], &errorCounts); err != nil {
+		t.Fatalf("errors: %v", err)
+	}
+	for _, key := range []string{"leaseLost", "reRegisterFailures", "watchErrors", "hookPanics", "errorsDropped"} {
+		if _, ok := errorCounts[key]; !ok {
+			t.Errorf("error count %s missing: %v", key, errorCounts)
+		}
+	}
+
+	// 反序列化后与原快照一致
+	var decoded RegistryStats
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal stats: %v", err)
+	}
+	again, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatalf("marshal decoded: %v", err)
+	}
+	var a, b any
+	json.Unmarshal(data, &a)
+	json.Unmarshal(again, &b)
+	if !reflect.DeepEqual(a, b) {
+		t.Errorf("round trip changed the snapshot:\n%s\n%s", data, again)
+	}
+}
@@ -0,0 +1,113 @@
+// registry/status.go
+package registry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// 实例注册状态，Status为空等同于StatusUp
+const (
+	// StatusUp 正常提供服务
+	StatusUp = "up"
+	// StatusDraining 正在下线，不再接收新请求
+	StatusDraining = "draining"
+	// StatusDown 暂停服务
+	StatusDown = "down"
+)
+
+// IsUp 实例是否处于可接收新请求的状态
+func (s *ServiceInfo) IsUp() bool {
+	return s.Status == "" || s.Status == StatusUp
+}
+
+// UpdateServiceInfo 更新已注册实例的服务信息，保留原有租约
+// 实例未注册时返回错误；Name和Address用于定位实例，不能通过本方法修改
+func (r *EtcdRegistry) UpdateServiceInfo(serviceInfo *ServiceInfo) error {
+	return r.UpdateServiceInfoContext(context.Background(), serviceInfo)
+}
+
+// UpdateServiceInfoContext 同UpdateServiceInfo，ctx用于取消请求和链路追踪
+func (r *EtcdRegistry) UpdateServiceInfoContext(ctx context.Context, serviceInfo *ServiceInfo) (err error) {
+	key := serviceKey(serviceInfo.Name, serviceInfo.Address)
+	ctx, span := r.startSpan(ctx, SpanUpdate)
+	span.SetAttributes("service", serviceInfo.Name, "address", serviceInfo.Address, "key", key)
+	defer func() { span.End(err) }()
+	ctx, cancel := r.opContext(ctx)
+	defer cancel()
+
+	if err := serviceInfo.Validate(); err != nil {
+		return wrapError("update", serviceInfo.Name, serviceInfo.Address, err)
+	}
+	value, err := r.encodeStamped(serviceInfo, time.Time{}, time.Time{})
+	if err != nil {
+		return wrapError("update", serviceInfo.Name, serviceInfo.Address, err)
+	}
+
+	var resp *clientv3.TxnResponse
+	err = r.retry(ctx, "update", serviceInfo.Name, func(ctx context.Context) (err error) {
+		resp, err = r.kv.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision(key), ">", 0)).
+			Then(clientv3.OpPut(key, value, clientv3.WithIgnoreLease())).
+			Commit()
+		return err
+	})
+	if err != nil {
+		return wrapError("update", serviceInfo.Name, serviceInfo.Address, err)
+	}
+	if !resp.Succeeded {
+		return newError("update", serviceInfo.Name, serviceInfo.Address, ErrNotRegistered)
+	}
+
+	// 心跳和重新注册会在后台读取reg.info，保存副本避免调用方之后的修改影响它们
+	info := *serviceInfo
+	r.mu.Lock()
+	if reg, ok := r.registrations[key]; ok {
+		reg.info = &info
+	}
+	r.mu.Unlock()
+	r.writeAudit(ctx, AuditUpdate, serviceInfo)
+	return nil
+}
+
+// SetStatus 修改已注册实例的状态，例如下线前设置为StatusDraining，
+// resolver在下一次watch事件中即停止向该实例分配新请求
+func (r *EtcdRegistry) SetStatus(serviceName, address, status string) error {
+	switch status {
+	case "", StatusUp, StatusDraining, StatusDown:
+	default:
+		return wrapError("update", serviceName, address, fmt.Errorf("%w: unknown status %q", ErrInvalidService, status))
+	}
+	var resp *clientv3.GetResponse
+	err := r.retry(r.ctx, "update", serviceName, func(ctx context.Context) (err error) {
+		resp, err = r.kv.Get(ctx, serviceKey(serviceName, address))
+		return err
+	})
+	if err != nil {
+		return wrapError("update", serviceName, address, err)
+	}
+	if len(resp.Kvs) == 0 {
+		return newError("update", serviceName, address, ErrNotRegistered)
+	}
+
+	service, err := r.codec.decode(resp.Kvs[0].Value)
+	if err != nil {
+		return wrapError("update", serviceName, address, fmt.Errorf("invalid registration: %v", err))
+	}
+	service.Status = status
+	return r.UpdateServiceInfo(service)
+}
+
+// upServices 过滤掉非up状态的实例
+func upServices(services []*ServiceInfo) []*ServiceInfo {
+	up := make([]*ServiceInfo, 0, len(services))
+	for _, service := range services {
+		if service.IsUp() {
+			up = append(up, service)
+		}
+	}
+	return up
+}
@@ -0,0 +1,52 @@
+// registry/subset.go
+package registry
+
+import (
+	"hash/fnv"
+	"sort"
+)
+
+// selectSubset 使用rendezvous哈希为客户端选出最多size个实例，结果按地址排序
+// 每个实例的得分只取决于客户端标识和实例地址，成员变化时已选中的实例只会被得分更高的新实例替换
+func selectSubset(services []*ServiceInfo, clientID string, size int) []*ServiceInfo {
+	if len(services) <= size {
+		return services
+	}
+
+	type scored struct {
+		service *ServiceInfo
+		score   uint64
+	}
+	candidates := make([]scored, 0, len(services))
+	for _, service := range services {
+		candidates = append(candidates, scored{service: service, score: rendezvousScore(clientID, service.Address)})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].service.Address < candidates[j].service.Address
+	})
+
+	subset := make([]*ServiceInfo, 0, size)
+	for _, c := range candidates[:size] {
+		subset = append(subset, c.service)
+	}
+	sort.Slice(subset, func(i, j int) bool { return subset[i].Address < subset[j].Address })
+	return subset
+}
+
+func rendezvousScore(clientID, address string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(clientID))
+	h.Write([]byte{0})
+	h.Write([]byte(address))
+	// fnv对相近输入的高位区分度不足，再做一次混合
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,131 @@
+// registry/supervisor.go
+package registry
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errorChannelSize Errors通道的容量
+const errorChannelSize = 16
+
+// RegistryErrorKind 持续性后台错误的类型
+type RegistryErrorKind string
+
+const (
+	// ErrorReRegisterExhausted 租约丢失后重新注册持续失败超过阈值，注册中心仍会继续重试
+	ErrorReRegisterExhausted RegistryErrorKind = "re-register-exhausted"
+	// ErrorWatchFailed 服务watch持续无法从etcd拉取实例超过阈值，resolver和Watch回调停留在旧的实例列表上
+	ErrorWatchFailed RegistryErrorKind = "watch-failed"
+	// ErrorEtcdUnreachable 后台etcd交互（心跳、拉取、watch）持续失败超过阈值
+	ErrorEtcdUnreachable RegistryErrorKind = "etcd-unreachable"
+)
+
+// RegistryError Errors通道中的持续性后台错误
+// 同一故障只在持续时间首次超过WithFailureThreshold时发送一次，恢复后再次出现故障会重新发送
+type RegistryError struct {
+	Kind RegistryErrorKind
+	// Service和Address 出错的服务和实例，ErrorEtcdUnreachable时为空，ErrorWatchFailed时Address为空
+	Service string
+	Address string
+	// Err 最近一次失败的原因
+	Err error
+	// Since 故障开始的时间
+	Since time.Time
+}
+
+func (e RegistryError) Error() string {
+	msg := fmt.Sprintf("registry: %s", e.Kind)
+	if e.Service != "" {
+		msg += " " + e.Service
+	}
+	if e.Address != "" {
+		msg += " at " + e.Address
+	}
+	return fmt.Sprintf("%s since %s: %v", msg, e.Since.Format(time.RFC3339), e.Err)
+}
+
+// Unwrap 返回最近一次失败的原因
+func (e RegistryError) Unwrap() error {
+	return e.Err
+}
+
+// errorChannel 有界的错误通道，满时丢弃最旧的错误，发送方永不阻塞
+type errorChannel struct {
+	mu      sync.Mutex
+	ch      chan RegistryError
+	closed  bool
+	dropped atomic.Uint64
+}
+
+func newErrorChannel(size int) *errorChannel {
+	return &errorChannel{ch: make(chan RegistryError, size)}
+}
+
+// send 发送错误，通道已满时丢弃最旧的错误，关闭后忽略
+func (c *errorChannel) send(e RegistryError) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	for {
+		select {
+		case c.ch <- e:
+			return
+		default:
+		}
+		select {
+		case <-c.ch:
+			c.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+// close 关闭通道，重复调用是安全的
+func (c *errorChannel) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.ch)
+	}
+}
+
+// Errors 返回持续性后台错误的通道，供监管协程决定退出或降级，Close时关闭
+// 通道容量有限，消费不及时时丢弃最旧的错误，丢弃数见ErrorsDropped；
+// 所有调用返回同一个通道，多个消费者会分摊其中的错误
+func (r *EtcdRegistry) Errors() <-chan RegistryError {
+	return r.errs.ch
+}
+
+// ErrorsDropped 返回Errors通道因消费不及时丢弃的错误数
+func (r *EtcdRegistry) ErrorsDropped() uint64 {
+	return r.errs.dropped.Load()
+}
+
+// failureTracker 记录一个持续故障的开始时间，故障持续超过阈值时只报告一次
+type failureTracker struct {
+	since    time.Time
+	reported bool
+}
+
+// fail 记录一次失败，故障持续时间首次达到threshold时返回true；threshold为0表示从不报告
+func (t *failureTracker) fail(now time.Time, threshold time.Duration) bool {
+	if t.since.IsZero() {
+		t.since = now
+	}
+	if t.reported || threshold <= 0 || now.Sub(t.since) < threshold {
+		return false
+	}
+	t.reported = true
+	return true
+}
+
+// reset 故障恢复
+func (t *failureTracker) reset() {
+	*t = failureTracker{}
+}
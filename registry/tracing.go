@@ -0,0 +1,76 @@
+// registry/tracing.go
+package registry
+
+import "context"
+
+// Span名称
+const (
+	SpanRegister   = "registry.Register"
+	SpanUnregister = "registry.Unregister"
+	SpanDiscover   = "registry.Discover"
+	SpanUpdate     = "registry.UpdateServiceInfo"
+	// SpanRefresh 服务watch从etcd全量拉取实例，resolver和Watch的刷新都经过这里
+	SpanRefresh = "registry.Refresh"
+	// SpanLeaseLost 和SpanReRegister 为后台操作，没有调用方span，
+	// 以根span的形式创建并链接到注册时的span
+	SpanLeaseLost  = "registry.LeaseLost"
+	SpanReRegister = "registry.ReRegister"
+	// SpanWatchCallback 和SpanHook 一次Watch回调和钩子的执行，同样是根span
+	SpanWatchCallback = "registry.WatchCallback"
+	SpanHook          = "registry.Hook"
+)
+
+// Tracer 注册中心链路追踪接口，核心包不依赖任何具体的追踪系统，由调用方通过WithTracer接入
+type Tracer interface {
+	// Start 以ctx中的span为父span开始一个span，返回携带新span的ctx
+	// links为需要链接的其他span所在的ctx，用于没有父span的后台操作
+	Start(ctx context.Context, name string, links ...context.Context) (context.Context, Span)
+}
+
+// Span 一次被追踪的操作，keyvals为交替出现的键和值
+type Span interface {
+	SetAttributes(keyvals ...any)
+	AddEvent(name string, keyvals ...any)
+	// End 结束span，err不为nil时将span标记为错误
+	End(err error)
+}
+
+// noopTracer 默认的空追踪实现
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string, _ ...context.Context) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...any)    {}
+func (noopSpan) AddEvent(string, ...any) {}
+func (noopSpan) End(error)               {}
+
+// spanCtxKey context中保存当前Span的键，供retry等内部步骤记录事件
+type spanCtxKey struct{}
+
+// startSpan 开始span并把它保存到返回的ctx中
+func (r *EtcdRegistry) startSpan(ctx context.Context, name string, links ...context.Context) (context.Context, Span) {
+	ctx, span := r.opts.tracer.Start(ctx, name, links...)
+	return context.WithValue(ctx, spanCtxKey{}, span), span
+}
+
+// spanFromContext 返回ctx中由startSpan开始的span，没有时返回空实现
+func spanFromContext(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanCtxKey{}).(Span); ok {
+		return span
+	}
+	return noopSpan{}
+}
+
+// opContext 返回同时受调用方ctx和注册中心生命周期控制的ctx，任一结束时取消
+func (r *EtcdRegistry) opContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(r.ctx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
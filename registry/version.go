@@ -0,0 +1,57 @@
+// registry/version.go
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/coreos/go-semver/semver"
+)
+
+// ServerVersion 查询etcd集群的版本，依次尝试各个节点直到成功
+func (r *EtcdRegistry) ServerVersion(ctx context.Context) (string, error) {
+	var errs []error
+	for _, endpoint := range r.client.Endpoints() {
+		resp, err := r.client.Status(ctx, endpoint)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", endpoint, err))
+			continue
+		}
+		return resp.Version, nil
+	}
+	if len(errs) == 0 {
+		return "", errors.New("query etcd server version: no endpoints")
+	}
+	return "", fmt.Errorf("query etcd server version: %w", errors.Join(errs...))
+}
+
+// checkServerVersion 确认etcd集群版本不低于配置的最低版本
+// warnOnly时版本过低只记录日志；无法查询版本时同样按warnOnly处理
+func (r *EtcdRegistry) checkServerVersion() error {
+	minVersion := r.opts.minServerVersion
+	if minVersion == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(r.ctx, r.opts.requestTimeout)
+	defer cancel()
+
+	version, err := r.ServerVersion(ctx)
+	if err == nil {
+		var current *semver.Version
+		if current, err = semver.NewVersion(version); err != nil {
+			err = fmt.Errorf("parse etcd server version %q: %v", version, err)
+		} else if current.LessThan(*minVersion) {
+			err = fmt.Errorf("etcd server version %s is below the required minimum %s", version, minVersion)
+		}
+	}
+	if err == nil {
+		return nil
+	}
+	if r.opts.versionWarnOnly {
+		r.opts.logger.Warn("etcd server version check failed", "minVersion", minVersion.String(), "error", err)
+		return nil
+	}
+	return err
+}
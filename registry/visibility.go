@@ -0,0 +1,95 @@
+// registry/visibility.go
+package registry
+
+import (
+	"context"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// visibilityEvent 一次带写入时间的实例变化，推送给订阅者后按写入时间计算可见延迟
+type visibilityEvent struct {
+	// metric MetricRegistrationVisibility或MetricDeregistrationVisibility
+	metric    string
+	service   string
+	writtenAt time.Time
+}
+
+// encodeStamped 编码写入etcd的服务信息
+// 开启WithVisibilityTracking时写入非零的registeredAt和deregisteredAt，否则清除从etcd读回的旧时间戳，
+// 避免更新状态时带上旧的注册时间被读取方误算为注册延迟；开启WithRegisteredBy时还在元数据中写入注册中心标识
+func (r *EtcdRegistry) encodeStamped(info *ServiceInfo, registeredAt, deregisteredAt time.Time) (string, error) {
+	if r.opts.stampRegisteredBy {
+		info = r.stampRegisteredBy(info)
+	}
+	stamped := *info
+	stamped.RegisteredAt, stamped.DeregisteredAt = 0, 0
+	if r.opts.visibilityTracking {
+		stamped.RegisteredAt = unixMilli(registeredAt)
+		stamped.DeregisteredAt = unixMilli(deregisteredAt)
+	}
+	return r.codec.encode(&stamped)
+}
+
+// unixMilli 零值时间返回0
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+// markDeregistering 删除实例前写入带注销时间的down状态，读取方据此统计注销到客户端移除实例的延迟
+// 只在开启WithVisibilityTracking时写入，失败不影响随后的删除
+func (r *EtcdRegistry) markDeregistering(ctx context.Context, info *ServiceInfo) {
+	if !r.opts.visibilityTracking {
+		return
+	}
+	down := *info
+	down.Status = StatusDown
+	value, err := r.encodeStamped(&down, time.Time{}, time.Now())
+	if err == nil {
+		key := serviceKey(info.Name, info.Address)
+		ctx, cancel := context.WithTimeout(ctx, r.opts.requestTimeout)
+		defer cancel()
+		_, err = r.kv.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision(key), ">", 0)).
+			Then(clientv3.OpPut(key, value, clientv3.WithIgnoreLease())).
+			Commit()
+	}
+	if err != nil {
+		r.opts.logger.Debug("mark deregistering failed", "service", info.Name, "address", info.Address, "error", err)
+	}
+}
+
+// visibilityEventOf 返回watch事件对应的可见延迟事件
+// 只统计新建key时的注册时间，更新和续租不算作注册；删除事件不带写入时间，注销时间来自markDeregistering写入的down状态
+func visibilityEventOf(event *clientv3.Event, service *ServiceInfo) (visibilityEvent, bool) {
+	switch {
+	case service.DeregisteredAt > 0:
+		return visibilityEvent{metric: MetricDeregistrationVisibility, service: service.Name,
+			writtenAt: time.UnixMilli(service.DeregisteredAt)}, true
+	case service.RegisteredAt > 0 && event.IsCreate():
+		return visibilityEvent{metric: MetricRegistrationVisibility, service: service.Name,
+			writtenAt: time.UnixMilli(service.RegisteredAt)}, true
+	}
+	return visibilityEvent{}, false
+}
+
+// observeVisibility 记录一次推送送达的变更的可见延迟，写入方与读取方的时钟偏差会直接计入延迟，负值按0记录
+func (r *EtcdRegistry) observeVisibility(events []visibilityEvent) {
+	for _, event := range events {
+		delay := max(time.Since(event.writtenAt), 0)
+		r.opts.metrics.ObserveHistogram(event.metric, serviceLabels(event.service), delay.Seconds())
+	}
+}
+
+// mergeWatchUpdates 订阅者尚未处理上一次推送时合并两次推送，保留新快照，累积可见延迟事件并合并推送来源
+func mergeWatchUpdates(older, newer watchUpdate) watchUpdate {
+	if len(older.events) > 0 {
+		newer.events = append(older.events[:len(older.events):len(older.events)], newer.events...)
+	}
+	newer.eventType = mergeEventType(older.eventType, newer.eventType)
+	return newer
+}
@@ -0,0 +1,214 @@
+// registrytest/conformance.go
+package registrytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+
+	"github.com/YuanJey/grpc-etcd/registry"
+	"github.com/YuanJey/grpc-etcd/resolvertest"
+)
+
+// conformanceTimeout 等待异步实现（例如EtcdRegistry）的Discover、Watch和resolver结果收敛的最长时间
+const conformanceTimeout = 10 * time.Second
+
+// conformanceSeq 为每个子测试生成不同的服务名，共享同一个etcd的实现之间互不干扰
+var conformanceSeq atomic.Int64
+
+// TestRegistry 对Registry实现运行一致性测试，EtcdRegistry和InMemory的行为通过同一套用例约束，避免两者逐渐不一致
+// newRegistry 为每个子测试创建一个新的注册中心，由TestRegistry负责关闭；
+// 实现了resolver.Builder时额外校验resolver的过滤和状态过滤规则
+//
+//	func TestInMemoryConformance(t *testing.T) {
+//		registrytest.TestRegistry(t, func(t *testing.T) registry.Registry { return registrytest.NewInMemory() })
+//	}
+func TestRegistry(t *testing.T, newRegistry func(t *testing.T) registry.Registry) {
+	run := func(name string, fn func(t *testing.T, reg registry.Registry, service string)) {
+		t.Run(name, func(t *testing.T) {
+			reg := newRegistry(t)
+			defer reg.Close()
+			fn(t, reg, fmt.Sprintf("conformance-%d-%d", time.Now().UnixNano(), conformanceSeq.Add(1)))
+		})
+	}
+
+	run("RegisterDiscover", func(t *testing.T, reg registry.Registry, service string) {
+		mustRegister(t, reg, &registry.ServiceInfo{Name: service, Address: "10.0.0.2:80", Version: "v1"})
+		mustRegister(t, reg, &registry.ServiceInfo{Name: service, Address: "10.0.0.1:80", Version: "v2", Tags: []string{"canary"}})
+		eventually(t, "discover both instances", func() error {
+			services, err := reg.Discover(service)
+			if err != nil {
+				return err
+			}
+			return expectAddrs(services, "10.0.0.1:80", "10.0.0.2:80")
+		})
+	})
+
+	run("RegisterDuplicate", func(t *testing.T, reg registry.Registry, service string) {
+		mustRegister(t, reg, &registry.ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+		err := reg.Register(service, "10.0.0.1:80", "")
+		if !errors.Is(err, registry.ErrAlreadyRegistered) {
+			t.Fatalf("duplicate register: got %v, want ErrAlreadyRegistered", err)
+		}
+	})
+
+	run("RegisterInvalid", func(t *testing.T, reg registry.Registry, service string) {
+		if err := reg.Register("", "10.0.0.1:80", ""); !errors.Is(err, registry.ErrInvalidService) {
+			t.Errorf("empty name: got %v, want ErrInvalidService", err)
+		}
+		if err := reg.Register(service, "10.0.0.1", ""); !errors.Is(err, registry.ErrInvalidAddress) {
+			t.Errorf("address without port: got %v, want ErrInvalidAddress", err)
+		}
+		err := reg.RegisterService(&registry.ServiceInfo{Name: service, Address: "10.0.0.1:80", Status: "unknown"})
+		if !errors.Is(err, registry.ErrInvalidService) {
+			t.Errorf("unknown status: got %v, want ErrInvalidService", err)
+		}
+	})
+
+	run("Unregister", func(t *testing.T, reg registry.Registry, service string) {
+		mustRegister(t, reg, &registry.ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+		if err := reg.Unregister(service, "10.0.0.1:80"); err != nil {
+			t.Fatalf("unregister: %v", err)
+		}
+		eventually(t, "discover no instances", func() error {
+			services, err := reg.Discover(service)
+			if errors.Is(err, registry.ErrNoInstances) {
+				return nil
+			}
+			return fmt.Errorf("got %d instances, err %v, want ErrNoInstances", len(services), err)
+		})
+		if err := reg.Unregister(service, "10.0.0.1:80"); !errors.Is(err, registry.ErrNotRegistered) {
+			t.Errorf("unregister twice: got %v, want ErrNotRegistered", err)
+		}
+		// 注销后可以再次注册
+		mustRegister(t, reg, &registry.ServiceInfo{Name: service, Address: "10.0.0.1:80"})
+	})
+
+	run("DiscoverUnknown", func(t *testing.T, reg registry.Registry, service string) {
+		if _, err := reg.Discover(service); !errors.Is(err, registry.ErrNoInstances) {
+			t.Errorf("discover unknown service: got %v, want ErrNoInstances", err)
+		}
+	})
+
+	run("Watch", func(t *testing.T, reg registry.Registry, service string) {
+		var mu sync.Mutex
+		var last []*registry.ServiceInfo
+		err := reg.Watch(service, func(services []*registry.ServiceInfo) {
+			mu.Lock()
+			last = services
+			mu.Unlock()
+		})
+		if err != nil {
+			t.Fatalf("watch: %v", err)
+		}
+		latest := func() []*registry.ServiceInfo {
+			mu.Lock()
+			defer mu.Unlock()
+			return last
+		}
+
+		mustRegister(t, reg, &registry.ServiceInfo{Name: service, Address: "10.0.0.1:80", Version: "v1"})
+		mustRegister(t, reg, &registry.ServiceInfo{Name: service, Address: "10.0.0.2:80", Version: "v1"})
+		eventually(t, "watch both instances", func() error { return expectAddrs(latest(), "10.0.0.1:80", "10.0.0.2:80") })
+		if err := reg.Unregister(service, "10.0.0.1:80"); err != nil {
+			t.Fatalf("unregister: %v", err)
+		}
+		eventually(t, "watch remaining instance", func() error { return expectAddrs(latest(), "10.0.0.2:80") })
+	})
+
+	run("WatchAfterClose", func(t *testing.T, reg registry.Registry, service string) {
+		if err := reg.Close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		if err := reg.Close(); err != nil {
+			t.Errorf("close twice: %v", err)
+		}
+		err := reg.Watch(service, func([]*registry.ServiceInfo) {})
+		if !errors.Is(err, registry.ErrRegistryClosed) {
+			t.Errorf("watch after close: got %v, want ErrRegistryClosed", err)
+		}
+	})
+
+	run("ResolverFilter", func(t *testing.T, reg registry.Registry, service string) {
+		builder, ok := reg.(resolver.Builder)
+		if !ok {
+			t.Skip("registry does not implement resolver.Builder")
+		}
+		mustRegister(t, reg, &registry.ServiceInfo{Name: service, Address: "10.0.0.1:80", Version: "v1"})
+		mustRegister(t, reg, &registry.ServiceInfo{Name: service, Address: "10.0.0.2:80", Version: "v2", Env: "prod",
+			Tags: []string{"canary"}, Metadata: map[string]string{"shard": "a"}})
+		mustRegister(t, reg, &registry.ServiceInfo{Name: service, Address: "10.0.0.3:80", Version: "v2", Status: registry.StatusDown})
+
+		ctx, cancel := context.WithTimeout(context.Background(), conformanceTimeout)
+		defer cancel()
+		for query, want := range map[string][]string{
+			"":                             {"10.0.0.1:80", "10.0.0.2:80"},
+			"?version=v2":                  {"10.0.0.2:80"},
+			"?env=prod":                    {"10.0.0.2:80"},
+			"?tag=canary":                  {"10.0.0.2:80"},
+			"?metadata=shard:a":            {"10.0.0.2:80"},
+			"?version=v1&tag=canary":       {},
+			"?version=v2&metadata=shard:a": {"10.0.0.2:80"},
+		} {
+			cc, rsv, err := resolvertest.Build(builder, builder.Scheme()+":///"+service+query)
+			if err != nil {
+				t.Fatalf("build %q: %v", query, err)
+			}
+			if _, err := cc.WaitForState(ctx, resolvertest.HasAddrs(want...)); err != nil {
+				state, _ := cc.LastState()
+				t.Errorf("target query %q: got %v, want %v: %v", query, resolvertest.Addrs(state), want, err)
+			}
+			rsv.Close()
+		}
+
+		if _, _, err := resolvertest.Build(builder, builder.Scheme()+":///"+service+"?verison=v2"); err == nil {
+			t.Errorf("unknown target query parameter: got nil error")
+		}
+	})
+}
+
+// mustRegister 注册实例，失败时终止子测试
+func mustRegister(t *testing.T, reg registry.Registry, info *registry.ServiceInfo) {
+	t.Helper()
+	if err := reg.RegisterService(info); err != nil {
+		t.Fatalf("register %s at %s: %v", info.Name, info.Address, err)
+	}
+}
+
+// eventually 在conformanceTimeout内反复检查check，始终失败时终止子测试
+func eventually(t *testing.T, what string, check func() error) {
+	t.Helper()
+	deadline := time.Now().Add(conformanceTimeout)
+	for {
+		err := check()
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: %v", what, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// expectAddrs 检查实例地址与want相同，不关心顺序
+func expectAddrs(services []*registry.ServiceInfo, want ...string) error {
+	got := make([]string, 0, len(services))
+	for _, service := range services {
+		got = append(got, service.Address)
+	}
+	slices.Sort(got)
+	want = slices.Clone(want)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		return fmt.Errorf("got instances %v, want %v", got, want)
+	}
+	return nil
+}
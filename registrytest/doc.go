@@ -0,0 +1,14 @@
+// Package registrytest 提供不依赖etcd的内存注册中心和Registry实现的一致性测试，
+// 供依赖服务发现的代码编写单元测试
+//
+// 典型用法：
+//
+//	reg := registrytest.NewInMemory()
+//	defer reg.Close()
+//	reg.SetInstances("svc", []*registry.ServiceInfo{{Address: "10.0.0.1:80", Version: "v2"}})
+//	conn, err := reg.Dial(ctx, "svc", registry.DialVersion("v2"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+//	reg.ExpireLease("svc", "10.0.0.1:80")
+//
+// Watch回调和resolver推送在修改注册中心的调用返回前同步完成，断言无需等待；
+// 自定义的Registry实现可以通过TestRegistry运行与EtcdRegistry相同的一致性测试
+package registrytest
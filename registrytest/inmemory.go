@@ -0,0 +1,376 @@
+// registrytest/inmemory.go
+package registrytest
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/resolver"
+
+	"github.com/YuanJey/grpc-etcd/registry"
+)
+
+// Scheme InMemory作为resolver.Builder使用的scheme
+const Scheme = "inmemory"
+
+var (
+	_ registry.Registry = (*InMemory)(nil)
+	_ resolver.Builder  = (*InMemory)(nil)
+)
+
+// InMemory 不依赖etcd的内存注册中心，实现registry.Registry和resolver.Builder，用于单元测试依赖服务发现的代码
+//
+// 与EtcdRegistry的区别：
+//   - 注册、注销和注入实例后，Watch回调和resolver推送在调用返回前同步完成；
+//     回调中再次修改注册中心时，新的推送在当前回调返回后按顺序进行
+//   - 多个goroutine并发修改时推送可能由其他goroutine完成，需要等待时调用Flush
+//   - 没有租约和心跳，通过ExpireLease模拟租约过期，过期的实例不会自动重新注册
+type InMemory struct {
+	mu sync.Mutex
+	// instances 按服务名和地址保存的实例
+	instances map[string]map[string]*instance
+	watches   map[*watch]struct{}
+	closed    bool
+
+	// pending 待推送的通知，delivering为true时由正在推送的goroutine依次执行
+	pending    []notification
+	delivering bool
+	// delivered 推送队列清空时广播，供Flush等待
+	delivered *sync.Cond
+}
+
+// instance 内存中的一个实例
+type instance struct {
+	info *registry.ServiceInfo
+	// registered 是否通过Register注册，SetInstances注入的实例为false
+	registered bool
+}
+
+// watch 一个Watch回调或resolver的订阅
+type watch struct {
+	serviceName string
+	callback    func([]*registry.ServiceInfo)
+	// stopped 订阅取消后不再推送，由InMemory.mu保护
+	stopped bool
+}
+
+// notification 一次待推送的实例快照
+type notification struct {
+	watch    *watch
+	services []*registry.ServiceInfo
+}
+
+// NewInMemory 创建内存注册中心
+func NewInMemory() *InMemory {
+	m := &InMemory{
+		instances: make(map[string]map[string]*instance),
+		watches:   make(map[*watch]struct{}),
+	}
+	m.delivered = sync.NewCond(&m.mu)
+	return m
+}
+
+// Register 注册服务
+func (m *InMemory) Register(serviceName, address, version string) error {
+	return m.RegisterService(&registry.ServiceInfo{
+		Name:    serviceName,
+		Address: address,
+		Version: version,
+	})
+}
+
+// RegisterService 使用完整的服务信息注册服务，错误与EtcdRegistry.RegisterService一致：
+// 同一实例重复注册返回ErrAlreadyRegistered，服务信息不合法时返回ErrInvalidAddress或ErrInvalidService
+func (m *InMemory) RegisterService(serviceInfo *registry.ServiceInfo) error {
+	if err := serviceInfo.Validate(); err != nil {
+		// 与EtcdRegistry一样保留Validate返回的错误，errors.Is可以匹配其中的错误类型
+		return &registry.Error{Op: "register", Service: serviceInfo.Name, Address: serviceInfo.Address, Err: err}
+	}
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return newError("register", serviceInfo.Name, serviceInfo.Address, registry.ErrRegistryClosed)
+	}
+	if existing, ok := m.instances[serviceInfo.Name][serviceInfo.Address]; ok && existing.registered {
+		m.mu.Unlock()
+		return newError("register", serviceInfo.Name, serviceInfo.Address, registry.ErrAlreadyRegistered)
+	}
+	m.putLocked(&instance{info: copyService(serviceInfo), registered: true})
+	m.notifyLocked(serviceInfo.Name)
+	m.mu.Unlock()
+	m.deliver()
+	return nil
+}
+
+// Unregister 注销服务，实例不存在时返回ErrNotRegistered
+// 与etcd一样，SetInstances注入的实例同样可以被注销
+func (m *InMemory) Unregister(serviceName, address string) error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return newError("unregister", serviceName, address, registry.ErrRegistryClosed)
+	}
+	if !m.removeLocked(serviceName, address) {
+		m.mu.Unlock()
+		return newError("unregister", serviceName, address, registry.ErrNotRegistered)
+	}
+	m.notifyLocked(serviceName)
+	m.mu.Unlock()
+	m.deliver()
+	return nil
+}
+
+// Discover 发现服务，返回按地址排序的实例副本，服务没有任何实例时返回ErrNoInstances
+func (m *InMemory) Discover(serviceName string) ([]*registry.ServiceInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, newError("discover", serviceName, "", registry.ErrRegistryClosed)
+	}
+	services := m.snapshotLocked(serviceName)
+	if len(services) == 0 {
+		return nil, newError("discover", serviceName, "", registry.ErrNoInstances)
+	}
+	return services, nil
+}
+
+// Watch 监听服务变化，返回前同步回调一次当前的实例列表（可能为空），之后每次变化回调完整的实例列表
+// 注册中心关闭后不再回调
+func (m *InMemory) Watch(serviceName string, callback func([]*registry.ServiceInfo)) error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return newError("watch", serviceName, "", registry.ErrRegistryClosed)
+	}
+	w := &watch{serviceName: serviceName, callback: callback}
+	m.watches[w] = struct{}{}
+	m.pending = append(m.pending, notification{watch: w, services: m.snapshotLocked(serviceName)})
+	m.mu.Unlock()
+	m.deliver()
+	return nil
+}
+
+// Flush 等待所有已发生变化的Watch回调和resolver推送完成
+// 不能在Watch回调或resolver.ClientConn中调用，否则会一直等待
+func (m *InMemory) Flush() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for m.delivering || len(m.pending) > 0 {
+		m.delivered.Wait()
+	}
+}
+
+// Close 关闭注册中心，注销通过Register注册的实例并停止所有Watch和resolver，重复调用是安全的
+func (m *InMemory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	for w := range m.watches {
+		w.stopped = true
+	}
+	clear(m.watches)
+	for serviceName, byAddr := range m.instances {
+		for address, inst := range byAddr {
+			if inst.registered {
+				m.removeLocked(serviceName, address)
+			}
+		}
+	}
+	return nil
+}
+
+// SetInstances 将服务中未通过Register注册的实例替换为services，模拟其他进程注册的实例，
+// services为空时清空这些实例；通过Register注册的同地址实例会被覆盖并视为注入的实例
+func (m *InMemory) SetInstances(serviceName string, services []*registry.ServiceInfo) {
+	m.mu.Lock()
+	for address, inst := range m.instances[serviceName] {
+		if !inst.registered {
+			m.removeLocked(serviceName, address)
+		}
+	}
+	for _, service := range services {
+		service = copyService(service)
+		service.Name = serviceName
+		m.putLocked(&instance{info: service})
+	}
+	m.notifyLocked(serviceName)
+	m.mu.Unlock()
+	m.deliver()
+}
+
+// ExpireLease 模拟实例的租约过期：实例从注册中心消失并通知Watch和resolver，实例不存在时返回false
+// 与EtcdRegistry自动重新注册不同，需要恢复时由测试再次调用Register
+func (m *InMemory) ExpireLease(serviceName, address string) bool {
+	m.mu.Lock()
+	if !m.removeLocked(serviceName, address) {
+		m.mu.Unlock()
+		return false
+	}
+	m.notifyLocked(serviceName)
+	m.mu.Unlock()
+	m.deliver()
+	return true
+}
+
+// ExpireAll 模拟通过Register注册的所有实例的租约同时过期，例如进程与etcd断开超过TTL，返回过期的实例数
+func (m *InMemory) ExpireAll() int {
+	m.mu.Lock()
+	expired := 0
+	for serviceName, byAddr := range m.instances {
+		removed := false
+		for address, inst := range byAddr {
+			if inst.registered {
+				removed = m.removeLocked(serviceName, address) || removed
+				expired++
+			}
+		}
+		if removed {
+			m.notifyLocked(serviceName)
+		}
+	}
+	m.mu.Unlock()
+	m.deliver()
+	return expired
+}
+
+// Target 返回用于拨号的服务target，例如 inmemory:///svc
+func (m *InMemory) Target(serviceName string) string {
+	return Scheme + ":///" + serviceName
+}
+
+// Dial 通过内存注册中心连接服务，拨号默认值及DialVersion、DialTag等过滤选项与EtcdRegistry.Dial一致
+func (m *InMemory) Dial(ctx context.Context, serviceName string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	return registry.DialBuilder(ctx, m, serviceName, opts...)
+}
+
+// Build 实现resolver.Builder接口，target查询参数的过滤规则与etcd resolver一致，
+// 例如 inmemory:///svc?version=v2&tag=canary；非up状态的实例不会被推送
+func (m *InMemory) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	filter, err := registry.ParseTargetFilter(target)
+	if err != nil {
+		return nil, err
+	}
+	serviceName := target.Endpoint()
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, registry.ErrRegistryClosed
+	}
+	rsv := &inMemoryResolver{registry: m}
+	rsv.watch = &watch{serviceName: serviceName, callback: func(services []*registry.ServiceInfo) {
+		cc.UpdateState(registry.ResolverState(filter.Apply(services)))
+	}}
+	m.watches[rsv.watch] = struct{}{}
+	m.pending = append(m.pending, notification{watch: rsv.watch, services: m.snapshotLocked(serviceName)})
+	m.mu.Unlock()
+	m.deliver()
+	return rsv, nil
+}
+
+// Scheme 实现resolver.Builder接口
+func (m *InMemory) Scheme() string {
+	return Scheme
+}
+
+// inMemoryResolver 实现resolver.Resolver接口
+type inMemoryResolver struct {
+	registry *InMemory
+	watch    *watch
+}
+
+// ResolveNow 实现resolver.Resolver接口，变化总是立即推送，无需重新解析
+func (r *inMemoryResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+// Close 实现resolver.Resolver接口
+func (r *inMemoryResolver) Close() {
+	r.registry.mu.Lock()
+	r.watch.stopped = true
+	delete(r.registry.watches, r.watch)
+	r.registry.mu.Unlock()
+}
+
+// putLocked 保存实例，调用方需持有m.mu
+func (m *InMemory) putLocked(inst *instance) {
+	byAddr, ok := m.instances[inst.info.Name]
+	if !ok {
+		byAddr = make(map[string]*instance)
+		m.instances[inst.info.Name] = byAddr
+	}
+	byAddr[inst.info.Address] = inst
+}
+
+// removeLocked 删除实例，实例不存在时返回false，调用方需持有m.mu
+func (m *InMemory) removeLocked(serviceName, address string) bool {
+	byAddr := m.instances[serviceName]
+	if _, ok := byAddr[address]; !ok {
+		return false
+	}
+	delete(byAddr, address)
+	if len(byAddr) == 0 {
+		delete(m.instances, serviceName)
+	}
+	return true
+}
+
+// snapshotLocked 返回服务按地址排序的实例副本，调用方需持有m.mu
+func (m *InMemory) snapshotLocked(serviceName string) []*registry.ServiceInfo {
+	services := make([]*registry.ServiceInfo, 0, len(m.instances[serviceName]))
+	for _, inst := range m.instances[serviceName] {
+		services = append(services, copyService(inst.info))
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Address < services[j].Address })
+	return services
+}
+
+// notifyLocked 为服务的每个订阅排队一次当前快照，调用方需持有m.mu，释放锁后调用deliver
+func (m *InMemory) notifyLocked(serviceName string) {
+	for w := range m.watches {
+		if w.serviceName == serviceName {
+			m.pending = append(m.pending, notification{watch: w, services: m.snapshotLocked(serviceName)})
+		}
+	}
+}
+
+// deliver 依次执行待推送的通知，已有goroutine在推送时直接返回，由它继续推送新排队的通知
+// 回调在不持有锁的情况下执行，回调中可以再次调用注册中心
+func (m *InMemory) deliver() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.delivering {
+		return
+	}
+	m.delivering = true
+	for len(m.pending) > 0 {
+		n := m.pending[0]
+		m.pending = m.pending[1:]
+		if n.watch.stopped {
+			continue
+		}
+		m.mu.Unlock()
+		n.watch.callback(n.services)
+		m.mu.Lock()
+	}
+	m.delivering = false
+	m.delivered.Broadcast()
+}
+
+// copyService 复制服务信息，调用方修改返回值不会影响注册中心中保存的实例
+func copyService(service *registry.ServiceInfo) *registry.ServiceInfo {
+	copied := *service
+	copied.Addresses = slices.Clone(service.Addresses)
+	copied.Tags = slices.Clone(service.Tags)
+	copied.Metadata = maps.Clone(service.Metadata)
+	return &copied
+}
+
+// newError 构造不带底层错误的注册中心错误
+func newError(op, service, address string, kind error) error {
+	return &registry.Error{Op: op, Service: service, Address: address, Kind: kind}
+}
@@ -0,0 +1,13 @@
+// registrytest/inmemory_test.go
+package registrytest_test
+
+import (
+	"testing"
+
+	"github.com/YuanJey/grpc-etcd/registry"
+	"github.com/YuanJey/grpc-etcd/registrytest"
+)
+
+func TestInMemoryConformance(t *testing.T) {
+	registrytest.TestRegistry(t, func(t *testing.T) registry.Registry { return registrytest.NewInMemory() })
+}
@@ -0,0 +1,189 @@
+// resolvertest/clientconn.go
+package resolvertest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// ClientConn 记录resolver推送内容的resolver.ClientConn实现，用于测试resolver和balancer
+type ClientConn struct {
+	// 嵌入接口以便gRPC新增方法时仍能编译，未实现的方法调用会panic
+	resolver.ClientConn
+
+	mu     sync.Mutex
+	states []resolver.State
+	errs   []error
+	notify chan struct{}
+}
+
+// NewClientConn 创建ClientConn
+func NewClientConn() *ClientConn {
+	return &ClientConn{notify: make(chan struct{})}
+}
+
+// UpdateState 实现resolver.ClientConn接口
+func (c *ClientConn) UpdateState(state resolver.State) error {
+	c.mu.Lock()
+	c.states = append(c.states, state)
+	c.wakeLocked()
+	c.mu.Unlock()
+	return nil
+}
+
+// ReportError 实现resolver.ClientConn接口
+func (c *ClientConn) ReportError(err error) {
+	c.mu.Lock()
+	c.errs = append(c.errs, err)
+	c.wakeLocked()
+	c.mu.Unlock()
+}
+
+// NewAddress 实现resolver.ClientConn接口
+func (c *ClientConn) NewAddress(addrs []resolver.Address) {
+	c.UpdateState(resolver.State{Addresses: addrs})
+}
+
+// Config ParseServiceConfig返回的服务配置，保存原始JSON
+type Config struct {
+	serviceconfig.Config
+	JSON string
+}
+
+// ParseServiceConfig 实现resolver.ClientConn接口，只校验JSON语法
+func (c *ClientConn) ParseServiceConfig(serviceConfigJSON string) *serviceconfig.ParseResult {
+	if !json.Valid([]byte(serviceConfigJSON)) {
+		return &serviceconfig.ParseResult{Err: fmt.Errorf("invalid service config JSON: %q", serviceConfigJSON)}
+	}
+	return &serviceconfig.ParseResult{Config: &Config{JSON: serviceConfigJSON}}
+}
+
+func (c *ClientConn) wakeLocked() {
+	close(c.notify)
+	c.notify = make(chan struct{})
+}
+
+// States 返回按顺序记录的全部UpdateState
+func (c *ClientConn) States() []resolver.State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]resolver.State(nil), c.states...)
+}
+
+// Errors 返回按顺序记录的全部ReportError
+func (c *ClientConn) Errors() []error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]error(nil), c.errs...)
+}
+
+// LastState 返回最近一次UpdateState
+func (c *ClientConn) LastState() (resolver.State, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.states) == 0 {
+		return resolver.State{}, false
+	}
+	return c.states[len(c.states)-1], true
+}
+
+// WaitForState 等待最近一次UpdateState满足match，ctx结束时返回错误
+func (c *ClientConn) WaitForState(ctx context.Context, match func(resolver.State) bool) (resolver.State, error) {
+	for {
+		c.mu.Lock()
+		notify := c.notify
+		if n := len(c.states); n > 0 && match(c.states[n-1]) {
+			state := c.states[n-1]
+			c.mu.Unlock()
+			return state, nil
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return resolver.State{}, fmt.Errorf("waiting for resolver state: %w", ctx.Err())
+		case <-notify:
+		}
+	}
+}
+
+// WaitForError 等待出现满足match的ReportError，ctx结束时返回错误
+func (c *ClientConn) WaitForError(ctx context.Context, match func(error) bool) (error, error) {
+	seen := 0
+	for {
+		c.mu.Lock()
+		notify := c.notify
+		errs := c.errs[seen:]
+		seen = len(c.errs)
+		c.mu.Unlock()
+
+		for _, err := range errs {
+			if match(err) {
+				return err, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for resolver error: %w", ctx.Err())
+		case <-notify:
+		}
+	}
+}
+
+// Do 执行action（例如注册或注销实例）并等待其引起的推送满足match，
+// 用于同步驱动注册中心的watch并断言resolver的结果
+func (c *ClientConn) Do(ctx context.Context, action func() error, match func(resolver.State) bool) (resolver.State, error) {
+	if err := action(); err != nil {
+		return resolver.State{}, err
+	}
+	return c.WaitForState(ctx, match)
+}
+
+// Build 解析target并使用builder创建resolver，返回记录推送的ClientConn
+func Build(builder resolver.Builder, target string) (*ClientConn, resolver.Resolver, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.Scheme != builder.Scheme() {
+		return nil, nil, fmt.Errorf("resolvertest: target scheme %q does not match builder scheme %q", u.Scheme, builder.Scheme())
+	}
+	cc := NewClientConn()
+	r, err := builder.Build(resolver.Target{URL: *u}, cc, resolver.BuildOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	return cc, r, nil
+}
+
+// Addrs 返回状态中的地址字符串，便于断言
+func Addrs(state resolver.State) []string {
+	addrs := make([]string, 0, len(state.Addresses))
+	for _, addr := range state.Addresses {
+		addrs = append(addrs, addr.Addr)
+	}
+	return addrs
+}
+
+// HasAddrs 返回判断状态地址恰好为addrs（顺序一致）的匹配函数，配合WaitForState使用
+func HasAddrs(addrs ...string) func(resolver.State) bool {
+	return func(state resolver.State) bool {
+		got := Addrs(state)
+		if len(got) != len(addrs) {
+			return false
+		}
+		for i := range got {
+			if got[i] != addrs[i] {
+				return false
+			}
+		}
+		return true
+	}
+}
@@ -0,0 +1,9 @@
+// Package resolvertest 提供测试etcd resolver及基于其地址属性的balancer所需的工具
+//
+// 典型用法：
+//
+//	cc, r, err := resolvertest.Build(reg, "etcd:///svc?version=v2")
+//	defer r.Close()
+//	reg.RegisterService(&registry.ServiceInfo{Name: "svc", Address: "10.0.0.1:80", Version: "v2"})
+//	state, err := cc.WaitForState(ctx, resolvertest.HasAddrs("10.0.0.1:80"))
+package resolvertest